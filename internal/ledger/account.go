@@ -0,0 +1,45 @@
+package ledger
+
+import (
+	"fmt"
+
+	"go-wallet-service/internal/money"
+)
+
+// Account is a ledger account. Every wallet has its own account; money entering
+// or leaving the service is booked against the system accounts.
+type Account struct {
+	ID       int    `db:"id"`
+	Code     string `db:"code"`
+	WalletId *int   `db:"wallet_id"`
+}
+
+var (
+	// CashIn is debited by every deposit: it holds the negative of all money
+	// that has ever been paid into the service.
+	CashIn = Account{Code: "cash-in"}
+	// CashOut is credited by every withdrawal.
+	CashOut = Account{Code: "cash-out"}
+	// OpeningBalance balances the entries that seed wallets created before the
+	// ledger existed.
+	OpeningBalance = Account{Code: "opening-balance"}
+	// Adjustments balances the manual credits and debits staff make to
+	// wallets.
+	Adjustments = Account{Code: "adjustments"}
+)
+
+// FXAccount returns the exchange account of a currency. A cross-currency
+// transfer credits the exchange account of the source currency and debits the
+// one of the destination currency, so each currency still balances on its own.
+func FXAccount(currency money.Currency) Account {
+	return Account{Code: fmt.Sprintf("fx:%s", currency)}
+}
+
+// WalletAccount returns the account backing the given wallet.
+func WalletAccount(walletId int) Account {
+	return Account{Code: fmt.Sprintf("wallet:%d", walletId), WalletId: &walletId}
+}
+
+func (a Account) IsWallet() bool {
+	return a.WalletId != nil
+}
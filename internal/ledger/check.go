@@ -0,0 +1,65 @@
+package ledger
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/money"
+)
+
+type CurrencyTotal struct {
+	Currency money.Currency `db:"currency"`
+	Total    int64          `db:"total"`
+}
+
+type WalletMismatch struct {
+	WalletId      int   `db:"wallet_id"`
+	Balance       int64 `db:"balance"`
+	LedgerBalance int64 `db:"ledger_balance"`
+}
+
+// Report is the outcome of Check. The ledger is consistent when every currency
+// totals zero, every posting balances and every cached wallet balance matches
+// the entries of its account.
+type Report struct {
+	Totals             []CurrencyTotal
+	UnbalancedPostings []int
+	WalletMismatches   []WalletMismatch
+}
+
+func (r Report) OK() bool {
+	for _, total := range r.Totals {
+		if total.Total != 0 {
+			return false
+		}
+	}
+	return len(r.UnbalancedPostings) == 0 && len(r.WalletMismatches) == 0
+}
+
+// Check verifies the ledger invariants against the database.
+func Check(db *sqlx.DB) (Report, error) {
+	var report Report
+
+	err := db.Select(&report.Totals, "SELECT currency, SUM(amount) AS total FROM ledger_entries GROUP BY currency ORDER BY currency")
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = db.Select(&report.UnbalancedPostings, "SELECT DISTINCT posting_id FROM ledger_entries GROUP BY posting_id, currency HAVING SUM(amount) <> 0 ORDER BY posting_id")
+	if err != nil {
+		return Report{}, err
+	}
+
+	err = db.Select(&report.WalletMismatches, `
+		SELECT w.id AS wallet_id, w.balance, COALESCE(SUM(e.amount), 0) AS ledger_balance
+		FROM wallets w
+		LEFT JOIN ledger_accounts a ON a.wallet_id = w.id
+		LEFT JOIN ledger_entries e ON e.account_id = a.id
+		GROUP BY w.id, w.balance
+		HAVING w.balance <> COALESCE(SUM(e.amount), 0)
+		ORDER BY w.id`)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,68 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Post writes a posting with its entries and applies every wallet entry to the
+// cached wallets.balance column. It must run in the same transaction as the
+// money movement it records, after the affected wallets have been locked.
+func Post(tx *sqlx.Tx, posting Posting) (int, error) {
+	if err := posting.Validate(); err != nil {
+		return 0, err
+	}
+
+	var postingId int
+	err := tx.Get(&postingId, "INSERT INTO ledger_postings (transaction_id, type) VALUES ($1, $2) RETURNING id", posting.TransactionId, posting.Type)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range posting.Entries {
+		accountId, err := accountId(tx, entry.Account)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec("INSERT INTO ledger_entries (posting_id, account_id, amount, currency) VALUES ($1, $2, $3, $4)", postingId, accountId, entry.Amount, entry.Amount.Currency)
+		if err != nil {
+			return 0, err
+		}
+
+		if !entry.Account.IsWallet() {
+			continue
+		}
+		result, err := tx.Exec("UPDATE wallets SET balance = balance + $1, update_date = CURRENT_TIMESTAMP WHERE id = $2", entry.Amount, *entry.Account.WalletId)
+		if err != nil {
+			return 0, err
+		}
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			return 0, fmt.Errorf("wallet [%d] does not exist", *entry.Account.WalletId)
+		}
+	}
+	return postingId, nil
+}
+
+// accountId resolves an account to its row, creating it on first use. System
+// accounts are only ever read here, never locked, so they do not serialize
+// unrelated postings.
+func accountId(tx *sqlx.Tx, account Account) (int, error) {
+	var id int
+	err := tx.Get(&id, "SELECT id FROM ledger_accounts WHERE code = $1", account.Code)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	err = tx.Get(&id, "INSERT INTO ledger_accounts (code, wallet_id) VALUES ($1, $2) ON CONFLICT (code) DO NOTHING RETURNING id", account.Code, account.WalletId)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.Get(&id, "SELECT id FROM ledger_accounts WHERE code = $1", account.Code)
+	}
+	return id, err
+}
@@ -0,0 +1,169 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+
+	"go-wallet-service/internal/money"
+)
+
+var ErrUnbalancedPosting = errors.New("unbalanced posting")
+
+const (
+	PostingTypeDeposit        = "deposit"
+	PostingTypeWithdraw       = "withdraw"
+	PostingTypeTransfer       = "transfer"
+	PostingTypeReversal       = "reversal"
+	PostingTypeFee            = "fee"
+	PostingTypeAdjustment     = "adjustment"
+	PostingTypeOpeningBalance = "opening-balance"
+)
+
+// Entry books an amount against one account. A positive amount credits the
+// account and raises its balance, a negative amount debits it.
+type Entry struct {
+	Account Account
+	Amount  money.Money
+}
+
+// Posting is a set of entries that are written together and sum to zero.
+type Posting struct {
+	TransactionId *int
+	Type          string
+	Entries       []Entry
+}
+
+// Deposit moves amount from the cash-in account into the wallet.
+func Deposit(transactionId int, walletId int, amount money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeDeposit,
+		Entries: []Entry{
+			{Account: CashIn, Amount: amount.Neg()},
+			{Account: WalletAccount(walletId), Amount: amount},
+		},
+	}
+}
+
+// Withdrawal moves amount from the wallet into the cash-out account.
+func Withdrawal(transactionId int, walletId int, amount money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeWithdraw,
+		Entries: []Entry{
+			{Account: WalletAccount(walletId), Amount: amount.Neg()},
+			{Account: CashOut, Amount: amount},
+		},
+	}
+}
+
+// DepositReversal returns amount of a deposit from the wallet to the cash-in
+// account it came from.
+func DepositReversal(transactionId int, walletId int, amount money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeReversal,
+		Entries: []Entry{
+			{Account: WalletAccount(walletId), Amount: amount.Neg()},
+			{Account: CashIn, Amount: amount},
+		},
+	}
+}
+
+// Credit adjusts the wallet up by amount, out of the adjustments account.
+func Credit(transactionId int, walletId int, amount money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeAdjustment,
+		Entries: []Entry{
+			{Account: Adjustments, Amount: amount.Neg()},
+			{Account: WalletAccount(walletId), Amount: amount},
+		},
+	}
+}
+
+// Debit adjusts the wallet down by amount, into the adjustments account.
+func Debit(transactionId int, walletId int, amount money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeAdjustment,
+		Entries: []Entry{
+			{Account: WalletAccount(walletId), Amount: amount.Neg()},
+			{Account: Adjustments, Amount: amount},
+		},
+	}
+}
+
+// Transfer moves amount from one wallet into another.
+func Transfer(transactionId int, senderWalletId int, receiverWalletId int, amount money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeTransfer,
+		Entries: []Entry{
+			{Account: WalletAccount(senderWalletId), Amount: amount.Neg()},
+			{Account: WalletAccount(receiverWalletId), Amount: amount},
+		},
+	}
+}
+
+// Fee moves a fee charged on an operation of the wallet into the house
+// wallet that collects fees.
+func Fee(transactionId int, walletId int, houseWalletId int, amount money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeFee,
+		Entries: []Entry{
+			{Account: WalletAccount(walletId), Amount: amount.Neg()},
+			{Account: WalletAccount(houseWalletId), Amount: amount},
+		},
+	}
+}
+
+// Exchange moves source out of the sender wallet and destination, the same
+// value in the receiver's currency, into the receiver wallet through the
+// exchange accounts of both currencies.
+func Exchange(transactionId int, senderWalletId int, receiverWalletId int, source money.Money, destination money.Money) Posting {
+	return Posting{
+		TransactionId: &transactionId,
+		Type:          PostingTypeTransfer,
+		Entries: []Entry{
+			{Account: WalletAccount(senderWalletId), Amount: source.Neg()},
+			{Account: FXAccount(source.Currency), Amount: source},
+			{Account: FXAccount(destination.Currency), Amount: destination.Neg()},
+			{Account: WalletAccount(receiverWalletId), Amount: destination},
+		},
+	}
+}
+
+// Validate checks that the posting has at least two entries and that the
+// entries of every currency sum to zero.
+func (p Posting) Validate() error {
+	if len(p.Entries) < 2 {
+		return fmt.Errorf("%w: a posting needs at least two entries", ErrUnbalancedPosting)
+	}
+
+	sums := make(map[money.Currency]money.Money)
+	for _, entry := range p.Entries {
+		if entry.Amount.IsZero() {
+			return fmt.Errorf("%w: zero entry for account %s", ErrUnbalancedPosting, entry.Account.Code)
+		}
+
+		zero := money.New(0, entry.Amount.Currency)
+		sum, ok := sums[zero.Currency]
+		if !ok {
+			sum = zero
+		}
+		sum, err := sum.Add(entry.Amount)
+		if err != nil {
+			return err
+		}
+		sums[zero.Currency] = sum
+	}
+
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s entries sum to %s", ErrUnbalancedPosting, currency, sum)
+		}
+	}
+	return nil
+}
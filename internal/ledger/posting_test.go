@@ -0,0 +1,70 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/money"
+)
+
+func TestPostingsBalance(t *testing.T) {
+	amount := money.New(1250, money.DefaultCurrency)
+
+	for _, posting := range []Posting{
+		Deposit(1, 10, amount),
+		Withdrawal(2, 10, amount),
+		Transfer(3, 10, 11, amount),
+		Exchange(4, 10, 12, amount, money.New(1151, "EUR")),
+		DepositReversal(5, 10, amount),
+		Fee(6, 10, 1, amount),
+		Credit(7, 10, amount),
+		Debit(8, 10, amount),
+	} {
+		assert.NoError(t, posting.Validate(), posting.Type)
+	}
+}
+
+func TestDepositEntries(t *testing.T) {
+	posting := Deposit(1, 10, money.New(500, money.DefaultCurrency))
+
+	assert.Equal(t, CashIn, posting.Entries[0].Account)
+	assert.Equal(t, int64(-500), posting.Entries[0].Amount.Amount)
+	assert.Equal(t, WalletAccount(10), posting.Entries[1].Account)
+	assert.Equal(t, int64(500), posting.Entries[1].Amount.Amount)
+}
+
+func TestExchangeEntries(t *testing.T) {
+	posting := Exchange(1, 10, 12, money.New(1000, "USD"), money.New(1513, "JPY"))
+
+	assert.Equal(t, []Entry{
+		{Account: WalletAccount(10), Amount: money.New(-1000, "USD")},
+		{Account: FXAccount("USD"), Amount: money.New(1000, "USD")},
+		{Account: FXAccount("JPY"), Amount: money.New(-1513, "JPY")},
+		{Account: WalletAccount(12), Amount: money.New(1513, "JPY")},
+	}, posting.Entries)
+}
+
+func TestValidateRejectsUnbalancedPostings(t *testing.T) {
+	tests := map[string]Posting{
+		"single entry": {Entries: []Entry{
+			{Account: WalletAccount(1), Amount: money.New(100, "USD")},
+		}},
+		"non zero sum": {Entries: []Entry{
+			{Account: CashIn, Amount: money.New(-100, "USD")},
+			{Account: WalletAccount(1), Amount: money.New(99, "USD")},
+		}},
+		"zero entry": {Entries: []Entry{
+			{Account: CashIn, Amount: money.New(0, "USD")},
+			{Account: WalletAccount(1), Amount: money.New(0, "USD")},
+		}},
+		"currencies balanced only together": {Entries: []Entry{
+			{Account: CashIn, Amount: money.New(-100, "USD")},
+			{Account: WalletAccount(1), Amount: money.New(100, "EUR")},
+		}},
+	}
+
+	for name, posting := range tests {
+		assert.ErrorIs(t, posting.Validate(), ErrUnbalancedPosting, name)
+	}
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/model"
+	s "go-wallet-service/internal/service"
+)
+
+const (
+	RequestIdHeader = "X-Request-Id"
+
+	requestContextKey contextKey = "request"
+	// maxProblemSize bounds how much of a refused response is kept to read
+	// its problem code.
+	maxProblemSize = 4096
+)
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// request is what the Audit middleware knows of a request. The principal is
+// filled in once OAuth authenticates the caller further down the chain.
+type request struct {
+	id        string
+	principal *Principal
+}
+
+// Audit gives every request an ID, taken from its X-Request-Id header when the
+// client sent a usable one, and answers with it. Requests refused as
+// unauthenticated (401) or unauthorized (403) are written to the audit log. It
+// must run before OAuth.
+func Audit(auditService *s.AuditService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestId := RequestId(r.Header.Get(RequestIdHeader))
+			record := &request{id: requestId}
+			r = r.WithContext(context.WithValue(r.Context(), requestContextKey, record))
+			w.Header().Set(RequestIdHeader, requestId)
+
+			recorder := &refusalRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status != http.StatusUnauthorized && recorder.status != http.StatusForbidden {
+				return
+			}
+			entry, err := refusalEntry(r, recorder)
+			if err == nil {
+				err = auditService.Record(ActorFromRequest(r), entry)
+			}
+			if err != nil {
+				log.Error().Str("error", "audit_failed").Str("error_description", fmt.Sprintf("Unable to audit refused request [%s] due to: %s", requestId, err.Error())).Send()
+			}
+		})
+	}
+}
+
+// ActorFromRequest is who makes the request: the authenticated user, acting
+// as an admin when the Admin middleware let them through, along with where
+// the request came from. The user is unknown before OAuth.
+func ActorFromRequest(r *http.Request) model.Actor {
+	actor := model.Actor{Type: model.ActorTypeUser, IP: remoteIP(r), UserAgent: r.UserAgent()}
+
+	principal, ok := PrincipalFromContext(r.Context())
+	if record, found := r.Context().Value(requestContextKey).(*request); found {
+		actor.RequestId = record.id
+		if !ok && record.principal != nil {
+			principal, ok = *record.principal, true
+		}
+	}
+	if ok {
+		actor.UserId = principal.UserId
+		if model.IsStaff(principal.Role) {
+			actor.Type = model.ActorTypeAdmin
+		}
+	}
+	return actor
+}
+
+// refusalEntry describes a refused request by what it asked for and the
+// problem it was answered with.
+func refusalEntry(r *http.Request, recorder *refusalRecorder) (model.AuditEntry, error) {
+	action := model.AuditActionAccessDenied
+	if recorder.status == http.StatusUnauthorized {
+		action = model.AuditActionAuthFailed
+	}
+
+	var problem struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(recorder.body, &problem)
+
+	details, err := json.Marshal(map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"status": recorder.status,
+		"code":   problem.Code,
+	})
+	if err != nil {
+		return model.AuditEntry{}, err
+	}
+
+	entry := model.AuditEntry{Action: action, Details: string(details)}
+	vars := mux.Vars(r)
+	entry.UserId = pathIdOrNil(vars["userId"])
+	entry.WalletId = pathIdOrNil(vars["walletId"])
+	entry.TransactionId = pathIdOrNil(vars["transactionId"])
+	return entry, nil
+}
+
+// refusalRecorder passes a response through, keeping its status and the start
+// of its body.
+type refusalRecorder struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (rr *refusalRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *refusalRecorder) Write(body []byte) (int, error) {
+	if (rr.status == http.StatusUnauthorized || rr.status == http.StatusForbidden) && len(rr.body) < maxProblemSize {
+		rr.body = append(rr.body, body[:min(len(body), maxProblemSize-len(rr.body))]...)
+	}
+	return rr.ResponseWriter.Write(body)
+}
+
+// Unwrap lets http.ResponseController flush the response, which event
+// streams need.
+func (rr *refusalRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// remoteIP is the address the request came from. Forwarding headers are not
+// trusted, since any client can set them.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequestId is the ID a request is known by: the one the client sent when it
+// is usable, or a new one.
+func RequestId(sent string) string {
+	if requestIdPattern.MatchString(sent) {
+		return sent
+	}
+	return newRequestId()
+}
+
+func newRequestId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func pathIdOrNil(value string) *int {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/object"
+	s "go-wallet-service/internal/service"
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrNotWalletOwner = utils.Forbidden("invalid_authorization", "The current user is not the owner of the wallet")
+	ErrUnauthorized   = utils.Forbidden("invalid_authorization", "The current user is unauthorized")
+	ErrAdminRequired  = utils.Forbidden("admin_required", "The current user has no staff role")
+	ErrNotPermitted   = utils.Forbidden("permission_denied", "The role of the current user does not allow this operation")
+)
+
+// WalletOwner only lets a request through when the wallet named by the
+// {walletId} path variable belongs to the authenticated user. It must run after
+// OAuth.
+func WalletOwner(walletService *s.WalletService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authorizedPrincipal(r)
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			walletId, err := PathId(r, "walletId")
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			wallet, err := walletService.GetById(walletId)
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			if wallet.UserId != principal.UserId {
+				log.Error().Str("error", "invalid_authorization").Str("error_description", fmt.Sprintf("User [%d] is not the owner of wallet [%d]", principal.UserId, walletId)).Send()
+				utils.WriteProblem(w, r, ErrNotWalletOwner)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserSelf only lets a request through when the {userId} path variable is the
+// authenticated user. It must run after OAuth.
+func UserSelf() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authorizedPrincipal(r)
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			userId, err := PathId(r, "userId")
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			if userId != principal.UserId {
+				log.Error().Str("error", "invalid_authorization").Str("error_description", fmt.Sprintf("User [%d] cannot act as user [%d]", principal.UserId, userId)).Send()
+				utils.WriteProblem(w, r, ErrUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Admin only lets a request through when the authenticated user has a staff
+// role, which it adds to the principal for Permission. It must run after
+// OAuth.
+func Admin(userService *s.UserService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authorizedPrincipal(r)
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			user, err := userService.GetById(principal.UserId)
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			if !model.IsStaff(user.Role) {
+				log.Error().Str("error", "admin_required").Str("error_description", fmt.Sprintf("User [%d] has no staff role", principal.UserId)).Send()
+				utils.WriteProblem(w, r, ErrAdminRequired)
+				return
+			}
+
+			principal.Role = user.Role
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// Permission only lets a request through when the role of the authenticated
+// user grants permission. It must run after Admin.
+func Permission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := PrincipalFromContext(r.Context())
+			if !model.HasPermission(principal.Role, permission) {
+				log.Error().Str("error", "permission_denied").Str("error_description", fmt.Sprintf("User [%d] with role [%s] lacks permission [%s]", principal.UserId, principal.Role, permission)).Send()
+				utils.WriteProblem(w, r, ErrNotPermitted)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PathId reads the integer ID in the path variable name.
+func PathId(r *http.Request, name string) (int, error) {
+	value := mux.Vars(r)[name]
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, utils.Invalid("invalid_parameter", fmt.Sprintf("%s must be a valid integer", name))
+	}
+	return id, nil
+}
+
+// authorizedPrincipal returns the authenticated caller after checking that a
+// user_id sent in the request body, such as the sender of a transfer, is the
+// caller.
+func authorizedPrincipal(r *http.Request) (Principal, error) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		log.Error().Str("error", "authorization_failed").Str("error_description", "Authorization middleware used without OAuth").Send()
+		return Principal{}, ErrAuthorizationRequired
+	}
+
+	requestParams, _ := r.Context().Value("requestParams").(string)
+	var OAuthParams object.OAuthParams
+	err := json.Unmarshal([]byte(requestParams), &OAuthParams)
+	if err == nil && OAuthParams.UserId != nil && *OAuthParams.UserId != principal.UserId {
+		log.Error().Str("error", "invalid_authorization").Str("error_description", fmt.Sprintf("User [%d] is unauthorized", principal.UserId)).Send()
+		return Principal{}, ErrUnauthorized
+	}
+
+	return principal, nil
+}
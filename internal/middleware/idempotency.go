@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	s "go-wallet-service/internal/service"
+	"go-wallet-service/utils"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	MaxIdempotencyKeyLength  = 255
+)
+
+var ErrInvalidIdempotencyKey = utils.Invalid("invalid_idempotency_key", fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, MaxIdempotencyKeyLength))
+
+// Idempotency makes a handler safe to retry. The first request carrying an
+// Idempotency-Key header is executed and its response stored; later requests
+// from the same user with the same key and payload get the stored response
+// back instead of running the handler again. It must run after OAuth.
+func Idempotency(idempotencyService *s.IdempotencyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > MaxIdempotencyKeyLength {
+				utils.WriteProblem(w, r, ErrInvalidIdempotencyKey)
+				return
+			}
+
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				log.Error().Str("error", "authorization_failed").Str("error_description", "Idempotency middleware used without OAuth").Send()
+				utils.WriteProblem(w, r, ErrAuthorizationRequired)
+				return
+			}
+
+			userId := principal.UserId
+			requestParams, _ := r.Context().Value("requestParams").(string)
+			fingerprint := []byte(r.Method + " " + r.URL.Path + "\n" + requestParams)
+
+			stored, reserved, err := idempotencyService.Begin(userId, key, fingerprint)
+			if err != nil {
+				utils.WriteProblem(w, r, err)
+				return
+			}
+
+			if !reserved {
+				// stored error responses are problem documents
+				contentType := "application/json"
+				if *stored.StatusCode >= http.StatusBadRequest {
+					contentType = "application/problem+json"
+				}
+				w.Header().Set("Content-Type", contentType)
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(*stored.StatusCode)
+				w.Write(stored.ResponseBody)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				// server errors and panics leave nothing worth replaying, so the
+				// key is freed for the client's retry
+				if err := idempotencyService.Release(userId, key); err != nil {
+					log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to release idempotency key for user [%d] due to: %s", userId, err.Error())).Send()
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.statusCode >= http.StatusInternalServerError {
+				return
+			}
+
+			// from here on the request may have moved money, so a key whose
+			// response cannot be stored stays reserved until it expires rather
+			// than letting a retry run the request twice
+			completed = true
+			if err := idempotencyService.Complete(userId, key, recorder.statusCode, recorder.body.Bytes()); err != nil {
+				log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to store idempotent response for user [%d] due to: %s", userId, err.Error())).Send()
+			}
+		})
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of its
+// status code and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if !rr.wroteHeader {
+		rr.statusCode = statusCode
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
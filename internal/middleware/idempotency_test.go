@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	s "go-wallet-service/internal/service"
+)
+
+type memoryIdempotencyRepository struct {
+	keys map[string]model.IdempotencyKey
+}
+
+func (m *memoryIdempotencyRepository) Reserve(userId int, key string, requestHash string, expiryDate time.Time) (model.IdempotencyKey, bool, error) {
+	id := fmt.Sprintf("%d/%s", userId, key)
+	if stored, ok := m.keys[id]; ok && stored.ExpiryDate.After(time.Now()) {
+		return stored, false, nil
+	}
+	m.keys[id] = model.IdempotencyKey{UserId: userId, Key: key, RequestHash: requestHash, ExpiryDate: expiryDate}
+	return m.keys[id], true, nil
+}
+
+func (m *memoryIdempotencyRepository) Complete(userId int, key string, statusCode int, responseBody []byte) error {
+	id := fmt.Sprintf("%d/%s", userId, key)
+	stored := m.keys[id]
+	stored.StatusCode = &statusCode
+	stored.ResponseBody = responseBody
+	m.keys[id] = stored
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) Release(userId int, key string) error {
+	delete(m.keys, fmt.Sprintf("%d/%s", userId, key))
+	return nil
+}
+
+func newIdempotentHandler(ttl time.Duration, statusCode int) (http.Handler, *int) {
+	calls := 0
+	repository := &memoryIdempotencyRepository{keys: map[string]model.IdempotencyKey{}}
+	handler := Idempotency(s.NewIdempotencyService(repository, ttl))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		w.Write([]byte(`{"status":"ok","call":` + strconv.Itoa(calls) + `}`))
+	}))
+	return handler, &calls
+}
+
+func idempotentRequest(userId int, key string, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/wallet/8/deposit", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	ctx := context.WithValue(r.Context(), "requestParams", body)
+	ctx = withPrincipal(ctx, Principal{UserId: userId})
+	return r.WithContext(ctx)
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	handler, calls := newIdempotentHandler(time.Hour, http.StatusOK)
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, idempotentRequest(2, "abc", `{"user_id":2,"amount":500}`))
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, idempotentRequest(2, "abc", `{"user_id":2,"amount":500}`))
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+}
+
+func TestIdempotencyRejectsDifferentPayload(t *testing.T) {
+	handler, calls := newIdempotentHandler(time.Hour, http.StatusOK)
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "abc", `{"user_id":2,"amount":500}`))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, idempotentRequest(2, "abc", `{"user_id":2,"amount":900}`))
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	assert.Contains(t, response.Body.String(), "idempotency_key_reused")
+}
+
+func TestIdempotencyKeysAreScopedPerUser(t *testing.T) {
+	handler, calls := newIdempotentHandler(time.Hour, http.StatusOK)
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "abc", `{"amount":500}`))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(3, "abc", `{"amount":500}`))
+
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	handler, calls := newIdempotentHandler(-time.Second, http.StatusOK)
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "abc", `{"amount":500}`))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "abc", `{"amount":500}`))
+
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotencyDoesNotStoreServerErrors(t *testing.T) {
+	handler, calls := newIdempotentHandler(time.Hour, http.StatusInternalServerError)
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "abc", `{"amount":500}`))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "abc", `{"amount":500}`))
+
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotencyWithoutKey(t *testing.T) {
+	handler, calls := newIdempotentHandler(time.Hour, http.StatusOK)
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "", `{"amount":500}`))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "", `{"amount":500}`))
+
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotencyReplaysStoredProblem(t *testing.T) {
+	handler, calls := newIdempotentHandler(time.Hour, http.StatusConflict)
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(2, "abc", `{"amount":500}`))
+	replayed := httptest.NewRecorder()
+	handler.ServeHTTP(replayed, idempotentRequest(2, "abc", `{"amount":500}`))
+
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, http.StatusConflict, replayed.Code)
+	assert.Equal(t, "application/problem+json", replayed.Header().Get("Content-Type"))
+}
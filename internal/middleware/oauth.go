@@ -3,67 +3,79 @@ package middleware
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 
-	"go-wallet-service/internal/object"
 	s "go-wallet-service/internal/service"
 	"go-wallet-service/utils"
 )
 
-func OAuth(userService *s.UserService) func(http.Handler) http.Handler {
+var (
+	ErrAuthorizationRequired = utils.Unauthorized("authorization_required", "OAuth Bearer authorization required")
+	ErrUnreadableBody        = utils.Invalid("invalid_request", "Unable to read body")
+)
+
+func OAuth(tokenService *s.TokenService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authorizationHeader := r.Header.Get("Authorization")
 
 			if !strings.Contains(authorizationHeader, "Bearer") {
-				log.Error().Str("error", "authorization_failed").Str("error_description", "OAuth authorization required").Send()
-				utils.HttpErrorResponse(w, "invalid_authorization", "OAuth Bearer authorization required", http.StatusUnauthorized)
+				utils.WriteProblem(w, r, ErrAuthorizationRequired)
 				return
 			}
 
 			authorization := strings.Split(authorizationHeader, " ")
 			if len(authorization) != 2 {
-				utils.HttpErrorResponse(w, "invalid_authorization", "OAuth Bearer authorization invalid format", http.StatusUnauthorized)
+				utils.WriteProblem(w, r, ErrAuthorizationRequired.WithMessage("OAuth Bearer authorization invalid format"))
 				return
 			}
 
-			token := authorization[1]
-			userId, err := userService.GetUserByToken(token)
+			userId, err := tokenService.Authenticate(authorization[1])
 			if err != nil {
-				log.Error().Str("error", "token_invalid").Str("error_description", fmt.Sprintf("Token [%s] invalid for user due to %s", token, err.Error())).Send()
-				utils.HttpErrorResponse(w, "authorization_failed", "The token provided is invalid or user does not exists.", http.StatusUnauthorized)
+				writeTokenProblem(w, r, err)
 				return
 			}
 
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
-				log.Error().Str("error", "io_read_error").Str("error_description", "Unable to read body").Send()
-				utils.HttpErrorResponse(w, "invalid_request", "Unable to read body", http.StatusForbidden)
+				utils.WriteProblem(w, r, ErrUnreadableBody)
 				return
 			}
 			r.Body.Close()
 
 			ctx := context.WithValue(r.Context(), "requestParams", string(body))
+			ctx = withPrincipal(ctx, Principal{UserId: userId})
 			r = r.WithContext(ctx)
-
 			r.Body = io.NopCloser(bytes.NewReader(body))
-			var OAuthParams object.OAuthParams
-			OAuthParamsErr := json.NewDecoder(r.Body).Decode(&OAuthParams)
-			if OAuthParamsErr == nil {
-				if userId != OAuthParams.UserId {
-					log.Error().Str("error", "invalid_authorization").Str("error_description", fmt.Sprintf("User [%d] is unauthorized", userId)).Send()
-					utils.HttpErrorResponse(w, "invalid_authorization", "The current user is unauthorized", http.StatusForbidden)
-					return
-				}
-			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// writeTokenProblem rejects a bearer token with an error code that tells the
+// client whether refreshing can help.
+func writeTokenProblem(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	utils.WriteProblem(w, r, TokenError(err))
+}
+
+// TokenError is the error a bearer token that failed to authenticate is
+// rejected with. The token itself is never logged.
+func TokenError(err error) error {
+	switch {
+	case errors.Is(err, s.ErrTokenExpired):
+		err = s.ErrTokenExpired.WithMessage("The access token has expired, use the refresh token to obtain a new one")
+	case errors.Is(err, s.ErrTokenRevoked):
+		log.Error().Str("error", "token_revoked").Str("error_description", "Revoked access token presented").Send()
+	case errors.Is(err, s.ErrTokenInvalid):
+		log.Error().Str("error", "token_invalid").Str("error_description", "Unknown access token presented").Send()
+		err = s.ErrTokenInvalid.WithMessage("The token provided is invalid or user does not exists.")
+	}
+	return err
+}
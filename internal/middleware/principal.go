@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+)
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// Principal is the caller authenticated by the OAuth middleware.
+type Principal struct {
+	UserId int
+	// Role is only known past the Admin middleware.
+	Role string
+}
+
+// withPrincipal authenticates the request as principal, which the Audit
+// middleware also learns of for the refusals it records.
+func withPrincipal(ctx context.Context, principal Principal) context.Context {
+	if record, ok := ctx.Value(requestContextKey).(*request); ok {
+		record.principal = &principal
+	}
+	return context.WithValue(ctx, principalContextKey, principal)
+}
+
+// PrincipalFromContext returns the caller authenticated by the OAuth
+// middleware, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditActionUserViewed          = "user.viewed"
+	AuditActionWalletViewed        = "wallet.viewed"
+	AuditActionTransactionViewed   = "transaction.viewed"
+	AuditActionAuditViewed         = "audit.viewed"
+	AuditActionUserRegistered      = "user.registered"
+	AuditActionUserProfileUpdated  = "user.profile_updated"
+	AuditActionUserStatusChanged   = "user.status_changed"
+	AuditActionWalletCreated       = "wallet.created"
+	AuditActionWalletRenamed       = "wallet.renamed"
+	AuditActionWalletDefaultSet    = "wallet.default_set"
+	AuditActionWalletStatusChanged = "wallet.status_changed"
+	AuditActionWalletDeposited     = "wallet.deposited"
+	AuditActionWalletWithdrawn     = "wallet.withdrawn"
+	AuditActionWalletTransferred   = "wallet.transferred"
+	AuditActionWalletAdjusted      = "wallet.adjusted"
+	AuditActionTransactionReversed = "transaction.reversed"
+	AuditActionHoldPlaced          = "hold.placed"
+	AuditActionHoldCaptured        = "hold.captured"
+	AuditActionHoldReleased        = "hold.released"
+	AuditActionHoldExpired         = "hold.expired"
+	AuditActionWebhookRegistered   = "webhook.registered"
+	AuditActionWebhookRemoved      = "webhook.removed"
+	AuditActionWebhookRedelivered  = "webhook.redelivered"
+	AuditActionAuthFailed          = "auth.failed"
+	AuditActionAccessDenied        = "access.denied"
+)
+
+// Kinds of actor in the audit log: users acting on their own account, staff
+// acting through the admin API and the service's own workers.
+const (
+	ActorTypeUser   = "user"
+	ActorTypeAdmin  = "admin"
+	ActorTypeSystem = "system"
+)
+
+// Actor is who makes a change and, for changes made through the API, where
+// the request came from. UserId is zero for the system and for callers that
+// are not authenticated.
+type Actor struct {
+	Type      string
+	UserId    int
+	IP        string
+	UserAgent string
+	RequestId string
+}
+
+// SystemActor makes the changes of background work such as expiring holds
+// and running scheduled transfers.
+var SystemActor = Actor{Type: ActorTypeSystem}
+
+// AuditEntry records an action taken by an actor on the user, wallet or
+// transaction it names. Details holds the JSON object describing it, with the
+// values the action changed under "before" and "after". Entries are only ever
+// appended, each carrying the hash of the one before it.
+type AuditEntry struct {
+	ID            int       `db:"id"`
+	ActorType     string    `db:"actor_type"`
+	ActorUserId   *int      `db:"actor_user_id"`
+	Action        string    `db:"action"`
+	UserId        *int      `db:"user_id"`
+	WalletId      *int      `db:"wallet_id"`
+	TransactionId *int      `db:"transaction_id"`
+	Details       string    `db:"details"`
+	IP            string    `db:"ip"`
+	UserAgent     string    `db:"user_agent"`
+	RequestId     string    `db:"request_id"`
+	CreationDate  time.Time `db:"creation_date"`
+	PrevHash      string    `db:"prev_hash"`
+	Hash          string    `db:"hash"`
+}
+
+// By attributes the entry to actor.
+func (e AuditEntry) By(actor Actor) AuditEntry {
+	e.ActorType, e.ActorUserId = actor.Type, nil
+	if actor.UserId != 0 {
+		userId := actor.UserId
+		e.ActorUserId = &userId
+	}
+	e.IP, e.UserAgent, e.RequestId = actor.IP, actor.UserAgent, actor.RequestId
+	return e
+}
+
+// AuditFilter selects audit entries. Zero fields do not filter. Entries are
+// returned newest first, starting below BeforeId when it is set.
+type AuditFilter struct {
+	ActorType     string
+	ActorUserId   int
+	Action        string
+	UserId        int
+	WalletId      int
+	TransactionId int
+	RequestId     string
+	From          *time.Time
+	To            *time.Time
+	BeforeId      int
+	Limit         int
+}
+
+// AuditVerification is the outcome of checking the hash chain of the audit
+// log. Entries written before the log was chained have no hash and are only
+// counted. BrokenId is the first entry that does not match its hash or does
+// not link to the entry before it.
+type AuditVerification struct {
+	Chained  int
+	Unhashed int
+	LastId   int
+	LastHash string
+	BrokenId int
+	Problem  string
+}
+
+func (v AuditVerification) OK() bool {
+	return v.BrokenId == 0
+}
+
+type AuditEntryData struct {
+	ID            int             `json:"id"`
+	ActorType     string          `json:"actor_type"`
+	ActorUserId   *int            `json:"actor_user_id"`
+	Action        string          `json:"action"`
+	UserId        *int            `json:"user_id"`
+	WalletId      *int            `json:"wallet_id"`
+	TransactionId *int            `json:"transaction_id"`
+	Details       json.RawMessage `json:"details"`
+	IP            string          `json:"ip"`
+	UserAgent     string          `json:"user_agent"`
+	RequestId     string          `json:"request_id"`
+	CreationDate  time.Time       `json:"creation_date"`
+	PrevHash      string          `json:"prev_hash"`
+	Hash          string          `json:"hash"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"go-wallet-service/internal/money"
+)
+
+// FeeRule prices the fee on withdrawals or transfers of at least MinAmount:
+// Flat plus Rate times the amount, but no more than Cap when it is set.
+// Amounts are in major units of Currency, or of the operation's currency for
+// a rule without one. Rules of one type with different minimums make tiers.
+type FeeRule struct {
+	ID              int             `db:"id"`
+	TransactionType string          `db:"transaction_type"`
+	Currency        *money.Currency `db:"currency"`
+	MinAmount       money.Decimal   `db:"min_amount"`
+	Flat            money.Decimal   `db:"flat"`
+	Rate            money.Decimal   `db:"rate"`
+	Cap             *money.Decimal  `db:"cap"`
+	CreationDate    time.Time       `db:"creation_date"`
+	UpdateDate      time.Time       `db:"update_date"`
+}
+
+// Fee is a fee to charge on an operation and the house wallet it is paid
+// into.
+type Fee struct {
+	Amount        money.Money
+	HouseWalletId int
+}
+
+type FeeQuote struct {
+	TransactionType string
+	Amount          money.Money
+	Fee             money.Money
+	Total           money.Money
+}
+
+type FeeQuoteData struct {
+	Type     string      `json:"type"`
+	Amount   money.Money `json:"amount"`
+	Fee      money.Money `json:"fee"`
+	Total    money.Money `json:"total"`
+	Currency string      `json:"currency"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"go-wallet-service/internal/money"
+)
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold reserves part of a wallet's balance until it is captured into a
+// withdrawal or transfer, released, or expires. Held money stays in the
+// wallet but cannot be withdrawn or sent. A hold placed for a payee is
+// captured by a transfer into ReceiverWalletId.
+type Hold struct {
+	ID               int            `db:"id"`
+	WalletId         int            `db:"wallet_id"`
+	ReceiverWalletId *int           `db:"receiver_wallet_id"`
+	Amount           money.Money    `db:"amount"`
+	Currency         money.Currency `db:"currency"`
+	CapturedAmount   *money.Money   `db:"captured_amount"`
+	Status           string         `db:"status"`
+	TransactionId    *int           `db:"transaction_id"`
+	ExpiryDate       time.Time      `db:"expiry_date"`
+	CreationDate     time.Time      `db:"creation_date"`
+	UpdateDate       time.Time      `db:"update_date"`
+}
+
+type HoldData struct {
+	ID               int          `json:"id"`
+	WalletId         int          `json:"wallet_id"`
+	ReceiverWalletId *int         `json:"receiver_wallet_id,omitempty"`
+	Amount           money.Money  `json:"amount"`
+	CapturedAmount   *money.Money `json:"captured_amount,omitempty"`
+	Currency         string       `json:"currency"`
+	Status           string       `json:"status"`
+	TransactionId    *int         `json:"transaction_id,omitempty"`
+	ExpiryDate       time.Time    `json:"expiry_date"`
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+)
+
+type IdempotencyKey struct {
+	UserId       int       `db:"user_id"`
+	Key          string    `db:"key"`
+	RequestHash  string    `db:"request_hash"`
+	StatusCode   *int      `db:"status_code"`
+	ResponseBody []byte    `db:"response_body"`
+	CreationDate time.Time `db:"creation_date"`
+	ExpiryDate   time.Time `db:"expiry_date"`
+}
+
+// Completed reports whether the response of the first request has been stored.
+func (k IdempotencyKey) Completed() bool {
+	return k.StatusCode != nil
+}
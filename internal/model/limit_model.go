@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"go-wallet-service/internal/money"
+)
+
+const (
+	LimitPeriodTransaction = "transaction"
+	LimitPeriodDaily       = "daily"
+	LimitPeriodMonthly     = "monthly"
+)
+
+const (
+	LimitScopeUser   = "user"
+	LimitScopeWallet = "wallet"
+)
+
+// TransactionLimit caps the deposits, withdrawals or transfers of an operation
+// type, either each on its own or added up over a rolling period. A limit
+// with no user or wallet applies to everyone, and one with no currency to
+// every currency, in that currency's major units.
+type TransactionLimit struct {
+	ID           int             `db:"id"`
+	UserId       *int            `db:"user_id"`
+	WalletId     *int            `db:"wallet_id"`
+	Operation    string          `db:"operation"`
+	Period       string          `db:"period"`
+	Amount       money.Decimal   `db:"amount"`
+	Currency     *money.Currency `db:"currency"`
+	CreationDate time.Time       `db:"creation_date"`
+	UpdateDate   time.Time       `db:"update_date"`
+}
+
+// LimitUsage is what an operation type has used of a limit over its period.
+// Oldest is the date of the oldest transaction counted, if any.
+type LimitUsage struct {
+	Total  money.Money
+	Oldest *time.Time
+}
+
+type LimitBreachData struct {
+	Operation string      `json:"operation"`
+	Period    string      `json:"period"`
+	Scope     string      `json:"scope"`
+	Limit     money.Money `json:"limit"`
+	Remaining money.Money `json:"remaining"`
+	Currency  string      `json:"currency"`
+	ResetsAt  *time.Time  `json:"resets_at,omitempty"`
+}
@@ -0,0 +1,41 @@
+package model
+
+// Permissions of the staff roles on the admin API.
+const (
+	// PermissionLookup reads any user, wallet or transaction.
+	PermissionLookup = "lookup"
+	// PermissionAudit reads the audit log.
+	PermissionAudit = "audit"
+	// PermissionStatus changes the status of users and wallets.
+	PermissionStatus = "status"
+	// PermissionAdjust credits or debits wallets by hand and forces
+	// reversals.
+	PermissionAdjust = "adjust"
+	// PermissionWebhooks registers webhook endpoints and redelivers events.
+	PermissionWebhooks = "webhooks"
+	// PermissionSettle captures and releases holds in place of their payee.
+	PermissionSettle = "settle"
+)
+
+var rolePermissions = map[string][]string{
+	RoleSupport:  {PermissionLookup, PermissionAudit},
+	RoleOperator: {PermissionLookup, PermissionAudit, PermissionStatus},
+	RoleFinance:  {PermissionLookup, PermissionAudit, PermissionAdjust, PermissionSettle},
+	RoleAuditor:  {PermissionAudit},
+	RoleAdmin:    {PermissionLookup, PermissionAudit, PermissionStatus, PermissionAdjust, PermissionWebhooks, PermissionSettle},
+}
+
+// HasPermission tells whether users of role are granted permission.
+func HasPermission(role string, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff tells whether role is granted anything on the admin API.
+func IsStaff(role string) bool {
+	return len(rolePermissions[role]) > 0
+}
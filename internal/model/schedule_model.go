@@ -0,0 +1,112 @@
+package model
+
+import (
+	"time"
+
+	"go-wallet-service/internal/money"
+)
+
+const (
+	RecurrenceOnce    = "once"
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+const (
+	ScheduleStatusActive    = "active"
+	ScheduleStatusPaused    = "paused"
+	ScheduleStatusCancelled = "cancelled"
+	ScheduleStatusCompleted = "completed"
+	ScheduleStatusFailed    = "failed"
+)
+
+const (
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+)
+
+// MaxScheduledTransferAttempts is how many times one occurrence of a schedule
+// is tried while the sender wallet lacks the funds.
+const MaxScheduledTransferAttempts = 5
+
+// ScheduledTransfer is a transfer to be made on ScheduledDate and then again
+// on every recurrence. NextRunDate is when the worker next tries it, which is
+// later than ScheduledDate while a failed attempt is being retried. Version
+// changes with every edit and run, so a worker only runs the schedule it
+// claimed.
+type ScheduledTransfer struct {
+	ID               int            `db:"id"`
+	UserId           int            `db:"user_id"`
+	SenderWalletId   int            `db:"sender_wallet_id"`
+	ReceiverWalletId int            `db:"receiver_wallet_id"`
+	Amount           money.Money    `db:"amount"`
+	Currency         money.Currency `db:"currency"`
+	Recurrence       string         `db:"recurrence"`
+	DayOfMonth       *int           `db:"day_of_month"`
+	ScheduledDate    time.Time      `db:"scheduled_date"`
+	NextRunDate      time.Time      `db:"next_run_date"`
+	Attempts         int            `db:"attempts"`
+	Status           string         `db:"status"`
+	Version          int            `db:"version"`
+	ClaimedUntil     *time.Time     `db:"claimed_until"`
+	CreationDate     time.Time      `db:"creation_date"`
+	UpdateDate       time.Time      `db:"update_date"`
+}
+
+// NextOccurrence returns the occurrence that follows ScheduledDate, and false
+// for a schedule that does not recur. A monthly schedule on a day the month
+// does not have runs on the month's last day instead.
+func (s ScheduledTransfer) NextOccurrence() (time.Time, bool) {
+	switch s.Recurrence {
+	case RecurrenceDaily:
+		return s.ScheduledDate.AddDate(0, 0, 1), true
+	case RecurrenceWeekly:
+		return s.ScheduledDate.AddDate(0, 0, 7), true
+	case RecurrenceMonthly:
+		day := s.ScheduledDate.Day()
+		if s.DayOfMonth != nil {
+			day = *s.DayOfMonth
+		}
+		date := s.ScheduledDate
+		firstOfNextMonth := time.Date(date.Year(), date.Month()+1, 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+		lastDay := firstOfNextMonth.AddDate(0, 1, -1).Day()
+		return firstOfNextMonth.AddDate(0, 0, min(day, lastDay)-1), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+type ScheduledTransferRun struct {
+	ID            int       `db:"id"`
+	ScheduleId    int       `db:"schedule_id"`
+	ScheduledDate time.Time `db:"scheduled_date"`
+	Attempt       int       `db:"attempt"`
+	Status        string    `db:"status"`
+	TransactionId *int      `db:"transaction_id"`
+	Error         *string   `db:"error"`
+	CreationDate  time.Time `db:"creation_date"`
+}
+
+type ScheduledTransferData struct {
+	ID               int         `json:"id"`
+	SenderWalletId   int         `json:"sender_wallet_id"`
+	ReceiverWalletId int         `json:"receiver_wallet_id"`
+	Amount           money.Money `json:"amount"`
+	Currency         string      `json:"currency"`
+	Recurrence       string      `json:"recurrence"`
+	DayOfMonth       *int        `json:"day_of_month,omitempty"`
+	NextRunDate      time.Time   `json:"next_run_date"`
+	Attempts         int         `json:"attempts"`
+	Status           string      `json:"status"`
+}
+
+type ScheduledTransferRunData struct {
+	ID            int       `json:"id"`
+	ScheduledDate time.Time `json:"scheduled_date"`
+	Attempt       int       `json:"attempt"`
+	Status        string    `json:"status"`
+	TransactionId *int      `json:"transaction_id,omitempty"`
+	Error         *string   `json:"error,omitempty"`
+	RunDate       time.Time `json:"run_date"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+	thirtyFirst := 31
+
+	tests := map[string]struct {
+		schedule ScheduledTransfer
+		next     time.Time
+	}{
+		"daily":                {ScheduledTransfer{Recurrence: RecurrenceDaily, ScheduledDate: date(2024, 12, 31)}, date(2025, 1, 1)},
+		"weekly":               {ScheduledTransfer{Recurrence: RecurrenceWeekly, ScheduledDate: date(2024, 2, 26)}, date(2024, 3, 4)},
+		"monthly":              {ScheduledTransfer{Recurrence: RecurrenceMonthly, ScheduledDate: date(2024, 12, 15)}, date(2025, 1, 15)},
+		"monthly in leap year": {ScheduledTransfer{Recurrence: RecurrenceMonthly, DayOfMonth: &thirtyFirst, ScheduledDate: date(2024, 1, 31)}, date(2024, 2, 29)},
+		"monthly after short":  {ScheduledTransfer{Recurrence: RecurrenceMonthly, DayOfMonth: &thirtyFirst, ScheduledDate: date(2025, 2, 28)}, date(2025, 3, 31)},
+		"monthly to short":     {ScheduledTransfer{Recurrence: RecurrenceMonthly, DayOfMonth: &thirtyFirst, ScheduledDate: date(2025, 3, 31)}, date(2025, 4, 30)},
+	}
+
+	for name, test := range tests {
+		next, ok := test.schedule.NextOccurrence()
+		assert.True(t, ok, name)
+		assert.Equal(t, test.next, next, name)
+	}
+
+	_, ok := ScheduledTransfer{Recurrence: RecurrenceOnce, ScheduledDate: date(2025, 1, 1)}.NextOccurrence()
+	assert.False(t, ok)
+}
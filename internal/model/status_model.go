@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// Users and wallets share these statuses. A wallet can only move money as far
+// as both its own status and its owner's allow.
+const (
+	StatusActive    = "active"
+	StatusFrozen    = "frozen"
+	StatusSuspended = "suspended"
+	StatusClosed    = "closed"
+)
+
+// CanSend tells whether money may leave a user or wallet in status.
+func CanSend(status string) bool {
+	return status == StatusActive
+}
+
+// CanReceive tells whether money may arrive at a user or wallet in status;
+// frozen ones keep receiving.
+func CanReceive(status string) bool {
+	return status == StatusActive || status == StatusFrozen
+}
+
+// StatusChange records a change of the status of a user, or of one of their
+// wallets when WalletId is set, with who made it and why.
+type StatusChange struct {
+	ID           int       `db:"id"`
+	UserId       int       `db:"user_id"`
+	WalletId     *int      `db:"wallet_id"`
+	FromStatus   string    `db:"from_status"`
+	ToStatus     string    `db:"to_status"`
+	Reason       string    `db:"reason"`
+	ActorUserId  int       `db:"actor_user_id"`
+	CreationDate time.Time `db:"creation_date"`
+}
+
+type StatusChangeData struct {
+	ID           int       `json:"id"`
+	UserId       int       `json:"user_id"`
+	WalletId     *int      `json:"wallet_id"`
+	FromStatus   string    `json:"from_status"`
+	ToStatus     string    `json:"to_status"`
+	Reason       string    `json:"reason"`
+	ActorUserId  int       `json:"actor_user_id"`
+	CreationDate time.Time `json:"creation_date"`
+}
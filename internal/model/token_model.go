@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// OAuthToken is an issued access or refresh token. Only the SHA-256 hash of
+// the token is stored; the token itself is handed to the client once.
+type OAuthToken struct {
+	ID             int        `db:"id"`
+	UserId         int        `db:"user_id"`
+	TokenHash      string     `db:"token_hash"`
+	Type           string     `db:"type"`
+	SessionId      string     `db:"session_id"`
+	ExpiryDate     time.Time  `db:"expiry_date"`
+	RevocationDate *time.Time `db:"revocation_date"`
+	CreationDate   time.Time  `db:"creation_date"`
+}
@@ -2,24 +2,180 @@ package model
 
 import (
 	"time"
+
+	"go-wallet-service/internal/money"
+)
+
+const (
+	TransactionTypeDeposit  = "deposit"
+	TransactionTypeWithdraw = "withdraw"
+	TransactionTypeTransfer = "transfer"
+	TransactionTypeReversal = "reversal"
+	TransactionTypeFee      = "fee"
+	// TransactionTypeCredit and TransactionTypeDebit are manual adjustments
+	// of a wallet made by staff.
+	TransactionTypeCredit = "credit"
+	TransactionTypeDebit  = "debit"
+)
+
+// Reason codes a manual adjustment must give.
+const (
+	ReasonCodeCorrection    = "correction"
+	ReasonCodeGoodwill      = "goodwill"
+	ReasonCodeChargeback    = "chargeback"
+	ReasonCodeFraudRecovery = "fraud_recovery"
+	ReasonCodeFeeRefund     = "fee_refund"
 )
 
 type Transaction struct {
-	ID               int        `db:"id"`
-	SenderUserId     int        `db:"sender_user_id"`
-	SenderWalletId   int        `db:"sender_wallet_id"`
-	ReceiverUserId   int        `db:"receiver_user_id"`
-	ReceiverWalletId int        `db:"receiver_wallet_id"`
-	Amount           float64    `db:"amount"`
-	Type             string     `db:"type"`
-	CreationDate     time.Time  `db:"creation_date"`
-	UpdateDate       time.Time  `db:"update_date"`
-	DeletionDate     *time.Time `db:"deletion_date"`
+	ID               int            `db:"id"`
+	SenderUserId     int            `db:"sender_user_id"`
+	SenderWalletId   int            `db:"sender_wallet_id"`
+	ReceiverUserId   int            `db:"receiver_user_id"`
+	ReceiverWalletId int            `db:"receiver_wallet_id"`
+	Amount           money.Money    `db:"amount"`
+	Currency         money.Currency `db:"currency"`
+	// DestinationAmount, DestinationCurrency and ExchangeRate are only set on
+	// transfers between wallets of different currencies.
+	DestinationAmount   *money.Money    `db:"destination_amount"`
+	DestinationCurrency *money.Currency `db:"destination_currency"`
+	ExchangeRate        *money.Decimal  `db:"exchange_rate"`
+	// ReversalOf links a reversal to the transaction it compensates.
+	ReversalOf *int `db:"reversal_of"`
+	// FeeOf links a fee to the withdrawal or transfer it was charged on.
+	FeeOf *int `db:"fee_of"`
+	// ReasonCode is only set on manual credits and debits.
+	ReasonCode   *string    `db:"reason_code"`
+	Type         string     `db:"type"`
+	CreationDate time.Time  `db:"creation_date"`
+	UpdateDate   time.Time  `db:"update_date"`
+	DeletionDate *time.Time `db:"deletion_date"`
+}
+
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+// TransactionEntry is a transaction as seen from one of the user's wallets: the
+// wallet's ledger entry for it and the wallet balance right after it. A
+// transfer between two wallets of the same user yields an entry for each.
+type TransactionEntry struct {
+	Transaction
+	EntryId            int            `db:"entry_id"`
+	WalletId           int            `db:"wallet_id"`
+	EntryAmount        money.Money    `db:"entry_amount"`
+	EntryCurrency      money.Currency `db:"entry_currency"`
+	BalanceAfter       money.Money    `db:"balance_after"`
+	CounterpartyUserId *int           `db:"counterparty_user_id"`
+	Counterparty       *string        `db:"counterparty"`
+	// ReversedAmount is the part of the transaction that reversals have
+	// returned so far, in the transaction's currency.
+	ReversedAmount *money.Money `db:"reversed_amount"`
+}
+
+// Direction tells whether the entry moved money into or out of the wallet.
+func (e TransactionEntry) Direction() string {
+	if e.EntryAmount.IsNegative() {
+		return DirectionOutgoing
+	}
+	return DirectionIncoming
 }
 
+// TransactionFilter selects the entries of a user's transaction history. Zero
+// fields do not filter. Entries are returned newest first, starting below
+// BeforeEntryId when it is set.
+type TransactionFilter struct {
+	Type               string
+	Direction          string
+	From               *time.Time
+	To                 *time.Time
+	MinAmount          *money.Decimal
+	MaxAmount          *money.Decimal
+	CounterpartyUserId int
+	WalletId           int
+	BeforeEntryId      int
+	AfterEntryId       int
+	// OldestFirst lists the entries in the order they were made rather than
+	// newest first.
+	OldestFirst bool
+	Limit       int
+}
+
+// TransactionData is an entry of a wallet's history as version 1 of the API
+// shows it, keyed by the names of its Go fields. Later versions convert it to
+// objects of their own rather than change it.
 type TransactionData struct {
+	ID              int
 	Type            string
-	Amount          float64
-	Receiver        string
+	Direction       string
+	WalletId        int
+	Amount          money.Money
+	ConvertedAmount *money.Money   `json:",omitempty"`
+	ExchangeRate    *money.Decimal `json:",omitempty"`
+	Counterparty    *string        `json:",omitempty"`
+	ReversalOf      *int           `json:",omitempty"`
+	FeeOf           *int           `json:",omitempty"`
+	ReversedAmount  *money.Money   `json:",omitempty"`
+	Balance         money.Money
 	TransactionDate time.Time
 }
+
+// TransactionRecordData is a transaction as it is stored, seen from neither
+// side.
+type TransactionRecordData struct {
+	ID                  int             `json:"id"`
+	Type                string          `json:"type"`
+	SenderUserId        int             `json:"sender_user_id"`
+	SenderWalletId      int             `json:"sender_wallet_id"`
+	ReceiverUserId      int             `json:"receiver_user_id"`
+	ReceiverWalletId    int             `json:"receiver_wallet_id"`
+	Amount              money.Money     `json:"amount"`
+	Currency            money.Currency  `json:"currency"`
+	DestinationAmount   *money.Money    `json:"destination_amount,omitempty"`
+	DestinationCurrency *money.Currency `json:"destination_currency,omitempty"`
+	ExchangeRate        *money.Decimal  `json:"exchange_rate,omitempty"`
+	ReversalOf          *int            `json:"reversal_of,omitempty"`
+	FeeOf               *int            `json:"fee_of,omitempty"`
+	ReasonCode          *string         `json:"reason_code,omitempty"`
+	CreationDate        time.Time       `json:"creation_date"`
+}
+
+// RecordData describes the transaction as it is stored.
+func (t Transaction) RecordData() TransactionRecordData {
+	return TransactionRecordData{
+		ID:                  t.ID,
+		Type:                t.Type,
+		SenderUserId:        t.SenderUserId,
+		SenderWalletId:      t.SenderWalletId,
+		ReceiverUserId:      t.ReceiverUserId,
+		ReceiverWalletId:    t.ReceiverWalletId,
+		Amount:              t.Amount,
+		Currency:            t.Currency,
+		DestinationAmount:   t.DestinationAmount,
+		DestinationCurrency: t.DestinationCurrency,
+		ExchangeRate:        t.ExchangeRate,
+		ReversalOf:          t.ReversalOf,
+		FeeOf:               t.FeeOf,
+		ReasonCode:          t.ReasonCode,
+		CreationDate:        t.CreationDate,
+	}
+}
+
+// Adjustment is a manual credit or debit of a wallet by a member of staff,
+// who must give a reason code and may add a note.
+type Adjustment struct {
+	WalletId   int
+	Type       string
+	Amount     money.Money
+	ReasonCode string
+	Note       string
+}
+
+// Conversion is the exchange applied to a transfer between wallets of
+// different currencies: the amount credited to the receiver and the rate it
+// was converted at.
+type Conversion struct {
+	Rate   money.Decimal
+	Amount money.Money
+}
@@ -4,9 +4,54 @@ import (
 	"time"
 )
 
+const (
+	RoleUser = "user"
+	// RoleSupport, RoleOperator, RoleFinance, RoleAuditor and RoleAdmin are
+	// the staff roles, see HasPermission for what each may do.
+	RoleSupport  = "support"
+	RoleOperator = "operator"
+	RoleFinance  = "finance"
+	RoleAuditor  = "auditor"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
-	ID           int       `db:"id"`
-	Username     string    `db:"username"`
-	CreationDate time.Time `db:"creation_date"`
-	UpdateDate   time.Time `db:"update_date"`
+	ID           int        `db:"id"`
+	Username     string     `db:"username"`
+	DisplayName  string     `db:"display_name"`
+	Email        *string    `db:"email"`
+	Phone        *string    `db:"phone"`
+	Role         string     `db:"role"`
+	Status       string     `db:"status"`
+	CreationDate time.Time  `db:"creation_date"`
+	UpdateDate   time.Time  `db:"update_date"`
+	DeletionDate *time.Time `db:"deletion_date"`
+}
+
+type UserData struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	DisplayName  string    `json:"display_name"`
+	Email        *string   `json:"email"`
+	Phone        *string   `json:"phone"`
+	Role         string    `json:"role"`
+	Status       string    `json:"status"`
+	CreationDate time.Time `json:"creation_date"`
+}
+
+// UserDetailData is a user as staff see it.
+type UserDetailData struct {
+	UserData
+	DeletionDate *time.Time `json:"deletion_date"`
+}
+
+// RegistrationData answers a registration with the new user, their first
+// wallet and the tokens of their first session.
+type RegistrationData struct {
+	User         UserData   `json:"user"`
+	Wallet       WalletData `json:"wallet"`
+	AccessToken  string     `json:"access_token"`
+	TokenType    string     `json:"token_type"`
+	ExpiresIn    int        `json:"expires_in"`
+	RefreshToken string     `json:"refresh_token"`
 }
@@ -0,0 +1,29 @@
+// Package v2 holds the response objects of version 2 of the API that differ
+// from those of version 1. Objects the versions share stay in the model
+// package, whose encoding version 1 keeps as it was.
+package v2
+
+import (
+	"time"
+
+	"go-wallet-service/internal/money"
+)
+
+// TransactionData is an entry of a wallet's history. It has the fields of
+// model.TransactionData, which converts to it, under snake_case keys like
+// the other objects of the API.
+type TransactionData struct {
+	ID              int            `json:"id"`
+	Type            string         `json:"type"`
+	Direction       string         `json:"direction"`
+	WalletId        int            `json:"wallet_id"`
+	Amount          money.Money    `json:"amount"`
+	ConvertedAmount *money.Money   `json:"converted_amount,omitempty"`
+	ExchangeRate    *money.Decimal `json:"exchange_rate,omitempty"`
+	Counterparty    *string        `json:"counterparty,omitempty"`
+	ReversalOf      *int           `json:"reversal_of,omitempty"`
+	FeeOf           *int           `json:"fee_of,omitempty"`
+	ReversedAmount  *money.Money   `json:"reversed_amount,omitempty"`
+	Balance         money.Money    `json:"balance"`
+	TransactionDate time.Time      `json:"transaction_date"`
+}
@@ -2,13 +2,37 @@ package model
 
 import (
 	"time"
+
+	"go-wallet-service/internal/money"
 )
 
 type Wallet struct {
-	ID      		int			`db:"id"`
-	UserId     		int			`db:"user_id"`
-	Balance			float64 	`db:"balance"`
-	CreationDate	time.Time	`db:"creation_date"`
-	UpdateDate		time.Time	`db:"update_date"`
-	DeletionDate	*time.Time 	`db:"deletion_date"` 
-}
\ No newline at end of file
+	ID           int            `db:"id"`
+	UserId       int            `db:"user_id"`
+	Name         string         `db:"name"`
+	IsDefault    bool           `db:"is_default"`
+	Currency     money.Currency `db:"currency"`
+	Balance      money.Money    `db:"balance"`
+	Status       string         `db:"status"`
+	CreationDate time.Time      `db:"creation_date"`
+	UpdateDate   time.Time      `db:"update_date"`
+	DeletionDate *time.Time     `db:"deletion_date"`
+}
+
+type WalletData struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	IsDefault bool        `json:"is_default"`
+	Balance   money.Money `json:"balance"`
+	Currency  string      `json:"currency"`
+	Status    string      `json:"status"`
+}
+
+// WalletDetailData is a wallet as staff see it.
+type WalletDetailData struct {
+	WalletData
+	UserId           int         `json:"user_id"`
+	AvailableBalance money.Money `json:"available_balance"`
+	CreationDate     time.Time   `json:"creation_date"`
+	DeletionDate     *time.Time  `json:"deletion_date"`
+}
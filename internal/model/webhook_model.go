@@ -0,0 +1,149 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"go-wallet-service/internal/money"
+)
+
+// Types of the events written to the outbox and delivered to webhooks.
+const (
+	EventTypeWalletDeposited     = "wallet.deposited"
+	EventTypeWalletWithdrawn     = "wallet.withdrawn"
+	EventTypeWalletTransferred   = "wallet.transferred"
+	EventTypeWalletAdjusted      = "wallet.adjusted"
+	EventTypeTransactionReversed = "transaction.reversed"
+	EventTypeWalletStatusChanged = "wallet.status_changed"
+	EventTypeUserStatusChanged   = "user.status_changed"
+)
+
+var EventTypes = []string{
+	EventTypeWalletDeposited,
+	EventTypeWalletWithdrawn,
+	EventTypeWalletTransferred,
+	EventTypeWalletAdjusted,
+	EventTypeTransactionReversed,
+	EventTypeWalletStatusChanged,
+	EventTypeUserStatusChanged,
+}
+
+// IsEventType tells whether events of eventType are published.
+func IsEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+// MaxWebhookAttempts is how many times an event is sent to an endpoint before
+// its delivery is given up as dead.
+const MaxWebhookAttempts = 8
+
+// OutboxEvent is a change written in the same database transaction as the
+// change itself, so an event is published if and only if the change commits.
+// Payload holds the JSON object describing it.
+type OutboxEvent struct {
+	ID           int       `db:"id"`
+	Type         string    `db:"type"`
+	Payload      string    `db:"payload"`
+	CreationDate time.Time `db:"creation_date"`
+}
+
+// WebhookEndpoint receives the events of EventTypes, or of every type when
+// it is empty, signed with Secret.
+type WebhookEndpoint struct {
+	ID           int            `db:"id"`
+	URL          string         `db:"url"`
+	Secret       string         `db:"secret"`
+	EventTypes   pq.StringArray `db:"event_types"`
+	Description  string         `db:"description"`
+	Active       bool           `db:"active"`
+	CreationDate time.Time      `db:"creation_date"`
+	UpdateDate   time.Time      `db:"update_date"`
+}
+
+// WebhookDelivery is the sending of one event to one endpoint. A pending
+// delivery is sent on NextAttemptDate, and again with a growing delay after
+// every failed attempt until it is delivered or dead. It is claimed by one
+// dispatcher at a time until ClaimedUntil.
+type WebhookDelivery struct {
+	ID              int        `db:"id"`
+	EndpointId      int        `db:"endpoint_id"`
+	EventId         int        `db:"event_id"`
+	Status          string     `db:"status"`
+	Attempts        int        `db:"attempts"`
+	NextAttemptDate time.Time  `db:"next_attempt_date"`
+	ClaimedUntil    *time.Time `db:"claimed_until"`
+	LastStatusCode  *int       `db:"last_status_code"`
+	LastError       *string    `db:"last_error"`
+	DeliveryDate    *time.Time `db:"delivery_date"`
+	CreationDate    time.Time  `db:"creation_date"`
+	UpdateDate      time.Time  `db:"update_date"`
+}
+
+// WebhookAttempt is the outcome of sending a delivery once. StatusCode is
+// zero when no response came back.
+type WebhookAttempt struct {
+	StatusCode int
+	Error      string
+}
+
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// EventData is the body of a webhook request.
+type EventData struct {
+	ID           int             `json:"id"`
+	Type         string          `json:"type"`
+	CreationDate time.Time       `json:"creation_date"`
+	Data         json.RawMessage `json:"data"`
+}
+
+// MovementEventData describes a movement of money: the transaction and the
+// balances it left the wallets it moved money between with.
+type MovementEventData struct {
+	Transaction TransactionRecordData `json:"transaction"`
+	Wallets     []WalletBalanceData   `json:"wallets"`
+}
+
+type WalletBalanceData struct {
+	WalletId int            `json:"wallet_id"`
+	UserId   int            `json:"user_id"`
+	Balance  money.Money    `json:"balance"`
+	Currency money.Currency `json:"currency"`
+}
+
+type WebhookEndpointData struct {
+	ID           int       `json:"id"`
+	URL          string    `json:"url"`
+	Secret       string    `json:"secret,omitempty"`
+	EventTypes   []string  `json:"event_types"`
+	Description  string    `json:"description"`
+	Active       bool      `json:"active"`
+	CreationDate time.Time `json:"creation_date"`
+}
+
+type WebhookDeliveryData struct {
+	ID              int        `json:"id"`
+	EndpointId      int        `json:"endpoint_id"`
+	EventId         int        `json:"event_id"`
+	Status          string     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	NextAttemptDate *time.Time `json:"next_attempt_date,omitempty"`
+	LastStatusCode  *int       `json:"last_status_code,omitempty"`
+	LastError       *string    `json:"last_error,omitempty"`
+	DeliveryDate    *time.Time `json:"delivery_date,omitempty"`
+	CreationDate    time.Time  `json:"creation_date"`
+}
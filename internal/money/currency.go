@@ -0,0 +1,62 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+
+	"go-wallet-service/utils"
+)
+
+var ErrUnknownCurrency = utils.Invalid("unknown_currency", "unknown currency")
+
+// Currency is an ISO 4217 alphabetic currency code.
+type Currency string
+
+// DefaultCurrency is the currency of every wallet that does not carry one.
+const DefaultCurrency Currency = "USD"
+
+// exponents holds the number of minor unit digits of every supported currency.
+var exponents = map[Currency]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"IDR": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MYR": 2,
+	"NZD": 2,
+	"PHP": 2,
+	"SGD": 2,
+	"THB": 2,
+	"USD": 2,
+	"VND": 0,
+}
+
+func ParseCurrency(code string) (Currency, error) {
+	currency := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if _, ok := exponents[currency]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return currency, nil
+}
+
+// Exponent returns the number of minor unit digits of the currency, e.g. 2 for
+// USD (cents) and 0 for JPY.
+func (c Currency) Exponent() int {
+	exponent, ok := exponents[c]
+	if !ok {
+		panic(fmt.Sprintf("money: unknown currency %q", string(c)))
+	}
+	return exponent
+}
+
+func (c Currency) String() string {
+	return string(c)
+}
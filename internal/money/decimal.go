@@ -0,0 +1,292 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrInvalidAmount = utils.Invalid("invalid_amount", "invalid amount")
+	ErrOverflow      = utils.Invalid("amount_out_of_range", "amount out of range")
+)
+
+// maxScale bounds the number of fraction digits a Decimal can carry.
+const maxScale = 18
+
+// RoundingMode selects how digits dropped by Decimal.Round affect the result.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest value and ties to the even neighbour
+	// (banker's rounding). It is the default for every computed amount.
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest value and ties away from zero.
+	RoundHalfUp
+	// RoundDown truncates toward zero.
+	RoundDown
+	// RoundUp rounds away from zero whenever any dropped digit is non zero.
+	RoundUp
+)
+
+// Decimal is an exact base 10 number: Unscaled * 10^-Scale. Amounts are decoded
+// from JSON into a Decimal so they never pass through a float64.
+type Decimal struct {
+	unscaled int64
+	scale    int
+}
+
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{unscaled: unscaled, scale: scale}.normalize()
+}
+
+// ParseDecimal parses a plain or exponent notation decimal such as "12.50",
+// "-3" or "1.5e2". Trailing fraction zeros are not significant.
+func ParseDecimal(value string) (Decimal, error) {
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("%w: empty value", ErrInvalidAmount)
+	}
+
+	exponent := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || e > maxScale || e < -maxScale {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+		}
+		exponent = e
+		s = s[:i]
+	}
+
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	integer, fraction, _ := strings.Cut(s, ".")
+	if integer == "" && fraction == "" || !isDigits(integer) || !isDigits(fraction) {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+
+	unscaled, ok := new(big.Int).SetString(integer+fraction, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	if negative {
+		unscaled.Neg(unscaled)
+	}
+
+	scale := len(fraction) - exponent
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	return fromBig(unscaled, scale)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func fromBig(unscaled *big.Int, scale int) (Decimal, error) {
+	unscaled = new(big.Int).Set(unscaled)
+	ten := big.NewInt(10)
+	remainder := new(big.Int)
+	for scale > 0 {
+		quotient, r := new(big.Int).QuoRem(unscaled, ten, remainder)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled = quotient
+		scale--
+	}
+
+	if scale > maxScale || !unscaled.IsInt64() {
+		return Decimal{}, ErrOverflow
+	}
+	return Decimal{unscaled: unscaled.Int64(), scale: scale}, nil
+}
+
+func (d Decimal) normalize() Decimal {
+	for d.scale > 0 && d.unscaled%10 == 0 {
+		d.unscaled /= 10
+		d.scale--
+	}
+	return d
+}
+
+// Scale returns the number of significant fraction digits.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+func (d Decimal) Sign() int {
+	switch {
+	case d.unscaled > 0:
+		return 1
+	case d.unscaled < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func (d Decimal) IsZero() bool {
+	return d.unscaled == 0
+}
+
+// Cmp compares d and other and returns -1, 0 or +1.
+func (d Decimal) Cmp(other Decimal) int {
+	return d.rat().Cmp(other.rat())
+}
+
+// Mul returns the exact product of d and other.
+func (d Decimal) Mul(other Decimal) (Decimal, error) {
+	product := new(big.Int).Mul(big.NewInt(d.unscaled), big.NewInt(other.unscaled))
+	return fromBig(product, d.scale+other.scale)
+}
+
+// Round returns d with at most scale fraction digits, applying mode to the
+// dropped digits.
+func (d Decimal) Round(scale int, mode RoundingMode) (Decimal, error) {
+	if d.scale <= scale {
+		return d, nil
+	}
+
+	quotient := divide(big.NewInt(d.unscaled), pow10(d.scale-scale), mode)
+	return fromBig(quotient, scale)
+}
+
+// divide returns dividend / divisor for a positive divisor, rounding the
+// dropped fraction with mode.
+func divide(dividend *big.Int, divisor *big.Int, mode RoundingMode) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(dividend, divisor, new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	// twice the remainder against the divisor tells below, at or above half
+	half := new(big.Int).Abs(remainder)
+	half.Mul(half, big.NewInt(2))
+	away := false
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		away = true
+	case RoundHalfUp:
+		away = half.Cmp(divisor) >= 0
+	case RoundHalfEven:
+		c := half.Cmp(divisor)
+		away = c > 0 || c == 0 && quotient.Bit(0) == 1
+	}
+	if away {
+		quotient.Add(quotient, big.NewInt(int64(dividend.Sign())))
+	}
+	return quotient
+}
+
+// scaledTo returns the unscaled value of d expressed with exactly scale
+// fraction digits. It fails when d carries more precision than scale allows.
+func (d Decimal) scaledTo(scale int) (int64, error) {
+	if d.scale > scale {
+		return 0, ErrTooPrecise
+	}
+	unscaled := new(big.Int).Mul(big.NewInt(d.unscaled), pow10(scale-d.scale))
+	if !unscaled.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return unscaled.Int64(), nil
+}
+
+func (d Decimal) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(d.unscaled), pow10(d.scale))
+}
+
+func (d Decimal) String() string {
+	return formatUnscaled(d.unscaled, d.scale)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding a decimal.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	value := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidAmount, data)
+		}
+	}
+
+	parsed, err := ParseDecimal(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores the decimal as its exact string form, which NUMERIC columns
+// accept without rounding.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Decimal) Scan(src interface{}) error {
+	var value string
+	switch v := src.(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	case int64:
+		*d = NewDecimal(v, 0)
+		return nil
+	default:
+		return fmt.Errorf("money: cannot scan %T into a decimal", src)
+	}
+
+	parsed, err := ParseDecimal(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func formatUnscaled(unscaled int64, scale int) string {
+	digits := new(big.Int).Abs(big.NewInt(unscaled)).String()
+	sign := ""
+	if unscaled < 0 {
+		sign = "-"
+	}
+	if scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
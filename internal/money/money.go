@@ -0,0 +1,217 @@
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrTooPrecise       = utils.Invalid("amount_too_precise", "amount has more decimal places than the currency allows")
+	ErrCurrencyMismatch = utils.Invalid("currency_mismatch", "currency mismatch")
+)
+
+// Money is an exact amount of a currency, held as an integer number of minor
+// units (cents for USD). It is stored as a BIGINT and encoded in JSON as a
+// decimal number with the currency's number of fraction digits.
+type Money struct {
+	Amount   int64
+	Currency Currency
+}
+
+// New returns amount minor units of currency. An empty currency is the default
+// currency.
+func New(amount int64, currency Currency) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{Amount: amount, Currency: currency}
+}
+
+// FromDecimal converts a decoded decimal into money of the given currency. It
+// never rounds: amounts with more fraction digits than the currency allows are
+// rejected with ErrTooPrecise.
+func FromDecimal(d Decimal, currency Currency) (Money, error) {
+	amount, err := d.scaledTo(currency.Exponent())
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %s %s", err, d.String(), currency)
+	}
+	return New(amount, currency), nil
+}
+
+// RoundDecimal converts a computed decimal into money of the given currency,
+// rounding any excess fraction digits with mode.
+func RoundDecimal(d Decimal, currency Currency, mode RoundingMode) (Money, error) {
+	rounded, err := d.Round(currency.Exponent(), mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return FromDecimal(rounded, currency)
+}
+
+// Parse parses a decimal string such as "12.34" as money of the given currency.
+func Parse(value string, currency Currency) (Money, error) {
+	d, err := ParseDecimal(value)
+	if err != nil {
+		return Money{}, err
+	}
+	return FromDecimal(d, currency)
+}
+
+// Decimal returns the amount in major units.
+func (m Money) Decimal() Decimal {
+	return NewDecimal(m.Amount, m.currency().Exponent())
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.assertSameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	if other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount ||
+		other.Amount < 0 && m.Amount < math.MinInt64-other.Amount {
+		return Money{}, ErrOverflow
+	}
+	return New(m.Amount+other.Amount, m.currency()), nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(New(-other.Amount, other.currency()))
+}
+
+// Cmp compares two amounts of the same currency and returns -1, 0 or +1.
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.assertSameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// LessThan reports whether m is smaller than other. Amounts of different
+// currencies are never comparable and report false.
+func (m Money) LessThan(other Money) bool {
+	c, err := m.Cmp(other)
+	return err == nil && c < 0
+}
+
+// Mul multiplies the amount by factor and rounds the result back to the
+// currency's minor unit with mode.
+func (m Money) Mul(factor Decimal, mode RoundingMode) (Money, error) {
+	product, err := m.Decimal().Mul(factor)
+	if err != nil {
+		return Money{}, err
+	}
+	return RoundDecimal(product, m.currency(), mode)
+}
+
+// Convert exchanges the amount into currency at rate, the number of units of
+// currency bought by one unit of m's currency, rounding the result with mode.
+func (m Money) Convert(rate Decimal, currency Currency, mode RoundingMode) (Money, error) {
+	if rate.Sign() <= 0 {
+		return Money{}, fmt.Errorf("%w: exchange rate %s", ErrInvalidAmount, rate)
+	}
+	converted, err := m.Decimal().Mul(rate)
+	if err != nil {
+		return Money{}, err
+	}
+	return RoundDecimal(converted, currency, mode)
+}
+
+// Prorate returns the share numerator/denominator of the amount, rounded to
+// the minor unit with mode. The denominator must be positive.
+func (m Money) Prorate(numerator int64, denominator int64, mode RoundingMode) (Money, error) {
+	if denominator <= 0 {
+		return Money{}, fmt.Errorf("%w: denominator %d", ErrInvalidAmount, denominator)
+	}
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(numerator))
+	share := divide(product, big.NewInt(denominator), mode)
+	if !share.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return New(share.Int64(), m.currency()), nil
+}
+
+func (m Money) Neg() Money {
+	return New(-m.Amount, m.currency())
+}
+
+func (m Money) assertSameCurrency(other Money) error {
+	if m.currency() != other.currency() {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency(), other.currency())
+	}
+	return nil
+}
+
+// currency treats the zero value as the default currency, so money scanned
+// from a column without a currency stays usable.
+func (m Money) currency() Currency {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// String formats the amount in major units with every minor unit digit, e.g.
+// "12.30" for 1230 USD cents.
+func (m Money) String() string {
+	return formatUnscaled(m.Amount, m.currency().Exponent())
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Value stores the amount as its integer minor units.
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan reads integer minor units. A money without a currency is given the
+// default currency; callers that know better overwrite it after scanning.
+func (m *Money) Scan(src interface{}) error {
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+
+	switch v := src.(type) {
+	case int64:
+		m.Amount = v
+	case []byte:
+		d, err := ParseDecimal(string(v))
+		if err != nil {
+			return err
+		}
+		amount, err := d.scaledTo(0)
+		if err != nil {
+			return err
+		}
+		m.Amount = amount
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return nil
+}
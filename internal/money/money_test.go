@@ -0,0 +1,157 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency Currency
+		amount   int64
+		err      error
+	}{
+		{"12.34", "USD", 1234, nil},
+		{"12.3", "USD", 1230, nil},
+		{"12", "USD", 1200, nil},
+		{"12.340000", "USD", 1234, nil},
+		{"-0.01", "USD", -1, nil},
+		{"1.5e2", "USD", 15000, nil},
+		{"12.345", "USD", 0, ErrTooPrecise},
+		{"0.001", "USD", 0, ErrTooPrecise},
+		{"500", "JPY", 500, nil},
+		{"500.5", "JPY", 0, ErrTooPrecise},
+		{"1.234", "KWD", 1234, nil},
+		{"abc", "USD", 0, ErrInvalidAmount},
+		{"1.2.3", "USD", 0, ErrInvalidAmount},
+		{"", "USD", 0, ErrInvalidAmount},
+		{"99999999999999999999", "USD", 0, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		m, err := Parse(tt.value, tt.currency)
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, New(tt.amount, tt.currency), m, tt.value)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		value string
+		mode  RoundingMode
+		want  string
+	}{
+		{"1.005", RoundHalfEven, "1"},
+		{"1.015", RoundHalfEven, "1.02"},
+		{"1.025", RoundHalfEven, "1.02"},
+		{"1.0251", RoundHalfEven, "1.03"},
+		{"-1.025", RoundHalfEven, "-1.02"},
+		{"1.005", RoundHalfUp, "1.01"},
+		{"-1.005", RoundHalfUp, "-1.01"},
+		{"1.009", RoundDown, "1"},
+		{"-1.009", RoundDown, "-1"},
+		{"1.001", RoundUp, "1.01"},
+		{"1.2", RoundHalfEven, "1.2"},
+	}
+
+	for _, tt := range tests {
+		d, err := ParseDecimal(tt.value)
+		assert.NoError(t, err)
+		rounded, err := d.Round(2, tt.mode)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, rounded.String(), tt.value)
+	}
+}
+
+func TestMul(t *testing.T) {
+	rate, err := ParseDecimal("0.015")
+	assert.NoError(t, err)
+
+	fee, err := New(1050, "USD").Mul(rate, RoundHalfEven)
+	assert.NoError(t, err)
+	assert.Equal(t, New(16, "USD"), fee)
+
+	fee, err = New(1050, "USD").Mul(rate, RoundDown)
+	assert.NoError(t, err)
+	assert.Equal(t, New(15, "USD"), fee)
+}
+
+func TestConvert(t *testing.T) {
+	rate, err := ParseDecimal("0.9215")
+	assert.NoError(t, err)
+
+	euros, err := New(1050, "USD").Convert(rate, "EUR", RoundHalfEven)
+	assert.NoError(t, err)
+	assert.Equal(t, New(968, "EUR"), euros)
+
+	rate, err = ParseDecimal("151.37")
+	assert.NoError(t, err)
+
+	yen, err := New(1050, "USD").Convert(rate, "JPY", RoundHalfEven)
+	assert.NoError(t, err)
+	assert.Equal(t, New(1589, "JPY"), yen)
+
+	_, err = New(1050, "USD").Convert(NewDecimal(0, 0), "EUR", RoundHalfEven)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestProrate(t *testing.T) {
+	share, err := New(968, "EUR").Prorate(525, 1050, RoundHalfEven)
+	assert.NoError(t, err)
+	assert.Equal(t, New(484, "EUR"), share)
+
+	share, err = New(1001, "EUR").Prorate(1, 2, RoundHalfEven)
+	assert.NoError(t, err)
+	assert.Equal(t, New(500, "EUR"), share)
+
+	share, err = New(1001, "EUR").Prorate(1, 2, RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Equal(t, New(501, "EUR"), share)
+
+	_, err = New(1001, "EUR").Prorate(1, 0, RoundHalfEven)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestArithmetic(t *testing.T) {
+	sum, err := New(150, "USD").Add(New(275, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, New(425, "USD"), sum)
+
+	difference, err := sum.Sub(New(500, "USD"))
+	assert.NoError(t, err)
+	assert.True(t, difference.IsNegative())
+
+	_, err = New(1, "USD").Add(New(1, "EUR"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	assert.False(t, New(1, "USD").LessThan(New(2, "EUR")))
+}
+
+func TestJSON(t *testing.T) {
+	var params struct {
+		Amount Decimal `json:"amount"`
+	}
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount": 19.99}`), &params))
+	m, err := FromDecimal(params.Amount, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1999), m.Amount)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount": "0.10"}`), &params))
+	m, err = FromDecimal(params.Amount, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), m.Amount)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount": "ten"}`), &params))
+
+	encoded, err := json.Marshal(map[string]Money{"balance": New(1230, "USD"), "yen": New(500, "JPY")})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"balance": 12.30, "yen": 500}`, string(encoded))
+	assert.Contains(t, string(encoded), "12.30")
+}
@@ -0,0 +1,18 @@
+package object
+
+import "go-wallet-service/internal/money"
+
+// StatusParams changes the status of a user or wallet.
+type StatusParams struct {
+	Status string `json:"status" binding:"required,oneof=active frozen suspended closed"`
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// AdjustmentParams credits or debits a wallet by hand.
+type AdjustmentParams struct {
+	Type       string        `json:"type" binding:"required,oneof=credit debit"`
+	Amount     money.Decimal `json:"amount" binding:"required,min=0,max=10000000"`
+	Currency   string        `json:"currency" binding:"currency"`
+	ReasonCode string        `json:"reason_code" binding:"required,oneof=correction goodwill chargeback fraud_recovery fee_refund"`
+	Note       string        `json:"note" binding:"max=255"`
+}
@@ -0,0 +1,18 @@
+package object
+
+import "go-wallet-service/internal/money"
+
+type HoldParams struct {
+	UserId           int           `json:"user_id"`
+	Amount           money.Decimal `json:"amount" binding:"required,min=0,max=10000000"`
+	Currency         string        `json:"currency" binding:"currency"`
+	ExpiresIn        int64         `json:"expires_in"`
+	ReceiverUserId   int           `json:"receiver_user_id"`
+	ReceiverWalletId *int          `json:"receiver_wallet_id"`
+}
+
+type CaptureParams struct {
+	UserId   int            `json:"user_id"`
+	Amount   *money.Decimal `json:"amount" binding:"min=0,max=10000000"`
+	Currency string         `json:"currency" binding:"currency"`
+}
@@ -0,0 +1,29 @@
+package object
+
+import (
+	"time"
+
+	"go-wallet-service/internal/money"
+)
+
+type ScheduleParams struct {
+	UserId           int           `json:"user_id"`
+	SenderWalletId   *int          `json:"sender_wallet_id"`
+	ReceiverUserId   int           `json:"receiver_user_id"`
+	ReceiverWalletId *int          `json:"receiver_wallet_id"`
+	Amount           money.Decimal `json:"amount" binding:"required,min=0,max=10000000"`
+	Currency         string        `json:"currency" binding:"currency"`
+	StartDate        time.Time     `json:"start_date" binding:"required"`
+	Recurrence       string        `json:"recurrence" binding:"oneof=once daily weekly monthly"`
+	DayOfMonth       *int          `json:"day_of_month" binding:"min=1,max=31"`
+}
+
+type UpdateScheduleParams struct {
+	UserId      int            `json:"user_id"`
+	Amount      *money.Decimal `json:"amount" binding:"min=0,max=10000000"`
+	Currency    string         `json:"currency" binding:"currency"`
+	NextRunDate *time.Time     `json:"next_run_date"`
+	Recurrence  *string        `json:"recurrence" binding:"oneof=once daily weekly monthly"`
+	DayOfMonth  *int           `json:"day_of_month" binding:"min=1,max=31"`
+	Status      *string        `json:"status" binding:"oneof=active paused"`
+}
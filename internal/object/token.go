@@ -0,0 +1,10 @@
+package object
+
+type TokenParams struct {
+	GrantType    string `json:"grant_type" binding:"required,oneof=refresh_token"`
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type RevokeParams struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,9 @@
+package object
+
+import "go-wallet-service/internal/money"
+
+type ReversalParams struct {
+	UserId *int           `json:"user_id"`
+	Amount *money.Decimal `json:"amount" binding:"min=0,max=10000000"`
+	Force  bool           `json:"force"`
+}
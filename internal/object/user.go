@@ -1,11 +1,34 @@
 package object
 
+import "go-wallet-service/internal/money"
+
 type TransferParams struct {
-	UserId         int     `json:"user_id"`
-	ReceiverUserId int     `json:"receiver_user_id"`
-	Amount         float64 `json:"amount" binding:"required,min=0,max=10000000"`
+	UserId           int           `json:"user_id" binding:"required"`
+	SenderWalletId   *int          `json:"sender_wallet_id"`
+	ReceiverUserId   int           `json:"receiver_user_id"`
+	ReceiverWalletId *int          `json:"receiver_wallet_id"`
+	Amount           money.Decimal `json:"amount" binding:"required,min=0,max=10000000"`
+	Currency         string        `json:"currency" binding:"currency"`
 }
 
 type UserParams struct {
 	UserId int `json:"user_id"`
 }
+
+type RegisterParams struct {
+	Username    string `json:"username" binding:"required,min=3,max=64,username"`
+	DisplayName string `json:"display_name" binding:"max=255"`
+	Email       string `json:"email" binding:"max=255,email"`
+	Phone       string `json:"phone" binding:"phone"`
+	WalletName  string `json:"wallet_name" binding:"max=255"`
+	Currency    string `json:"currency" binding:"currency"`
+}
+
+// ProfileParams changes the fields it sets; an empty email or phone removes
+// it from the profile.
+type ProfileParams struct {
+	UserId      int     `json:"user_id"`
+	DisplayName *string `json:"display_name" binding:"max=255"`
+	Email       *string `json:"email" binding:"max=255,email"`
+	Phone       *string `json:"phone" binding:"phone"`
+}
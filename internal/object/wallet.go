@@ -1,7 +1,9 @@
 package object
 
+import "go-wallet-service/internal/money"
+
 type OAuthParams struct {
-	UserId int `json:"user_id" binding:"required"`
+	UserId *int `json:"user_id"`
 }
 
 type BalanceParams struct {
@@ -9,11 +11,26 @@ type BalanceParams struct {
 }
 
 type DepositParams struct {
-	UserId int     `json:"user_id" binding:"required"`
-	Amount float64 `json:"amount" binding:"required,min=0,max=10000000"`
+	UserId   int           `json:"user_id" binding:"required"`
+	Amount   money.Decimal `json:"amount" binding:"required,min=0,max=10000000"`
+	Currency string        `json:"currency" binding:"currency"`
 }
 
 type WithdrawParams struct {
-	UserId int     `json:"user_id" binding:"required"`
-	Amount float64 `json:"amount" binding:"required,min=0,max=10000000"`
+	UserId   int           `json:"user_id" binding:"required"`
+	Amount   money.Decimal `json:"amount" binding:"required,min=0,max=10000000"`
+	Currency string        `json:"currency" binding:"currency"`
+}
+
+type CreateWalletParams struct {
+	UserId    int    `json:"user_id"`
+	Name      string `json:"name" binding:"required,max=255"`
+	Currency  string `json:"currency" binding:"currency"`
+	IsDefault bool   `json:"is_default"`
+}
+
+type WalletParams struct {
+	UserId    int     `json:"user_id"`
+	Name      *string `json:"name" binding:"max=255"`
+	IsDefault *bool   `json:"is_default"`
 }
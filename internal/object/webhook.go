@@ -0,0 +1,9 @@
+package object
+
+// WebhookParams registers a webhook endpoint. It receives every type of
+// event when event_types is left out.
+type WebhookParams struct {
+	URL         string   `json:"url" binding:"required,max=2048,webhook_url"`
+	EventTypes  []string `json:"event_types" binding:"event_types"`
+	Description string   `json:"description" binding:"max=255"`
+}
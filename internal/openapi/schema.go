@@ -0,0 +1,244 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const componentPrefix = "#/components/schemas/"
+
+// Schema is the subset of the OpenAPI schema object that the types of the
+// API need.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	AllOf       []*Schema          `json:"allOf,omitempty"`
+}
+
+// Ref refers to the component schema called name.
+func Ref(name string) *Schema {
+	return &Schema{Ref: componentPrefix + name}
+}
+
+// RuleFunc narrows the schema of a field to the values a binding rule
+// accepts. param is what follows the rule's "=" in the tag, if anything.
+type RuleFunc func(schema *Schema, param string) error
+
+var rules = map[string]RuleFunc{
+	// required is a property of the object, which adds the field to its
+	// required list
+	"required": func(*Schema, string) error { return nil },
+	"min": func(schema *Schema, param string) error {
+		return bound(schema, param, &schema.Minimum, &schema.MinLength, &schema.MinItems)
+	},
+	"max": func(schema *Schema, param string) error {
+		return bound(schema, param, &schema.Maximum, &schema.MaxLength, &schema.MaxItems)
+	},
+	"oneof": func(schema *Schema, param string) error {
+		schema.Enum = nil
+		for _, option := range strings.Fields(param) {
+			if schema.Type != "integer" {
+				schema.Enum = append(schema.Enum, option)
+				continue
+			}
+			value, err := strconv.Atoi(option)
+			if err != nil {
+				return fmt.Errorf("oneof option %q is not an integer", option)
+			}
+			schema.Enum = append(schema.Enum, value)
+		}
+		return nil
+	},
+}
+
+// RegisterRule describes a binding rule registered with the validator, which
+// documents cannot describe fields using otherwise. Rules must be registered
+// before documents are generated.
+func RegisterRule(rule string, describe RuleFunc) {
+	rules[rule] = describe
+}
+
+var types = map[reflect.Type]Schema{
+	reflect.TypeOf(time.Time{}):          {Type: "string", Format: "date-time"},
+	reflect.TypeOf(json.RawMessage(nil)): {},
+}
+
+// RegisterType sets the schema of a type that encodes itself as JSON, and
+// whose fields therefore say nothing of how it looks.
+func RegisterType(t reflect.Type, schema Schema) {
+	types[t] = schema
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the JSON encoding of t. Named structs are
+// added to the components of the document and referred to.
+func (d *Document) SchemaOf(t reflect.Type) (*Schema, error) {
+	if schema, ok := types[t]; ok {
+		return &schema, nil
+	}
+	if t.Kind() == reflect.Pointer {
+		schema, err := d.SchemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if schema.Ref != "" {
+			return &Schema{AllOf: []*Schema{schema}, Nullable: true}, nil
+		}
+		schema.Nullable = true
+		return schema, nil
+	}
+	if t.Implements(jsonMarshaler) || t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler) {
+		return nil, fmt.Errorf("%s encodes itself and has no registered schema", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := d.SchemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.objectOf(t)
+		}
+		return d.component(t)
+	}
+	return nil, fmt.Errorf("%s has no JSON schema", t)
+}
+
+// component refers to the schema of the named struct t, adding it to the
+// components of the document the first time.
+func (d *Document) component(t reflect.Type) (*Schema, error) {
+	ref := Ref(t.Name())
+	if known, ok := d.componentTypes[t.Name()]; ok {
+		if known != t {
+			return nil, fmt.Errorf("%s and %s are both named %s", known, t, t.Name())
+		}
+		return ref, nil
+	}
+
+	// known before its fields are, so a type can refer to itself
+	d.componentTypes[t.Name()] = t
+	schema, err := d.objectOf(t)
+	if err != nil {
+		delete(d.componentTypes, t.Name())
+		return nil, err
+	}
+	d.Components.Schemas[t.Name()] = schema
+	return ref, nil
+}
+
+// objectOf describes the fields of struct t the way encoding/json encodes
+// them, narrowed by the rules of their binding tags.
+func (d *Document) objectOf(t reflect.Type) (*Schema, error) {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	if err := d.addFields(schema, t); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func (d *Document) addFields(schema *Schema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := d.addFields(schema, field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := d.SchemaOf(field.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t, field.Name, err)
+		}
+		if tag := field.Tag.Get("binding"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				rule, param, _ := strings.Cut(rule, "=")
+				describe, ok := rules[rule]
+				if !ok {
+					return fmt.Errorf("%s.%s: no schema for binding rule %q", t, field.Name, rule)
+				}
+				if err := describe(property, param); err != nil {
+					return fmt.Errorf("%s.%s: %w", t, field.Name, err)
+				}
+				if rule == "required" {
+					schema.Required = append(schema.Required, name)
+				}
+			}
+		}
+		schema.Properties[name] = property
+	}
+	return nil
+}
+
+// bound sets the bound of a min or max rule on what the validator compares
+// it with: the value of a number, and the length of a string or array.
+func bound(schema *Schema, param string, value **float64, length **int, items **int) error {
+	switch schema.Type {
+	case "integer", "number":
+		parsed, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return fmt.Errorf("bound %q is not a number", param)
+		}
+		*value = &parsed
+		return nil
+	case "string", "array":
+		parsed, err := strconv.Atoi(param)
+		if err != nil {
+			return fmt.Errorf("length %q is not an integer", param)
+		}
+		if schema.Type == "string" {
+			*length = &parsed
+		} else {
+			*items = &parsed
+		}
+		return nil
+	}
+	return fmt.Errorf("a %q schema has no bounds", schema.Type)
+}
@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type amount struct{ value string }
+
+func (a amount) MarshalJSON() ([]byte, error) { return []byte(a.value), nil }
+
+type transferParams struct {
+	ReceiverUserId   int       `json:"receiver_user_id" binding:"required"`
+	ReceiverWalletId *int      `json:"receiver_wallet_id"`
+	Amount           amount    `json:"amount" binding:"required,min=0,max=10000000"`
+	Note             string    `json:"note" binding:"max=255"`
+	Recurrence       *string   `json:"recurrence" binding:"oneof=once daily"`
+	Tags             []string  `json:"tags" binding:"max=3"`
+	StartDate        time.Time `json:"start_date"`
+	Internal         bool      `json:"-"`
+	hidden           bool
+}
+
+type walletData struct {
+	ID      int    `json:"id"`
+	Balance amount `json:"balance"`
+}
+
+type walletDetailData struct {
+	walletData
+	UserId   int         `json:"user_id"`
+	Previous *walletData `json:"previous"`
+}
+
+type entryData struct {
+	ID   int
+	Note *string `json:",omitempty"`
+}
+
+func newTestDocument() *Document {
+	RegisterType(reflect.TypeOf(amount{}), Schema{Type: "number"})
+	return NewDocument(Info{Title: "test", Version: "1"})
+}
+
+func TestSchemaOfParamsFollowsBindingRules(t *testing.T) {
+	document := newTestDocument()
+
+	ref, err := document.SchemaOf(reflect.TypeOf(transferParams{}))
+	if err != nil {
+		t.Fatalf("Failed to describe params: %v", err)
+	}
+
+	schema := document.Resolve(ref)
+	assert.Equal(t, componentPrefix+"transferParams", ref.Ref)
+	assert.Equal(t, []string{"receiver_user_id", "amount"}, schema.Required)
+	assert.Equal(t, []string{"amount", "note", "receiver_user_id", "receiver_wallet_id", "recurrence", "start_date", "tags"}, keys(schema.Properties))
+
+	assert.Equal(t, &Schema{Type: "integer", Nullable: true}, schema.Properties["receiver_wallet_id"])
+	assert.Equal(t, 0.0, *schema.Properties["amount"].Minimum)
+	assert.Equal(t, 10000000.0, *schema.Properties["amount"].Maximum)
+	assert.Equal(t, 255, *schema.Properties["note"].MaxLength)
+	assert.Equal(t, []any{"once", "daily"}, schema.Properties["recurrence"].Enum)
+	assert.True(t, schema.Properties["recurrence"].Nullable)
+	assert.Equal(t, 3, *schema.Properties["tags"].MaxItems)
+	assert.Equal(t, "date-time", schema.Properties["start_date"].Format)
+}
+
+func TestSchemaOfFlattensEmbeddedStructs(t *testing.T) {
+	document := newTestDocument()
+
+	ref, err := document.SchemaOf(reflect.TypeOf(walletDetailData{}))
+	if err != nil {
+		t.Fatalf("Failed to describe wallet: %v", err)
+	}
+
+	schema := document.Resolve(ref)
+	assert.Equal(t, []string{"balance", "id", "previous", "user_id"}, keys(schema.Properties))
+	assert.Equal(t, &Schema{AllOf: []*Schema{{Ref: componentPrefix + "walletData"}}, Nullable: true}, schema.Properties["previous"])
+	assert.Contains(t, document.Components.Schemas, "walletData")
+}
+
+func TestSchemaOfNamesUntaggedFieldsLikeEncodingJSON(t *testing.T) {
+	document := newTestDocument()
+
+	ref, err := document.SchemaOf(reflect.TypeOf([]entryData{}))
+	if err != nil {
+		t.Fatalf("Failed to describe entries: %v", err)
+	}
+
+	encoded, _ := json.Marshal(entryData{ID: 1})
+	var fields map[string]any
+	json.Unmarshal(encoded, &fields)
+
+	schema := document.Resolve(ref.Items)
+	for field := range fields {
+		assert.Contains(t, schema.Properties, field)
+	}
+	assert.Contains(t, schema.Properties, "Note")
+}
+
+func TestSchemaOfUnknownRuleFails(t *testing.T) {
+	document := newTestDocument()
+
+	_, err := document.SchemaOf(reflect.TypeOf(struct {
+		Code string `json:"code" binding:"iban"`
+	}{}))
+
+	assert.ErrorContains(t, err, `no schema for binding rule "iban"`)
+}
+
+func TestSchemaOfUnregisteredMarshalerFails(t *testing.T) {
+	document := NewDocument(Info{Title: "test", Version: "1"})
+	delete(types, reflect.TypeOf(amount{}))
+
+	_, err := document.SchemaOf(reflect.TypeOf(walletData{}))
+
+	assert.ErrorContains(t, err, "encodes itself")
+	assert.NotContains(t, document.Components.Schemas, "walletData")
+}
+
+func TestRegisteredRuleDescribesField(t *testing.T) {
+	document := newTestDocument()
+	RegisterRule("currency", func(schema *Schema, _ string) error {
+		schema.Pattern = "^[A-Z]{3}$"
+		return nil
+	})
+
+	schema, err := document.SchemaOf(reflect.TypeOf(struct {
+		Currency string `json:"currency" binding:"currency"`
+	}{}))
+	if err != nil {
+		t.Fatalf("Failed to describe params: %v", err)
+	}
+
+	assert.Equal(t, "^[A-Z]{3}$", schema.Properties["currency"].Pattern)
+}
+
+func keys(properties map[string]*Schema) []string {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
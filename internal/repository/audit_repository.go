@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+// auditChainLock is the advisory lock that serializes appends to the audit
+// log, so that every entry links to the one committed before it.
+const auditChainLock = 7220431
+
+const auditVerifyBatch = 500
+
+type AuditRepository interface {
+	Append(actor model.Actor, entry model.AuditEntry) (model.AuditEntry, error)
+	List(filter model.AuditFilter) ([]model.AuditEntry, error)
+	Verify() (model.AuditVerification, error)
+}
+
+type auditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) *auditRepository {
+	return &auditRepository{db: db}
+}
+
+// Append adds the entry to the audit log on behalf of actor. Entries are
+// never updated or deleted; the database refuses to.
+func (r *auditRepository) Append(actor model.Actor, entry model.AuditEntry) (model.AuditEntry, error) {
+	var appended model.AuditEntry
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		var err error
+		appended, err = appendAudit(tx, actor, entry)
+		return err
+	})
+	if err != nil {
+		return model.AuditEntry{}, err
+	}
+	return appended, nil
+}
+
+// List returns the entries matching filter, newest first.
+func (r *auditRepository) List(filter model.AuditFilter) ([]model.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.ActorType != "" {
+		where("actor_type = $%d", filter.ActorType)
+	}
+	if filter.ActorUserId != 0 {
+		where("actor_user_id = $%d", filter.ActorUserId)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.UserId != 0 {
+		where("user_id = $%d", filter.UserId)
+	}
+	if filter.WalletId != 0 {
+		where("wallet_id = $%d", filter.WalletId)
+	}
+	if filter.TransactionId != 0 {
+		where("transaction_id = $%d", filter.TransactionId)
+	}
+	if filter.RequestId != "" {
+		where("request_id = $%d", filter.RequestId)
+	}
+	if filter.From != nil {
+		where("creation_date >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		where("creation_date < $%d", *filter.To)
+	}
+	if filter.BeforeId != 0 {
+		where("id < $%d", filter.BeforeId)
+	}
+
+	query := "SELECT * FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	var entries []model.AuditEntry
+	if err := r.db.Select(&entries, query, args...); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Verify walks the whole audit log in order, recomputing the hash of every
+// entry and checking that it links to the entry before it. It stops at the
+// first entry that fails.
+func (r *auditRepository) Verify() (model.AuditVerification, error) {
+	var verification model.AuditVerification
+
+	for {
+		var entries []model.AuditEntry
+		err := r.db.Select(&entries, "SELECT * FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2", verification.LastId, auditVerifyBatch)
+		if err != nil {
+			return model.AuditVerification{}, err
+		}
+
+		for _, entry := range entries {
+			verification.LastId = entry.ID
+			if entry.Hash == "" && verification.Chained == 0 {
+				verification.Unhashed++
+				continue
+			}
+
+			problem, err := chainProblem(entry, verification.LastHash)
+			if err != nil {
+				return model.AuditVerification{}, err
+			}
+			if problem != "" {
+				verification.BrokenId, verification.Problem = entry.ID, problem
+				return verification, nil
+			}
+			verification.Chained++
+			verification.LastHash = entry.Hash
+		}
+
+		if len(entries) < auditVerifyBatch {
+			return verification, nil
+		}
+	}
+}
+
+// chainProblem tells what is wrong with an entry that should follow the entry
+// hashed prevHash, or is empty when nothing is.
+func chainProblem(entry model.AuditEntry, prevHash string) (string, error) {
+	if entry.Hash == "" {
+		return "the entry has no hash", nil
+	}
+	if entry.PrevHash != prevHash {
+		return "the entry does not link to the entry before it", nil
+	}
+	hash, err := auditHash(entry)
+	if err != nil {
+		return "", err
+	}
+	if hash != entry.Hash {
+		return "the entry does not match its hash", nil
+	}
+	return "", nil
+}
+
+// appendAudit writes the entry within tx, which may be the transaction of the
+// change it records so that the change and its entry commit together. Appends
+// are serialized on the chain lock until tx ends, so it should be the last
+// lock a transaction takes.
+func appendAudit(tx *sqlx.Tx, actor model.Actor, entry model.AuditEntry) (model.AuditEntry, error) {
+	entry = entry.By(actor)
+	if entry.Details == "" {
+		entry.Details = "{}"
+	}
+	details, err := canonicalJSON(entry.Details)
+	if err != nil {
+		return model.AuditEntry{}, err
+	}
+	entry.Details = details
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return model.AuditEntry{}, err
+	}
+	if err := tx.Get(&entry.PrevHash, "SELECT COALESCE((SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1), '')"); err != nil {
+		return model.AuditEntry{}, err
+	}
+	if err := tx.Get(&entry.ID, "SELECT nextval(pg_get_serial_sequence('audit_log', 'id'))"); err != nil {
+		return model.AuditEntry{}, err
+	}
+	// the database keeps microseconds, and the hash must survive the round
+	// trip
+	entry.CreationDate = time.Now().UTC().Truncate(time.Microsecond)
+	if entry.Hash, err = auditHash(entry); err != nil {
+		return model.AuditEntry{}, err
+	}
+
+	var appended model.AuditEntry
+	err = tx.Get(&appended, `INSERT INTO audit_log (id, actor_type, actor_user_id, action, user_id, wallet_id, transaction_id, details, ip, user_agent, request_id, creation_date, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING *`,
+		entry.ID, entry.ActorType, entry.ActorUserId, entry.Action, entry.UserId, entry.WalletId, entry.TransactionId, entry.Details, entry.IP, entry.UserAgent, entry.RequestId, entry.CreationDate, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return model.AuditEntry{}, err
+	}
+	return appended, nil
+}
+
+// auditHash is the SHA-256 of the previous entry's hash followed by every
+// field of the entry, so changing, removing or reordering an entry breaks the
+// chain from there on.
+func auditHash(entry model.AuditEntry) (string, error) {
+	details, err := canonicalJSON(entry.Details)
+	if err != nil {
+		return "", err
+	}
+
+	fields, err := json.Marshal(struct {
+		ID            int             `json:"id"`
+		ActorType     string          `json:"actor_type"`
+		ActorUserId   *int            `json:"actor_user_id"`
+		Action        string          `json:"action"`
+		UserId        *int            `json:"user_id"`
+		WalletId      *int            `json:"wallet_id"`
+		TransactionId *int            `json:"transaction_id"`
+		Details       json.RawMessage `json:"details"`
+		IP            string          `json:"ip"`
+		UserAgent     string          `json:"user_agent"`
+		RequestId     string          `json:"request_id"`
+		CreationDate  string          `json:"creation_date"`
+	}{entry.ID, entry.ActorType, entry.ActorUserId, entry.Action, entry.UserId, entry.WalletId, entry.TransactionId, json.RawMessage(details), entry.IP, entry.UserAgent, entry.RequestId, entry.CreationDate.UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(entry.PrevHash+"\n"), fields...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON rewrites a JSON document with sorted keys and no spacing. The
+// database stores details as JSONB, which reorders and respaces them, so
+// hashes are taken over this form.
+func canonicalJSON(document string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+
+	var canonical bytes.Buffer
+	encoder := json.NewEncoder(&canonical)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(canonical.String(), "\n"), nil
+}
+
+// auditDetails encodes the details of an audit entry.
+func auditDetails(details map[string]interface{}) (string, error) {
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// auditMovement records a movement of money with the balances, by wallet ID,
+// of every wallet it touched before and after it. before holds the wallets as
+// they were locked for the movement.
+func auditMovement(tx *sqlx.Tx, actor model.Actor, entry model.AuditEntry, details map[string]interface{}, before map[int]model.Wallet) error {
+	balancesBefore := make(map[string]money.Money, len(before))
+	balancesAfter := make(map[string]money.Money, len(before))
+	for walletId, wallet := range before {
+		after, err := getWallet(tx, "SELECT * FROM wallets WHERE id = $1", walletId)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprint(walletId)
+		balancesBefore[key], balancesAfter[key] = wallet.Balance, after.Balance
+	}
+	details["before"] = map[string]interface{}{"balances": balancesBefore}
+	details["after"] = map[string]interface{}{"balances": balancesAfter}
+
+	encoded, err := auditDetails(details)
+	if err != nil {
+		return err
+	}
+	entry.Details = encoded
+	_, err = appendAudit(tx, actor, entry)
+	return err
+}
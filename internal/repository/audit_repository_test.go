@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+func TestAdjustmentIsPostedAndAudited(t *testing.T) {
+	db := connectTestDatabase(t)
+	wallets := NewWalletRepository(db)
+	audit := NewAuditRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+	staff := createTestWallet(t, db, 0)
+	actor := model.Actor{Type: model.ActorTypeAdmin, UserId: staff.UserId, RequestId: "adjust-1"}
+
+	credit, err := wallets.Adjust(actor, model.Adjustment{WalletId: wallet.ID, Type: model.TransactionTypeCredit, Amount: money.New(250, money.DefaultCurrency), ReasonCode: model.ReasonCodeGoodwill})
+	assert.NoError(t, err)
+	_, err = wallets.Adjust(actor, model.Adjustment{WalletId: wallet.ID, Type: model.TransactionTypeDebit, Amount: money.New(2000, money.DefaultCurrency), ReasonCode: model.ReasonCodeChargeback})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	updated, err := wallets.GetById(wallet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1250), updated.Balance.Amount)
+	assertLedgerConsistent(t, db)
+
+	entries, err := audit.List(model.AuditFilter{WalletId: wallet.ID, Action: model.AuditActionWalletAdjusted, Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, model.ActorTypeAdmin, entries[0].ActorType)
+		assert.Equal(t, &staff.UserId, entries[0].ActorUserId)
+		assert.Equal(t, "adjust-1", entries[0].RequestId)
+		assert.Equal(t, &credit.ID, entries[0].TransactionId)
+		assert.JSONEq(t, fmt.Sprintf(`{"balances": {"%d": 10.00}}`, wallet.ID), string(detail(t, entries[0], "before")))
+		assert.JSONEq(t, fmt.Sprintf(`{"balances": {"%d": 12.50}}`, wallet.ID), string(detail(t, entries[0], "after")))
+	}
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	db := connectTestDatabase(t)
+	wallet := createTestWallet(t, db, 0)
+
+	actor := model.Actor{Type: model.ActorTypeAdmin, UserId: wallet.UserId}
+	entry, err := NewAuditRepository(db).Append(actor, model.AuditEntry{Action: model.AuditActionUserViewed, UserId: &wallet.UserId})
+	assert.NoError(t, err)
+
+	_, err = db.Exec("UPDATE audit_log SET action = 'tampered' WHERE id = $1", entry.ID)
+	assert.Error(t, err)
+	_, err = db.Exec("DELETE FROM audit_log WHERE id = $1", entry.ID)
+	assert.Error(t, err)
+}
+
+func TestAuditLogIsChained(t *testing.T) {
+	db := connectTestDatabase(t)
+	audit := NewAuditRepository(db)
+	wallet := createTestWallet(t, db, 0)
+
+	first, err := audit.Append(model.SystemActor, model.AuditEntry{Action: model.AuditActionWalletViewed, WalletId: &wallet.ID, Details: `{"b": 1, "a": [true, null]}`})
+	assert.NoError(t, err)
+	second, err := audit.Append(model.SystemActor, model.AuditEntry{Action: model.AuditActionWalletViewed, WalletId: &wallet.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, first.Hash, second.PrevHash)
+
+	verification, err := audit.Verify()
+	assert.NoError(t, err)
+	assert.True(t, verification.OK(), verification.Problem)
+	assert.GreaterOrEqual(t, verification.LastId, second.ID)
+}
+
+func TestAuditHashCoversEveryField(t *testing.T) {
+	userId := 7
+	entry := model.AuditEntry{
+		ID:           12,
+		ActorType:    model.ActorTypeAdmin,
+		ActorUserId:  &userId,
+		Action:       model.AuditActionWalletAdjusted,
+		Details:      `{"reason_code": "goodwill", "after": {"balances": {"3": 12.50}}}`,
+		IP:           "192.0.2.1",
+		RequestId:    "req-1",
+		CreationDate: time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC),
+		PrevHash:     "abc",
+	}
+	hash, err := auditHash(entry)
+	assert.NoError(t, err)
+
+	// the database hands details back reordered and respaced
+	stored := entry
+	stored.Details = `{"after":{"balances":{"3":12.50}},"reason_code":"goodwill"}`
+	stored.CreationDate = entry.CreationDate.In(time.FixedZone("CET", 3600))
+	storedHash, err := auditHash(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, storedHash)
+
+	tampered := []func(e *model.AuditEntry){
+		func(e *model.AuditEntry) { e.ID++ },
+		func(e *model.AuditEntry) { e.ActorUserId = nil },
+		func(e *model.AuditEntry) { e.Action = model.AuditActionWalletDeposited },
+		func(e *model.AuditEntry) {
+			e.Details = `{"reason_code": "goodwill", "after": {"balances": {"3": 125.00}}}`
+		},
+		func(e *model.AuditEntry) { e.IP = "192.0.2.2" },
+		func(e *model.AuditEntry) { e.CreationDate = e.CreationDate.Add(time.Microsecond) },
+		func(e *model.AuditEntry) { e.PrevHash = "abd" },
+	}
+	for i, tamper := range tampered {
+		changed := entry
+		tamper(&changed)
+		changedHash, err := auditHash(changed)
+		assert.NoError(t, err)
+		assert.NotEqual(t, hash, changedHash, "change %d", i)
+	}
+}
+
+func detail(t *testing.T, entry model.AuditEntry, key string) json.RawMessage {
+	t.Helper()
+	var details map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(entry.Details), &details); err != nil {
+		t.Fatal(err)
+	}
+	return details[key]
+}
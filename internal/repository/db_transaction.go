@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrInsufficientFunds = utils.InsufficientFunds("insufficient_funds", "the amount is greater than the available wallet balance")
+	ErrInvalidAmount     = utils.Invalid("invalid_amount", "amount must be greater than zero")
+)
+
+const uniqueViolation = "23505"
+
+// withTransaction runs fn inside a single database transaction, committing when
+// fn succeeds and rolling back otherwise.
+func withTransaction(db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockWallets takes a row lock on every given wallet in ascending ID order, so
+// two transactions locking the same pair of wallets can never deadlock.
+func lockWallets(tx *sqlx.Tx, walletIds ...int) (map[int]model.Wallet, error) {
+	ids := append([]int(nil), walletIds...)
+	sort.Ints(ids)
+
+	wallets := make(map[int]model.Wallet, len(ids))
+	for _, id := range ids {
+		if _, ok := wallets[id]; ok {
+			continue
+		}
+
+		wallet, err := getWallet(tx, "SELECT * FROM wallets WHERE id = $1 FOR UPDATE", id)
+		if err != nil {
+			return nil, err
+		}
+		wallets[id] = wallet
+	}
+	return wallets, nil
+}
+
+// getWallet reads a single wallet and gives its balance the wallet's currency,
+// which the balance column alone does not carry.
+func getWallet(q sqlx.Queryer, query string, args ...interface{}) (model.Wallet, error) {
+	var wallet model.Wallet
+	if err := sqlx.Get(q, &wallet, query, args...); err != nil {
+		return model.Wallet{}, err
+	}
+	wallet.Balance = money.New(wallet.Balance.Amount, wallet.Currency)
+	return wallet, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// violatedUniqueIndex names the unique index err broke, or is empty when err
+// is not a unique violation.
+func violatedUniqueIndex(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return pqErr.Constraint
+	}
+	return ""
+}
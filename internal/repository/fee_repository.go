@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/ledger"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+type FeeRepository interface {
+	GetRules(transactionType string, currency money.Currency) ([]model.FeeRule, error)
+}
+
+type feeRepository struct {
+	db *sqlx.DB
+}
+
+func NewFeeRepository(db *sqlx.DB) *feeRepository {
+	return &feeRepository{db: db}
+}
+
+// GetRules returns the fee rules of the transaction type in the currency and
+// in any currency.
+func (r *feeRepository) GetRules(transactionType string, currency money.Currency) ([]model.FeeRule, error) {
+	var rules []model.FeeRule
+	err := r.db.Select(&rules, "SELECT * FROM fee_rules WHERE transaction_type = $1 AND (currency IS NULL OR currency = $2) ORDER BY min_amount", transactionType, currency)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// withFee adds the fee, if any, to the amount an operation takes from a
+// wallet.
+func withFee(amount money.Money, fee *model.Fee) (money.Money, error) {
+	if fee == nil {
+		return amount, nil
+	}
+	return amount.Add(fee.Amount)
+}
+
+// feeWalletIds returns the house wallet a fee is paid into, if any, to be
+// locked along with the wallets of the operation it is charged on.
+func feeWalletIds(fee *model.Fee) []int {
+	if fee == nil {
+		return nil
+	}
+	return []int{fee.HouseWalletId}
+}
+
+// chargeFee records the fee charged on the transaction made from the wallet
+// as its own transaction and posts it to the house wallet. The wallet and the
+// house wallet must already be locked.
+func chargeFee(tx *sqlx.Tx, wallet model.Wallet, houseWallet model.Wallet, transactionId int, fee model.Fee) error {
+	if fee.Amount.Currency != wallet.Currency || houseWallet.Currency != wallet.Currency {
+		return fmt.Errorf("%w: %s fee on a %s wallet paid into a %s wallet", money.ErrCurrencyMismatch, fee.Amount.Currency, wallet.Currency, houseWallet.Currency)
+	}
+	if err := ensureCanReceive(tx, houseWallet); err != nil {
+		return err
+	}
+
+	var feeId int
+	err := tx.Get(&feeId, "INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, currency, fee_of, type) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id", wallet.UserId, wallet.ID, houseWallet.UserId, houseWallet.ID, fee.Amount, fee.Amount.Currency, transactionId, model.TransactionTypeFee)
+	if err != nil {
+		return err
+	}
+
+	_, err = ledger.Post(tx, ledger.Fee(feeId, wallet.ID, houseWallet.ID, fee.Amount))
+	return err
+}
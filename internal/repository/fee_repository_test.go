@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+func TestFeesArePaidIntoHouseWalletAndLinked(t *testing.T) {
+	db := connectTestDatabase(t)
+	wallets := NewWalletRepository(db)
+	users := NewUserRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+	receiver := createTestWallet(t, db, 0)
+	house := createTestWallet(t, db, 0)
+	fee := &model.Fee{Amount: money.New(50, money.DefaultCurrency), HouseWalletId: house.ID}
+
+	// the fee counts against the balance along with the amount
+	_, err := wallets.Update(model.SystemActor, wallet.ID, money.New(960, money.DefaultCurrency), model.TransactionTypeWithdraw, fee, nil)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	_, err = wallets.Update(model.SystemActor, wallet.ID, money.New(500, money.DefaultCurrency), model.TransactionTypeWithdraw, fee, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, users.Transfer(model.SystemActor, wallet.ID, receiver.ID, money.New(200, money.DefaultCurrency), nil, fee, nil))
+
+	wallet, err = wallets.GetById(wallet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), wallet.Balance.Amount)
+	house, err = wallets.GetById(house.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), house.Balance.Amount)
+
+	var linked int
+	assert.NoError(t, db.Get(&linked, "SELECT COUNT(*) FROM transactions f JOIN transactions t ON t.id = f.fee_of AND t.sender_wallet_id = f.sender_wallet_id WHERE f.type = $1 AND f.sender_wallet_id = $2 AND f.receiver_wallet_id = $3", model.TransactionTypeFee, wallet.ID, house.ID))
+	assert.Equal(t, 2, linked)
+	assertLedgerConsistent(t, db)
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/money"
+)
+
+type FXRateRepository interface {
+	GetRate(baseCurrency money.Currency, quoteCurrency money.Currency) (money.Decimal, error)
+}
+
+type fxRateRepository struct {
+	db *sqlx.DB
+}
+
+func NewFXRateRepository(db *sqlx.DB) *fxRateRepository {
+	return &fxRateRepository{db: db}
+}
+
+// GetRate returns how many units of quoteCurrency one unit of baseCurrency
+// buys, or sql.ErrNoRows when the pair has no rate.
+func (r *fxRateRepository) GetRate(baseCurrency money.Currency, quoteCurrency money.Currency) (money.Decimal, error) {
+	var rate money.Decimal
+	err := r.db.Get(&rate, "SELECT rate FROM fx_rates WHERE base_currency = $1 AND quote_currency = $2", baseCurrency, quoteCurrency)
+	if err != nil {
+		return money.Decimal{}, err
+	}
+	return rate, nil
+}
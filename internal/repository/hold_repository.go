@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrHoldNotActive      = utils.Conflict("hold_not_active", "the hold has already been captured, released or has expired")
+	ErrCaptureExceedsHold = utils.Invalid("capture_exceeds_hold", "the capture exceeds the held amount")
+)
+
+type HoldRepository interface {
+	GetById(holdId int) (model.Hold, error)
+	GetActiveByWalletId(walletId int) ([]model.Hold, error)
+	Create(actor model.Actor, walletId int, receiverWalletId *int, amount money.Money, expiryDate time.Time) (model.Hold, error)
+	Capture(actor model.Actor, holdId int, amount *money.Money, conversion *model.Conversion, fee *model.Fee, check MovementCheck) (model.Hold, error)
+	Release(actor model.Actor, holdId int) (model.Hold, error)
+	ReleaseExpired() (int64, error)
+}
+
+type holdRepository struct {
+	db *sqlx.DB
+}
+
+func NewHoldRepository(db *sqlx.DB) *holdRepository {
+	return &holdRepository{db: db}
+}
+
+func (r *holdRepository) GetById(holdId int) (model.Hold, error) {
+	return getHold(r.db, "SELECT * FROM holds WHERE id = $1", holdId)
+}
+
+func (r *holdRepository) GetActiveByWalletId(walletId int) ([]model.Hold, error) {
+	var holds []model.Hold
+	err := r.db.Select(&holds, "SELECT * FROM holds WHERE wallet_id = $1 AND status = $2 AND expiry_date > CURRENT_TIMESTAMP ORDER BY id", walletId, model.HoldStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	for i := range holds {
+		holds[i] = holdWithCurrency(holds[i])
+	}
+	return holds, nil
+}
+
+// Create reserves amount of the wallet's available balance until expiryDate,
+// for the payee receiverWalletId when it is set.
+func (r *holdRepository) Create(actor model.Actor, walletId int, receiverWalletId *int, amount money.Money, expiryDate time.Time) (model.Hold, error) {
+	if !amount.IsPositive() {
+		return model.Hold{}, ErrInvalidAmount
+	}
+
+	var hold model.Hold
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		wallets, err := lockWallets(tx, walletId)
+		if err != nil {
+			return err
+		}
+		wallet := wallets[walletId]
+		if err := ensureCanSend(tx, wallet); err != nil {
+			return err
+		}
+
+		if amount.Currency != wallet.Currency {
+			return fmt.Errorf("%w: %s hold on a %s wallet", money.ErrCurrencyMismatch, amount.Currency, wallet.Currency)
+		}
+		available, err := availableBalance(tx, wallet)
+		if err != nil {
+			return err
+		}
+		if available.LessThan(amount) {
+			return ErrInsufficientFunds
+		}
+
+		hold, err = getHold(tx, "INSERT INTO holds (wallet_id, receiver_wallet_id, amount, currency, status, expiry_date) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *", walletId, receiverWalletId, amount, amount.Currency, model.HoldStatusActive, expiryDate)
+		if err != nil {
+			return err
+		}
+		return auditHold(tx, actor, model.AuditActionHoldPlaced, wallet.UserId, hold, "", map[string]interface{}{"amount": hold.Amount, "currency": hold.Currency, "expiry_date": hold.ExpiryDate, "receiver_wallet_id": hold.ReceiverWalletId})
+	})
+	if err != nil {
+		return model.Hold{}, err
+	}
+	return hold, nil
+}
+
+// Capture settles an active hold with a withdrawal of amount, or of the whole
+// hold when amount is nil, or with a transfer into the hold's payee when it
+// has one. A hold is captured once; whatever part of it is not captured is
+// released. A fee on the capture is taken from the wallet on top of the held
+// amount. check, when given, vets the movement settling the hold.
+func (r *holdRepository) Capture(actor model.Actor, holdId int, amount *money.Money, conversion *model.Conversion, fee *model.Fee, check MovementCheck) (model.Hold, error) {
+	var hold model.Hold
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		var err error
+		hold, err = getHold(tx, "SELECT * FROM holds WHERE id = $1 FOR UPDATE", holdId)
+		if err != nil {
+			return err
+		}
+
+		captured := hold.Amount
+		if amount != nil {
+			if amount.Currency != hold.Currency {
+				return fmt.Errorf("%w: %s capture of a %s hold", money.ErrCurrencyMismatch, amount.Currency, hold.Currency)
+			}
+			if amount.Amount > hold.Amount.Amount {
+				return ErrCaptureExceedsHold
+			}
+			captured = *amount
+		}
+
+		// settling the hold first lifts its reservation, so the movement
+		// below can spend the money it was holding
+		result, err := tx.Exec("UPDATE holds SET status = $1, captured_amount = $2, update_date = CURRENT_TIMESTAMP WHERE id = $3 AND status = $4 AND expiry_date > CURRENT_TIMESTAMP", model.HoldStatusCaptured, captured, holdId, model.HoldStatusActive)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+			return ErrHoldNotActive
+		}
+
+		var wallet model.Wallet
+		var transactionId int
+		if hold.ReceiverWalletId == nil {
+			wallet, transactionId, err = update(tx, actor, hold.WalletId, captured, model.TransactionTypeWithdraw, fee, check)
+		} else {
+			transactionId, err = transfer(tx, actor, hold.WalletId, *hold.ReceiverWalletId, captured, conversion, fee, check)
+			if err == nil {
+				wallet, err = getWallet(tx, "SELECT * FROM wallets WHERE id = $1", hold.WalletId)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		hold, err = getHold(tx, "UPDATE holds SET transaction_id = $1 WHERE id = $2 RETURNING *", transactionId, holdId)
+		if err != nil {
+			return err
+		}
+		return auditHold(tx, actor, model.AuditActionHoldCaptured, wallet.UserId, hold, model.HoldStatusActive, map[string]interface{}{"captured_amount": captured, "receiver_wallet_id": hold.ReceiverWalletId})
+	})
+	if err != nil {
+		return model.Hold{}, err
+	}
+	return hold, nil
+}
+
+// Release gives the money of an active hold back to the wallet's available
+// balance.
+func (r *holdRepository) Release(actor model.Actor, holdId int) (model.Hold, error) {
+	var hold model.Hold
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		var err error
+		hold, err = getHold(tx, "UPDATE holds SET status = $1, update_date = CURRENT_TIMESTAMP WHERE id = $2 AND status = $3 AND expiry_date > CURRENT_TIMESTAMP RETURNING *", model.HoldStatusReleased, holdId, model.HoldStatusActive)
+		if err != nil {
+			return err
+		}
+		return auditHold(tx, actor, model.AuditActionHoldReleased, 0, hold, model.HoldStatusActive, nil)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.GetById(holdId); err != nil {
+			return model.Hold{}, err
+		}
+		return model.Hold{}, ErrHoldNotActive
+	}
+	if err != nil {
+		return model.Hold{}, err
+	}
+	return hold, nil
+}
+
+// ReleaseExpired marks every active hold past its expiry as expired and
+// returns how many there were. Expired holds already stopped counting against
+// the available balance; this only settles their status. A single statement
+// does it, so concurrent sweepers never conflict, and each expiry is audited
+// as the system's.
+func (r *holdRepository) ReleaseExpired() (int64, error) {
+	var holds []model.Hold
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		err := tx.Select(&holds, "UPDATE holds SET status = $1, update_date = CURRENT_TIMESTAMP WHERE status = $2 AND expiry_date <= CURRENT_TIMESTAMP RETURNING *", model.HoldStatusExpired, model.HoldStatusActive)
+		if err != nil {
+			return err
+		}
+		for _, hold := range holds {
+			if err := auditHold(tx, model.SystemActor, model.AuditActionHoldExpired, 0, holdWithCurrency(hold), model.HoldStatusActive, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(holds)), nil
+}
+
+// auditHold records a change to a hold. The hold's wallet owner is looked up
+// when userId is zero. fromStatus is empty for a new hold.
+func auditHold(tx *sqlx.Tx, actor model.Actor, action string, userId int, hold model.Hold, fromStatus string, details map[string]interface{}) error {
+	if userId == 0 {
+		if err := tx.Get(&userId, "SELECT user_id FROM wallets WHERE id = $1", hold.WalletId); err != nil {
+			return err
+		}
+	}
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["hold_id"] = hold.ID
+	if fromStatus != "" {
+		details["before"] = map[string]string{"status": fromStatus}
+	}
+	details["after"] = map[string]string{"status": hold.Status}
+
+	encoded, err := auditDetails(details)
+	if err != nil {
+		return err
+	}
+	_, err = appendAudit(tx, actor, model.AuditEntry{Action: action, UserId: &userId, WalletId: &hold.WalletId, TransactionId: hold.TransactionId, Details: encoded})
+	return err
+}
+
+// availableBalance is the wallet balance less its active, unexpired holds.
+func availableBalance(q sqlx.Queryer, wallet model.Wallet) (money.Money, error) {
+	var held int64
+	err := sqlx.Get(q, &held, "SELECT COALESCE(SUM(amount), 0) FROM holds WHERE wallet_id = $1 AND status = $2 AND expiry_date > CURRENT_TIMESTAMP", wallet.ID, model.HoldStatusActive)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return wallet.Balance.Sub(money.New(held, wallet.Currency))
+}
+
+func getHold(q sqlx.Queryer, query string, args ...interface{}) (model.Hold, error) {
+	var hold model.Hold
+	if err := sqlx.Get(q, &hold, query, args...); err != nil {
+		return model.Hold{}, err
+	}
+	return holdWithCurrency(hold), nil
+}
+
+func holdWithCurrency(hold model.Hold) model.Hold {
+	hold.Amount = money.New(hold.Amount.Amount, hold.Currency)
+	if hold.CapturedAmount != nil {
+		captured := money.New(hold.CapturedAmount.Amount, hold.Currency)
+		hold.CapturedAmount = &captured
+	}
+	return hold
+}
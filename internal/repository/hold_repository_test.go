@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+func TestHoldBlocksWithdrawalUntilCaptured(t *testing.T) {
+	db := connectTestDatabase(t)
+	holds := NewHoldRepository(db)
+	wallets := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+
+	hold, err := holds.Create(model.SystemActor, wallet.ID, nil, money.New(700, money.DefaultCurrency), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	_, err = wallets.Update(model.SystemActor, wallet.ID, money.New(400, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, nil)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	partial := money.New(500, money.DefaultCurrency)
+	hold, err = holds.Capture(model.SystemActor, hold.ID, &partial, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, model.HoldStatusCaptured, hold.Status)
+	assert.NotNil(t, hold.TransactionId)
+
+	// the 200 left uncaptured are released with the hold
+	available, err := wallets.GetAvailableBalance(wallet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500), available.Amount)
+
+	_, err = holds.Capture(model.SystemActor, hold.ID, nil, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrHoldNotActive)
+	assertLedgerConsistent(t, db)
+}
+
+func TestCaptureHoldPaysItsPayee(t *testing.T) {
+	db := connectTestDatabase(t)
+	holds := NewHoldRepository(db)
+	wallets := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+	payee := createTestWallet(t, db, 100)
+
+	hold, err := holds.Create(model.SystemActor, wallet.ID, &payee.ID, money.New(300, money.DefaultCurrency), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	hold, err = holds.Capture(model.SystemActor, hold.ID, nil, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, model.HoldStatusCaptured, hold.Status)
+
+	paid, err := wallets.GetById(payee.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(400), paid.Balance.Amount)
+	assertLedgerConsistent(t, db)
+}
+
+func TestConcurrentHoldsNeverExceedBalance(t *testing.T) {
+	db := connectTestDatabase(t)
+	holds := NewHoldRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	placed := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := holds.Create(model.SystemActor, wallet.ID, nil, money.New(100, money.DefaultCurrency), time.Now().Add(time.Hour))
+			if err == nil {
+				mu.Lock()
+				placed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, placed)
+}
+
+func TestReleaseExpiredHolds(t *testing.T) {
+	db := connectTestDatabase(t)
+	holds := NewHoldRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+
+	hold, err := holds.Create(model.SystemActor, wallet.ID, nil, money.New(300, money.DefaultCurrency), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	_, err = db.Exec("UPDATE holds SET expiry_date = CURRENT_TIMESTAMP - INTERVAL '1 minute' WHERE id = $1", hold.ID)
+	assert.NoError(t, err)
+
+	expired, err := holds.ReleaseExpired()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, expired, int64(1))
+
+	hold, err = holds.GetById(hold.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.HoldStatusExpired, hold.Status)
+	_, err = holds.Release(model.SystemActor, hold.ID)
+	assert.ErrorIs(t, err, ErrHoldNotActive)
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+)
+
+type IdempotencyRepository interface {
+	Reserve(userId int, key string, requestHash string, expiryDate time.Time) (model.IdempotencyKey, bool, error)
+	Complete(userId int, key string, statusCode int, responseBody []byte) error
+	Release(userId int, key string) error
+}
+
+type idempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) *idempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve claims the key for a new request. When the key is already taken the
+// stored key is returned instead and reserved is false. An expired key is
+// dropped and claimed again.
+func (r *idempotencyRepository) Reserve(userId int, key string, requestHash string, expiryDate time.Time) (model.IdempotencyKey, bool, error) {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND expiry_date < CURRENT_TIMESTAMP", userId, key)
+	if err != nil {
+		return model.IdempotencyKey{}, false, err
+	}
+
+	var idempotencyKey model.IdempotencyKey
+	err = r.db.Get(&idempotencyKey, "INSERT INTO idempotency_keys (user_id, key, request_hash, expiry_date) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, key) DO NOTHING RETURNING *", userId, key, requestHash, expiryDate)
+	if err == nil {
+		return idempotencyKey, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return model.IdempotencyKey{}, false, err
+	}
+
+	err = r.db.Get(&idempotencyKey, "SELECT * FROM idempotency_keys WHERE user_id = $1 AND key = $2", userId, key)
+	if err != nil {
+		return model.IdempotencyKey{}, false, err
+	}
+	return idempotencyKey, false, nil
+}
+
+func (r *idempotencyRepository) Complete(userId int, key string, statusCode int, responseBody []byte) error {
+	_, err := r.db.Exec("UPDATE idempotency_keys SET status_code = $1, response_body = $2 WHERE user_id = $3 AND key = $4", statusCode, responseBody, userId, key)
+	return err
+}
+
+func (r *idempotencyRepository) Release(userId int, key string) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2", userId, key)
+	return err
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+type LimitRepository interface {
+	GetLimits(wallet model.Wallet, operation string) ([]model.TransactionLimit, error)
+	GetUsage(wallet model.Wallet, scope string, operation string, window time.Duration) (model.LimitUsage, error)
+}
+
+type limitRepository struct {
+	q sqlx.Queryer
+}
+
+func NewLimitRepository(db *sqlx.DB) *limitRepository {
+	return &limitRepository{q: db}
+}
+
+// MovementCheck vets a movement of money out of, or into, wallet before it is
+// made. It runs inside the transaction making the movement, once the wallet
+// and its user are locked, and reads the wallet's limits through that
+// transaction, so no other movement it would count can be made until this one
+// is committed or rolled back.
+type MovementCheck func(wallet model.Wallet, limits LimitRepository) error
+
+// checkMovement runs check, when there is one, on the locked wallet.
+func checkMovement(tx *sqlx.Tx, wallet model.Wallet, check MovementCheck) error {
+	if check == nil {
+		return nil
+	}
+	return check(wallet, &limitRepository{q: tx})
+}
+
+// lockOwner locks the user of the wallet a checked movement is made from.
+// Limits of the user count the movements of all their wallets, which locking
+// the one wallet would not keep apart. Users are locked before their wallets,
+// as status changes lock them.
+func lockOwner(tx *sqlx.Tx, walletId int, check MovementCheck) error {
+	if check == nil {
+		return nil
+	}
+	var userId int
+	return tx.Get(&userId, "SELECT u.id FROM users u JOIN wallets w ON w.user_id = u.id WHERE w.id = $1 FOR UPDATE OF u", walletId)
+}
+
+// GetLimits returns every limit on the operation type that applies to the
+// wallet: its own, its user's and everyone's, in its currency or in any.
+func (r *limitRepository) GetLimits(wallet model.Wallet, operation string) ([]model.TransactionLimit, error) {
+	var limits []model.TransactionLimit
+	err := sqlx.Select(r.q, &limits, `SELECT * FROM transaction_limits
+		WHERE operation = $1 AND (currency IS NULL OR currency = $2) AND (user_id IS NULL OR user_id = $3) AND (wallet_id IS NULL OR wallet_id = $4)`,
+		operation, wallet.Currency, wallet.UserId, wallet.ID)
+	if err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// GetUsage adds up the operations of the type made from the wallet, or from
+// every wallet of its user in its currency, over the last window. Deposits
+// and withdrawals name their wallet as the sender too.
+func (r *limitRepository) GetUsage(wallet model.Wallet, scope string, operation string, window time.Duration) (model.LimitUsage, error) {
+	column, id := "sender_wallet_id", wallet.ID
+	if scope == model.LimitScopeUser {
+		column, id = "sender_user_id", wallet.UserId
+	}
+
+	var usage struct {
+		Total  int64      `db:"total"`
+		Oldest *time.Time `db:"oldest"`
+	}
+	query := fmt.Sprintf(`SELECT COALESCE(SUM(amount), 0) AS total, MIN(creation_date) AS oldest FROM transactions
+		WHERE %s = $1 AND type = $2 AND currency = $3 AND creation_date > CURRENT_TIMESTAMP - $4 * INTERVAL '1 second'`, column)
+	if err := sqlx.Get(r.q, &usage, query, id, operation, wallet.Currency, window.Seconds()); err != nil {
+		return model.LimitUsage{}, err
+	}
+	return model.LimitUsage{Total: money.New(usage.Total, wallet.Currency), Oldest: usage.Oldest}, nil
+}
@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrScheduleChanged = utils.Conflict("schedule_changed", "the schedule changed since it was read")
+	ErrScheduleClosed  = utils.Conflict("schedule_closed", "the schedule is cancelled or finished")
+)
+
+type ScheduleRepository interface {
+	GetById(scheduleId int) (model.ScheduledTransfer, error)
+	GetByUserId(userId int) ([]model.ScheduledTransfer, error)
+	GetRuns(scheduleId int) ([]model.ScheduledTransferRun, error)
+	Create(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error)
+	Update(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error)
+	ClaimDue(limit int, lease time.Duration) ([]model.ScheduledTransfer, error)
+	Execute(schedule model.ScheduledTransfer, conversion *model.Conversion, fee *model.Fee, check MovementCheck, retryAt time.Time) (model.ScheduledTransferRun, error)
+	Fail(schedule model.ScheduledTransfer, reason error) (model.ScheduledTransferRun, error)
+}
+
+type scheduleRepository struct {
+	db *sqlx.DB
+}
+
+func NewScheduleRepository(db *sqlx.DB) *scheduleRepository {
+	return &scheduleRepository{db: db}
+}
+
+func (r *scheduleRepository) GetById(scheduleId int) (model.ScheduledTransfer, error) {
+	return getSchedule(r.db, "SELECT * FROM scheduled_transfers WHERE id = $1", scheduleId)
+}
+
+func (r *scheduleRepository) GetByUserId(userId int) ([]model.ScheduledTransfer, error) {
+	var schedules []model.ScheduledTransfer
+	if err := r.db.Select(&schedules, "SELECT * FROM scheduled_transfers WHERE user_id = $1 ORDER BY id", userId); err != nil {
+		return nil, err
+	}
+	for i := range schedules {
+		schedules[i] = scheduleWithCurrency(schedules[i])
+	}
+	return schedules, nil
+}
+
+func (r *scheduleRepository) GetRuns(scheduleId int) ([]model.ScheduledTransferRun, error) {
+	var runs []model.ScheduledTransferRun
+	if err := r.db.Select(&runs, "SELECT * FROM scheduled_transfer_runs WHERE schedule_id = $1 ORDER BY id DESC", scheduleId); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (r *scheduleRepository) Create(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+	if !schedule.Amount.IsPositive() {
+		return model.ScheduledTransfer{}, ErrInvalidAmount
+	}
+	return getSchedule(r.db, "INSERT INTO scheduled_transfers (user_id, sender_wallet_id, receiver_wallet_id, amount, currency, recurrence, day_of_month, scheduled_date, next_run_date, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $9) RETURNING *",
+		schedule.UserId, schedule.SenderWalletId, schedule.ReceiverWalletId, schedule.Amount, schedule.Amount.Currency, schedule.Recurrence, schedule.DayOfMonth, schedule.ScheduledDate, model.ScheduleStatusActive)
+}
+
+// Update saves an edited schedule as long as nobody else changed it since it
+// was read, and it is not cancelled or finished.
+func (r *scheduleRepository) Update(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+	if !schedule.Amount.IsPositive() {
+		return model.ScheduledTransfer{}, ErrInvalidAmount
+	}
+
+	updated, err := getSchedule(r.db, "UPDATE scheduled_transfers SET amount = $1, currency = $2, recurrence = $3, day_of_month = $4, scheduled_date = $5, next_run_date = $6, attempts = $7, status = $8, version = version + 1, update_date = CURRENT_TIMESTAMP WHERE id = $9 AND version = $10 AND status IN ($11, $12) RETURNING *",
+		schedule.Amount, schedule.Amount.Currency, schedule.Recurrence, schedule.DayOfMonth, schedule.ScheduledDate, schedule.NextRunDate, schedule.Attempts, schedule.Status, schedule.ID, schedule.Version, model.ScheduleStatusActive, model.ScheduleStatusPaused)
+	if errors.Is(err, sql.ErrNoRows) {
+		current, err := r.GetById(schedule.ID)
+		if err != nil {
+			return model.ScheduledTransfer{}, err
+		}
+		if current.Status != model.ScheduleStatusActive && current.Status != model.ScheduleStatusPaused {
+			return model.ScheduledTransfer{}, ErrScheduleClosed
+		}
+		return model.ScheduledTransfer{}, ErrScheduleChanged
+	}
+	return updated, err
+}
+
+// ClaimDue leases up to limit active schedules whose next run is due. Rows
+// another worker is claiming are skipped, and a schedule stays claimed for
+// lease, so replicas polling together pick different schedules. A lease that
+// runs out, because its worker died, lets the schedule be claimed again.
+func (r *scheduleRepository) ClaimDue(limit int, lease time.Duration) ([]model.ScheduledTransfer, error) {
+	var schedules []model.ScheduledTransfer
+	err := r.db.Select(&schedules, `UPDATE scheduled_transfers SET claimed_until = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM scheduled_transfers
+			WHERE status = $2 AND next_run_date <= CURRENT_TIMESTAMP AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+			ORDER BY next_run_date
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, lease.Seconds(), model.ScheduleStatusActive, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range schedules {
+		schedules[i] = scheduleWithCurrency(schedules[i])
+	}
+	return schedules, nil
+}
+
+// Execute makes the transfer of a claimed schedule, records the run and moves
+// the schedule on, all in one transaction. A transfer refused for lack of
+// funds is retried at retryAt until the occurrence has used up its attempts;
+// any other failure is recorded and the schedule moves to its next
+// occurrence. It returns ErrScheduleChanged, and does nothing, when the
+// schedule was edited or run since it was claimed. The transfer is audited as
+// made by the system, and check vets it like any transfer's.
+func (r *scheduleRepository) Execute(schedule model.ScheduledTransfer, conversion *model.Conversion, fee *model.Fee, check MovementCheck, retryAt time.Time) (model.ScheduledTransferRun, error) {
+	var run model.ScheduledTransferRun
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		if err := lockClaimedSchedule(tx, schedule); err != nil {
+			return err
+		}
+
+		// a failed transfer is undone on its own, so its run can still be
+		// recorded
+		if _, err := tx.Exec("SAVEPOINT scheduled_transfer"); err != nil {
+			return err
+		}
+		transactionId, transferErr := transfer(tx, model.SystemActor, schedule.SenderWalletId, schedule.ReceiverWalletId, schedule.Amount, conversion, fee, check)
+		if transferErr != nil {
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT scheduled_transfer"); err != nil {
+				return err
+			}
+
+			var retry *time.Time
+			if errors.Is(transferErr, ErrInsufficientFunds) && schedule.Attempts+1 < model.MaxScheduledTransferAttempts {
+				retry = &retryAt
+			}
+			var err error
+			run, err = settleRun(tx, schedule, nil, transferErr, retry)
+			return err
+		}
+
+		var err error
+		run, err = settleRun(tx, schedule, &transactionId, nil, nil)
+		return err
+	})
+	if err != nil {
+		return model.ScheduledTransferRun{}, err
+	}
+	return run, nil
+}
+
+// Fail records a run of a claimed schedule that could not be attempted and
+// moves the schedule to its next occurrence.
+func (r *scheduleRepository) Fail(schedule model.ScheduledTransfer, reason error) (model.ScheduledTransferRun, error) {
+	var run model.ScheduledTransferRun
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		if err := lockClaimedSchedule(tx, schedule); err != nil {
+			return err
+		}
+
+		var err error
+		run, err = settleRun(tx, schedule, nil, reason, nil)
+		return err
+	})
+	if err != nil {
+		return model.ScheduledTransferRun{}, err
+	}
+	return run, nil
+}
+
+func lockClaimedSchedule(tx *sqlx.Tx, schedule model.ScheduledTransfer) error {
+	current, err := getSchedule(tx, "SELECT * FROM scheduled_transfers WHERE id = $1 FOR UPDATE", schedule.ID)
+	if err != nil {
+		return err
+	}
+	if current.Status != model.ScheduleStatusActive || current.Version != schedule.Version {
+		return ErrScheduleChanged
+	}
+	return nil
+}
+
+// settleRun records a run of schedule and moves the schedule on: to retry
+// when it is set, and otherwise to the next occurrence, or to completed or
+// failed when there is none.
+func settleRun(tx *sqlx.Tx, schedule model.ScheduledTransfer, transactionId *int, runErr error, retry *time.Time) (model.ScheduledTransferRun, error) {
+	status := model.RunStatusSucceeded
+	var reason *string
+	if runErr != nil {
+		status = model.RunStatusFailed
+		message := runErr.Error()
+		reason = &message
+	}
+
+	var run model.ScheduledTransferRun
+	err := tx.Get(&run, "INSERT INTO scheduled_transfer_runs (schedule_id, scheduled_date, attempt, status, transaction_id, error) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *", schedule.ID, schedule.ScheduledDate, schedule.Attempts+1, status, transactionId, reason)
+	if err != nil {
+		return model.ScheduledTransferRun{}, err
+	}
+
+	if retry != nil {
+		_, err = tx.Exec("UPDATE scheduled_transfers SET next_run_date = $1, attempts = attempts + 1, claimed_until = NULL, version = version + 1, update_date = CURRENT_TIMESTAMP WHERE id = $2", *retry, schedule.ID)
+		return run, err
+	}
+
+	next, ok := schedule.NextOccurrence()
+	if !ok {
+		final := model.ScheduleStatusCompleted
+		if runErr != nil {
+			final = model.ScheduleStatusFailed
+		}
+		_, err = tx.Exec("UPDATE scheduled_transfers SET status = $1, attempts = 0, claimed_until = NULL, version = version + 1, update_date = CURRENT_TIMESTAMP WHERE id = $2", final, schedule.ID)
+		return run, err
+	}
+
+	_, err = tx.Exec("UPDATE scheduled_transfers SET scheduled_date = $1, next_run_date = $1, attempts = 0, claimed_until = NULL, version = version + 1, update_date = CURRENT_TIMESTAMP WHERE id = $2", next, schedule.ID)
+	return run, err
+}
+
+func getSchedule(q sqlx.Queryer, query string, args ...interface{}) (model.ScheduledTransfer, error) {
+	var schedule model.ScheduledTransfer
+	if err := sqlx.Get(q, &schedule, query, args...); err != nil {
+		return model.ScheduledTransfer{}, err
+	}
+	return scheduleWithCurrency(schedule), nil
+}
+
+func scheduleWithCurrency(schedule model.ScheduledTransfer) model.ScheduledTransfer {
+	schedule.Amount = money.New(schedule.Amount.Amount, schedule.Currency)
+	return schedule
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+func createTestSchedule(t *testing.T, repository *scheduleRepository, sender model.Wallet, receiver model.Wallet, amount int64, recurrence string) model.ScheduledTransfer {
+	t.Helper()
+
+	schedule, err := repository.Create(model.ScheduledTransfer{
+		UserId:           sender.UserId,
+		SenderWalletId:   sender.ID,
+		ReceiverWalletId: receiver.ID,
+		Amount:           money.New(amount, money.DefaultCurrency),
+		Recurrence:       recurrence,
+		ScheduledDate:    time.Now().Add(-time.Minute).UTC(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+	return schedule
+}
+
+func TestScheduledTransferRetriesUntilFunded(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewScheduleRepository(db)
+	sender := createTestWallet(t, db, 100)
+	receiver := createTestWallet(t, db, 0)
+	schedule := createTestSchedule(t, repository, sender, receiver, 300, model.RecurrenceDaily)
+
+	run, err := repository.Execute(schedule, nil, nil, nil, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, model.RunStatusFailed, run.Status)
+
+	// a run that lost the schedule to an earlier one does nothing
+	_, err = repository.Execute(schedule, nil, nil, nil, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, ErrScheduleChanged)
+
+	retrying, err := repository.GetById(schedule.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retrying.Attempts)
+	assert.True(t, retrying.ScheduledDate.Equal(schedule.ScheduledDate))
+
+	_, err = NewWalletRepository(db).Update(model.SystemActor, sender.ID, money.New(500, money.DefaultCurrency), model.TransactionTypeDeposit, nil, nil)
+	assert.NoError(t, err)
+	run, err = repository.Execute(retrying, nil, nil, nil, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, model.RunStatusSucceeded, run.Status)
+	assert.NotNil(t, run.TransactionId)
+
+	advanced, err := repository.GetById(schedule.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, advanced.Attempts)
+	assert.True(t, advanced.ScheduledDate.Equal(schedule.ScheduledDate.AddDate(0, 0, 1)))
+	assertLedgerConsistent(t, db)
+}
+
+func TestClaimDueHandsEachScheduleToOneWorker(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewScheduleRepository(db)
+	sender := createTestWallet(t, db, 1000)
+	receiver := createTestWallet(t, db, 0)
+	schedule := createTestSchedule(t, repository, sender, receiver, 100, model.RecurrenceOnce)
+
+	const workers = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claims := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := repository.ClaimDue(100, time.Minute)
+			assert.NoError(t, err)
+			for _, s := range claimed {
+				if s.ID == schedule.ID {
+					mu.Lock()
+					claims++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, claims)
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrSendingBlocked   = utils.Conflict("sending_blocked", "the wallet or its owner is not allowed to send money")
+	ErrReceivingBlocked = utils.Conflict("receiving_blocked", "the wallet or its owner is not allowed to receive money")
+	ErrStatusFinal      = utils.Conflict("status_final", "a closed wallet cannot be reopened")
+	ErrWalletNotEmpty   = utils.Conflict("wallet_not_empty", "the wallet still holds money, withdraw or transfer it before closing the wallet")
+)
+
+// ensureCanSend fails unless both the wallet and its owner may send money.
+// The wallet must be locked, which keeps its status from changing until tx
+// ends.
+func ensureCanSend(tx *sqlx.Tx, wallet model.Wallet) error {
+	return ensureStatus(tx, wallet, model.CanSend, ErrSendingBlocked)
+}
+
+// ensureCanReceive fails unless both the wallet and its owner may receive
+// money. The wallet must be locked.
+func ensureCanReceive(tx *sqlx.Tx, wallet model.Wallet) error {
+	return ensureStatus(tx, wallet, model.CanReceive, ErrReceivingBlocked)
+}
+
+func ensureStatus(tx *sqlx.Tx, wallet model.Wallet, allowed func(string) bool, blocked *utils.Error) error {
+	if !allowed(wallet.Status) {
+		return blocked.With("wallet_id", wallet.ID).With("status", wallet.Status)
+	}
+
+	// status changes of the owner lock all their wallets, so reading the
+	// owner's status once the wallet is locked cannot miss one
+	var ownerStatus string
+	if err := tx.Get(&ownerStatus, "SELECT status FROM users WHERE id = $1", wallet.UserId); err != nil {
+		return err
+	}
+	if !allowed(ownerStatus) {
+		return blocked.With("user_id", wallet.UserId).With("status", ownerStatus)
+	}
+	return nil
+}
+
+// closeWallet closes a locked, empty wallet. A closed wallet is soft-deleted:
+// it stops being the default, its holds are released and the schedules from
+// or to it are cancelled.
+func closeWallet(tx *sqlx.Tx, wallet model.Wallet) error {
+	if !wallet.Balance.IsZero() {
+		return ErrWalletNotEmpty
+	}
+
+	_, err := tx.Exec("UPDATE wallets SET status = $1, is_default = FALSE, deletion_date = CURRENT_TIMESTAMP, update_date = CURRENT_TIMESTAMP WHERE id = $2", model.StatusClosed, wallet.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE holds SET status = $1, update_date = CURRENT_TIMESTAMP WHERE wallet_id = $2 AND status = $3", model.HoldStatusReleased, wallet.ID, model.HoldStatusActive)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE scheduled_transfers SET status = $1, version = version + 1, update_date = CURRENT_TIMESTAMP
+		WHERE status IN ($2, $3) AND (sender_wallet_id = $4 OR receiver_wallet_id = $4)`,
+		model.ScheduleStatusCancelled, model.ScheduleStatusActive, model.ScheduleStatusPaused, wallet.ID)
+	return err
+}
+
+// recordStatusChange keeps the change in the status history and in the audit
+// log, and publishes it.
+func recordStatusChange(tx *sqlx.Tx, actor model.Actor, change model.StatusChange) (model.StatusChange, error) {
+	var recorded model.StatusChange
+	err := tx.Get(&recorded, "INSERT INTO status_changes (user_id, wallet_id, from_status, to_status, reason, actor_user_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *", change.UserId, change.WalletId, change.FromStatus, change.ToStatus, change.Reason, change.ActorUserId)
+	if err != nil {
+		return model.StatusChange{}, err
+	}
+
+	if err := publishStatusChange(tx, recorded); err != nil {
+		return model.StatusChange{}, err
+	}
+
+	action := model.AuditActionUserStatusChanged
+	if recorded.WalletId != nil {
+		action = model.AuditActionWalletStatusChanged
+	}
+	details, err := auditDetails(map[string]interface{}{
+		"reason": recorded.Reason,
+		"before": map[string]string{"status": recorded.FromStatus},
+		"after":  map[string]string{"status": recorded.ToStatus},
+	})
+	if err != nil {
+		return model.StatusChange{}, err
+	}
+	_, err = appendAudit(tx, actor, model.AuditEntry{Action: action, UserId: &recorded.UserId, WalletId: recorded.WalletId, Details: details})
+	if err != nil {
+		return model.StatusChange{}, err
+	}
+	return recorded, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+func TestFrozenWalletReceivesButCannotSend(t *testing.T) {
+	db := connectTestDatabase(t)
+	wallets := NewWalletRepository(db)
+	users := NewUserRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+	other := createTestWallet(t, db, 1000)
+	amount := money.New(100, money.DefaultCurrency)
+
+	admin := model.Actor{Type: model.ActorTypeAdmin, UserId: other.UserId}
+
+	change, err := wallets.SetStatus(admin, wallet.ID, model.StatusChange{ToStatus: model.StatusFrozen, Reason: "chargeback under review"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusActive, change.FromStatus)
+	assert.Equal(t, wallet.UserId, change.UserId)
+	assert.Equal(t, other.UserId, change.ActorUserId)
+
+	_, err = wallets.Update(model.SystemActor, wallet.ID, amount, model.TransactionTypeDeposit, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, users.Transfer(model.SystemActor, other.ID, wallet.ID, amount, nil, nil, nil))
+	_, err = wallets.Update(model.SystemActor, wallet.ID, amount, model.TransactionTypeWithdraw, nil, nil)
+	assert.ErrorIs(t, err, ErrSendingBlocked)
+	assert.ErrorIs(t, users.Transfer(model.SystemActor, wallet.ID, other.ID, amount, nil, nil, nil), ErrSendingBlocked)
+	_, err = NewHoldRepository(db).Create(model.SystemActor, wallet.ID, nil, amount, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, ErrSendingBlocked)
+	assertLedgerConsistent(t, db)
+}
+
+func TestSuspendedOwnerBlocksEveryMovement(t *testing.T) {
+	db := connectTestDatabase(t)
+	wallets := NewWalletRepository(db)
+	users := NewUserRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+	other := createTestWallet(t, db, 1000)
+	amount := money.New(100, money.DefaultCurrency)
+
+	admin := model.Actor{Type: model.ActorTypeAdmin, UserId: other.UserId}
+
+	_, err := users.SetStatus(admin, wallet.UserId, model.StatusChange{ToStatus: model.StatusSuspended, Reason: "court order"})
+	assert.NoError(t, err)
+
+	_, err = wallets.Update(model.SystemActor, wallet.ID, amount, model.TransactionTypeDeposit, nil, nil)
+	assert.ErrorIs(t, err, ErrReceivingBlocked)
+	assert.ErrorIs(t, users.Transfer(model.SystemActor, other.ID, wallet.ID, amount, nil, nil, nil), ErrReceivingBlocked)
+
+	_, err = users.SetStatus(admin, wallet.UserId, model.StatusChange{ToStatus: model.StatusActive, Reason: "order lifted"})
+	assert.NoError(t, err)
+	assert.NoError(t, users.Transfer(model.SystemActor, other.ID, wallet.ID, amount, nil, nil, nil))
+
+	var changes int
+	assert.NoError(t, db.Get(&changes, "SELECT COUNT(*) FROM status_changes WHERE user_id = $1 AND wallet_id IS NULL", wallet.UserId))
+	assert.Equal(t, 2, changes)
+}
+
+func TestClosedWalletIsEmptyHiddenAndFinal(t *testing.T) {
+	db := connectTestDatabase(t)
+	wallets := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 100)
+	owner := model.Actor{Type: model.ActorTypeUser, UserId: wallet.UserId}
+	closing := model.StatusChange{ToStatus: model.StatusClosed, Reason: "requested by the user"}
+
+	_, err := wallets.SetStatus(owner, wallet.ID, closing)
+	assert.ErrorIs(t, err, ErrWalletNotEmpty)
+
+	_, err = wallets.Update(model.SystemActor, wallet.ID, money.New(100, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, nil)
+	assert.NoError(t, err)
+	_, err = wallets.SetStatus(owner, wallet.ID, closing)
+	assert.NoError(t, err)
+
+	listed, err := wallets.GetWalletByUserId(wallet.UserId)
+	assert.NoError(t, err)
+	assert.Empty(t, listed)
+	_, err = wallets.Update(model.SystemActor, wallet.ID, money.New(100, money.DefaultCurrency), model.TransactionTypeDeposit, nil, nil)
+	assert.ErrorIs(t, err, ErrReceivingBlocked)
+	_, err = wallets.SetStatus(owner, wallet.ID, model.StatusChange{ToStatus: model.StatusActive, Reason: "reopen"})
+	assert.ErrorIs(t, err, ErrStatusFinal)
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+)
+
+type TokenRepository interface {
+	Create(token model.OAuthToken) (model.OAuthToken, error)
+	GetByHash(tokenHash string) (model.OAuthToken, error)
+	Revoke(tokenId int) (bool, error)
+	RevokeSession(sessionId string) error
+	RevokeAllByUserId(userId int) error
+}
+
+type tokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewTokenRepository(db *sqlx.DB) *tokenRepository {
+	return &tokenRepository{db: db}
+}
+
+func (r *tokenRepository) Create(token model.OAuthToken) (model.OAuthToken, error) {
+	var created model.OAuthToken
+	err := r.db.Get(&created, "INSERT INTO oauth_tokens (user_id, token_hash, type, session_id, expiry_date) VALUES ($1, $2, $3, $4, $5) RETURNING *", token.UserId, token.TokenHash, token.Type, token.SessionId, token.ExpiryDate)
+	if err != nil {
+		return model.OAuthToken{}, err
+	}
+	return created, nil
+}
+
+func (r *tokenRepository) GetByHash(tokenHash string) (model.OAuthToken, error) {
+	var token model.OAuthToken
+	err := r.db.Get(&token, "SELECT * FROM oauth_tokens WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		return model.OAuthToken{}, err
+	}
+	return token, nil
+}
+
+// Revoke revokes a single token and reports whether this call revoked it, so
+// two requests racing to use the same refresh token cannot both succeed.
+func (r *tokenRepository) Revoke(tokenId int) (bool, error) {
+	result, err := r.db.Exec("UPDATE oauth_tokens SET revocation_date = CURRENT_TIMESTAMP WHERE id = $1 AND revocation_date IS NULL", tokenId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *tokenRepository) RevokeSession(sessionId string) error {
+	_, err := r.db.Exec("UPDATE oauth_tokens SET revocation_date = CURRENT_TIMESTAMP WHERE session_id = $1 AND revocation_date IS NULL", sessionId)
+	return err
+}
+
+func (r *tokenRepository) RevokeAllByUserId(userId int) error {
+	_, err := r.db.Exec("UPDATE oauth_tokens SET revocation_date = CURRENT_TIMESTAMP WHERE user_id = $1 AND revocation_date IS NULL", userId)
+	return err
+}
@@ -6,16 +6,35 @@ import (
 
 	"github.com/jmoiron/sqlx"
 
+	"go-wallet-service/internal/ledger"
 	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrNotReversible         = utils.Unprocessable("not_reversible", "only deposits and transfers can be reversed")
+	ErrAlreadyReversed       = utils.Conflict("already_reversed", "the transaction has already been reversed in full")
+	ErrReversalExceedsAmount = utils.Invalid("reversal_exceeds_amount", "the reversal exceeds the amount left to reverse")
+	ErrUsernameTaken         = utils.Conflict("username_taken", "the username is already taken")
+	ErrEmailTaken            = utils.Conflict("email_taken", "the email is already used by another user")
+	ErrAccountNotEmpty       = utils.Conflict("account_not_empty", "the account still holds money, withdraw or transfer it before deleting the account")
 )
 
 type UserRepository interface {
 	GetById(userId int) (model.User, error)
+	GetByIdIncludingDeleted(userId int) (model.User, error)
+	Register(actor model.Actor, user model.User, walletName string, currency money.Currency) (model.User, model.Wallet, error)
+	UpdateProfile(actor model.Actor, user model.User) (model.User, error)
+	Delete(actor model.Actor, userId int) error
+	SetStatus(actor model.Actor, userId int, change model.StatusChange) (model.StatusChange, error)
 	GetByIds(userId []int) ([]model.User, error)
-	GetUserByToken(token string) (int, error)
 	GetUserByUserId(userId int) ([]model.User, error)
-	GetUserTransactionsByUserId(userId int) ([]model.Transaction, error)
-	Transfer(senderUserId int, senderWalletId int, senderWalletBalance float64, receiverUserId int, receiverWalletId int, receiverWalletBalance float64, amount float64) error
+	GetUserTransactionsByUserId(userId int, filter model.TransactionFilter) ([]model.TransactionEntry, error)
+	GetTransactionById(transactionId int) (model.Transaction, error)
+	Transfer(actor model.Actor, senderWalletId int, receiverWalletId int, amount money.Money, conversion *model.Conversion, fee *model.Fee, check MovementCheck) error
+	Reverse(actor model.Actor, transactionId int, amount *money.Money, force bool) (model.Transaction, error)
 }
 
 type userRepository struct {
@@ -26,9 +45,10 @@ func NewUserRepository(db *sqlx.DB) *userRepository {
 	return &userRepository{db: db}
 }
 
+// GetById returns the user unless the account was deleted.
 func (ur *userRepository) GetById(userId int) (model.User, error) {
 	var user model.User
-	err := ur.db.Get(&user, "SELECT * FROM users WHERE id = $1", userId)
+	err := ur.db.Get(&user, "SELECT * FROM users WHERE id = $1 AND deletion_date IS NULL", userId)
 
 	if err != nil {
 		return model.User{}, err
@@ -36,6 +56,171 @@ func (ur *userRepository) GetById(userId int) (model.User, error) {
 	return user, nil
 }
 
+// GetByIdIncludingDeleted returns the user even when the account was deleted,
+// for staff looking into closed accounts.
+func (ur *userRepository) GetByIdIncludingDeleted(userId int) (model.User, error) {
+	var user model.User
+	if err := ur.db.Get(&user, "SELECT * FROM users WHERE id = $1", userId); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// Register creates the user along with their first wallet, which becomes
+// their default one. An actor without a user, such as a caller that is not
+// signed in, registers as the new user.
+func (ur *userRepository) Register(actor model.Actor, user model.User, walletName string, currency money.Currency) (model.User, model.Wallet, error) {
+	var wallet model.Wallet
+
+	err := withTransaction(ur.db, func(tx *sqlx.Tx) error {
+		err := tx.Get(&user, "INSERT INTO users (username, display_name, email, phone) VALUES ($1, $2, $3, $4) RETURNING *", user.Username, user.DisplayName, user.Email, user.Phone)
+		if err != nil {
+			return err
+		}
+
+		wallet, err = getWallet(tx, "INSERT INTO wallets (user_id, name, is_default, currency, balance) VALUES ($1, $2, TRUE, $3, 0) RETURNING *", user.ID, walletName, currency)
+		if err != nil {
+			return err
+		}
+
+		if actor.UserId == 0 {
+			actor.UserId = user.ID
+		}
+		details, err := auditDetails(map[string]interface{}{
+			"after": map[string]interface{}{"username": user.Username, "wallet_name": wallet.Name, "currency": wallet.Currency},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = appendAudit(tx, actor, model.AuditEntry{Action: model.AuditActionUserRegistered, UserId: &user.ID, WalletId: &wallet.ID, Details: details})
+		return err
+	})
+	if err := profileConflict(err); err != nil {
+		return model.User{}, model.Wallet{}, err
+	}
+	return user, wallet, nil
+}
+
+// UpdateProfile stores the display name, email and phone of the user.
+func (ur *userRepository) UpdateProfile(actor model.Actor, user model.User) (model.User, error) {
+	var updated model.User
+
+	err := withTransaction(ur.db, func(tx *sqlx.Tx) error {
+		var before model.User
+		if err := tx.Get(&before, "SELECT * FROM users WHERE id = $1 AND deletion_date IS NULL FOR UPDATE", user.ID); err != nil {
+			return err
+		}
+
+		err := tx.Get(&updated, "UPDATE users SET display_name = $1, email = $2, phone = $3, update_date = CURRENT_TIMESTAMP WHERE id = $4 RETURNING *", user.DisplayName, user.Email, user.Phone, user.ID)
+		if err != nil {
+			return err
+		}
+
+		details, err := auditDetails(map[string]interface{}{"before": profile(before), "after": profile(updated)})
+		if err != nil {
+			return err
+		}
+		_, err = appendAudit(tx, actor, model.AuditEntry{Action: model.AuditActionUserProfileUpdated, UserId: &updated.ID, Details: details})
+		return err
+	})
+	if err := profileConflict(err); err != nil {
+		return model.User{}, err
+	}
+	return updated, nil
+}
+
+// profile is the part of a user that UpdateProfile changes.
+func profile(user model.User) map[string]interface{} {
+	return map[string]interface{}{"display_name": user.DisplayName, "email": user.Email, "phone": user.Phone}
+}
+
+// profileConflict tells which unique field of a user a write collided on.
+func profileConflict(err error) error {
+	switch violatedUniqueIndex(err) {
+	case "users_username_idx":
+		return ErrUsernameTaken
+	case "users_email_idx":
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// Delete closes the account of a user whose wallets are all empty, as a
+// status change made by actor.
+func (ur *userRepository) Delete(actor model.Actor, userId int) error {
+	_, err := ur.SetStatus(actor, userId, model.StatusChange{ToStatus: model.StatusClosed, Reason: "account deleted by the user"})
+	return err
+}
+
+// SetStatus moves the user to change.ToStatus and records the change. Closing
+// the account is final: it needs every wallet of the user to be empty and
+// closes them too, revokes the user's sessions and soft-deletes the user. The
+// row is kept for the transactions that name it, and the username stays
+// taken.
+func (ur *userRepository) SetStatus(actor model.Actor, userId int, change model.StatusChange) (model.StatusChange, error) {
+	err := withTransaction(ur.db, func(tx *sqlx.Tx) error {
+		var status string
+		if err := tx.Get(&status, "SELECT status FROM users WHERE id = $1 AND deletion_date IS NULL FOR UPDATE", userId); err != nil {
+			return err
+		}
+
+		// locking the wallets waits for the movements in flight and keeps
+		// new ones from reading the old status
+		var wallets []model.Wallet
+		if err := tx.Select(&wallets, "SELECT * FROM wallets WHERE user_id = $1 ORDER BY id FOR UPDATE", userId); err != nil {
+			return err
+		}
+
+		if change.ToStatus == model.StatusClosed {
+			for _, wallet := range wallets {
+				if !wallet.Balance.IsZero() {
+					return ErrAccountNotEmpty
+				}
+			}
+			if err := closeUser(tx, actor, userId, wallets, change); err != nil {
+				return err
+			}
+		} else if _, err := tx.Exec("UPDATE users SET status = $1, update_date = CURRENT_TIMESTAMP WHERE id = $2", change.ToStatus, userId); err != nil {
+			return err
+		}
+
+		change.UserId, change.WalletId, change.FromStatus, change.ActorUserId = userId, nil, status, actor.UserId
+		var err error
+		change, err = recordStatusChange(tx, actor, change)
+		return err
+	})
+	if err != nil {
+		return model.StatusChange{}, err
+	}
+	return change, nil
+}
+
+// closeUser closes the user and every wallet of theirs still open, recording
+// the wallets' changes as part of change.
+func closeUser(tx *sqlx.Tx, actor model.Actor, userId int, wallets []model.Wallet, change model.StatusChange) error {
+	if _, err := tx.Exec("UPDATE users SET status = $1, deletion_date = CURRENT_TIMESTAMP, update_date = CURRENT_TIMESTAMP WHERE id = $2", model.StatusClosed, userId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE oauth_tokens SET revocation_date = CURRENT_TIMESTAMP WHERE user_id = $1 AND revocation_date IS NULL", userId); err != nil {
+		return err
+	}
+
+	for _, wallet := range wallets {
+		if wallet.Status == model.StatusClosed {
+			continue
+		}
+		if err := closeWallet(tx, wallet); err != nil {
+			return err
+		}
+		walletId := wallet.ID
+		walletChange := model.StatusChange{UserId: userId, WalletId: &walletId, FromStatus: wallet.Status, ToStatus: model.StatusClosed, Reason: change.Reason, ActorUserId: actor.UserId}
+		if _, err := recordStatusChange(tx, actor, walletChange); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (ur *userRepository) GetByIds(userIds []int) ([]model.User, error) {
 	var users []model.User
 
@@ -63,39 +248,388 @@ func (ur *userRepository) GetUserByUserId(userId int) ([]model.User, error) {
 	return user, nil
 }
 
-func (ur *userRepository) GetUserByToken(token string) (int, error) {
-	var userId int
-	err := ur.db.Get(&userId, "SELECT user_id FROM oauth WHERE token = $1", token)
+func (ur *userRepository) GetTransactionById(transactionId int) (model.Transaction, error) {
+	var transaction model.Transaction
+	err := ur.db.Get(&transaction, "SELECT * FROM transactions WHERE id = $1", transactionId)
 	if err != nil {
-		return 0, err
+		return model.Transaction{}, err
 	}
-	return userId, nil
+	return withCurrencies(transaction), nil
 }
 
-func (ur *userRepository) GetUserTransactionsByUserId(userId int) ([]model.Transaction, error) {
-	var transactions []model.Transaction
-	err := ur.db.Select(&transactions, "SELECT * FROM transactions WHERE sender_user_id = $1 ORDER BY creation_date DESC", userId)
-	if err != nil {
+// withCurrencies gives the scanned amounts of a transaction the currencies
+// stored next to them.
+func withCurrencies(transaction model.Transaction) model.Transaction {
+	transaction.Amount = money.New(transaction.Amount.Amount, transaction.Currency)
+	if transaction.DestinationAmount != nil && transaction.DestinationCurrency != nil {
+		destinationAmount := money.New(transaction.DestinationAmount.Amount, *transaction.DestinationCurrency)
+		transaction.DestinationAmount = &destinationAmount
+	}
+	return transaction
+}
+
+// transactionHistory lists every wallet entry of a user with the transaction
+// it belongs to. The running balance is summed over all entries of the wallet
+// account, including opening balances, before any filter is applied.
+const transactionHistory = `
+	SELECT t.*, e.entry_id, e.wallet_id, e.entry_amount, e.entry_currency, e.balance_after,
+		CASE WHEN t.sender_wallet_id = t.receiver_wallet_id THEN NULL WHEN e.entry_amount < 0 THEN t.receiver_user_id ELSE t.sender_user_id END AS counterparty_user_id,
+		(SELECT SUM(COALESCE(r.destination_amount, r.amount)) FROM transactions r WHERE r.reversal_of = t.id) AS reversed_amount
+	FROM (
+		SELECT e.id AS entry_id, p.transaction_id, a.wallet_id, e.amount AS entry_amount, e.currency AS entry_currency,
+			SUM(e.amount) OVER (PARTITION BY e.account_id ORDER BY e.id) AS balance_after
+		FROM ledger_entries e
+		JOIN ledger_accounts a ON a.id = e.account_id
+		JOIN ledger_postings p ON p.id = e.posting_id
+		WHERE a.wallet_id IN (SELECT id FROM wallets WHERE user_id = $1)
+	) e
+	JOIN transactions t ON t.id = e.transaction_id`
+
+// GetUserTransactionsByUserId returns the user's incoming and outgoing entries
+// matching filter, newest first unless it asks for the oldest first.
+func (ur *userRepository) GetUserTransactionsByUserId(userId int, filter model.TransactionFilter) ([]model.TransactionEntry, error) {
+	args := []interface{}{userId}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var conditions []string
+	if filter.Type != "" {
+		conditions = append(conditions, "h.type = "+arg(filter.Type))
+	}
+	switch filter.Direction {
+	case model.DirectionIncoming:
+		conditions = append(conditions, "h.entry_amount > 0")
+	case model.DirectionOutgoing:
+		conditions = append(conditions, "h.entry_amount < 0")
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "h.creation_date >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "h.creation_date < "+arg(*filter.To))
+	}
+	if filter.CounterpartyUserId != 0 {
+		conditions = append(conditions, "h.counterparty_user_id = "+arg(filter.CounterpartyUserId))
+	}
+	if filter.WalletId != 0 {
+		conditions = append(conditions, "h.wallet_id = "+arg(filter.WalletId))
+	}
+	if filter.BeforeEntryId != 0 {
+		conditions = append(conditions, "h.entry_id < "+arg(filter.BeforeEntryId))
+	}
+	if filter.AfterEntryId != 0 {
+		conditions = append(conditions, "h.entry_id > "+arg(filter.AfterEntryId))
+	}
+	if filter.MinAmount != nil || filter.MaxAmount != nil {
+		condition, err := ur.amountCondition(userId, filter.MinAmount, filter.MaxAmount, arg)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	query := "SELECT h.*, u.username AS counterparty FROM (" + transactionHistory + ") h LEFT JOIN users u ON u.id = h.counterparty_user_id"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if filter.OldestFirst {
+		query += " ORDER BY h.entry_id"
+	} else {
+		query += " ORDER BY h.entry_id DESC"
+	}
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	var entries []model.TransactionEntry
+	if err := ur.db.Select(&entries, query, args...); err != nil {
 		return nil, err
 	}
-	return transactions, nil
+
+	for i, entry := range entries {
+		entries[i].Transaction = withCurrencies(entry.Transaction)
+		entries[i].EntryAmount = money.New(entry.EntryAmount.Amount, entry.EntryCurrency)
+		entries[i].BalanceAfter = money.New(entry.BalanceAfter.Amount, entry.EntryCurrency)
+		if entry.ReversedAmount != nil {
+			reversedAmount := money.New(entry.ReversedAmount.Amount, entry.Currency)
+			entries[i].ReversedAmount = &reversedAmount
+		}
+	}
+	return entries, nil
 }
 
-func (r *userRepository) Transfer(senderUserId int, senderWalletId int, senderWalletBalance float64, receiverUserId int, receiverWalletId int, receiverWalletBalance float64, amount float64) error {
-	_, err := r.db.Exec("UPDATE wallets SET balance = $1 WHERE id = $2", senderWalletBalance, senderWalletId)
-	if err != nil {
+// amountCondition bounds the size of an entry in major units. Amounts are
+// stored in minor units of each wallet's currency, so the bounds are scaled
+// separately for every currency the user holds: a minimum rounds up and a
+// maximum rounds down to the currency's minor unit.
+func (ur *userRepository) amountCondition(userId int, minAmount *money.Decimal, maxAmount *money.Decimal, arg func(interface{}) string) (string, error) {
+	var currencies []money.Currency
+	if err := ur.db.Select(&currencies, "SELECT DISTINCT currency FROM wallets WHERE user_id = $1 ORDER BY currency", userId); err != nil {
+		return "", err
+	}
+	if len(currencies) == 0 {
+		return "FALSE", nil
+	}
+
+	perCurrency := make([]string, len(currencies))
+	for i, currency := range currencies {
+		condition := "h.entry_currency = " + arg(currency)
+		if minAmount != nil {
+			bound, err := money.RoundDecimal(*minAmount, currency, money.RoundUp)
+			if err != nil {
+				return "", err
+			}
+			condition += " AND ABS(h.entry_amount) >= " + arg(bound.Amount)
+		}
+		if maxAmount != nil {
+			bound, err := money.RoundDecimal(*maxAmount, currency, money.RoundDown)
+			if err != nil {
+				return "", err
+			}
+			condition += " AND ABS(h.entry_amount) <= " + arg(bound.Amount)
+		}
+		perCurrency[i] = "(" + condition + ")"
+	}
+	return "(" + strings.Join(perCurrency, " OR ") + ")", nil
+}
+
+// Transfer moves amount between two wallets in a single database transaction.
+// Both wallet rows are locked before the balances are read, so concurrent
+// transfers touching the same wallets are serialized instead of losing updates.
+//
+// amount is in the sender wallet's currency. A transfer into a wallet of
+// another currency needs a conversion, which sets the amount credited to the
+// receiver; same-currency transfers take none. A fee, when given, is taken
+// from the sender on top of amount and paid into the house wallet. check,
+// when given, vets the transfer against the locked sender wallet.
+func (r *userRepository) Transfer(actor model.Actor, senderWalletId int, receiverWalletId int, amount money.Money, conversion *model.Conversion, fee *model.Fee, check MovementCheck) error {
+	return withTransaction(r.db, func(tx *sqlx.Tx) error {
+		_, err := transfer(tx, actor, senderWalletId, receiverWalletId, amount, conversion, fee, check)
 		return err
+	})
+}
+
+// transfer does the work of Transfer inside tx and returns the ID of the
+// recorded transaction. Only the sender's available balance, what is left
+// after its active holds, can be sent.
+func transfer(tx *sqlx.Tx, actor model.Actor, senderWalletId int, receiverWalletId int, amount money.Money, conversion *model.Conversion, fee *model.Fee, check MovementCheck) (int, error) {
+	if !amount.IsPositive() {
+		return 0, ErrInvalidAmount
+	}
+	if conversion != nil && !conversion.Amount.IsPositive() {
+		return 0, ErrInvalidAmount
 	}
 
-	_, err = r.db.Exec("UPDATE wallets SET balance = $1 WHERE id = $2", receiverWalletBalance, receiverWalletId)
+	if err := lockOwner(tx, senderWalletId, check); err != nil {
+		return 0, err
+	}
+	wallets, err := lockWallets(tx, append(feeWalletIds(fee), senderWalletId, receiverWalletId)...)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	senderWallet := wallets[senderWalletId]
+	receiverWallet := wallets[receiverWalletId]
+	if err := ensureCanSend(tx, senderWallet); err != nil {
+		return 0, err
+	}
+	if err := ensureCanReceive(tx, receiverWallet); err != nil {
+		return 0, err
+	}
+
+	destination := amount
+	if conversion != nil {
+		destination = conversion.Amount
+	}
+	if amount.Currency != senderWallet.Currency || destination.Currency != receiverWallet.Currency {
+		return 0, fmt.Errorf("%w: %s to %s transfer between a %s and a %s wallet", money.ErrCurrencyMismatch, amount.Currency, destination.Currency, senderWallet.Currency, receiverWallet.Currency)
 	}
 
-	_, err = r.db.Exec("INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, type) VALUES ($1, $2, $3, $4, $5, $6)", senderUserId, senderWalletId, receiverUserId, receiverWalletId, amount, "transfer")
+	required, err := withFee(amount, fee)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	available, err := availableBalance(tx, senderWallet)
+	if err != nil {
+		return 0, err
+	}
+	if available.LessThan(required) {
+		return 0, ErrInsufficientFunds
+	}
+	if err := checkMovement(tx, senderWallet, check); err != nil {
+		return 0, err
 	}
 
-	return nil
+	var transactionId int
+	var posting ledger.Posting
+	if conversion == nil {
+		err = tx.Get(&transactionId, "INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, currency, type) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", senderWallet.UserId, senderWallet.ID, receiverWallet.UserId, receiverWallet.ID, amount, amount.Currency, model.TransactionTypeTransfer)
+		posting = ledger.Transfer(transactionId, senderWallet.ID, receiverWallet.ID, amount)
+	} else {
+		err = tx.Get(&transactionId, "INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, currency, destination_amount, destination_currency, exchange_rate, type) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id", senderWallet.UserId, senderWallet.ID, receiverWallet.UserId, receiverWallet.ID, amount, amount.Currency, destination, destination.Currency, conversion.Rate, model.TransactionTypeTransfer)
+		posting = ledger.Exchange(transactionId, senderWallet.ID, receiverWallet.ID, amount, destination)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := ledger.Post(tx, posting); err != nil {
+		return 0, err
+	}
+
+	if fee != nil {
+		if err := chargeFee(tx, senderWallet, wallets[fee.HouseWalletId], transactionId, *fee); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := publishMovement(tx, model.EventTypeWalletTransferred, transactionId); err != nil {
+		return 0, err
+	}
+
+	details := map[string]interface{}{
+		"receiver_user_id":   receiverWallet.UserId,
+		"receiver_wallet_id": receiverWallet.ID,
+		"amount":             amount,
+		"currency":           amount.Currency,
+	}
+	if conversion != nil {
+		details["destination_amount"], details["destination_currency"], details["exchange_rate"] = destination, destination.Currency, conversion.Rate
+	}
+	if fee != nil {
+		details["fee"] = fee.Amount
+	}
+	err = auditMovement(tx, actor, model.AuditEntry{Action: model.AuditActionWalletTransferred, UserId: &senderWallet.UserId, WalletId: &senderWallet.ID, TransactionId: &transactionId}, details, wallets)
+	if err != nil {
+		return 0, err
+	}
+	return transactionId, nil
+}
+
+// Reverse books a compensating transaction that returns amount, or everything
+// not yet reversed when amount is nil, to where the original transaction took
+// it from: a deposit back to cash-in, a transfer back to the sender. The
+// amount is in the original transaction's currency. Reversals of one
+// transaction are serialized on its row and never exceed its amount. Unless
+// force is set, the wallet giving the money back must hold enough of it; it
+// must be allowed to send money either way.
+func (r *userRepository) Reverse(actor model.Actor, transactionId int, amount *money.Money, force bool) (model.Transaction, error) {
+	var reversal model.Transaction
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		var original model.Transaction
+		if err := tx.Get(&original, "SELECT * FROM transactions WHERE id = $1 FOR UPDATE", transactionId); err != nil {
+			return err
+		}
+		original = withCurrencies(original)
+		if original.Type != model.TransactionTypeDeposit && original.Type != model.TransactionTypeTransfer {
+			return ErrNotReversible
+		}
+
+		var reversed struct {
+			Source      int64 `db:"source"`
+			Destination int64 `db:"destination"`
+		}
+		err := tx.Get(&reversed, "SELECT COALESCE(SUM(COALESCE(destination_amount, amount)), 0) AS source, COALESCE(SUM(amount), 0) AS destination FROM transactions WHERE reversal_of = $1", original.ID)
+		if err != nil {
+			return err
+		}
+
+		remaining := original.Amount.Amount - reversed.Source
+		if remaining <= 0 {
+			return ErrAlreadyReversed
+		}
+		refund := money.New(remaining, original.Currency)
+		if amount != nil {
+			if amount.Currency != original.Currency {
+				return fmt.Errorf("%w: %s reversal of a %s transaction", money.ErrCurrencyMismatch, amount.Currency, original.Currency)
+			}
+			if !amount.IsPositive() {
+				return ErrInvalidAmount
+			}
+			if amount.Amount > remaining {
+				return ErrReversalExceedsAmount
+			}
+			refund = *amount
+		}
+
+		// the wallet that received the money pays it back
+		debit := refund
+		if original.DestinationAmount != nil {
+			// prorate cumulatively, so partial reversals add up to exactly
+			// the converted amount once the whole transfer is reversed
+			total, err := original.DestinationAmount.Prorate(reversed.Source+refund.Amount, original.Amount.Amount, money.RoundHalfEven)
+			if err != nil {
+				return err
+			}
+			debit = money.New(total.Amount-reversed.Destination, total.Currency)
+		}
+		if !debit.IsPositive() {
+			return ErrInvalidAmount
+		}
+
+		wallets, err := lockWallets(tx, original.SenderWalletId, original.ReceiverWalletId)
+		if err != nil {
+			return err
+		}
+		payer := wallets[original.ReceiverWalletId]
+		payee := wallets[original.SenderWalletId]
+		if err := ensureCanSend(tx, payer); err != nil {
+			return err
+		}
+		if err := ensureCanReceive(tx, payee); err != nil {
+			return err
+		}
+		if !force {
+			available, err := availableBalance(tx, payer)
+			if err != nil {
+				return err
+			}
+			if available.LessThan(debit) {
+				return ErrInsufficientFunds
+			}
+		}
+
+		var destinationAmount *money.Money
+		var destinationCurrency *money.Currency
+		if original.DestinationAmount != nil {
+			destinationAmount, destinationCurrency = &refund, &refund.Currency
+		}
+		err = tx.Get(&reversal, "INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, currency, destination_amount, destination_currency, reversal_of, type) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *", payer.UserId, payer.ID, payee.UserId, payee.ID, debit, debit.Currency, destinationAmount, destinationCurrency, original.ID, model.TransactionTypeReversal)
+		if err != nil {
+			return err
+		}
+
+		var posting ledger.Posting
+		switch {
+		case original.Type == model.TransactionTypeDeposit:
+			posting = ledger.DepositReversal(reversal.ID, payer.ID, debit)
+		case original.DestinationAmount != nil:
+			posting = ledger.Exchange(reversal.ID, payer.ID, payee.ID, debit, refund)
+		default:
+			posting = ledger.Transfer(reversal.ID, payer.ID, payee.ID, debit)
+		}
+		posting.Type = ledger.PostingTypeReversal
+		if _, err := ledger.Post(tx, posting); err != nil {
+			return err
+		}
+
+		if err := publishMovement(tx, model.EventTypeTransactionReversed, reversal.ID); err != nil {
+			return err
+		}
+
+		details := map[string]interface{}{
+			"reversal_of":     original.ID,
+			"payee_wallet_id": payee.ID,
+			"amount":          debit,
+			"currency":        debit.Currency,
+			"force":           force,
+		}
+		return auditMovement(tx, actor, model.AuditEntry{Action: model.AuditActionTransactionReversed, UserId: &payer.UserId, WalletId: &payer.ID, TransactionId: &reversal.ID}, details, wallets)
+	})
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	return withCurrencies(reversal), nil
 }
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+func TestRegisterKeepsUsernamesAndEmailsUnique(t *testing.T) {
+	db := connectTestDatabase(t)
+	users := NewUserRepository(db)
+	var username string
+	assert.NoError(t, db.Get(&username, "SELECT 'test-' || md5(random()::text)"))
+	email := username + "@example.com"
+
+	user, wallet, err := users.Register(model.SystemActor, model.User{Username: username, Email: &email}, "main", money.DefaultCurrency)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+	assert.Equal(t, model.RoleUser, user.Role)
+	assert.Equal(t, user.ID, wallet.UserId)
+	assert.True(t, wallet.IsDefault)
+
+	// emails are compared without case
+	upperEmail := strings.ToUpper(email)
+	_, _, err = users.Register(model.SystemActor, model.User{Username: username}, "main", money.DefaultCurrency)
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+	_, _, err = users.Register(model.SystemActor, model.User{Username: username + "-2", Email: &upperEmail}, "main", money.DefaultCurrency)
+	assert.ErrorIs(t, err, ErrEmailTaken)
+}
+
+func TestDeleteOnlyClosesEmptyAccounts(t *testing.T) {
+	db := connectTestDatabase(t)
+	users := NewUserRepository(db)
+	wallets := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 100)
+
+	assert.ErrorIs(t, users.Delete(model.SystemActor, wallet.UserId), ErrAccountNotEmpty)
+
+	_, err := wallets.Update(model.SystemActor, wallet.ID, money.New(100, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, users.Delete(model.SystemActor, wallet.UserId))
+
+	_, err = users.GetById(wallet.UserId)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = wallets.GetById(wallet.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, users.Delete(model.SystemActor, wallet.UserId), sql.ErrNoRows)
+
+	// staff still find the closed account
+	deleted, err := users.GetByIdIncludingDeleted(wallet.UserId)
+	assert.NoError(t, err)
+	assert.NotNil(t, deleted.DeletionDate)
+	closed, err := wallets.GetByIdIncludingDeleted(wallet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusClosed, closed.Status)
+	assert.NotNil(t, closed.DeletionDate)
+}
@@ -1,15 +1,32 @@
 package repository
 
 import (
+	"fmt"
+
 	"github.com/jmoiron/sqlx"
 
+	"go-wallet-service/internal/ledger"
 	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+
+	"go-wallet-service/utils"
 )
 
+var ErrWalletNameTaken = utils.Conflict("wallet_name_taken", "the user already has a wallet with this name")
+
 type WalletRepository interface {
 	GetWalletByUserId(userId int) ([]model.Wallet, error)
+	GetAllWalletsByUserId(userId int) ([]model.Wallet, error)
+	GetDefaultWalletByUserId(userId int) (model.Wallet, error)
 	GetById(walletId int) (model.Wallet, error)
-	Update(wallet model.Wallet, amount float64, transactionType string) error
+	GetByIdIncludingDeleted(walletId int) (model.Wallet, error)
+	GetAvailableBalance(walletId int) (money.Money, error)
+	Create(actor model.Actor, userId int, name string, currency money.Currency, isDefault bool) (model.Wallet, error)
+	Rename(actor model.Actor, walletId int, name string) (model.Wallet, error)
+	SetDefault(actor model.Actor, walletId int) (model.Wallet, error)
+	Update(actor model.Actor, walletId int, amount money.Money, transactionType string, fee *model.Fee, check MovementCheck) (model.Wallet, error)
+	SetStatus(actor model.Actor, walletId int, change model.StatusChange) (model.StatusChange, error)
+	Adjust(actor model.Actor, adjustment model.Adjustment) (model.Transaction, error)
 }
 
 type walletRepository struct {
@@ -20,31 +37,389 @@ func NewWalletRepository(db *sqlx.DB) *walletRepository {
 	return &walletRepository{db: db}
 }
 
+// GetWalletByUserId lists the user's wallets that are not closed.
 func (r *walletRepository) GetWalletByUserId(userId int) ([]model.Wallet, error) {
 	var wallet []model.Wallet
-	err := r.db.Select(&wallet, "SELECT * FROM wallets WHERE user_id = $1", userId)
+	err := r.db.Select(&wallet, "SELECT * FROM wallets WHERE user_id = $1 AND deletion_date IS NULL ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range wallet {
+		wallet[i].Balance = money.New(wallet[i].Balance.Amount, wallet[i].Currency)
+	}
+	return wallet, nil
+}
+
+// GetAllWalletsByUserId lists every wallet of the user, closed ones too.
+func (r *walletRepository) GetAllWalletsByUserId(userId int) ([]model.Wallet, error) {
+	var wallet []model.Wallet
+	err := r.db.Select(&wallet, "SELECT * FROM wallets WHERE user_id = $1 ORDER BY id", userId)
 	if err != nil {
 		return nil, err
 	}
+	for i := range wallet {
+		wallet[i].Balance = money.New(wallet[i].Balance.Amount, wallet[i].Currency)
+	}
+	return wallet, nil
+}
+
+// GetDefaultWalletByUserId returns the user's default wallet, falling back to
+// the oldest open wallet for users that never picked one or closed it.
+func (r *walletRepository) GetDefaultWalletByUserId(userId int) (model.Wallet, error) {
+	wallet, err := getWallet(r.db, "SELECT w.* FROM wallets w JOIN users u ON u.id = w.user_id WHERE w.user_id = $1 AND w.deletion_date IS NULL AND u.deletion_date IS NULL ORDER BY w.is_default DESC, w.id LIMIT 1", userId)
+	if err != nil {
+		return model.Wallet{}, err
+	}
 	return wallet, nil
 }
 
+// Create adds a wallet holding currency with a zero balance. A user's first
+// wallet always becomes the default one.
+func (r *walletRepository) Create(actor model.Actor, userId int, name string, currency money.Currency, isDefault bool) (model.Wallet, error) {
+	var wallet model.Wallet
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		// the user row serializes wallet creation and default changes per user
+		if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", userId); err != nil {
+			return err
+		}
+
+		var walletCount int
+		if err := tx.Get(&walletCount, "SELECT COUNT(*) FROM wallets WHERE user_id = $1 AND deletion_date IS NULL", userId); err != nil {
+			return err
+		}
+
+		isDefault = isDefault || walletCount == 0
+		if isDefault {
+			if _, err := tx.Exec("UPDATE wallets SET is_default = FALSE WHERE user_id = $1 AND is_default", userId); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		wallet, err = getWallet(tx, "INSERT INTO wallets (user_id, name, is_default, currency, balance) VALUES ($1, $2, $3, $4, 0) RETURNING *", userId, name, isDefault, currency)
+		if err != nil {
+			return err
+		}
+		return auditWallet(tx, actor, model.AuditActionWalletCreated, wallet, nil, map[string]interface{}{"name": wallet.Name, "currency": wallet.Currency, "is_default": wallet.IsDefault})
+	})
+	if isUniqueViolation(err) {
+		return model.Wallet{}, ErrWalletNameTaken
+	}
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	return wallet, nil
+}
+
+func (r *walletRepository) Rename(actor model.Actor, walletId int, name string) (model.Wallet, error) {
+	var wallet model.Wallet
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		before, err := getWallet(tx, "SELECT * FROM wallets WHERE id = $1 FOR UPDATE", walletId)
+		if err != nil {
+			return err
+		}
+
+		wallet, err = getWallet(tx, "UPDATE wallets SET name = $1, update_date = CURRENT_TIMESTAMP WHERE id = $2 RETURNING *", name, walletId)
+		if err != nil {
+			return err
+		}
+		return auditWallet(tx, actor, model.AuditActionWalletRenamed, wallet, map[string]interface{}{"name": before.Name}, map[string]interface{}{"name": wallet.Name})
+	})
+	if isUniqueViolation(err) {
+		return model.Wallet{}, ErrWalletNameTaken
+	}
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	return wallet, nil
+}
+
+// SetDefault makes the wallet its owner's default wallet. Closed wallets are
+// not found.
+func (r *walletRepository) SetDefault(actor model.Actor, walletId int) (model.Wallet, error) {
+	var wallet model.Wallet
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		var userId int
+		err := tx.Get(&userId, "SELECT u.id FROM users u JOIN wallets w ON w.user_id = u.id WHERE w.id = $1 AND w.deletion_date IS NULL FOR UPDATE OF u", walletId)
+		if err != nil {
+			return err
+		}
+
+		var previous []int
+		if err := tx.Select(&previous, "UPDATE wallets SET is_default = FALSE WHERE user_id = $1 AND is_default RETURNING id", userId); err != nil {
+			return err
+		}
+
+		wallet, err = getWallet(tx, "UPDATE wallets SET is_default = TRUE, update_date = CURRENT_TIMESTAMP WHERE id = $1 RETURNING *", walletId)
+		if err != nil {
+			return err
+		}
+		var before map[string]interface{}
+		if len(previous) > 0 {
+			before = map[string]interface{}{"default_wallet_id": previous[0]}
+		}
+		return auditWallet(tx, actor, model.AuditActionWalletDefaultSet, wallet, before, map[string]interface{}{"default_wallet_id": wallet.ID})
+	})
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	return wallet, nil
+}
+
+// GetById returns the wallet unless its owner deleted their account, so the
+// wallets of closed accounts can no longer be paid into.
 func (r *walletRepository) GetById(walletId int) (model.Wallet, error) {
+	wallet, err := getWallet(r.db, "SELECT w.* FROM wallets w JOIN users u ON u.id = w.user_id WHERE w.id = $1 AND u.deletion_date IS NULL", walletId)
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	return wallet, nil
+}
+
+// GetByIdIncludingDeleted returns the wallet even when it or its owner's
+// account was closed, for staff looking into closed accounts.
+func (r *walletRepository) GetByIdIncludingDeleted(walletId int) (model.Wallet, error) {
+	return getWallet(r.db, "SELECT * FROM wallets WHERE id = $1", walletId)
+}
+
+// GetAvailableBalance returns what can be withdrawn or sent from the wallet:
+// its balance less its active holds. Closed wallets are answered too.
+func (r *walletRepository) GetAvailableBalance(walletId int) (money.Money, error) {
+	wallet, err := r.GetByIdIncludingDeleted(walletId)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return availableBalance(r.db, wallet)
+}
+
+// Update applies a deposit or withdrawal to the wallet against its locked row,
+// records the transaction, posts it to the ledger and audits it as done by
+// actor, returning the wallet as committed. The amount must be in the
+// wallet's currency. check, when given, vets the movement against the locked
+// wallet.
+func (r *walletRepository) Update(actor model.Actor, walletId int, amount money.Money, transactionType string, fee *model.Fee, check MovementCheck) (model.Wallet, error) {
 	var wallet model.Wallet
 
-	err := r.db.Get(&wallet, "SELECT * FROM wallets WHERE id = $1", walletId)
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		var err error
+		wallet, _, err = update(tx, actor, walletId, amount, transactionType, fee, check)
+		return err
+	})
 	if err != nil {
 		return model.Wallet{}, err
 	}
 	return wallet, nil
 }
 
-func (r *walletRepository) Update(wallet model.Wallet, amount float64, transactionType string) error {
-	_, err := r.db.Exec("UPDATE wallets SET balance = $1 WHERE id = $2", wallet.Balance, wallet.ID)
+// update does the work of Update inside tx and also returns the ID of the
+// recorded transaction. A withdrawal can only take the available balance,
+// what is left after the wallet's active holds.
+func update(tx *sqlx.Tx, actor model.Actor, walletId int, amount money.Money, transactionType string, fee *model.Fee, check MovementCheck) (model.Wallet, int, error) {
+	if !amount.IsPositive() {
+		return model.Wallet{}, 0, ErrInvalidAmount
+	}
+	if fee != nil && transactionType != model.TransactionTypeWithdraw {
+		return model.Wallet{}, 0, fmt.Errorf("fees are not charged on %s transactions", transactionType)
+	}
+
+	if err := lockOwner(tx, walletId, check); err != nil {
+		return model.Wallet{}, 0, err
+	}
+	wallets, err := lockWallets(tx, append(feeWalletIds(fee), walletId)...)
+	if err != nil {
+		return model.Wallet{}, 0, err
+	}
+	wallet := wallets[walletId]
+
+	if amount.Currency != wallet.Currency {
+		return model.Wallet{}, 0, fmt.Errorf("%w: %s amount for a %s wallet", money.ErrCurrencyMismatch, amount.Currency, wallet.Currency)
+	}
+
+	switch transactionType {
+	case model.TransactionTypeDeposit:
+		if err := ensureCanReceive(tx, wallet); err != nil {
+			return model.Wallet{}, 0, err
+		}
+	case model.TransactionTypeWithdraw:
+		if err := ensureCanSend(tx, wallet); err != nil {
+			return model.Wallet{}, 0, err
+		}
+		required, err := withFee(amount, fee)
+		if err != nil {
+			return model.Wallet{}, 0, err
+		}
+		available, err := availableBalance(tx, wallet)
+		if err != nil {
+			return model.Wallet{}, 0, err
+		}
+		if available.LessThan(required) {
+			return model.Wallet{}, 0, ErrInsufficientFunds
+		}
+	default:
+		return model.Wallet{}, 0, fmt.Errorf("unsupported transaction type %q", transactionType)
+	}
+	if err := checkMovement(tx, wallet, check); err != nil {
+		return model.Wallet{}, 0, err
+	}
+
+	var transactionId int
+	err = tx.Get(&transactionId, "INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, currency, type) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", wallet.UserId, wallet.ID, wallet.UserId, wallet.ID, amount, amount.Currency, transactionType)
 	if err != nil {
+		return model.Wallet{}, 0, err
+	}
+
+	posting := ledger.Deposit(transactionId, wallet.ID, amount)
+	if transactionType == model.TransactionTypeWithdraw {
+		posting = ledger.Withdrawal(transactionId, wallet.ID, amount)
+	}
+	if _, err := ledger.Post(tx, posting); err != nil {
+		return model.Wallet{}, 0, err
+	}
+
+	if fee != nil {
+		if err := chargeFee(tx, wallet, wallets[fee.HouseWalletId], transactionId, *fee); err != nil {
+			return model.Wallet{}, 0, err
+		}
+	}
+
+	action, eventType := model.AuditActionWalletDeposited, model.EventTypeWalletDeposited
+	if transactionType == model.TransactionTypeWithdraw {
+		action, eventType = model.AuditActionWalletWithdrawn, model.EventTypeWalletWithdrawn
+	}
+	if err := publishMovement(tx, eventType, transactionId); err != nil {
+		return model.Wallet{}, 0, err
+	}
+	details := map[string]interface{}{"amount": amount, "currency": amount.Currency}
+	if fee != nil {
+		details["fee"] = fee.Amount
+	}
+	err = auditMovement(tx, actor, model.AuditEntry{Action: action, UserId: &wallet.UserId, WalletId: &wallet.ID, TransactionId: &transactionId}, details, wallets)
+	if err != nil {
+		return model.Wallet{}, 0, err
+	}
+
+	wallet, err = getWallet(tx, "SELECT * FROM wallets WHERE id = $1", wallet.ID)
+	if err != nil {
+		return model.Wallet{}, 0, err
+	}
+	return wallet, transactionId, nil
+}
+
+// SetStatus moves the wallet to change.ToStatus and records the change. A
+// closed wallet stays closed; closing one needs it to be empty.
+func (r *walletRepository) SetStatus(actor model.Actor, walletId int, change model.StatusChange) (model.StatusChange, error) {
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		wallets, err := lockWallets(tx, walletId)
+		if err != nil {
+			return err
+		}
+		wallet := wallets[walletId]
+
+		if wallet.Status == model.StatusClosed {
+			return ErrStatusFinal
+		}
+		if change.ToStatus == model.StatusClosed {
+			err = closeWallet(tx, wallet)
+		} else {
+			_, err = tx.Exec("UPDATE wallets SET status = $1, update_date = CURRENT_TIMESTAMP WHERE id = $2", change.ToStatus, walletId)
+		}
+		if err != nil {
+			return err
+		}
+
+		change.UserId, change.WalletId, change.FromStatus, change.ActorUserId = wallet.UserId, &walletId, wallet.Status, actor.UserId
+		change, err = recordStatusChange(tx, actor, change)
 		return err
+	})
+	if err != nil {
+		return model.StatusChange{}, err
 	}
+	return change, nil
+}
 
-	_, err = r.db.Exec("INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, type) VALUES ($1, $2, $3, $4, $5, $6)", wallet.UserId, wallet.ID, wallet.UserId, wallet.ID, amount, transactionType)
+// Adjust books a manual credit or debit of the wallet together with the audit
+// entry of the member of staff who made it. A debit can only take the
+// available balance, and the wallet's status applies as to any other
+// movement.
+func (r *walletRepository) Adjust(actor model.Actor, adjustment model.Adjustment) (model.Transaction, error) {
+	amount := adjustment.Amount
+	if !amount.IsPositive() {
+		return model.Transaction{}, ErrInvalidAmount
+	}
+
+	var transaction model.Transaction
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		wallets, err := lockWallets(tx, adjustment.WalletId)
+		if err != nil {
+			return err
+		}
+		wallet := wallets[adjustment.WalletId]
+
+		if amount.Currency != wallet.Currency {
+			return fmt.Errorf("%w: %s adjustment of a %s wallet", money.ErrCurrencyMismatch, amount.Currency, wallet.Currency)
+		}
+		switch adjustment.Type {
+		case model.TransactionTypeCredit:
+			if err := ensureCanReceive(tx, wallet); err != nil {
+				return err
+			}
+		case model.TransactionTypeDebit:
+			if err := ensureCanSend(tx, wallet); err != nil {
+				return err
+			}
+			available, err := availableBalance(tx, wallet)
+			if err != nil {
+				return err
+			}
+			if available.LessThan(amount) {
+				return ErrInsufficientFunds
+			}
+		default:
+			return fmt.Errorf("unsupported adjustment type %q", adjustment.Type)
+		}
+
+		err = tx.Get(&transaction, "INSERT INTO transactions (sender_user_id, sender_wallet_id, receiver_user_id, receiver_wallet_id, amount, currency, reason_code, type) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *", wallet.UserId, wallet.ID, wallet.UserId, wallet.ID, amount, amount.Currency, adjustment.ReasonCode, adjustment.Type)
+		if err != nil {
+			return err
+		}
+
+		posting := ledger.Credit(transaction.ID, wallet.ID, amount)
+		if adjustment.Type == model.TransactionTypeDebit {
+			posting = ledger.Debit(transaction.ID, wallet.ID, amount)
+		}
+		if _, err := ledger.Post(tx, posting); err != nil {
+			return err
+		}
+
+		if err := publishMovement(tx, model.EventTypeWalletAdjusted, transaction.ID); err != nil {
+			return err
+		}
+
+		details := map[string]interface{}{
+			"type":        adjustment.Type,
+			"amount":      amount,
+			"currency":    amount.Currency,
+			"reason_code": adjustment.ReasonCode,
+			"note":        adjustment.Note,
+		}
+		return auditMovement(tx, actor, model.AuditEntry{Action: model.AuditActionWalletAdjusted, UserId: &wallet.UserId, WalletId: &wallet.ID, TransactionId: &transaction.ID}, details, wallets)
+	})
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	return withCurrencies(transaction), nil
+}
+
+// auditWallet records a change to the wallet other than a movement of money,
+// with the values it changed.
+func auditWallet(tx *sqlx.Tx, actor model.Actor, action string, wallet model.Wallet, before map[string]interface{}, after map[string]interface{}) error {
+	details, err := auditDetails(map[string]interface{}{"before": before, "after": after})
+	if err != nil {
+		return err
+	}
+	_, err = appendAudit(tx, actor, model.AuditEntry{Action: action, UserId: &wallet.UserId, WalletId: &wallet.ID, Details: details})
 	return err
 }
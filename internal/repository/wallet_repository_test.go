@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/ledger"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+// connectTestDatabase connects to the database in TEST_DATABASE_URL, which
+// must already hold the schema from the README. Tests are skipped without it.
+func connectTestDatabase(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	databaseUrl := os.Getenv("TEST_DATABASE_URL")
+	if databaseUrl == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sqlx.Connect("postgres", databaseUrl)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createTestWallet(t *testing.T, db *sqlx.DB, balance int64) model.Wallet {
+	t.Helper()
+
+	var userId int
+	if err := db.Get(&userId, "INSERT INTO users (username) VALUES ('test-' || md5(random()::text)) RETURNING id"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", userId) })
+
+	var wallet model.Wallet
+	if err := db.Get(&wallet, "INSERT INTO wallets (user_id, name, is_default, balance) VALUES ($1, 'main', TRUE, 0) RETURNING *", userId); err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+
+	// fund the wallet through the ledger so the invariants hold afterwards
+	wallet, err := NewWalletRepository(db).Update(model.SystemActor, wallet.ID, money.New(balance, money.DefaultCurrency), model.TransactionTypeDeposit, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to fund wallet: %v", err)
+	}
+	return wallet
+}
+
+func assertLedgerConsistent(t *testing.T, db *sqlx.DB) {
+	t.Helper()
+
+	report, err := ledger.Check(db)
+	assert.NoError(t, err)
+	assert.True(t, report.OK(), "ledger inconsistent: %+v", report)
+}
+
+func TestWalletUpdateConcurrent(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+	deposit := money.New(30, money.DefaultCurrency)
+	withdrawal := money.New(10, money.DefaultCurrency)
+
+	const workers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := repository.Update(model.SystemActor, wallet.ID, deposit, model.TransactionTypeDeposit, nil, nil)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := repository.Update(model.SystemActor, wallet.ID, withdrawal, model.TransactionTypeWithdraw, nil, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	updated, err := repository.GetById(wallet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000+workers*30-workers*10), updated.Balance.Amount)
+
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM transactions WHERE sender_wallet_id = $1", wallet.ID))
+	assert.Equal(t, workers*2+1, count)
+	assertLedgerConsistent(t, db)
+}
+
+func TestWalletUpdateRejectsOverdraw(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 100)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repository.Update(model.SystemActor, wallet.ID, money.New(10, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, nil)
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, ErrInsufficientFunds)
+		}()
+	}
+	wg.Wait()
+
+	updated, err := repository.GetById(wallet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, succeeded)
+	assert.True(t, updated.Balance.IsZero())
+	assertLedgerConsistent(t, db)
+}
+
+func TestWalletUpdateChecksUsageAfterLocking(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+	errOverLimit := errors.New("over limit")
+	// allow at most 100 withdrawn a day, counting what is already withdrawn
+	check := func(wallet model.Wallet, limits LimitRepository) error {
+		usage, err := limits.GetUsage(wallet, model.LimitScopeWallet, model.TransactionTypeWithdraw, 24*time.Hour)
+		if err != nil {
+			return err
+		}
+		if usage.Total.Amount+10 > 100 {
+			return errOverLimit
+		}
+		return nil
+	}
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repository.Update(model.SystemActor, wallet.ID, money.New(10, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, check)
+			if err != nil {
+				assert.ErrorIs(t, err, errOverLimit)
+			}
+		}()
+	}
+	wg.Wait()
+
+	updated, err := repository.GetById(wallet.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(900), updated.Balance.Amount)
+	assertLedgerConsistent(t, db)
+}
+
+func TestTransferConcurrentOppositeDirections(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewUserRepository(db)
+	first := createTestWallet(t, db, 500)
+	second := createTestWallet(t, db, 500)
+
+	const workers = 25
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, repository.Transfer(model.SystemActor, first.ID, second.ID, money.New(7, money.DefaultCurrency), nil, nil, nil))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, repository.Transfer(model.SystemActor, second.ID, first.ID, money.New(3, money.DefaultCurrency), nil, nil, nil))
+		}()
+	}
+	wg.Wait()
+
+	walletRepository := NewWalletRepository(db)
+	updatedFirst, err := walletRepository.GetById(first.ID)
+	assert.NoError(t, err)
+	updatedSecond, err := walletRepository.GetById(second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500-workers*7+workers*3), updatedFirst.Balance.Amount)
+	assert.Equal(t, int64(500+workers*7-workers*3), updatedSecond.Balance.Amount)
+	assertLedgerConsistent(t, db)
+}
+
+func TestTransferAcrossCurrencies(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewUserRepository(db)
+	walletRepository := NewWalletRepository(db)
+	sender := createTestWallet(t, db, 1000)
+	receiver, err := walletRepository.Create(model.SystemActor, sender.UserId, "yen", "JPY", false)
+	assert.NoError(t, err)
+
+	rate, err := money.ParseDecimal("151.37")
+	assert.NoError(t, err)
+	conversion := model.Conversion{Rate: rate, Amount: money.New(757, "JPY")}
+
+	assert.ErrorIs(t, repository.Transfer(model.SystemActor, sender.ID, receiver.ID, money.New(500, "USD"), nil, nil, nil), money.ErrCurrencyMismatch)
+	assert.NoError(t, repository.Transfer(model.SystemActor, sender.ID, receiver.ID, money.New(500, "USD"), &conversion, nil, nil))
+
+	updatedSender, err := walletRepository.GetById(sender.ID)
+	assert.NoError(t, err)
+	updatedReceiver, err := walletRepository.GetById(receiver.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(500, "USD"), updatedSender.Balance)
+	assert.Equal(t, money.New(757, "JPY"), updatedReceiver.Balance)
+
+	var transaction model.Transaction
+	assert.NoError(t, db.Get(&transaction, "SELECT * FROM transactions WHERE receiver_wallet_id = $1", receiver.ID))
+	assert.Equal(t, "151.37", transaction.ExchangeRate.String())
+	assert.Equal(t, int64(757), transaction.DestinationAmount.Amount)
+	assertLedgerConsistent(t, db)
+}
+
+func TestTransactionHistoryShowsBothSides(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewUserRepository(db)
+	sender := createTestWallet(t, db, 1000)
+	receiver := createTestWallet(t, db, 0)
+	assert.NoError(t, repository.Transfer(model.SystemActor, sender.ID, receiver.ID, money.New(250, money.DefaultCurrency), nil, nil, nil))
+	assert.NoError(t, repository.Transfer(model.SystemActor, sender.ID, receiver.ID, money.New(100, money.DefaultCurrency), nil, nil, nil))
+
+	received, err := repository.GetUserTransactionsByUserId(receiver.UserId, model.TransactionFilter{Type: model.TransactionTypeTransfer})
+	assert.NoError(t, err)
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, model.DirectionIncoming, received[0].Direction())
+		assert.Equal(t, money.New(350, money.DefaultCurrency), received[0].BalanceAfter)
+		assert.Equal(t, money.New(250, money.DefaultCurrency), received[1].BalanceAfter)
+		assert.Equal(t, sender.UserId, *received[0].CounterpartyUserId)
+	}
+
+	sent, err := repository.GetUserTransactionsByUserId(sender.UserId, model.TransactionFilter{Direction: model.DirectionOutgoing, Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, money.New(650, money.DefaultCurrency), sent[0].BalanceAfter)
+		assert.Equal(t, receiver.UserId, *sent[0].CounterpartyUserId)
+	}
+
+	minAmount := money.NewDecimal(2, 0)
+	large, err := repository.GetUserTransactionsByUserId(sender.UserId, model.TransactionFilter{MinAmount: &minAmount, CounterpartyUserId: receiver.UserId})
+	assert.NoError(t, err)
+	if assert.Len(t, large, 1) {
+		assert.Equal(t, money.New(-250, money.DefaultCurrency), large[0].EntryAmount)
+	}
+}
+
+func TestReverseTransfer(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewUserRepository(db)
+	walletRepository := NewWalletRepository(db)
+	sender := createTestWallet(t, db, 1000)
+	receiver := createTestWallet(t, db, 0)
+	assert.NoError(t, repository.Transfer(model.SystemActor, sender.ID, receiver.ID, money.New(600, money.DefaultCurrency), nil, nil, nil))
+
+	var transfer model.Transaction
+	assert.NoError(t, db.Get(&transfer, "SELECT * FROM transactions WHERE receiver_wallet_id = $1 AND type = 'transfer'", receiver.ID))
+
+	partial := money.New(200, money.DefaultCurrency)
+	reversal, err := repository.Reverse(model.SystemActor, transfer.ID, &partial, false)
+	assert.NoError(t, err)
+	assert.Equal(t, transfer.ID, *reversal.ReversalOf)
+
+	tooMuch := money.New(500, money.DefaultCurrency)
+	_, err = repository.Reverse(model.SystemActor, transfer.ID, &tooMuch, false)
+	assert.ErrorIs(t, err, ErrReversalExceedsAmount)
+
+	// the receiver spends what is left, so only a forced reversal goes through
+	_, err = walletRepository.Update(model.SystemActor, receiver.ID, money.New(400, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, nil)
+	assert.NoError(t, err)
+	_, err = repository.Reverse(model.SystemActor, transfer.ID, nil, false)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = repository.Reverse(model.SystemActor, transfer.ID, nil, true)
+	assert.NoError(t, err)
+	_, err = repository.Reverse(model.SystemActor, transfer.ID, nil, true)
+	assert.ErrorIs(t, err, ErrAlreadyReversed)
+
+	updatedSender, err := walletRepository.GetById(sender.ID)
+	assert.NoError(t, err)
+	updatedReceiver, err := walletRepository.GetById(receiver.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(1000, money.DefaultCurrency), updatedSender.Balance)
+	assert.Equal(t, money.New(-400, money.DefaultCurrency), updatedReceiver.Balance)
+	assertLedgerConsistent(t, db)
+}
+
+func TestReverseConvertedTransferInParts(t *testing.T) {
+	db := connectTestDatabase(t)
+	repository := NewUserRepository(db)
+	walletRepository := NewWalletRepository(db)
+	sender := createTestWallet(t, db, 1000)
+	receiver, err := walletRepository.Create(model.SystemActor, sender.UserId, "euros", "EUR", false)
+	assert.NoError(t, err)
+
+	rate, err := money.ParseDecimal("0.9215")
+	assert.NoError(t, err)
+	assert.NoError(t, repository.Transfer(model.SystemActor, sender.ID, receiver.ID, money.New(1050, "USD"), &model.Conversion{Rate: rate, Amount: money.New(968, "EUR")}, nil, nil))
+
+	var transfer model.Transaction
+	assert.NoError(t, db.Get(&transfer, "SELECT * FROM transactions WHERE receiver_wallet_id = $1", receiver.ID))
+
+	for _, part := range []int64{333, 333, 384} {
+		amount := money.New(part, "USD")
+		_, err := repository.Reverse(model.SystemActor, transfer.ID, &amount, false)
+		assert.NoError(t, err)
+	}
+
+	updatedReceiver, err := walletRepository.GetById(receiver.ID)
+	assert.NoError(t, err)
+	assert.True(t, updatedReceiver.Balance.IsZero())
+	assertLedgerConsistent(t, db)
+}
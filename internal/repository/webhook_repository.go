@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-wallet-service/internal/model"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrDeliveryPending = utils.Conflict("delivery_pending", "the delivery is still being attempted")
+	ErrWebhookInactive = utils.Conflict("webhook_inactive", "the webhook endpoint was removed")
+	ErrDeliveryChanged = utils.Conflict("delivery_changed", "the delivery changed since it was claimed")
+)
+
+type WebhookRepository interface {
+	CreateEndpoint(actor model.Actor, endpoint model.WebhookEndpoint) (model.WebhookEndpoint, error)
+	GetEndpoints() ([]model.WebhookEndpoint, error)
+	GetEndpointById(endpointId int) (model.WebhookEndpoint, error)
+	RemoveEndpoint(actor model.Actor, endpointId int) (model.WebhookEndpoint, error)
+	GetEventById(eventId int) (model.OutboxEvent, error)
+	GetDeliveries(endpointId int, status string, limit int) ([]model.WebhookDelivery, error)
+	ClaimDue(limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	Settle(delivery model.WebhookDelivery, attempt model.WebhookAttempt, retryAt *time.Time) (model.WebhookDelivery, error)
+	Redeliver(actor model.Actor, deliveryId int) (model.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) *webhookRepository {
+	return &webhookRepository{db: db}
+}
+
+// CreateEndpoint registers the endpoint. It receives the events published
+// from then on.
+func (r *webhookRepository) CreateEndpoint(actor model.Actor, endpoint model.WebhookEndpoint) (model.WebhookEndpoint, error) {
+	var created model.WebhookEndpoint
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		if endpoint.EventTypes == nil {
+			endpoint.EventTypes = []string{}
+		}
+		err := tx.Get(&created, "INSERT INTO webhook_endpoints (url, secret, event_types, description) VALUES ($1, $2, $3, $4) RETURNING *", endpoint.URL, endpoint.Secret, endpoint.EventTypes, endpoint.Description)
+		if err != nil {
+			return err
+		}
+		return auditEndpoint(tx, actor, model.AuditActionWebhookRegistered, created)
+	})
+	if err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	return created, nil
+}
+
+func (r *webhookRepository) GetEndpoints() ([]model.WebhookEndpoint, error) {
+	var endpoints []model.WebhookEndpoint
+	if err := r.db.Select(&endpoints, "SELECT * FROM webhook_endpoints WHERE active ORDER BY id"); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+func (r *webhookRepository) GetEndpointById(endpointId int) (model.WebhookEndpoint, error) {
+	var endpoint model.WebhookEndpoint
+	if err := r.db.Get(&endpoint, "SELECT * FROM webhook_endpoints WHERE id = $1", endpointId); err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	return endpoint, nil
+}
+
+// RemoveEndpoint stops publishing events to the endpoint and gives up its
+// pending deliveries. The endpoint and its deliveries are kept; removing it
+// again finds no rows.
+func (r *webhookRepository) RemoveEndpoint(actor model.Actor, endpointId int) (model.WebhookEndpoint, error) {
+	var removed model.WebhookEndpoint
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		err := tx.Get(&removed, "UPDATE webhook_endpoints SET active = FALSE, update_date = CURRENT_TIMESTAMP WHERE id = $1 AND active RETURNING *", endpointId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE webhook_deliveries SET status = $1, claimed_until = NULL, last_error = $2, update_date = CURRENT_TIMESTAMP WHERE endpoint_id = $3 AND status = $4",
+			model.DeliveryStatusDead, "the endpoint was removed", endpointId, model.DeliveryStatusPending)
+		if err != nil {
+			return err
+		}
+		return auditEndpoint(tx, actor, model.AuditActionWebhookRemoved, removed)
+	})
+	if err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	return removed, nil
+}
+
+func (r *webhookRepository) GetEventById(eventId int) (model.OutboxEvent, error) {
+	var event model.OutboxEvent
+	if err := r.db.Get(&event, "SELECT * FROM outbox_events WHERE id = $1", eventId); err != nil {
+		return model.OutboxEvent{}, err
+	}
+	return event, nil
+}
+
+// GetDeliveries returns up to limit deliveries to the endpoint, newest
+// first, only those with status when it is set.
+func (r *webhookRepository) GetDeliveries(endpointId int, status string, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.db.Select(&deliveries, "SELECT * FROM webhook_deliveries WHERE endpoint_id = $1 AND ($2 = '' OR status = $2) ORDER BY id DESC LIMIT $3", endpointId, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimDue leases up to limit pending deliveries whose next attempt is due,
+// oldest event first. Like scheduled transfers, rows another dispatcher is
+// claiming are skipped and a lease that runs out lets the delivery be claimed
+// again.
+func (r *webhookRepository) ClaimDue(limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.db.Select(&deliveries, `UPDATE webhook_deliveries SET claimed_until = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $2 AND next_attempt_date <= CURRENT_TIMESTAMP AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+			ORDER BY event_id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, lease.Seconds(), model.DeliveryStatusPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Settle records an attempt of a claimed delivery. A delivery that failed is
+// retried at retryAt, or is dead when there is none. It returns
+// ErrDeliveryChanged, and does nothing, when the delivery was settled,
+// redelivered or given up since it was claimed.
+func (r *webhookRepository) Settle(delivery model.WebhookDelivery, attempt model.WebhookAttempt, retryAt *time.Time) (model.WebhookDelivery, error) {
+	var statusCode *int
+	if attempt.StatusCode != 0 {
+		statusCode = &attempt.StatusCode
+	}
+	var reason *string
+	if attempt.Error != "" {
+		reason = &attempt.Error
+	}
+
+	status, nextAttempt := model.DeliveryStatusDead, delivery.NextAttemptDate
+	switch {
+	case attempt.Succeeded():
+		status = model.DeliveryStatusDelivered
+	case retryAt != nil:
+		status, nextAttempt = model.DeliveryStatusPending, *retryAt
+	}
+
+	var settled model.WebhookDelivery
+	err := r.db.Get(&settled, `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, next_attempt_date = $2, claimed_until = NULL, last_status_code = $3, last_error = $4,
+		delivery_date = CASE WHEN $1::text = $5::text THEN CURRENT_TIMESTAMP END, update_date = CURRENT_TIMESTAMP
+		WHERE id = $6 AND status = $7 AND attempts = $8 RETURNING *`,
+		status, nextAttempt, statusCode, reason, model.DeliveryStatusDelivered, delivery.ID, model.DeliveryStatusPending, delivery.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.WebhookDelivery{}, ErrDeliveryChanged
+	}
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	return settled, nil
+}
+
+// Redeliver sends a delivered or dead delivery again, as soon as a
+// dispatcher claims it, with a fresh set of attempts.
+func (r *webhookRepository) Redeliver(actor model.Actor, deliveryId int) (model.WebhookDelivery, error) {
+	var redelivered model.WebhookDelivery
+
+	err := withTransaction(r.db, func(tx *sqlx.Tx) error {
+		var delivery model.WebhookDelivery
+		if err := tx.Get(&delivery, "SELECT * FROM webhook_deliveries WHERE id = $1 FOR UPDATE", deliveryId); err != nil {
+			return err
+		}
+		if delivery.Status == model.DeliveryStatusPending {
+			return ErrDeliveryPending
+		}
+
+		var active bool
+		if err := tx.Get(&active, "SELECT active FROM webhook_endpoints WHERE id = $1", delivery.EndpointId); err != nil {
+			return err
+		}
+		if !active {
+			return ErrWebhookInactive
+		}
+
+		err := tx.Get(&redelivered, `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_date = CURRENT_TIMESTAMP, claimed_until = NULL, update_date = CURRENT_TIMESTAMP
+			WHERE id = $2 RETURNING *`, model.DeliveryStatusPending, deliveryId)
+		if err != nil {
+			return err
+		}
+
+		details, err := auditDetails(map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"event_id":    delivery.EventId,
+			"before":      map[string]interface{}{"status": delivery.Status, "attempts": delivery.Attempts},
+			"after":       map[string]interface{}{"status": redelivered.Status, "attempts": redelivered.Attempts},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = appendAudit(tx, actor, model.AuditEntry{Action: model.AuditActionWebhookRedelivered, Details: details})
+		return err
+	})
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	return redelivered, nil
+}
+
+// auditEndpoint records a change to an endpoint. Its secret is left out.
+func auditEndpoint(tx *sqlx.Tx, actor model.Actor, action string, endpoint model.WebhookEndpoint) error {
+	details, err := auditDetails(map[string]interface{}{
+		"endpoint_id": endpoint.ID,
+		"url":         endpoint.URL,
+		"event_types": []string(endpoint.EventTypes),
+		"active":      endpoint.Active,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = appendAudit(tx, actor, model.AuditEntry{Action: action, Details: details})
+	return err
+}
+
+// publishEvent writes the event to the outbox within tx, the transaction of
+// the change it describes, along with a delivery to every active endpoint
+// subscribed to its type.
+func publishEvent(tx *sqlx.Tx, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var eventId int
+	if err := tx.Get(&eventId, "INSERT INTO outbox_events (type, payload) VALUES ($1, $2) RETURNING id", eventType, string(payload)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO webhook_deliveries (endpoint_id, event_id, status)
+		SELECT id, $1, $2 FROM webhook_endpoints WHERE active AND (cardinality(event_types) = 0 OR $3 = ANY(event_types))`,
+		eventId, model.DeliveryStatusPending, eventType)
+	return err
+}
+
+// publishMovement publishes the transaction with the balances of the wallets
+// it moved money between, as they are within tx.
+func publishMovement(tx *sqlx.Tx, eventType string, transactionId int) error {
+	var transaction model.Transaction
+	if err := tx.Get(&transaction, "SELECT * FROM transactions WHERE id = $1", transactionId); err != nil {
+		return err
+	}
+	transaction = withCurrencies(transaction)
+
+	data := model.MovementEventData{Transaction: transaction.RecordData()}
+	for _, walletId := range []int{transaction.SenderWalletId, transaction.ReceiverWalletId} {
+		if len(data.Wallets) > 0 && data.Wallets[0].WalletId == walletId {
+			continue
+		}
+		wallet, err := getWallet(tx, "SELECT * FROM wallets WHERE id = $1", walletId)
+		if err != nil {
+			return err
+		}
+		data.Wallets = append(data.Wallets, model.WalletBalanceData{WalletId: wallet.ID, UserId: wallet.UserId, Balance: wallet.Balance, Currency: wallet.Currency})
+	}
+	return publishEvent(tx, eventType, data)
+}
+
+// publishStatusChange publishes a change of the status of a user or wallet.
+func publishStatusChange(tx *sqlx.Tx, change model.StatusChange) error {
+	eventType := model.EventTypeUserStatusChanged
+	if change.WalletId != nil {
+		eventType = model.EventTypeWalletStatusChanged
+	}
+	return publishEvent(tx, eventType, model.StatusChangeData{
+		ID:           change.ID,
+		UserId:       change.UserId,
+		WalletId:     change.WalletId,
+		FromStatus:   change.FromStatus,
+		ToStatus:     change.ToStatus,
+		Reason:       change.Reason,
+		ActorUserId:  change.ActorUserId,
+		CreationDate: change.CreationDate,
+	})
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+func TestMovementsArePublishedWithTheirTransaction(t *testing.T) {
+	db := connectTestDatabase(t)
+	webhooks := NewWebhookRepository(db)
+	wallets := NewWalletRepository(db)
+	wallet := createTestWallet(t, db, 1000)
+
+	deposits, err := webhooks.CreateEndpoint(model.SystemActor, model.WebhookEndpoint{URL: "https://example.com/deposits", Secret: "whsec_a", EventTypes: []string{model.EventTypeWalletDeposited}})
+	assert.NoError(t, err)
+	everything, err := webhooks.CreateEndpoint(model.SystemActor, model.WebhookEndpoint{URL: "https://example.com/all", Secret: "whsec_b"})
+	assert.NoError(t, err)
+
+	_, err = wallets.Update(model.SystemActor, wallet.ID, money.New(250, money.DefaultCurrency), model.TransactionTypeDeposit, nil, nil)
+	assert.NoError(t, err)
+	_, err = wallets.Update(model.SystemActor, wallet.ID, money.New(5000, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, nil)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = wallets.Update(model.SystemActor, wallet.ID, money.New(50, money.DefaultCurrency), model.TransactionTypeWithdraw, nil, nil)
+	assert.NoError(t, err)
+
+	toDeposits, err := webhooks.GetDeliveries(deposits.ID, "", 10)
+	assert.NoError(t, err)
+	toEverything, err := webhooks.GetDeliveries(everything.ID, model.DeliveryStatusPending, 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, toDeposits, 1) || !assert.Len(t, toEverything, 2) {
+		return
+	}
+	assert.Equal(t, toDeposits[0].EventId, toEverything[1].EventId)
+
+	event, err := webhooks.GetEventById(toDeposits[0].EventId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.EventTypeWalletDeposited, event.Type)
+	var data model.MovementEventData
+	assert.NoError(t, json.Unmarshal([]byte(event.Payload), &data))
+	assert.Equal(t, wallet.ID, data.Transaction.ReceiverWalletId)
+	if assert.Len(t, data.Wallets, 1) {
+		assert.Equal(t, int64(1250), data.Wallets[0].Balance.Amount)
+	}
+
+	withdrawal, err := webhooks.GetEventById(toEverything[0].EventId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.EventTypeWalletWithdrawn, withdrawal.Type)
+}
+
+func TestDeadDeliveryCanBeRedelivered(t *testing.T) {
+	db := connectTestDatabase(t)
+	webhooks := NewWebhookRepository(db)
+	wallet := createTestWallet(t, db, 0)
+	endpoint, err := webhooks.CreateEndpoint(model.SystemActor, model.WebhookEndpoint{URL: "https://example.com/hooks", Secret: "whsec_c"})
+	assert.NoError(t, err)
+
+	_, err = NewWalletRepository(db).SetStatus(model.SystemActor, wallet.ID, model.StatusChange{ToStatus: model.StatusFrozen, Reason: "review"})
+	assert.NoError(t, err)
+	deliveries, err := webhooks.GetDeliveries(endpoint.ID, "", 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, deliveries, 1) {
+		return
+	}
+	delivery := deliveries[0]
+
+	_, err = webhooks.Redeliver(model.SystemActor, delivery.ID)
+	assert.ErrorIs(t, err, ErrDeliveryPending)
+
+	dead, err := webhooks.Settle(delivery, model.WebhookAttempt{StatusCode: 500, Error: "the endpoint answered 500"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeliveryStatusDead, dead.Status)
+	_, err = webhooks.Settle(delivery, model.WebhookAttempt{StatusCode: 200}, nil)
+	assert.ErrorIs(t, err, ErrDeliveryChanged)
+
+	redelivered, err := webhooks.Redeliver(model.SystemActor, delivery.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeliveryStatusPending, redelivered.Status)
+	assert.Zero(t, redelivered.Attempts)
+	assert.WithinDuration(t, time.Now(), redelivered.NextAttemptDate, time.Minute)
+
+	_, err = webhooks.RemoveEndpoint(model.SystemActor, endpoint.ID)
+	assert.NoError(t, err)
+	removed, err := webhooks.GetDeliveries(endpoint.ID, model.DeliveryStatusDead, 10)
+	assert.NoError(t, err)
+	assert.Len(t, removed, 1)
+	_, err = webhooks.Redeliver(model.SystemActor, delivery.ID)
+	assert.ErrorIs(t, err, ErrWebhookInactive)
+}
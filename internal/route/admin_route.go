@@ -0,0 +1,336 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/service"
+	"go-wallet-service/utils"
+)
+
+var auditService *service.AuditService
+
+// AdminRoutes serves the admin API to staff. What each member of staff may do
+// is set by the permissions of their role.
+func AdminRoutes(r *mux.Router, ts *service.TokenService, us *service.UserService, ws *service.WalletService, as *service.AuditService, whs *service.WebhookService, is *service.IdempotencyService) {
+	userService = us
+	walletService = ws
+	auditService = as
+	webhookService = whs
+
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.OAuth(ts))
+	adminRouter.Use(middleware.Admin(us))
+	idempotent := middleware.Idempotency(is)
+	lookup := middleware.Permission(model.PermissionLookup)
+	audit := middleware.Permission(model.PermissionAudit)
+	status := middleware.Permission(model.PermissionStatus)
+	adjust := middleware.Permission(model.PermissionAdjust)
+	webhooks := middleware.Permission(model.PermissionWebhooks)
+
+	adminRouter.Handle("/users/{userId}", lookup(handle(adminUserHandler))).Methods("GET")
+	adminRouter.Handle("/users/{userId}/status", status(handle(userStatusHandler))).Methods("POST")
+	adminRouter.Handle("/wallets/{walletId}", lookup(handle(adminWalletHandler))).Methods("GET")
+	adminRouter.Handle("/wallets/{walletId}/status", status(handle(walletStatusHandler))).Methods("POST")
+	adminRouter.Handle("/wallets/{walletId}/adjustments", adjust(idempotent(handle(adjustmentHandler)))).Methods("POST")
+	adminRouter.Handle("/transactions/{transactionId}", lookup(handle(adminTransactionHandler))).Methods("GET")
+	adminRouter.Handle("/audit", audit(handle(auditHandler))).Methods("GET")
+	adminRouter.Handle("/webhooks", webhooks(handle(webhooksHandler))).Methods("GET")
+	adminRouter.Handle("/webhooks", webhooks(handle(registerWebhookHandler))).Methods("POST")
+	adminRouter.Handle("/webhooks/{webhookId}", webhooks(handle(removeWebhookHandler))).Methods("DELETE")
+	adminRouter.Handle("/webhooks/{webhookId}/deliveries", webhooks(handle(webhookDeliveriesHandler))).Methods("GET")
+	adminRouter.Handle("/webhooks/deliveries/{deliveryId}/redeliver", webhooks(handle(redeliverHandler))).Methods("POST")
+}
+
+func adminUserHandler(w http.ResponseWriter, r *http.Request) error {
+	userId, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
+	}
+
+	user, err := userService.GetByIdIncludingDeleted(userId)
+	if err != nil {
+		return err
+	}
+
+	wallets, err := walletService.GetAllWalletsByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	if err := recordView(r, model.AuditEntry{Action: model.AuditActionUserViewed, UserId: &userId}); err != nil {
+		return err
+	}
+
+	walletModels := make([]model.WalletData, len(wallets))
+	for i, wallet := range wallets {
+		walletModels[i] = mapWallet(wallet)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":    model.UserDetailData{UserData: mapUser(user), DeletionDate: user.DeletionDate},
+		"wallets": walletModels,
+	})
+	return nil
+}
+
+func adminWalletHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
+	}
+
+	wallet, err := walletService.GetByIdIncludingDeleted(walletId)
+	if err != nil {
+		return err
+	}
+
+	available, err := walletService.GetAvailableBalance(walletId)
+	if err != nil {
+		return err
+	}
+
+	if err := recordView(r, model.AuditEntry{Action: model.AuditActionWalletViewed, UserId: &wallet.UserId, WalletId: &walletId}); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.WalletDetailData{
+		WalletData:       mapWallet(wallet),
+		UserId:           wallet.UserId,
+		AvailableBalance: available,
+		CreationDate:     wallet.CreationDate,
+		DeletionDate:     wallet.DeletionDate,
+	})
+	return nil
+}
+
+func adminTransactionHandler(w http.ResponseWriter, r *http.Request) error {
+	transactionId, err := middleware.PathId(r, "transactionId")
+	if err != nil {
+		return err
+	}
+
+	transaction, err := userService.GetTransactionById(transactionId)
+	if err != nil {
+		return err
+	}
+
+	if err := recordView(r, model.AuditEntry{Action: model.AuditActionTransactionViewed, TransactionId: &transactionId}); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transaction.RecordData())
+	return nil
+}
+
+func userStatusHandler(w http.ResponseWriter, r *http.Request) error {
+	userId, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
+	}
+
+	var statusParams object.StatusParams
+	if err := decodeParams(r, &statusParams); err != nil {
+		return err
+	}
+
+	change, err := userService.SetStatus(middleware.ActorFromRequest(r), userId, statusParams.Status, statusParams.Reason)
+	if err != nil {
+		return err
+	}
+
+	writeStatusChange(w, change)
+	return nil
+}
+
+func walletStatusHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
+	}
+
+	var statusParams object.StatusParams
+	if err := decodeParams(r, &statusParams); err != nil {
+		return err
+	}
+
+	change, err := walletService.SetStatus(middleware.ActorFromRequest(r), walletId, statusParams.Status, statusParams.Reason)
+	if err != nil {
+		return err
+	}
+
+	writeStatusChange(w, change)
+	return nil
+}
+
+// adjustmentHandler credits or debits a wallet by hand. Limits and fees do not
+// apply to adjustments.
+func adjustmentHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
+	}
+
+	var adjustmentParams object.AdjustmentParams
+	if err := decodeParams(r, &adjustmentParams); err != nil {
+		return err
+	}
+
+	wallet, err := walletService.GetById(walletId)
+	if err != nil {
+		return err
+	}
+
+	amount, err := service.WalletAmount(wallet, adjustmentParams.Amount, adjustmentParams.Currency)
+	if err != nil {
+		return err
+	}
+
+	transaction, err := walletService.Adjust(middleware.ActorFromRequest(r), model.Adjustment{
+		WalletId:   walletId,
+		Type:       adjustmentParams.Type,
+		Amount:     amount,
+		ReasonCode: adjustmentParams.ReasonCode,
+		Note:       adjustmentParams.Note,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transaction.RecordData())
+	return nil
+}
+
+// auditHandler lists the audit log newest first. A full page is followed by
+// the next one at ?before=<next_before>.
+func auditHandler(w http.ResponseWriter, r *http.Request) error {
+	filter, err := auditFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	entries, err := auditService.List(filter)
+	if err != nil {
+		return err
+	}
+
+	details, _ := json.Marshal(map[string]string{"query": r.URL.RawQuery})
+	if err := recordView(r, model.AuditEntry{Action: model.AuditActionAuditViewed, Details: string(details)}); err != nil {
+		return err
+	}
+
+	entryModels := make([]model.AuditEntryData, len(entries))
+	for i, entry := range entries {
+		entryModels[i] = model.AuditEntryData{
+			ID:            entry.ID,
+			ActorType:     entry.ActorType,
+			ActorUserId:   entry.ActorUserId,
+			Action:        entry.Action,
+			UserId:        entry.UserId,
+			WalletId:      entry.WalletId,
+			TransactionId: entry.TransactionId,
+			Details:       json.RawMessage(entry.Details),
+			IP:            entry.IP,
+			UserAgent:     entry.UserAgent,
+			RequestId:     entry.RequestId,
+			CreationDate:  entry.CreationDate,
+			PrevHash:      entry.PrevHash,
+			Hash:          entry.Hash,
+		}
+	}
+
+	response := map[string]interface{}{"entries": entryModels}
+	if len(entries) == filter.Limit {
+		response["next_before"] = entries[len(entries)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	return nil
+}
+
+// auditFilter reads the filters of the audit log from the query string. Dates
+// are read like those of the transaction history.
+func auditFilter(query url.Values) (model.AuditFilter, error) {
+	filter := model.AuditFilter{
+		ActorType: query.Get("actor_type"),
+		Action:    query.Get("action"),
+		RequestId: query.Get("request_id"),
+		Limit:     service.DefaultAuditPageSize,
+	}
+
+	switch filter.ActorType {
+	case "", model.ActorTypeUser, model.ActorTypeAdmin, model.ActorTypeSystem:
+	default:
+		return model.AuditFilter{}, invalidParameter("actor_type must be one of user, admin or system")
+	}
+
+	for name, field := range map[string]*int{
+		"actor_user_id":  &filter.ActorUserId,
+		"user_id":        &filter.UserId,
+		"wallet_id":      &filter.WalletId,
+		"transaction_id": &filter.TransactionId,
+		"before":         &filter.BeforeId,
+	} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				return model.AuditFilter{}, invalidParameter("%s must be a positive integer", name)
+			}
+			*field = id
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > service.MaxAuditPageSize {
+			return model.AuditFilter{}, invalidParameter("limit must be between 1 and %d", service.MaxAuditPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	var err error
+	if filter.From, err = timeParam(query, "from", false); err != nil {
+		return model.AuditFilter{}, err
+	}
+	if filter.To, err = timeParam(query, "to", true); err != nil {
+		return model.AuditFilter{}, err
+	}
+	return filter, nil
+}
+
+// recordView audits a member of staff reading data before it is answered, so
+// nothing is read without a trace.
+func recordView(r *http.Request, entry model.AuditEntry) error {
+	if err := auditService.Record(middleware.ActorFromRequest(r), entry); err != nil {
+		return utils.Internal("Unable to record the lookup in the audit log", err)
+	}
+	return nil
+}
+
+func writeStatusChange(w http.ResponseWriter, change model.StatusChange) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(model.StatusChangeData{
+		ID:           change.ID,
+		UserId:       change.UserId,
+		WalletId:     change.WalletId,
+		FromStatus:   change.FromStatus,
+		ToStatus:     change.ToStatus,
+		Reason:       change.Reason,
+		ActorUserId:  change.ActorUserId,
+		CreationDate: change.CreationDate,
+	})
+}
@@ -0,0 +1,147 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/utils"
+)
+
+const (
+	// eventStreamKeepAlive is how often an idle stream is sent a comment,
+	// which keeps proxies from closing it, and looks for transactions made
+	// by other replicas of the service, whose changes this one is not told.
+	eventStreamKeepAlive = 15 * time.Second
+	eventPageSize        = 100
+
+	eventTypeTransaction = "transaction"
+	eventTypeBalance     = "balance"
+)
+
+var errInvalidLastEventId = utils.Invalid("invalid_parameter", "Last-Event-ID must be the ID of an event of the stream")
+
+// walletEventsHandler streams the new transactions and the balance of a
+// wallet as server-sent events until the client goes away. A transaction
+// event has the ID of its ledger entry, so a client that reconnects with the
+// last one it got in Last-Event-ID is sent the transactions it missed first.
+// The balance is sent when the stream starts and after every change.
+func walletEventsHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
+	}
+	version := versionOf(r)
+
+	lastEntryId := 0
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		lastEntryId, err = strconv.Atoi(value)
+		if err != nil || lastEntryId <= 0 {
+			return errInvalidLastEventId
+		}
+	}
+
+	wallet, err := walletService.GetById(walletId)
+	if err != nil {
+		return err
+	}
+
+	// subscribing before reading the ledger misses no change in between
+	changes, unsubscribe := walletService.Subscribe(walletId)
+	defer unsubscribe()
+
+	if lastEntryId == 0 {
+		lastEntryId, err = userService.LastWalletEntryId(wallet)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	stream := http.NewResponseController(w)
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	sendBalance := true
+	for {
+		lastEntryId, err = sendWalletEvents(w, version, wallet, lastEntryId, sendBalance)
+		if err == nil {
+			err = stream.Flush()
+		}
+		if err != nil {
+			// the response has started, so the stream can only be cut short
+			log.Debug().Str("error", "event_stream_closed").Str("error_description", fmt.Sprintf("Event stream of wallet [%d] ended due to: %s", walletId, err.Error())).Send()
+			return nil
+		}
+
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-changes:
+			sendBalance = true
+		case <-keepAlive.C:
+			sendBalance = false
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// sendWalletEvents writes the transactions of the wallet made after entry
+// lastEntryId, followed by its balance when there were any or sendBalance is
+// set. Transactions are shown as version does. It returns the ID of the last
+// entry written.
+func sendWalletEvents(w http.ResponseWriter, version Version, wallet model.Wallet, lastEntryId int, sendBalance bool) (int, error) {
+	for {
+		entries, err := userService.GetWalletEntriesAfter(wallet, lastEntryId, eventPageSize)
+		if err != nil {
+			return lastEntryId, err
+		}
+		for i, transaction := range version.transactions(entries) {
+			if err := writeEvent(w, strconv.Itoa(entries[i].EntryId), eventTypeTransaction, transaction); err != nil {
+				return lastEntryId, err
+			}
+			lastEntryId = entries[i].EntryId
+			sendBalance = true
+		}
+		if len(entries) < eventPageSize {
+			break
+		}
+	}
+
+	if !sendBalance {
+		return lastEntryId, nil
+	}
+	balance, err := walletBalance(wallet.ID)
+	if err != nil {
+		return lastEntryId, err
+	}
+	return lastEntryId, writeEvent(w, "", eventTypeBalance, balance)
+}
+
+// writeEvent writes one event of a stream. An event without an ID leaves the
+// client's Last-Event-ID as it was.
+func writeEvent(w http.ResponseWriter, id string, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
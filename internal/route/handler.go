@@ -0,0 +1,21 @@
+package route
+
+import (
+	"net/http"
+
+	"go-wallet-service/utils"
+)
+
+// handlerFunc serves a request and returns, rather than writes, any error it
+// meets. It must return before writing anything when it fails.
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// handle answers the errors h returns as problem responses, which keeps the
+// mapping from domain errors to HTTP in one place.
+func handle(h handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			utils.WriteProblem(w, r, err)
+		}
+	}
+}
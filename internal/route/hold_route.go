@@ -0,0 +1,233 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/repository"
+	"go-wallet-service/internal/service"
+)
+
+var holdService *service.HoldService
+
+func holdsHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
+	}
+
+	holds, err := holdService.GetActiveByWalletId(walletId)
+	if err != nil {
+		return err
+	}
+
+	holdModels := make([]model.HoldData, len(holds))
+	for i, hold := range holds {
+		holdModels[i] = mapHold(hold)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"holds": holdModels,
+	})
+	return nil
+}
+
+func placeHoldHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
+	}
+
+	var holdParams object.HoldParams
+	if err := decodeParams(r, &holdParams); err != nil {
+		return err
+	}
+
+	wallet, err := walletService.GetById(walletId)
+	if err != nil {
+		return err
+	}
+
+	amount, err := service.WalletAmount(wallet, holdParams.Amount, holdParams.Currency)
+	if err != nil {
+		return err
+	}
+
+	var payee *model.Wallet
+	if holdParams.ReceiverUserId != 0 || holdParams.ReceiverWalletId != nil {
+		receiver, err := walletService.GetReceiverWallet(wallet, holdParams.ReceiverUserId, holdParams.ReceiverWalletId)
+		if err != nil {
+			return err
+		}
+		payee = &receiver
+	}
+
+	hold, err := holdService.Place(middleware.ActorFromRequest(r), wallet, payee, amount, time.Duration(holdParams.ExpiresIn)*time.Second)
+	if errors.Is(err, service.ErrInvalidHoldExpiry) {
+		return service.ErrInvalidHoldExpiry.WithMessage(fmt.Sprintf("expires_in must be between 1 and %d seconds", int64(service.MaxHoldTTL/time.Second)))
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mapHold(hold))
+	return nil
+}
+
+func captureHoldHandler(w http.ResponseWriter, r *http.Request) error {
+	hold, wallet, payee, err := settledHold(r)
+	if err != nil {
+		return err
+	}
+
+	var captureParams object.CaptureParams
+	if err := decodeParams(r, &captureParams); err != nil {
+		return err
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if captureParams.UserId != 0 && captureParams.UserId != principal.UserId {
+		return middleware.ErrUnauthorized
+	}
+
+	var amount *money.Money
+	if captureParams.Amount != nil {
+		captured, err := service.WalletAmount(wallet, *captureParams.Amount, captureParams.Currency)
+		if err != nil {
+			return err
+		}
+		if !captured.IsPositive() {
+			return repository.ErrInvalidAmount
+		}
+		amount = &captured
+	}
+
+	captured, operation := hold.Amount, model.TransactionTypeWithdraw
+	if amount != nil {
+		captured = *amount
+	}
+	if payee != nil {
+		operation = model.TransactionTypeTransfer
+	}
+	fee, err := feeService.Fee(wallet, operation, captured)
+	if err != nil {
+		return err
+	}
+
+	hold, err = holdService.Capture(middleware.ActorFromRequest(r), hold, amount, payee, fee, limitService.Check(operation, captured))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mapHold(hold))
+	return nil
+}
+
+func releaseHoldHandler(w http.ResponseWriter, r *http.Request) error {
+	hold, _, _, err := settledHold(r)
+	if err != nil {
+		return err
+	}
+
+	hold, err = holdService.Release(middleware.ActorFromRequest(r), hold)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mapHold(hold))
+	return nil
+}
+
+// settledHold returns the hold of the request, the wallet it was placed on
+// and its payee, once the caller is found allowed to capture or release it,
+// so nobody else learns more of it than that they are not.
+func settledHold(r *http.Request) (model.Hold, model.Wallet, *model.Wallet, error) {
+	hold, err := walletHold(r)
+	if err != nil {
+		return model.Hold{}, model.Wallet{}, nil, err
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	user, err := userService.GetById(principal.UserId)
+	if err != nil {
+		return model.Hold{}, model.Wallet{}, nil, err
+	}
+
+	wallet, err := walletService.GetById(hold.WalletId)
+	if err != nil {
+		return model.Hold{}, model.Wallet{}, nil, err
+	}
+	payee, err := holdPayee(hold)
+	if err != nil {
+		return model.Hold{}, model.Wallet{}, nil, err
+	}
+
+	if err := holdService.CheckSettle(middleware.ActorFromRequest(r), user.Role, wallet, payee); err != nil {
+		return model.Hold{}, model.Wallet{}, nil, err
+	}
+	return hold, wallet, payee, nil
+}
+
+// walletHold returns the hold named by the {holdId} path variable when it was
+// placed on the {walletId} wallet. Holds on other wallets are reported
+// missing.
+func walletHold(r *http.Request) (model.Hold, error) {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return model.Hold{}, err
+	}
+	holdId, err := middleware.PathId(r, "holdId")
+	if err != nil {
+		return model.Hold{}, err
+	}
+
+	hold, err := holdService.GetById(holdId)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	if hold.WalletId != walletId {
+		return model.Hold{}, service.ErrHoldNotFound
+	}
+	return hold, nil
+}
+
+// holdPayee returns the wallet the hold was placed for, or nil when it has no
+// payee.
+func holdPayee(hold model.Hold) (*model.Wallet, error) {
+	if hold.ReceiverWalletId == nil {
+		return nil, nil
+	}
+	payee, err := walletService.GetById(*hold.ReceiverWalletId)
+	if err != nil {
+		return nil, err
+	}
+	return &payee, nil
+}
+
+func mapHold(hold model.Hold) model.HoldData {
+	return model.HoldData{
+		ID:               hold.ID,
+		WalletId:         hold.WalletId,
+		ReceiverWalletId: hold.ReceiverWalletId,
+		Amount:           hold.Amount,
+		CapturedAmount:   hold.CapturedAmount,
+		Currency:         hold.Currency.String(),
+		Status:           hold.Status,
+		TransactionId:    hold.TransactionId,
+		ExpiryDate:       hold.ExpiryDate,
+	}
+}
@@ -0,0 +1,145 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/service"
+	"go-wallet-service/utils"
+)
+
+var tokenService *service.TokenService
+
+func OAuthRoutes(r *mux.Router, ts *service.TokenService) {
+	tokenService = ts
+
+	oauthRouter := r.PathPrefix("/oauth").Subrouter()
+	oauthRouter.HandleFunc("/token", tokenHandler).Methods("POST")
+	oauthRouter.HandleFunc("/revoke", revokeHandler).Methods("POST")
+	oauthRouter.Handle("/logout", middleware.OAuth(ts)(handle(logoutHandler))).Methods("POST")
+}
+
+// tokenHandler implements the refresh_token grant of the OAuth2 token
+// endpoint. Parameters are accepted form encoded, as the specification
+// requires, or as JSON.
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+	var tokenParams object.TokenParams
+	if err := decodeOAuthParams(r, &tokenParams, func() {
+		tokenParams.GrantType = r.PostFormValue("grant_type")
+		tokenParams.RefreshToken = r.PostFormValue("refresh_token")
+	}); err != nil {
+		writeOAuthParamsError(w, err)
+		return
+	}
+
+	tokenPair, err := tokenService.Refresh(tokenParams.RefreshToken)
+	switch {
+	case errors.Is(err, service.ErrTokenExpired):
+		utils.HttpErrorResponse(w, "invalid_grant", "The refresh token has expired", http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrTokenRevoked):
+		log.Error().Str("error", "token_revoked").Str("error_description", "Revoked refresh token presented, session revoked").Send()
+		utils.HttpErrorResponse(w, "invalid_grant", "The refresh token has been revoked", http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrTokenInvalid):
+		utils.HttpErrorResponse(w, "invalid_grant", "The refresh token is invalid", http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to refresh token due to: %s", err.Error())).Send()
+		utils.HttpErrorResponse(w, "server_error", "Unable to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenPair(w, tokenPair)
+}
+
+// revokeHandler implements OAuth2 token revocation: the session of the given
+// access or refresh token is ended. Unknown tokens succeed too.
+func revokeHandler(w http.ResponseWriter, r *http.Request) {
+	var revokeParams object.RevokeParams
+	if err := decodeOAuthParams(r, &revokeParams, func() {
+		revokeParams.Token = r.PostFormValue("token")
+	}); err != nil {
+		writeOAuthParamsError(w, err)
+		return
+	}
+
+	if err := tokenService.Revoke(revokeParams.Token); err != nil {
+		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to revoke token due to: %s", err.Error())).Send()
+		utils.HttpErrorResponse(w, "server_error", "Unable to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// logoutHandler ends every session of the authenticated user.
+func logoutHandler(w http.ResponseWriter, r *http.Request) error {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+
+	if err := tokenService.RevokeAll(principal.UserId); err != nil {
+		return utils.Internal("Unable to log out", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": "Logged out of all sessions",
+	})
+	return nil
+}
+
+// decodeOAuthParams reads the parameters of an OAuth2 endpoint, as JSON or
+// form encoded with fromForm, and validates them like those of any other
+// route.
+func decodeOAuthParams(r *http.Request, params interface{}, fromForm func()) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			return errMalformedParams
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return errMalformedParams
+		}
+		fromForm()
+	}
+	return utils.Validate(params)
+}
+
+// writeOAuthParamsError answers parameters decodeOAuthParams refused with the
+// error response of RFC 6749 section 5.2, which OAuth2 clients parse instead
+// of a problem: unsupported_grant_type for any grant but refresh_token, and
+// invalid_request for everything else.
+func writeOAuthParamsError(w http.ResponseWriter, err error) {
+	var validationErr *utils.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, field := range validationErr.Fields {
+			if field.Field == "grant_type" {
+				utils.HttpErrorResponse(w, "unsupported_grant_type", "Only the refresh_token grant type is supported", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	utils.HttpErrorResponse(w, "invalid_request", err.Error(), http.StatusBadRequest)
+}
+
+func writeTokenPair(w http.ResponseWriter, tokenPair service.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  tokenPair.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(tokenPair.ExpiresIn.Seconds()),
+		"refresh_token": tokenPair.RefreshToken,
+	})
+}
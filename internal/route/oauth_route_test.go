@@ -0,0 +1,181 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/service"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func refresh(t *testing.T, routes testRoutes, refreshToken string) (*httptest.ResponseRecorder, tokenResponse) {
+	t.Helper()
+
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	routes.router.ServeHTTP(w, r)
+
+	var tokens tokenResponse
+	if w.Code == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&tokens))
+	}
+	return w, tokens
+}
+
+func TestRefreshIssuesNewTokenPair(t *testing.T) {
+	routes := newTestRouter()
+	pair, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+
+	response, tokens := refresh(t, routes, pair.RefreshToken)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, 60, tokens.ExpiresIn)
+	assert.NotEqual(t, pair.RefreshToken, tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, serve(routes.router, http.MethodGet, "/wallet/2/balance", tokens.AccessToken, "").Code)
+}
+
+func TestTokensAreStoredHashed(t *testing.T) {
+	routes := newTestRouter()
+	pair, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+
+	for hash := range routes.tokens.tokens {
+		assert.NotEqual(t, pair.AccessToken, hash)
+		assert.NotEqual(t, pair.RefreshToken, hash)
+	}
+	assert.Contains(t, routes.tokens.tokens, service.HashToken(pair.AccessToken))
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	routes := newTestRouter()
+	pair, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+
+	_, rotated := refresh(t, routes, pair.RefreshToken)
+	reused, _ := refresh(t, routes, pair.RefreshToken)
+
+	assert.Equal(t, http.StatusBadRequest, reused.Code)
+	assert.Contains(t, reused.Body.String(), "invalid_grant")
+	response := serve(routes.router, http.MethodGet, "/wallet/2/balance", rotated.AccessToken, "")
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	assert.Contains(t, response.Body.String(), "token_revoked")
+}
+
+func TestExpiredAccessTokenIsRejected(t *testing.T) {
+	routes := newTestRouter()
+	routes.tokens.Create(model.OAuthToken{UserId: 2, TokenHash: service.HashToken("expired"), Type: model.TokenTypeAccess, SessionId: "s", ExpiryDate: time.Now().Add(-time.Second)})
+
+	response := serve(routes.router, http.MethodGet, "/wallet/2/balance", "expired", "")
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	assert.Contains(t, response.Body.String(), "token_expired")
+	assert.Equal(t, `Bearer error="invalid_token"`, response.Header().Get("WWW-Authenticate"))
+}
+
+func TestRefreshTokenIsNotAnAccessToken(t *testing.T) {
+	routes := newTestRouter()
+	pair, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+
+	response := serve(routes.router, http.MethodGet, "/wallet/2/balance", pair.RefreshToken, "")
+
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestRevokeEndsSession(t *testing.T) {
+	routes := newTestRouter()
+	pair, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+
+	form := url.Values{"token": {pair.RefreshToken}}
+	r := httptest.NewRequest(http.MethodPost, "/oauth/revoke", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	routes.router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	response := serve(routes.router, http.MethodGet, "/wallet/2/balance", pair.AccessToken, "")
+	assert.Contains(t, response.Body.String(), "token_revoked")
+}
+
+func TestLogoutRevokesAllSessions(t *testing.T) {
+	routes := newTestRouter()
+	first, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+	second, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+
+	response := serve(routes.router, http.MethodPost, "/oauth/logout", first.AccessToken, "")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(routes.router, http.MethodGet, "/wallet/2/balance", second.AccessToken, "").Code)
+	refreshed, _ := refresh(t, routes, second.RefreshToken)
+	assert.Equal(t, http.StatusBadRequest, refreshed.Code)
+	assert.Equal(t, http.StatusOK, serve(routes.router, http.MethodGet, "/wallet/1/balance", "token-user-1", "").Code)
+}
+
+func TestOAuthParamErrorsAreOAuth2Errors(t *testing.T) {
+	routes := newTestRouter()
+
+	form := url.Values{"grant_type": {"password"}, "refresh_token": {"token"}}
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	grant := httptest.NewRecorder()
+	routes.router.ServeHTTP(grant, r)
+
+	form = url.Values{"grant_type": {"refresh_token"}}
+	r = httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token := httptest.NewRecorder()
+	routes.router.ServeHTTP(token, r)
+
+	r = httptest.NewRequest(http.MethodPost, "/oauth/revoke", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	revoke := httptest.NewRecorder()
+	routes.router.ServeHTTP(revoke, r)
+
+	assert.Equal(t, http.StatusBadRequest, grant.Code)
+	assert.Equal(t, "application/json", grant.Header().Get("Content-Type"))
+	assert.Contains(t, grant.Body.String(), `"error":"unsupported_grant_type"`)
+	assert.Equal(t, http.StatusBadRequest, token.Code)
+	assert.Contains(t, token.Body.String(), `"error":"invalid_request","error_description":"refresh_token is required"`)
+	assert.Equal(t, http.StatusBadRequest, revoke.Code)
+	assert.Contains(t, revoke.Body.String(), `"error":"invalid_request","error_description":"token is required"`)
+}
+
+func TestOAuthFailuresAreServerErrors(t *testing.T) {
+	routes := newTestRouter()
+	pair, err := tokenService.Issue(2)
+	assert.NoError(t, err)
+	routes.tokens.unavailable = true
+
+	refreshed, _ := refresh(t, routes, pair.RefreshToken)
+	form := url.Values{"token": {pair.RefreshToken}}
+	r := httptest.NewRequest(http.MethodPost, "/oauth/revoke", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	revoked := httptest.NewRecorder()
+	routes.router.ServeHTTP(revoked, r)
+
+	assert.Equal(t, http.StatusInternalServerError, refreshed.Code)
+	assert.Contains(t, refreshed.Body.String(), `"error":"server_error"`)
+	assert.Equal(t, http.StatusInternalServerError, revoked.Code)
+	assert.Contains(t, revoked.Body.String(), `"error":"server_error"`)
+}
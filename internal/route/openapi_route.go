@@ -0,0 +1,517 @@
+package route
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/openapi"
+	"go-wallet-service/internal/service"
+	"go-wallet-service/utils"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+func init() {
+	openapi.RegisterType(reflect.TypeOf(money.Decimal{}), openapi.Schema{Type: "number"})
+	openapi.RegisterType(reflect.TypeOf(money.Money{}), openapi.Schema{Type: "number"})
+	openapi.RegisterType(reflect.TypeOf(money.Currency("")), openapi.Schema{Type: "string", Pattern: "^[A-Z]{3}$"})
+}
+
+// OpenAPIRoutes serves the OpenAPI document of the routes of version, which
+// r is the router of, at /openapi.json and a page to browse it at /docs. It
+// must be called once every other route of the version is registered, and
+// fails when a route has no operation or no route serves an operation.
+func OpenAPIRoutes(r *mux.Router, version Version) error {
+	var spec []byte
+	r.HandleFunc("/openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}).Methods("GET")
+	r.HandleFunc("/docs", docsHandler).Methods("GET")
+
+	document, err := openAPIDocument(r, version)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	spec = append(encoded, '\n')
+	return nil
+}
+
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
+
+// operation documents a route. Its path parameters are read from the route
+// and its body schemas from the types it decodes and encodes, so only what
+// the code does not say is written here.
+type operation struct {
+	id         string
+	tag        string
+	summary    string
+	public     bool // served without an access token
+	idempotent bool // replays requests with the same Idempotency-Key
+	oauth      bool // takes form encoded bodies and answers errors as RFC 6749 fixes
+	since      int  // the number of the first version serving the route, when not every one does
+	parameters []openapi.Parameter
+	params     any // the body is decoded into a value of this type
+	status     int
+	response   any // encoded as the body: fields for a map, a mediaType for a body that is not JSON
+}
+
+// versioned is a body, or a field of one, whose type differs between
+// versions.
+type versioned func(Version) reflect.Type
+
+// fields describes a response written as a map by a value of each key.
+type fields map[string]any
+
+// mediaType is the content type of a response that is not JSON.
+type mediaType string
+
+var (
+	statusFields  = fields{"status": "", "message": ""}
+	balanceFields = fields{"balance": money.Money{}, "available_balance": money.Money{}, "currency": money.Currency("")}
+	tokenFields   = fields{"access_token": "", "token_type": "", "expires_in": 0, "refresh_token": ""}
+)
+
+const (
+	tagOAuth         = "OAuth"
+	tagUsers         = "Users"
+	tagWallets       = "Wallets"
+	tagHolds         = "Holds"
+	tagTransactions  = "Transactions"
+	tagSchedules     = "Schedules"
+	tagAdmin         = "Admin"
+	tagDocumentation = "Documentation"
+)
+
+// operations documents every route by its method and path template.
+var operations = map[string]operation{
+	"POST /oauth/token": {
+		id: "refreshToken", tag: tagOAuth, summary: "Exchange a refresh token for new tokens",
+		public: true, oauth: true, params: object.TokenParams{}, status: http.StatusOK, response: tokenFields,
+	},
+	"POST /oauth/revoke": {
+		id: "revokeToken", tag: tagOAuth, summary: "End the session of an access or refresh token",
+		public: true, oauth: true, params: object.RevokeParams{}, status: http.StatusOK,
+	},
+	"POST /oauth/logout": {
+		id: "logout", tag: tagOAuth, summary: "End every session of the user",
+		status: http.StatusOK, response: statusFields,
+	},
+
+	"POST /users": {
+		id: "registerUser", tag: tagUsers, summary: "Register a user with their first wallet",
+		public: true, params: object.RegisterParams{}, status: http.StatusCreated, response: model.RegistrationData{},
+	},
+	"GET /user/{userId}": {
+		id: "getProfile", tag: tagUsers, summary: "Get the profile of the user",
+		status: http.StatusOK, response: model.UserData{},
+	},
+	"PATCH /user/{userId}": {
+		id: "updateProfile", tag: tagUsers, summary: "Change the profile of the user",
+		params: object.ProfileParams{}, status: http.StatusOK, response: model.UserData{},
+	},
+	"DELETE /user/{userId}": {
+		id: "deleteUser", tag: tagUsers, summary: "Delete the user",
+		status: http.StatusOK, response: statusFields,
+	},
+	"GET /user/{userId}/wallets": {
+		id: "listWallets", tag: tagWallets, summary: "List the wallets of the user",
+		status: http.StatusOK, response: []model.WalletData{},
+	},
+	"POST /user/{userId}/wallets": {
+		id: "createWallet", tag: tagWallets, summary: "Open a wallet",
+		params: object.CreateWalletParams{}, status: http.StatusCreated, response: model.WalletData{},
+	},
+	"GET /user/{userId}/transactions": {
+		id: "listTransactions", tag: tagTransactions, summary: "List the transactions of the user, newest first",
+		parameters: []openapi.Parameter{
+			query("limit", openapi.Schema{Type: "integer", Minimum: number(1), Maximum: number(service.MaxTransactionPageSize)}, "Number of transactions per page"),
+			query("cursor", openapi.Schema{Type: "string"}, "next_cursor of the previous page"),
+			query("type", openapi.Schema{Type: "string", Enum: enum(model.TransactionTypeDeposit, model.TransactionTypeWithdraw, model.TransactionTypeTransfer, model.TransactionTypeReversal, model.TransactionTypeFee, model.TransactionTypeCredit, model.TransactionTypeDebit)}, ""),
+			query("direction", openapi.Schema{Type: "string", Enum: enum(model.DirectionIncoming, model.DirectionOutgoing)}, ""),
+			query("from", openapi.Schema{Type: "string"}, "RFC 3339 time or date of the oldest transaction"),
+			query("to", openapi.Schema{Type: "string"}, "RFC 3339 time or date of the newest transaction; a date includes the whole day"),
+			query("min_amount", openapi.Schema{Type: "number"}, ""),
+			query("max_amount", openapi.Schema{Type: "number"}, ""),
+			query("counterparty", openapi.Schema{Type: "integer"}, "ID of the other user of a transfer"),
+		},
+		status: http.StatusOK, response: fields{"transactions": versioned(transactionsType), "next_cursor": ""},
+	},
+	"POST /user/{userId}/transfer": {
+		id: "transfer", tag: tagTransactions, summary: "Transfer money to another user",
+		idempotent: true, params: object.TransferParams{}, status: http.StatusOK, response: statusFields,
+	},
+
+	"GET /user/{userId}/schedules": {
+		id: "listSchedules", tag: tagSchedules, summary: "List the scheduled transfers of the user",
+		status: http.StatusOK, response: fields{"schedules": []model.ScheduledTransferData{}},
+	},
+	"POST /user/{userId}/schedules": {
+		id: "createSchedule", tag: tagSchedules, summary: "Schedule a transfer",
+		idempotent: true, params: object.ScheduleParams{}, status: http.StatusCreated, response: model.ScheduledTransferData{},
+	},
+	"PATCH /user/{userId}/schedules/{scheduleId}": {
+		id: "updateSchedule", tag: tagSchedules, summary: "Change, pause or resume a scheduled transfer",
+		params: object.UpdateScheduleParams{}, status: http.StatusOK, response: model.ScheduledTransferData{},
+	},
+	"DELETE /user/{userId}/schedules/{scheduleId}": {
+		id: "cancelSchedule", tag: tagSchedules, summary: "Cancel a scheduled transfer",
+		status: http.StatusOK, response: model.ScheduledTransferData{},
+	},
+	"GET /user/{userId}/schedules/{scheduleId}/runs": {
+		id: "listScheduleRuns", tag: tagSchedules, summary: "List the runs of a scheduled transfer",
+		status: http.StatusOK, response: fields{"runs": []model.ScheduledTransferRunData{}},
+	},
+
+	"POST /transactions/{transactionId}/reversal": {
+		id: "reverseTransaction", tag: tagTransactions, summary: "Reverse a transaction, in full or in part",
+		idempotent: true, params: object.ReversalParams{}, status: http.StatusCreated,
+		response: fields{"status": "", "message": "", "transaction_id": 0, "reversal_of": 0, "amount": money.Money{}, "currency": money.Currency("")},
+	},
+
+	"PATCH /wallet/{walletId}": {
+		id: "updateWallet", tag: tagWallets, summary: "Rename a wallet or make it the default",
+		params: object.WalletParams{}, status: http.StatusOK, response: model.WalletData{},
+	},
+	"GET /wallet/{walletId}/balance": {
+		id: "getBalance", tag: tagWallets, summary: "Get the balance of a wallet",
+		status: http.StatusOK, response: balanceFields,
+	},
+	"GET /wallet/{walletId}/events": {
+		id: "watchWallet", tag: tagWallets, summary: "Stream the balance and new transactions of a wallet as server-sent events",
+		parameters: []openapi.Parameter{
+			{Name: "Last-Event-ID", In: "header", Description: "ID of the last event received, whose later transactions are sent first", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		status: http.StatusOK, response: mediaType("text/event-stream"),
+	},
+	"GET /wallet/{walletId}/quote": {
+		id: "quoteFee", tag: tagWallets, summary: "Quote the fee of a withdrawal or transfer",
+		parameters: []openapi.Parameter{
+			required(query("type", openapi.Schema{Type: "string", Enum: enum(model.TransactionTypeWithdraw, model.TransactionTypeTransfer)}, "")),
+			required(query("amount", openapi.Schema{Type: "number"}, "")),
+			query("currency", openapi.Schema{Type: "string"}, "Currency of the amount, which must be the wallet's"),
+		},
+		status: http.StatusOK, response: model.FeeQuoteData{},
+	},
+	"POST /wallet/{walletId}/deposit": {
+		id: "deposit", tag: tagWallets, summary: "Deposit money into a wallet",
+		idempotent: true, params: object.DepositParams{}, status: http.StatusOK, response: statusFields,
+	},
+	"POST /wallet/{walletId}/withdraw": {
+		id: "withdraw", tag: tagWallets, summary: "Withdraw money from a wallet",
+		idempotent: true, params: object.WithdrawParams{}, status: http.StatusOK, response: statusFields,
+	},
+	"GET /wallet/{walletId}/holds": {
+		id: "listHolds", tag: tagHolds, summary: "List the holds on a wallet",
+		status: http.StatusOK, response: fields{"holds": []model.HoldData{}},
+	},
+	"POST /wallet/{walletId}/holds": {
+		id: "placeHold", tag: tagHolds, summary: "Hold money in a wallet for a later capture",
+		idempotent: true, params: object.HoldParams{}, status: http.StatusCreated, response: model.HoldData{},
+	},
+	"POST /wallet/{walletId}/holds/{holdId}/capture": {
+		id: "captureHold", tag: tagHolds, summary: "Capture a hold, in full or in part",
+		idempotent: true, params: object.CaptureParams{}, status: http.StatusOK, response: model.HoldData{},
+	},
+	"POST /wallet/{walletId}/holds/{holdId}/release": {
+		id: "releaseHold", tag: tagHolds, summary: "Release a hold",
+		status: http.StatusOK, response: model.HoldData{},
+	},
+
+	"GET /admin/users/{userId}": {
+		id: "adminGetUser", tag: tagAdmin, summary: "Look up a user and their wallets",
+		status: http.StatusOK, response: fields{"user": model.UserDetailData{}, "wallets": []model.WalletData{}},
+	},
+	"POST /admin/users/{userId}/status": {
+		id: "adminChangeUserStatus", tag: tagAdmin, summary: "Change the status of a user",
+		params: object.StatusParams{}, status: http.StatusCreated, response: model.StatusChangeData{},
+	},
+	"GET /admin/wallets/{walletId}": {
+		id: "adminGetWallet", tag: tagAdmin, summary: "Look up a wallet",
+		status: http.StatusOK, response: model.WalletDetailData{},
+	},
+	"POST /admin/wallets/{walletId}/status": {
+		id: "adminChangeWalletStatus", tag: tagAdmin, summary: "Change the status of a wallet",
+		params: object.StatusParams{}, status: http.StatusCreated, response: model.StatusChangeData{},
+	},
+	"POST /admin/wallets/{walletId}/adjustments": {
+		id: "adminAdjustWallet", tag: tagAdmin, summary: "Credit or debit a wallet by hand",
+		idempotent: true, params: object.AdjustmentParams{}, status: http.StatusCreated, response: model.TransactionRecordData{},
+	},
+	"GET /admin/transactions/{transactionId}": {
+		id: "adminGetTransaction", tag: tagAdmin, summary: "Look up a transaction",
+		status: http.StatusOK, response: model.TransactionRecordData{},
+	},
+	"GET /admin/audit": {
+		id: "adminListAudit", tag: tagAdmin, summary: "Search the audit log, newest first",
+		parameters: []openapi.Parameter{
+			query("actor_type", openapi.Schema{Type: "string", Enum: enum(model.ActorTypeUser, model.ActorTypeAdmin, model.ActorTypeSystem)}, ""),
+			query("actor_user_id", openapi.Schema{Type: "integer", Minimum: number(1)}, ""),
+			query("action", openapi.Schema{Type: "string"}, ""),
+			query("user_id", openapi.Schema{Type: "integer", Minimum: number(1)}, ""),
+			query("wallet_id", openapi.Schema{Type: "integer", Minimum: number(1)}, ""),
+			query("transaction_id", openapi.Schema{Type: "integer", Minimum: number(1)}, ""),
+			query("request_id", openapi.Schema{Type: "string"}, ""),
+			query("from", openapi.Schema{Type: "string"}, "RFC 3339 time or date of the oldest entry"),
+			query("to", openapi.Schema{Type: "string"}, "RFC 3339 time or date of the newest entry; a date includes the whole day"),
+			query("before", openapi.Schema{Type: "integer", Minimum: number(1)}, "next_before of the previous page"),
+			query("limit", openapi.Schema{Type: "integer", Minimum: number(1), Maximum: number(service.MaxAuditPageSize)}, "Number of entries per page"),
+		},
+		status: http.StatusOK, response: fields{"entries": []model.AuditEntryData{}, "next_before": 0},
+	},
+	"GET /admin/webhooks": {
+		id: "adminListWebhooks", tag: tagAdmin, summary: "List the webhook endpoints",
+		status: http.StatusOK, response: fields{"webhooks": []model.WebhookEndpointData{}},
+	},
+	"POST /admin/webhooks": {
+		id: "adminRegisterWebhook", tag: tagAdmin, summary: "Register a webhook endpoint",
+		params: object.WebhookParams{}, status: http.StatusCreated, response: model.WebhookEndpointData{},
+	},
+	"DELETE /admin/webhooks/{webhookId}": {
+		id: "adminRemoveWebhook", tag: tagAdmin, summary: "Stop delivering events to a webhook endpoint",
+		status: http.StatusOK, response: model.WebhookEndpointData{},
+	},
+	"GET /admin/webhooks/{webhookId}/deliveries": {
+		id: "adminListDeliveries", tag: tagAdmin, summary: "List the deliveries to a webhook endpoint",
+		parameters: []openapi.Parameter{
+			query("status", openapi.Schema{Type: "string", Enum: enum(model.DeliveryStatusPending, model.DeliveryStatusDelivered, model.DeliveryStatusDead)}, ""),
+			query("limit", openapi.Schema{Type: "integer", Minimum: number(1), Maximum: number(service.MaxDeliveryPageSize)}, ""),
+		},
+		status: http.StatusOK, response: fields{"deliveries": []model.WebhookDeliveryData{}},
+	},
+	"POST /admin/webhooks/deliveries/{deliveryId}/redeliver": {
+		id: "adminRedeliver", tag: tagAdmin, summary: "Deliver an event to a webhook endpoint again",
+		status: http.StatusAccepted, response: model.WebhookDeliveryData{},
+	},
+
+	"GET /openapi.json": {
+		id: "getOpenAPI", tag: tagDocumentation, summary: "Get this OpenAPI document",
+		public: true, status: http.StatusOK, response: fields{},
+	},
+	"GET /docs": {
+		id: "getDocs", tag: tagDocumentation, summary: "Browse this OpenAPI document",
+		public: true, status: http.StatusOK, response: mediaType("text/html"),
+	},
+}
+
+// openAPIDocument documents the routes of version, which r is the router of,
+// with their operations.
+func openAPIDocument(r *mux.Router, version Version) (*openapi.Document, error) {
+	description := "Wallets, their balances and the transactions that move money between them."
+	if !version.Deprecation.IsZero() {
+		description += fmt.Sprintf(" This version is deprecated from %s and served until %s; move to %s.",
+			version.Deprecation.Format(time.DateOnly), version.Sunset.Format(time.DateOnly), version.Successor)
+	}
+	document := openapi.NewDocument(openapi.Info{
+		Title:       "go-wallet-service",
+		Description: description,
+		Version:     fmt.Sprintf("%d.0.0", version.Number),
+	})
+	if version.Prefix != "" {
+		document.Servers = []openapi.Server{{URL: version.Prefix}}
+	}
+	document.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer"}
+	fieldErrors, err := document.SchemaOf(reflect.TypeOf([]utils.FieldError{}))
+	if err != nil {
+		return nil, err
+	}
+	document.Components.Schemas["Problem"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"type":     {Type: "string"},
+			"title":    {Type: "string"},
+			"status":   {Type: "integer"},
+			"detail":   {Type: "string"},
+			"instance": {Type: "string"},
+			"code":     {Type: "string"},
+			"errors":   fieldErrors,
+		},
+		Required: []string{"type", "title", "status", "detail", "instance", "code"},
+	}
+
+	routed := map[string]bool{}
+	err = r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// the path prefix of a subrouter
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		path = strings.TrimPrefix(path, version.Prefix)
+
+		for _, method := range methods {
+			key := method + " " + path
+			op, ok := operations[key]
+			if !ok {
+				return fmt.Errorf("%s has no operation in version %d", key, version.Number)
+			}
+			if op.since > version.Number {
+				// registered on every version, but not served by this one
+				continue
+			}
+			routed[key] = true
+
+			described, err := op.describe(document, version, path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			document.AddOperation(method, path, described)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var unrouted []string
+	for key, op := range operations {
+		if !routed[key] && op.since <= version.Number {
+			unrouted = append(unrouted, key)
+		}
+	}
+	if len(unrouted) > 0 {
+		sort.Strings(unrouted)
+		return nil, fmt.Errorf("no route serves %s", strings.Join(unrouted, ", "))
+	}
+	return document, nil
+}
+
+func (op operation) describe(document *openapi.Document, version Version, path string) (*openapi.Operation, error) {
+	described := &openapi.Operation{
+		Tags:        []string{op.tag},
+		Summary:     op.summary,
+		OperationId: op.id,
+		Responses:   map[string]openapi.Response{},
+		Deprecated:  !version.Deprecation.IsZero(),
+	}
+	if !op.public {
+		described.Security = []map[string][]string{{"bearerAuth": {}}}
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			described.Parameters = append(described.Parameters, openapi.Parameter{
+				Name: strings.TrimSuffix(name, "}"), In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"},
+			})
+		}
+	}
+	described.Parameters = append(described.Parameters, op.parameters...)
+	if op.idempotent {
+		described.Parameters = append(described.Parameters, openapi.Parameter{
+			Name: middleware.IdempotencyKeyHeader, In: "header", Schema: &openapi.Schema{Type: "string"},
+			Description: "Key under which the response is kept and replayed to retries, instead of repeating the operation",
+		})
+	}
+
+	if op.params != nil {
+		schema, err := schemaOf(document, version, op.params)
+		if err != nil {
+			return nil, err
+		}
+		described.RequestBody = &openapi.RequestBody{
+			Required: len(document.Resolve(schema).Required) > 0,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: schema}},
+		}
+		if op.oauth {
+			described.RequestBody.Content["application/x-www-form-urlencoded"] = openapi.MediaType{Schema: schema}
+		}
+	}
+
+	response := openapi.Response{Description: http.StatusText(op.status)}
+	switch body := op.response.(type) {
+	case nil:
+	case mediaType:
+		response.Content = map[string]openapi.MediaType{string(body): {Schema: &openapi.Schema{Type: "string"}}}
+	case fields:
+		schema := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+		for key, value := range body {
+			property, err := schemaOf(document, version, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			schema.Properties[key] = property
+		}
+		response.Content = map[string]openapi.MediaType{"application/json": {Schema: schema}}
+	default:
+		schema, err := schemaOf(document, version, body)
+		if err != nil {
+			return nil, err
+		}
+		response.Content = map[string]openapi.MediaType{"application/json": {Schema: schema}}
+	}
+	described.Responses[strconv.Itoa(op.status)] = response
+
+	if op.oauth {
+		errorResponse, err := document.SchemaOf(reflect.TypeOf(utils.ErrorResponse{}))
+		if err != nil {
+			return nil, err
+		}
+		described.Responses["default"] = openapi.Response{
+			Description: "Error",
+			Content:     map[string]openapi.MediaType{"application/json": {Schema: errorResponse}},
+		}
+	} else {
+		described.Responses["default"] = openapi.Response{
+			Description: "Problem",
+			Content:     map[string]openapi.MediaType{"application/problem+json": {Schema: openapi.Ref("Problem")}},
+		}
+	}
+	return described, nil
+}
+
+// schemaOf describes a value of a body as version encodes it.
+func schemaOf(document *openapi.Document, version Version, value any) (*openapi.Schema, error) {
+	if value, ok := value.(versioned); ok {
+		return document.SchemaOf(value(version))
+	}
+	return document.SchemaOf(reflect.TypeOf(value))
+}
+
+func transactionsType(version Version) reflect.Type {
+	return reflect.SliceOf(reflect.TypeOf(version.transaction(model.TransactionData{})))
+}
+
+func query(name string, schema openapi.Schema, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &schema}
+}
+
+func required(parameter openapi.Parameter) openapi.Parameter {
+	parameter.Required = true
+	return parameter
+}
+
+func number(value float64) *float64 {
+	return &value
+}
+
+func enum(values ...string) []any {
+	options := make([]any, len(values))
+	for i, value := range values {
+		options[i] = value
+	}
+	return options
+}
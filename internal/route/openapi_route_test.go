@@ -0,0 +1,251 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/openapi"
+)
+
+// specPath is the committed OpenAPI document of a version, which clients are
+// generated from. Run the tests with -update to rewrite it after changing the
+// API.
+func specPath(version Version) string {
+	return "../../api" + version.Prefix + "/openapi.json"
+}
+
+var update = flag.Bool("update", false, "rewrite the committed OpenAPI documents")
+
+func newDocumentedRouter(t *testing.T) testRoutes {
+	routes := newTestRouter()
+	for i, version := range Versions {
+		if err := OpenAPIRoutes(routes.versions[i], version); err != nil {
+			t.Fatalf("Failed to document version %d of the routes: %v", version.Number, err)
+		}
+	}
+	return routes
+}
+
+func servedSpec(t *testing.T, router *mux.Router, version Version) openapi.Document {
+	var spec openapi.Document
+	response := serve(router, http.MethodGet, version.Prefix+"/openapi.json", "", "")
+	if err := json.Unmarshal(response.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Failed to decode the document of version %d: %v", version.Number, err)
+	}
+	return spec
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	routes := newDocumentedRouter(t)
+
+	for _, version := range Versions {
+		spec := servedSpec(t, routes.router, version)
+		documented := 0
+		for _, item := range spec.Paths {
+			documented += len(item)
+		}
+		assert.Equal(t, len(operations), documented, version.Prefix)
+	}
+}
+
+func TestOpenAPIRejectsUndocumentedRoute(t *testing.T) {
+	routes := newTestRouter()
+	routes.versions[0].HandleFunc("/wallet/{walletId}/statement", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+
+	err := OpenAPIRoutes(routes.versions[0], Versions[0])
+
+	assert.ErrorContains(t, err, "GET /wallet/{walletId}/statement has no operation")
+}
+
+func TestOpenAPIRejectsOperationWithoutRoute(t *testing.T) {
+	router := mux.NewRouter()
+	OAuthRoutes(router, nil)
+
+	err := OpenAPIRoutes(router, Unversioned)
+
+	assert.ErrorContains(t, err, "no route serves")
+	assert.ErrorContains(t, err, "GET /user/{userId},")
+}
+
+func TestRouteOfLaterVersionIsOnlyServedFromIt(t *testing.T) {
+	operations["GET /wallet/{walletId}/statement"] = operation{id: "getStatement", since: V2.Number, status: http.StatusOK}
+	defer delete(operations, "GET /wallet/{walletId}/statement")
+	routes := newTestRouter()
+	for i, version := range Versions {
+		routes.versions[i].HandleFunc("/wallet/{walletId}/statement", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+		if err := OpenAPIRoutes(routes.versions[i], version); err != nil {
+			t.Fatalf("Failed to document version %d of the routes: %v", version.Number, err)
+		}
+	}
+
+	assert.NotContains(t, servedSpec(t, routes.router, V1).Paths, "/wallet/{walletId}/statement")
+	assert.Contains(t, servedSpec(t, routes.router, V2).Paths, "/wallet/{walletId}/statement")
+	assert.Equal(t, http.StatusNotFound, serve(routes.router, http.MethodGet, "/wallet/2/statement", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(routes.router, http.MethodGet, "/v1/wallet/2/statement", "", "").Code)
+	assert.Equal(t, http.StatusOK, serve(routes.router, http.MethodGet, "/v2/wallet/2/statement", "", "").Code)
+}
+
+func TestOpenAPIDocumentIsCommitted(t *testing.T) {
+	routes := newDocumentedRouter(t)
+
+	for _, version := range []Version{V1, V2} {
+		response := serve(routes.router, http.MethodGet, version.Prefix+"/openapi.json", "", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+
+		path := specPath(version)
+		if *update {
+			if err := os.WriteFile(path, response.Body.Bytes(), 0o644); err != nil {
+				t.Fatalf("Failed to update %s: %v", path, err)
+			}
+		}
+		committed, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if !bytes.Equal(committed, response.Body.Bytes()) {
+			t.Errorf("%s does not describe the routes; run go test ./internal/route -run TestOpenAPIDocumentIsCommitted -update and review the change", path)
+		}
+	}
+}
+
+func TestDocsPageIsServed(t *testing.T) {
+	routes := newDocumentedRouter(t)
+
+	response := serve(routes.router, http.MethodGet, "/v2/docs", "", "")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/html; charset=utf-8", response.Header().Get("Content-Type"))
+	// relative, so the page of each version loads the document of its own
+	assert.Contains(t, response.Body.String(), `fetch("openapi.json")`)
+}
+
+// TestOpenAPIDescribesResponses checks the bodies routes answer with against
+// the schemas documented for them, which catches responses written as maps
+// drifting from their operation.
+func TestOpenAPIDescribesResponses(t *testing.T) {
+	for _, version := range Versions {
+		assertResponsesDescribed(t, version)
+	}
+}
+
+func assertResponsesDescribed(t *testing.T, version Version) {
+	routes := newDocumentedRouter(t)
+	routes.users.entries = []model.TransactionEntry{walletEntry(30, 11, 2, 500, 20000)}
+	spec := servedSpec(t, routes.router, version)
+
+	for _, tt := range []struct {
+		method   string
+		template string
+		path     string
+		token    string
+		body     string
+	}{
+		{http.MethodPost, "/users", "/users", "", `{"username":"alice","email":"alice@example.com"}`},
+		{http.MethodPost, "/users", "/users", "", `{"username":"Alice Smith"}`},
+		{http.MethodGet, "/user/{userId}", "/user/1", "token-user-1", ""},
+		{http.MethodPatch, "/user/{userId}", "/user/1", "token-user-1", `{"display_name":"Alice"}`},
+		{http.MethodGet, "/user/{userId}/wallets", "/user/1/wallets", "token-user-1", ""},
+		{http.MethodPost, "/user/{userId}/wallets", "/user/1/wallets", "token-user-1", `{"name":"euros","currency":"EUR"}`},
+		{http.MethodGet, "/user/{userId}/transactions", "/user/2/transactions?limit=1", "token-user-2", ""},
+		{http.MethodPost, "/user/{userId}/transfer", "/user/2/transfer", "token-user-2", `{"user_id":2,"receiver_user_id":1,"amount":10}`},
+		{http.MethodGet, "/user/{userId}/schedules", "/user/1/schedules", "token-user-1", ""},
+		{http.MethodGet, "/wallet/{walletId}/balance", "/wallet/2/balance", "token-user-2", ""},
+		{http.MethodGet, "/wallet/{walletId}/balance", "/wallet/1/balance", "token-user-2", ""},
+		{http.MethodGet, "/wallet/{walletId}/quote", "/wallet/1/quote?type=withdraw&amount=20", "token-user-1", ""},
+		{http.MethodPost, "/wallet/{walletId}/deposit", "/wallet/1/deposit", "token-user-1", `{"user_id":1,"amount":20}`},
+		{http.MethodPost, "/wallet/{walletId}/holds", "/wallet/1/holds", "token-user-1", `{"amount":30}`},
+		{http.MethodGet, "/wallet/{walletId}/holds", "/wallet/1/holds", "token-user-1", ""},
+		{http.MethodPost, "/transactions/{transactionId}/reversal", "/transactions/10/reversal", "token-user-2", `{"amount":2.5}`},
+		{http.MethodGet, "/admin/users/{userId}", "/admin/users/2", "token-support", ""},
+		{http.MethodGet, "/admin/wallets/{walletId}", "/admin/wallets/2", "token-support", ""},
+		{http.MethodGet, "/admin/transactions/{transactionId}", "/admin/transactions/10", "token-support", ""},
+		{http.MethodGet, "/admin/audit", "/admin/audit?limit=2", "token-support", ""},
+		{http.MethodPost, "/admin/webhooks", "/admin/webhooks", "token-admin", `{"url":"https://example.com/hooks"}`},
+		{http.MethodGet, "/admin/webhooks", "/admin/webhooks", "token-admin", ""},
+		{http.MethodPost, "/oauth/logout", "/oauth/logout", "token-user-1", ""},
+	} {
+		name := tt.method + " " + version.Prefix + tt.path
+		response := serve(routes.router, tt.method, version.Prefix+tt.path, tt.token, tt.body)
+
+		operation := spec.Operation(tt.method, tt.template)
+		if !assert.NotNil(t, operation, name) {
+			continue
+		}
+		documented, ok := operation.Responses[strconv.Itoa(response.Code)]
+		if !ok {
+			documented = operation.Responses["default"]
+		}
+		contentType, _, _ := strings.Cut(response.Header().Get("Content-Type"), ";")
+		media, ok := documented.Content[contentType]
+		if !assert.True(t, ok, "%s answered %d with %s, which is not documented", name, response.Code, contentType) {
+			continue
+		}
+
+		var body any
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s answered with invalid JSON: %v", name, err)
+			continue
+		}
+		assertSchema(t, &spec, media.Schema, body, name)
+	}
+}
+
+// assertSchema checks that value has the type its schema documents and no
+// property it leaves out.
+func assertSchema(t *testing.T, spec *openapi.Document, schema *openapi.Schema, value any, at string) {
+	t.Helper()
+	if len(schema.AllOf) > 0 {
+		if value == nil {
+			assert.True(t, schema.Nullable, "%s is null", at)
+			return
+		}
+		schema = schema.AllOf[0]
+	}
+	schema = spec.Resolve(schema)
+	if schema.Type == "" {
+		// any value
+		return
+	}
+	if value == nil {
+		assert.True(t, schema.Nullable, "%s is null", at)
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		if !assert.Equal(t, "object", schema.Type, at) {
+			return
+		}
+		for key, property := range value {
+			propertySchema, ok := schema.Properties[key]
+			if !assert.True(t, ok, "%s.%s is not documented", at, key) {
+				continue
+			}
+			assertSchema(t, spec, propertySchema, property, at+"."+key)
+		}
+	case []any:
+		if !assert.Equal(t, "array", schema.Type, at) {
+			return
+		}
+		for i, item := range value {
+			assertSchema(t, spec, schema.Items, item, at+"["+strconv.Itoa(i)+"]")
+		}
+	case float64:
+		assert.Contains(t, []string{"number", "integer"}, schema.Type, at)
+	case string:
+		assert.Equal(t, "string", schema.Type, at)
+	case bool:
+		assert.Equal(t, "boolean", schema.Type, at)
+	}
+}
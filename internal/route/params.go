@@ -0,0 +1,123 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/openapi"
+	"go-wallet-service/utils"
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+	// phone numbers are kept in E.164 form, such as +6591234567
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+func init() {
+	utils.RegisterValidator("currency", func(value reflect.Value, _ string) bool {
+		_, err := money.ParseCurrency(value.String())
+		return err == nil
+	})
+	openapi.RegisterRule("currency", func(schema *openapi.Schema, _ string) error {
+		schema.Pattern = "^[A-Za-z]{3}$"
+		schema.Description = "ISO 4217 currency code"
+		return nil
+	})
+	utils.RegisterValidator("username", func(value reflect.Value, _ string) bool {
+		return usernamePattern.MatchString(value.String())
+	})
+	openapi.RegisterRule("username", func(schema *openapi.Schema, _ string) error {
+		schema.Pattern = usernamePattern.String()
+		return nil
+	})
+	// an empty email or phone clears it from a profile
+	utils.RegisterValidator("email", func(value reflect.Value, _ string) bool {
+		if value.String() == "" {
+			return true
+		}
+		address, err := mail.ParseAddress(value.String())
+		return err == nil && address.Address == value.String()
+	})
+	openapi.RegisterRule("email", func(schema *openapi.Schema, _ string) error {
+		schema.Format = "email"
+		return nil
+	})
+	utils.RegisterValidator("phone", func(value reflect.Value, _ string) bool {
+		return value.String() == "" || phonePattern.MatchString(value.String())
+	})
+	openapi.RegisterRule("phone", func(schema *openapi.Schema, _ string) error {
+		schema.Pattern = "^$|" + phonePattern.String()
+		return nil
+	})
+	utils.RegisterValidator("webhook_url", func(value reflect.Value, _ string) bool {
+		parsed, err := url.Parse(value.String())
+		return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+	})
+	openapi.RegisterRule("webhook_url", func(schema *openapi.Schema, _ string) error {
+		schema.Format = "uri"
+		schema.Pattern = "^https?://"
+		return nil
+	})
+	utils.RegisterValidator("event_types", func(value reflect.Value, _ string) bool {
+		for i := 0; i < value.Len(); i++ {
+			if !model.IsEventType(value.Index(i).String()) {
+				return false
+			}
+		}
+		return true
+	})
+	openapi.RegisterRule("event_types", func(schema *openapi.Schema, _ string) error {
+		if schema.Items == nil {
+			return errors.New("event_types applies to arrays")
+		}
+		schema.Items.Enum = nil
+		for _, eventType := range model.EventTypes {
+			schema.Items.Enum = append(schema.Items.Enum, eventType)
+		}
+		return nil
+	})
+}
+
+var errMalformedParams = utils.Invalid("invalid_parameter", "Parameters are missing, not expected or not matching the required format")
+
+// decodeParams reads the JSON request body the OAuth middleware kept, or the
+// body itself on routes without it, into params and validates it against its
+// binding tags. An empty body leaves params as they are. A body that fails
+// validation is reported as a *utils.ValidationError listing every failing
+// field.
+func decodeParams(r *http.Request, params any) error {
+	requestParams, ok := r.Context().Value("requestParams").(string)
+	if !ok {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return errMalformedParams
+		}
+		requestParams = string(body)
+	}
+
+	if requestParams != "" {
+		if err := json.Unmarshal([]byte(requestParams), params); err != nil {
+			log.Debug().Str("error", "json_unmarshal_error").Str("error_description", fmt.Sprintf("Unable to unmarshal parameters: %v", requestParams)).Send()
+			return errMalformedParams
+		}
+	}
+
+	return utils.Validate(params)
+}
+
+// invalidParameter reports a query or body parameter the request got wrong.
+func invalidParameter(format string, args ...any) error {
+	return utils.Invalid("invalid_parameter", fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,1930 @@
+package route
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+	"go-wallet-service/internal/service"
+)
+
+type fakeUserRepository struct {
+	transfers      int
+	lastTransfer   [2]int
+	lastConversion *model.Conversion
+	lastFee        *model.Fee
+	entries        []model.TransactionEntry
+	lastFilter     model.TransactionFilter
+	transactions   map[int]model.Transaction
+	reversals      int
+	lastForce      bool
+	wallets        *fakeWalletRepository
+	registered     map[int]model.User
+	deleted        map[int]bool
+}
+
+// staffRoles are the roles of the staff users of a test.
+var staffRoles = map[int]string{3: model.RoleAdmin, 5: model.RoleSupport, 6: model.RoleOperator, 7: model.RoleFinance}
+
+// GetById gives the staff users their roles and answers registered users as
+// stored.
+func (f *fakeUserRepository) GetById(userId int) (model.User, error) {
+	if f.deleted[userId] {
+		return model.User{}, sql.ErrNoRows
+	}
+	if user, ok := f.registered[userId]; ok {
+		return user, nil
+	}
+	if role, ok := staffRoles[userId]; ok {
+		return model.User{ID: userId, Role: role, Status: model.StatusActive}, nil
+	}
+	return model.User{ID: userId, Role: model.RoleUser, Status: model.StatusActive}, nil
+}
+
+// GetByIdIncludingDeleted answers deleted users too, with the date they were
+// deleted.
+func (f *fakeUserRepository) GetByIdIncludingDeleted(userId int) (model.User, error) {
+	if !f.deleted[userId] {
+		return f.GetById(userId)
+	}
+	user, ok := f.registered[userId]
+	if !ok {
+		user = model.User{ID: userId, Role: model.RoleUser}
+	}
+	deletionDate := time.Date(2024, time.December, 20, 0, 0, 0, 0, time.UTC)
+	user.Status, user.DeletionDate = model.StatusClosed, &deletionDate
+	return user, nil
+}
+
+// Register stores the user from ID 10 on, with their wallet from ID 100 on.
+func (f *fakeUserRepository) Register(actor model.Actor, user model.User, walletName string, currency money.Currency) (model.User, model.Wallet, error) {
+	for _, registered := range f.registered {
+		if registered.Username == user.Username {
+			return model.User{}, model.Wallet{}, repository.ErrUsernameTaken
+		}
+	}
+	user.ID = 10 + len(f.registered)
+	user.Role = model.RoleUser
+	user.Status = model.StatusActive
+	f.registered[user.ID] = user
+
+	wallet := model.Wallet{ID: 100 + len(f.registered), UserId: user.ID, Name: walletName, IsDefault: true, Currency: currency, Balance: money.New(0, currency), Status: model.StatusActive}
+	f.wallets.wallets[wallet.ID] = wallet
+	return user, wallet, nil
+}
+
+func (f *fakeUserRepository) UpdateProfile(actor model.Actor, user model.User) (model.User, error) {
+	f.registered[user.ID] = user
+	return user, nil
+}
+
+func (f *fakeUserRepository) Delete(actor model.Actor, userId int) error {
+	for _, wallet := range f.wallets.wallets {
+		if wallet.UserId == userId && !wallet.Balance.IsZero() {
+			return repository.ErrAccountNotEmpty
+		}
+	}
+	f.deleted[userId] = true
+	return nil
+}
+
+func (f *fakeUserRepository) SetStatus(actor model.Actor, userId int, change model.StatusChange) (model.StatusChange, error) {
+	user, err := f.GetById(userId)
+	if err != nil {
+		return model.StatusChange{}, err
+	}
+	change.UserId, change.FromStatus, change.ActorUserId = userId, user.Status, actor.UserId
+	user.Status = change.ToStatus
+	f.registered[userId] = user
+	return change, nil
+}
+
+func (f *fakeUserRepository) GetTransactionById(transactionId int) (model.Transaction, error) {
+	transaction, ok := f.transactions[transactionId]
+	if !ok {
+		return model.Transaction{}, sql.ErrNoRows
+	}
+	return transaction, nil
+}
+
+func (f *fakeUserRepository) Reverse(actor model.Actor, transactionId int, amount *money.Money, force bool) (model.Transaction, error) {
+	f.reversals++
+	f.lastForce = force
+	original := f.transactions[transactionId]
+	if amount == nil {
+		amount = &original.Amount
+	}
+	return model.Transaction{ID: 100 + f.reversals, Type: model.TransactionTypeReversal, Amount: *amount, Currency: amount.Currency, ReversalOf: &original.ID}, nil
+}
+
+func (f *fakeUserRepository) GetByIds(userIds []int) ([]model.User, error) {
+	return nil, nil
+}
+
+func (f *fakeUserRepository) GetUserByUserId(userId int) ([]model.User, error) {
+	return []model.User{{ID: userId}}, nil
+}
+
+// GetUserTransactionsByUserId pages through the seeded entries, newest first,
+// ignoring every filter but the wallet, the cursors, the order and the limit.
+func (f *fakeUserRepository) GetUserTransactionsByUserId(userId int, filter model.TransactionFilter) ([]model.TransactionEntry, error) {
+	f.lastFilter = filter
+
+	seeded := slices.Clone(f.entries)
+	if filter.OldestFirst {
+		slices.Reverse(seeded)
+	}
+
+	var entries []model.TransactionEntry
+	for _, entry := range seeded {
+		if filter.WalletId != 0 && entry.WalletId != filter.WalletId {
+			continue
+		}
+		if filter.BeforeEntryId != 0 && entry.EntryId >= filter.BeforeEntryId {
+			continue
+		}
+		if entry.EntryId <= filter.AfterEntryId {
+			continue
+		}
+		if len(entries) == filter.Limit {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (f *fakeUserRepository) Transfer(actor model.Actor, senderWalletId int, receiverWalletId int, amount money.Money, conversion *model.Conversion, fee *model.Fee, check repository.MovementCheck) error {
+	if err := runCheck(check, f.wallets.wallets[senderWalletId]); err != nil {
+		return err
+	}
+	f.transfers++
+	f.lastTransfer = [2]int{senderWalletId, receiverWalletId}
+	f.lastConversion = conversion
+	f.lastFee = fee
+	return nil
+}
+
+type fakeWalletRepository struct {
+	wallets     map[int]model.Wallet
+	held        map[int]int64
+	updates     int
+	lastFee     *model.Fee
+	adjustments []model.Adjustment
+	adjusters   []model.Actor
+}
+
+func (f *fakeWalletRepository) GetWalletByUserId(userId int) ([]model.Wallet, error) {
+	var wallets []model.Wallet
+	for _, wallet := range f.wallets {
+		if wallet.UserId == userId && wallet.DeletionDate == nil {
+			wallets = append(wallets, wallet)
+		}
+	}
+	return wallets, nil
+}
+
+func (f *fakeWalletRepository) GetAllWalletsByUserId(userId int) ([]model.Wallet, error) {
+	var wallets []model.Wallet
+	for _, wallet := range f.wallets {
+		if wallet.UserId == userId {
+			wallets = append(wallets, wallet)
+		}
+	}
+	return wallets, nil
+}
+
+// GetById does not answer closed wallets, which GetByIdIncludingDeleted does.
+func (f *fakeWalletRepository) GetById(walletId int) (model.Wallet, error) {
+	wallet, err := f.GetByIdIncludingDeleted(walletId)
+	if err == nil && wallet.DeletionDate != nil {
+		return model.Wallet{}, sql.ErrNoRows
+	}
+	return wallet, err
+}
+
+func (f *fakeWalletRepository) GetByIdIncludingDeleted(walletId int) (model.Wallet, error) {
+	wallet, ok := f.wallets[walletId]
+	if !ok {
+		return model.Wallet{}, sql.ErrNoRows
+	}
+	return wallet, nil
+}
+
+func (f *fakeWalletRepository) GetAvailableBalance(walletId int) (money.Money, error) {
+	wallet := f.wallets[walletId]
+	return money.New(wallet.Balance.Amount-f.held[walletId], wallet.Currency), nil
+}
+
+func (f *fakeWalletRepository) GetDefaultWalletByUserId(userId int) (model.Wallet, error) {
+	var fallback *model.Wallet
+	for _, wallet := range f.wallets {
+		if wallet.UserId != userId {
+			continue
+		}
+		if wallet.IsDefault {
+			return wallet, nil
+		}
+		if fallback == nil || wallet.ID < fallback.ID {
+			w := wallet
+			fallback = &w
+		}
+	}
+	if fallback == nil {
+		return model.Wallet{}, sql.ErrNoRows
+	}
+	return *fallback, nil
+}
+
+func (f *fakeWalletRepository) Create(actor model.Actor, userId int, name string, currency money.Currency, isDefault bool) (model.Wallet, error) {
+	id := 1
+	for walletId, wallet := range f.wallets {
+		if wallet.UserId == userId && wallet.Name == name {
+			return model.Wallet{}, repository.ErrWalletNameTaken
+		}
+		if walletId >= id {
+			id = walletId + 1
+		}
+	}
+	f.wallets[id] = model.Wallet{ID: id, UserId: userId, Name: name, Currency: currency, Balance: money.New(0, currency), Status: model.StatusActive}
+	if isDefault {
+		return f.SetDefault(actor, id)
+	}
+	return f.wallets[id], nil
+}
+
+func (f *fakeWalletRepository) Rename(actor model.Actor, walletId int, name string) (model.Wallet, error) {
+	wallet := f.wallets[walletId]
+	wallet.Name = name
+	f.wallets[walletId] = wallet
+	return wallet, nil
+}
+
+func (f *fakeWalletRepository) SetDefault(actor model.Actor, walletId int) (model.Wallet, error) {
+	userId := f.wallets[walletId].UserId
+	for id, wallet := range f.wallets {
+		if wallet.UserId == userId {
+			wallet.IsDefault = id == walletId
+			f.wallets[id] = wallet
+		}
+	}
+	return f.wallets[walletId], nil
+}
+
+func (f *fakeWalletRepository) Update(actor model.Actor, walletId int, amount money.Money, transactionType string, fee *model.Fee, check repository.MovementCheck) (model.Wallet, error) {
+	if err := runCheck(check, f.wallets[walletId]); err != nil {
+		return model.Wallet{}, err
+	}
+	f.updates++
+	f.lastFee = fee
+	return f.wallets[walletId], nil
+}
+
+func (f *fakeWalletRepository) Adjust(actor model.Actor, adjustment model.Adjustment) (model.Transaction, error) {
+	wallet, ok := f.wallets[adjustment.WalletId]
+	if !ok {
+		return model.Transaction{}, sql.ErrNoRows
+	}
+	f.adjustments = append(f.adjustments, adjustment)
+	f.adjusters = append(f.adjusters, actor)
+	return model.Transaction{ID: 200 + len(f.adjustments), Type: adjustment.Type, SenderUserId: wallet.UserId, SenderWalletId: wallet.ID, ReceiverUserId: wallet.UserId, ReceiverWalletId: wallet.ID, Amount: adjustment.Amount, Currency: adjustment.Amount.Currency, ReasonCode: &adjustment.ReasonCode}, nil
+}
+
+func (f *fakeWalletRepository) SetStatus(actor model.Actor, walletId int, change model.StatusChange) (model.StatusChange, error) {
+	wallet, ok := f.wallets[walletId]
+	if !ok {
+		return model.StatusChange{}, sql.ErrNoRows
+	}
+	change.UserId, change.WalletId, change.FromStatus, change.ActorUserId = wallet.UserId, &walletId, wallet.Status, actor.UserId
+	wallet.Status = change.ToStatus
+	f.wallets[walletId] = wallet
+	return change, nil
+}
+
+// fakeHoldRepository keeps the wallets' held amounts up to date, so their
+// available balances reflect the holds placed in a test.
+type fakeHoldRepository struct {
+	wallets        *fakeWalletRepository
+	holds          map[int]model.Hold
+	lastReceiver   *int
+	lastConversion *model.Conversion
+	lastFee        *model.Fee
+}
+
+func (f *fakeHoldRepository) GetById(holdId int) (model.Hold, error) {
+	hold, ok := f.holds[holdId]
+	if !ok {
+		return model.Hold{}, sql.ErrNoRows
+	}
+	return hold, nil
+}
+
+func (f *fakeHoldRepository) GetActiveByWalletId(walletId int) ([]model.Hold, error) {
+	var holds []model.Hold
+	for id := 1; id <= len(f.holds); id++ {
+		if hold := f.holds[id]; hold.WalletId == walletId && hold.Status == model.HoldStatusActive {
+			holds = append(holds, hold)
+		}
+	}
+	return holds, nil
+}
+
+func (f *fakeHoldRepository) Create(actor model.Actor, walletId int, receiverWalletId *int, amount money.Money, expiryDate time.Time) (model.Hold, error) {
+	available, _ := f.wallets.GetAvailableBalance(walletId)
+	if available.LessThan(amount) {
+		return model.Hold{}, repository.ErrInsufficientFunds
+	}
+	hold := model.Hold{ID: len(f.holds) + 1, WalletId: walletId, ReceiverWalletId: receiverWalletId, Amount: amount, Currency: amount.Currency, Status: model.HoldStatusActive, ExpiryDate: expiryDate}
+	f.holds[hold.ID] = hold
+	f.wallets.held[walletId] += amount.Amount
+	return hold, nil
+}
+
+func (f *fakeHoldRepository) Capture(actor model.Actor, holdId int, amount *money.Money, conversion *model.Conversion, fee *model.Fee, check repository.MovementCheck) (model.Hold, error) {
+	if err := runCheck(check, f.wallets.wallets[f.holds[holdId].WalletId]); err != nil {
+		return model.Hold{}, err
+	}
+	hold, err := f.settle(holdId, model.HoldStatusCaptured)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	captured := hold.Amount
+	if amount != nil {
+		if amount.Amount > hold.Amount.Amount {
+			return model.Hold{}, repository.ErrCaptureExceedsHold
+		}
+		captured = *amount
+	}
+	transactionId := 200 + holdId
+	hold.CapturedAmount = &captured
+	hold.TransactionId = &transactionId
+	f.holds[holdId] = hold
+	f.lastReceiver = hold.ReceiverWalletId
+	f.lastConversion = conversion
+	f.lastFee = fee
+	return hold, nil
+}
+
+func (f *fakeHoldRepository) Release(actor model.Actor, holdId int) (model.Hold, error) {
+	hold, err := f.settle(holdId, model.HoldStatusReleased)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	f.holds[holdId] = hold
+	return hold, nil
+}
+
+func (f *fakeHoldRepository) ReleaseExpired() (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeHoldRepository) settle(holdId int, status string) (model.Hold, error) {
+	hold := f.holds[holdId]
+	if hold.Status != model.HoldStatusActive {
+		return model.Hold{}, repository.ErrHoldNotActive
+	}
+	f.wallets.held[hold.WalletId] -= hold.Amount.Amount
+	hold.Status = status
+	return hold, nil
+}
+
+type fakeScheduleRepository struct {
+	schedules map[int]model.ScheduledTransfer
+}
+
+func (f *fakeScheduleRepository) GetById(scheduleId int) (model.ScheduledTransfer, error) {
+	schedule, ok := f.schedules[scheduleId]
+	if !ok {
+		return model.ScheduledTransfer{}, sql.ErrNoRows
+	}
+	return schedule, nil
+}
+
+func (f *fakeScheduleRepository) GetByUserId(userId int) ([]model.ScheduledTransfer, error) {
+	var schedules []model.ScheduledTransfer
+	for id := 1; id <= len(f.schedules); id++ {
+		if schedule := f.schedules[id]; schedule.UserId == userId {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+func (f *fakeScheduleRepository) GetRuns(scheduleId int) ([]model.ScheduledTransferRun, error) {
+	return nil, nil
+}
+
+func (f *fakeScheduleRepository) Create(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+	schedule.ID = len(f.schedules) + 1
+	schedule.Currency = schedule.Amount.Currency
+	schedule.NextRunDate = schedule.ScheduledDate
+	schedule.Status = model.ScheduleStatusActive
+	f.schedules[schedule.ID] = schedule
+	return schedule, nil
+}
+
+func (f *fakeScheduleRepository) Update(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+	current := f.schedules[schedule.ID]
+	if current.Status != model.ScheduleStatusActive && current.Status != model.ScheduleStatusPaused {
+		return model.ScheduledTransfer{}, repository.ErrScheduleClosed
+	}
+	schedule.Version++
+	f.schedules[schedule.ID] = schedule
+	return schedule, nil
+}
+
+func (f *fakeScheduleRepository) ClaimDue(limit int, lease time.Duration) ([]model.ScheduledTransfer, error) {
+	return nil, nil
+}
+
+func (f *fakeScheduleRepository) Execute(schedule model.ScheduledTransfer, conversion *model.Conversion, fee *model.Fee, check repository.MovementCheck, retryAt time.Time) (model.ScheduledTransferRun, error) {
+	return model.ScheduledTransferRun{}, nil
+}
+
+func (f *fakeScheduleRepository) Fail(schedule model.ScheduledTransfer, reason error) (model.ScheduledTransferRun, error) {
+	return model.ScheduledTransferRun{}, nil
+}
+
+// fakeLimitRepository holds the limits of a test. Every capped period has
+// used 150.00 so far.
+type fakeLimitRepository struct {
+	limits []model.TransactionLimit
+}
+
+func (f *fakeLimitRepository) GetLimits(wallet model.Wallet, operation string) ([]model.TransactionLimit, error) {
+	var limits []model.TransactionLimit
+	for _, limit := range f.limits {
+		if limit.Operation == operation {
+			limits = append(limits, limit)
+		}
+	}
+	return limits, nil
+}
+
+func (f *fakeLimitRepository) GetUsage(wallet model.Wallet, scope string, operation string, window time.Duration) (model.LimitUsage, error) {
+	oldest := time.Date(2024, 12, 20, 9, 0, 0, 0, time.UTC)
+	return model.LimitUsage{Total: money.New(15000, wallet.Currency), Oldest: &oldest}, nil
+}
+
+// runCheck runs a movement check on the wallet as the repositories do once it
+// is locked.
+func runCheck(check repository.MovementCheck, wallet model.Wallet) error {
+	if check == nil {
+		return nil
+	}
+	return check(wallet, &fakeLimitRepository{})
+}
+
+type fakeTokenRepository struct {
+	tokens map[string]model.OAuthToken
+	// unavailable fails the lookups like a database that is down
+	unavailable bool
+}
+
+func (f *fakeTokenRepository) Create(token model.OAuthToken) (model.OAuthToken, error) {
+	token.ID = len(f.tokens) + 1
+	f.tokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (f *fakeTokenRepository) GetByHash(tokenHash string) (model.OAuthToken, error) {
+	if f.unavailable {
+		return model.OAuthToken{}, errors.New("connection refused")
+	}
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return model.OAuthToken{}, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+func (f *fakeTokenRepository) Revoke(tokenId int) (bool, error) {
+	for hash, token := range f.tokens {
+		if token.ID == tokenId && token.RevocationDate == nil {
+			now := time.Now()
+			token.RevocationDate = &now
+			f.tokens[hash] = token
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeTokenRepository) RevokeSession(sessionId string) error {
+	return f.revokeWhere(func(token model.OAuthToken) bool { return token.SessionId == sessionId })
+}
+
+func (f *fakeTokenRepository) RevokeAllByUserId(userId int) error {
+	return f.revokeWhere(func(token model.OAuthToken) bool { return token.UserId == userId })
+}
+
+func (f *fakeTokenRepository) revokeWhere(match func(model.OAuthToken) bool) error {
+	now := time.Now()
+	for hash, token := range f.tokens {
+		if match(token) && token.RevocationDate == nil {
+			token.RevocationDate = &now
+			f.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+// fakeAuditRepository keeps the appended entries in order.
+type fakeAuditRepository struct {
+	entries []model.AuditEntry
+}
+
+func (f *fakeAuditRepository) Append(actor model.Actor, entry model.AuditEntry) (model.AuditEntry, error) {
+	entry = entry.By(actor)
+	entry.ID = len(f.entries) + 1
+	if entry.Details == "" {
+		entry.Details = "{}"
+	}
+	f.entries = append(f.entries, entry)
+	return entry, nil
+}
+
+func (f *fakeAuditRepository) List(filter model.AuditFilter) ([]model.AuditEntry, error) {
+	var entries []model.AuditEntry
+	for i := len(f.entries) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		entry := f.entries[i]
+		if filter.ActorUserId != 0 && (entry.ActorUserId == nil || *entry.ActorUserId != filter.ActorUserId) {
+			continue
+		}
+		if filter.Action != "" && entry.Action != filter.Action {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (f *fakeAuditRepository) Verify() (model.AuditVerification, error) {
+	return model.AuditVerification{Chained: len(f.entries), LastId: len(f.entries)}, nil
+}
+
+// fakeWebhookRepository keeps endpoints and deliveries by id.
+type fakeWebhookRepository struct {
+	endpoints  map[int]model.WebhookEndpoint
+	deliveries map[int]model.WebhookDelivery
+}
+
+func (f *fakeWebhookRepository) CreateEndpoint(actor model.Actor, endpoint model.WebhookEndpoint) (model.WebhookEndpoint, error) {
+	endpoint.ID = len(f.endpoints) + 1
+	endpoint.Active = true
+	f.endpoints[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+func (f *fakeWebhookRepository) GetEndpoints() ([]model.WebhookEndpoint, error) {
+	var endpoints []model.WebhookEndpoint
+	for id := 1; id <= len(f.endpoints); id++ {
+		if f.endpoints[id].Active {
+			endpoints = append(endpoints, f.endpoints[id])
+		}
+	}
+	return endpoints, nil
+}
+
+func (f *fakeWebhookRepository) GetEndpointById(endpointId int) (model.WebhookEndpoint, error) {
+	endpoint, ok := f.endpoints[endpointId]
+	if !ok {
+		return model.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	return endpoint, nil
+}
+
+func (f *fakeWebhookRepository) RemoveEndpoint(actor model.Actor, endpointId int) (model.WebhookEndpoint, error) {
+	endpoint, ok := f.endpoints[endpointId]
+	if !ok || !endpoint.Active {
+		return model.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	endpoint.Active = false
+	f.endpoints[endpointId] = endpoint
+	return endpoint, nil
+}
+
+func (f *fakeWebhookRepository) GetEventById(eventId int) (model.OutboxEvent, error) {
+	return model.OutboxEvent{}, sql.ErrNoRows
+}
+
+func (f *fakeWebhookRepository) GetDeliveries(endpointId int, status string, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	for id := len(f.deliveries); id >= 1 && len(deliveries) < limit; id-- {
+		delivery := f.deliveries[id]
+		if delivery.EndpointId == endpointId && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (f *fakeWebhookRepository) ClaimDue(limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (f *fakeWebhookRepository) Settle(delivery model.WebhookDelivery, attempt model.WebhookAttempt, retryAt *time.Time) (model.WebhookDelivery, error) {
+	return delivery, nil
+}
+
+func (f *fakeWebhookRepository) Redeliver(actor model.Actor, deliveryId int) (model.WebhookDelivery, error) {
+	delivery, ok := f.deliveries[deliveryId]
+	switch {
+	case !ok:
+		return model.WebhookDelivery{}, sql.ErrNoRows
+	case delivery.Status == model.DeliveryStatusPending:
+		return model.WebhookDelivery{}, repository.ErrDeliveryPending
+	case !f.endpoints[delivery.EndpointId].Active:
+		return model.WebhookDelivery{}, repository.ErrWebhookInactive
+	}
+	delivery.Status = model.DeliveryStatusPending
+	delivery.Attempts = 0
+	f.deliveries[deliveryId] = delivery
+	return delivery, nil
+}
+
+type fakeIdempotencyRepository struct{}
+
+func (fakeIdempotencyRepository) Reserve(userId int, key string, requestHash string, expiryDate time.Time) (model.IdempotencyKey, bool, error) {
+	return model.IdempotencyKey{}, true, nil
+}
+
+func (fakeIdempotencyRepository) Complete(userId int, key string, statusCode int, responseBody []byte) error {
+	return nil
+}
+
+func (fakeIdempotencyRepository) Release(userId int, key string) error {
+	return nil
+}
+
+// fakeFeeRepository holds the fee rules of a test.
+type fakeFeeRepository struct {
+	rules []model.FeeRule
+}
+
+func (f *fakeFeeRepository) GetRules(transactionType string, currency money.Currency) ([]model.FeeRule, error) {
+	var rules []model.FeeRule
+	for _, rule := range f.rules {
+		if rule.TransactionType == transactionType && (rule.Currency == nil || *rule.Currency == currency) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// fakeRateProvider only quotes USD to EUR.
+type fakeRateProvider struct{}
+
+func (fakeRateProvider) Rate(base money.Currency, quote money.Currency) (money.Decimal, error) {
+	if base == "USD" && quote == "EUR" {
+		return money.ParseDecimal("0.9215")
+	}
+	return money.Decimal{}, service.ErrRateUnavailable
+}
+
+type testRoutes struct {
+	router *mux.Router
+	// versions are the routers of Versions, in their order
+	versions  []*mux.Router
+	users     *fakeUserRepository
+	wallets   *fakeWalletRepository
+	holds     *fakeHoldRepository
+	schedules *fakeScheduleRepository
+	limits    *fakeLimitRepository
+	fees      *fakeFeeRepository
+	tokens    *fakeTokenRepository
+	audit     *fakeAuditRepository
+	webhooks  *fakeWebhookRepository
+}
+
+// newTestRouter serves every route for two users: user 1 owns wallet 1 and
+// user 2 owns wallet 2. Their access tokens are "token-user-1" and
+// "token-user-2". Fees are paid to user 4, who has no wallets. Users 3, 5, 6
+// and 7 are staff with the admin, support, operator and finance roles and the
+// tokens "token-admin", "token-support", "token-operator" and "token-finance".
+func newTestRouter() testRoutes {
+	userRepository := &fakeUserRepository{transactions: map[int]model.Transaction{
+		10: {ID: 10, Type: model.TransactionTypeTransfer, SenderUserId: 1, SenderWalletId: 1, ReceiverUserId: 2, ReceiverWalletId: 2, Amount: money.New(1000, "USD"), Currency: "USD"},
+		11: {ID: 11, Type: model.TransactionTypeDeposit, SenderUserId: 2, SenderWalletId: 2, ReceiverUserId: 2, ReceiverWalletId: 2, Amount: money.New(500, "USD"), Currency: "USD"},
+	}, registered: map[int]model.User{}, deleted: map[int]bool{}}
+	tokenRepository := &fakeTokenRepository{tokens: map[string]model.OAuthToken{}}
+	for userId, token := range map[int]string{1: "token-user-1", 2: "token-user-2", 3: "token-admin", 5: "token-support", 6: "token-operator", 7: "token-finance"} {
+		tokenRepository.Create(model.OAuthToken{UserId: userId, TokenHash: service.HashToken(token), Type: model.TokenTypeAccess, SessionId: token, ExpiryDate: time.Now().Add(time.Hour)})
+	}
+	walletRepository := &fakeWalletRepository{wallets: map[int]model.Wallet{
+		1: {ID: 1, UserId: 1, Name: "main", IsDefault: true, Currency: money.DefaultCurrency, Balance: money.New(10000, money.DefaultCurrency), Status: model.StatusActive},
+		2: {ID: 2, UserId: 2, Name: "main", IsDefault: true, Currency: money.DefaultCurrency, Balance: money.New(20000, money.DefaultCurrency), Status: model.StatusActive},
+	}, held: map[int]int64{}}
+	userRepository.wallets = walletRepository
+	holdRepository := &fakeHoldRepository{wallets: walletRepository, holds: map[int]model.Hold{}}
+	scheduleRepository := &fakeScheduleRepository{schedules: map[int]model.ScheduledTransfer{}}
+	limitRepository := &fakeLimitRepository{}
+	feeRepository := &fakeFeeRepository{}
+	auditRepository := &fakeAuditRepository{}
+	webhookRepository := &fakeWebhookRepository{endpoints: map[int]model.WebhookEndpoint{}, deliveries: map[int]model.WebhookDelivery{}}
+
+	walletHub := service.NewWalletHub()
+	us := service.NewUserService(userRepository, fakeRateProvider{}, walletHub)
+	ws := service.NewWalletService(walletRepository, walletHub)
+	hs := service.NewHoldService(holdRepository, fakeRateProvider{}, time.Hour, walletHub)
+	ls := service.NewLimitService(limitRepository)
+	fs := service.NewFeeService(feeRepository, walletRepository, 4)
+	ms := service.NewMovementService(ws, us, ls, fs)
+	ss := service.NewScheduleService(scheduleRepository, walletRepository, fakeRateProvider{}, ls, fs, walletHub)
+	is := service.NewIdempotencyService(fakeIdempotencyRepository{}, time.Hour)
+	ts := service.NewTokenService(tokenRepository, time.Minute, time.Hour)
+	as := service.NewAuditService(auditRepository)
+	whs := service.NewWebhookService(webhookRepository, http.DefaultClient)
+
+	router := mux.NewRouter()
+	router.Use(middleware.Audit(as))
+	versions := make([]*mux.Router, len(Versions))
+	for i, version := range Versions {
+		versions[i] = VersionRouter(router, version)
+		OAuthRoutes(versions[i], ts)
+		WalletRoutes(versions[i], ts, ws, us, hs, ms, ls, fs, is)
+		UserRoutes(versions[i], ts, us, ws, ms, is)
+		TransactionRoutes(versions[i], ts, us, is)
+		ScheduleRoutes(versions[i], ts, ss, ws, is)
+		AdminRoutes(versions[i], ts, us, ws, as, whs, is)
+	}
+	return testRoutes{router: router, versions: versions, users: userRepository, wallets: walletRepository, holds: holdRepository, schedules: scheduleRepository, limits: limitRepository, fees: feeRepository, tokens: tokenRepository, audit: auditRepository, webhooks: webhookRepository}
+}
+
+func serve(router http.Handler, method string, path string, token string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestBalanceOfOwnWallet(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodGet, "/wallet/2/balance", "token-user-2", "")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"balance": 200.00, "available_balance": 200.00, "currency": "USD"}`, response.Body.String())
+}
+
+func TestBalanceOfAnotherUsersWalletIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodGet, "/wallet/1/balance", "token-user-2", "")
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.NotContains(t, response.Body.String(), "available_balance")
+}
+
+func TestBalanceOfMissingWallet(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodGet, "/wallet/99/balance", "token-user-2", "")
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	assert.Contains(t, response.Body.String(), `"code":"wallet_not_found"`)
+}
+
+func TestWalletRoutesRequireToken(t *testing.T) {
+	routes := newTestRouter()
+
+	assert.Equal(t, http.StatusUnauthorized, serve(routes.router, http.MethodGet, "/wallet/2/balance", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(routes.router, http.MethodGet, "/wallet/2/balance", "unknown", "").Code)
+}
+
+func TestDepositIntoAnotherUsersWalletIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/wallet/1/deposit", "token-user-2", `{"user_id":2,"amount":10}`)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Equal(t, 0, routes.wallets.updates)
+}
+
+func TestWithdrawFromAnotherUsersWalletIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/wallet/1/withdraw", "token-user-2", `{"user_id":1,"amount":10}`)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Equal(t, 0, routes.wallets.updates)
+}
+
+func TestDepositIntoOwnWallet(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/wallet/2/deposit", "token-user-2", `{"user_id":2,"amount":10}`)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 1, routes.wallets.updates)
+}
+
+func TestTransactionsOfAnotherUserAreForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodGet, "/user/1/transactions", "token-user-2", "")
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+}
+
+func TestTransferAsAnotherUserIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	asPath := serve(routes.router, http.MethodPost, "/user/1/transfer", "token-user-2", `{"user_id":1,"receiver_user_id":2,"amount":10}`)
+	asSender := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":1,"receiver_user_id":2,"amount":10}`)
+
+	assert.Equal(t, http.StatusForbidden, asPath.Code)
+	assert.Equal(t, http.StatusForbidden, asSender.Code)
+	assert.Equal(t, 0, routes.users.transfers)
+}
+
+func TestTransferWithoutUserIdIsInvalid(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"receiver_user_id":1,"amount":10}`)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), `"field":"user_id","rule":"required"`)
+	assert.Equal(t, 0, routes.users.transfers)
+}
+
+func TestTransferAsSender(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"receiver_user_id":1,"amount":10}`)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 1, routes.users.transfers)
+}
+
+func TestCreateAndListWallets(t *testing.T) {
+	routes := newTestRouter()
+
+	created := serve(routes.router, http.MethodPost, "/user/2/wallets", "token-user-2", `{"name":"savings"}`)
+	duplicate := serve(routes.router, http.MethodPost, "/user/2/wallets", "token-user-2", `{"name":"savings"}`)
+	listed := serve(routes.router, http.MethodGet, "/user/2/wallets", "token-user-2", "")
+
+	assert.Equal(t, http.StatusCreated, created.Code)
+	assert.JSONEq(t, `{"id": 3, "name": "savings", "is_default": false, "balance": 0.00, "currency": "USD", "status": "active"}`, created.Body.String())
+	assert.Equal(t, http.StatusConflict, duplicate.Code)
+	assert.Equal(t, http.StatusOK, listed.Code)
+	assert.Contains(t, listed.Body.String(), `"savings"`)
+	assert.NotContains(t, listed.Body.String(), `"id":1`)
+}
+
+func TestCreateWalletForAnotherUserIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/user/1/wallets", "token-user-2", `{"name":"savings"}`)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Len(t, routes.wallets.wallets, 2)
+}
+
+func TestSetDefaultWallet(t *testing.T) {
+	routes := newTestRouter()
+	serve(routes.router, http.MethodPost, "/user/2/wallets", "token-user-2", `{"name":"savings"}`)
+
+	response := serve(routes.router, http.MethodPatch, "/wallet/3", "token-user-2", `{"name":"rainy day","is_default":true}`)
+	unset := serve(routes.router, http.MethodPatch, "/wallet/3", "token-user-2", `{"is_default":false}`)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"id": 3, "name": "rainy day", "is_default": true, "balance": 0.00, "currency": "USD", "status": "active"}`, response.Body.String())
+	assert.False(t, routes.wallets.wallets[2].IsDefault)
+	assert.Equal(t, http.StatusBadRequest, unset.Code)
+}
+
+func TestUpdateAnotherUsersWalletIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPatch, "/wallet/1", "token-user-2", `{"name":"mine"}`)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Equal(t, "main", routes.wallets.wallets[1].Name)
+}
+
+func TestTransferBetweenSelectedWallets(t *testing.T) {
+	routes := newTestRouter()
+	serve(routes.router, http.MethodPost, "/user/2/wallets", "token-user-2", `{"name":"savings"}`)
+
+	toOwnWallet := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"sender_wallet_id":2,"receiver_wallet_id":3,"amount":10}`)
+	assert.Equal(t, http.StatusOK, toOwnWallet.Code)
+	assert.Equal(t, [2]int{2, 3}, routes.users.lastTransfer)
+
+	toDefaultWallet := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"sender_wallet_id":3,"receiver_user_id":1,"amount":10}`)
+	assert.Equal(t, http.StatusOK, toDefaultWallet.Code)
+	assert.Equal(t, [2]int{3, 1}, routes.users.lastTransfer)
+}
+
+func TestTransferFromAnotherUsersWalletIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"sender_wallet_id":1,"receiver_wallet_id":2,"amount":10}`)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Equal(t, 0, routes.users.transfers)
+}
+
+func TestTransferToWalletOfAnotherReceiverIsRejected(t *testing.T) {
+	routes := newTestRouter()
+
+	mismatched := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"receiver_user_id":1,"receiver_wallet_id":2,"amount":10}`)
+	sameWallet := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"receiver_wallet_id":2,"amount":10}`)
+
+	assert.Equal(t, http.StatusBadRequest, mismatched.Code)
+	assert.Equal(t, http.StatusBadRequest, sameWallet.Code)
+	assert.Equal(t, 0, routes.users.transfers)
+}
+
+func TestDepositInAnotherCurrencyIsRejected(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/wallet/2/deposit", "token-user-2", `{"user_id":2,"amount":10,"currency":"EUR"}`)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), "currency_mismatch")
+	assert.Equal(t, 0, routes.wallets.updates)
+}
+
+func TestTransferAcrossCurrencies(t *testing.T) {
+	routes := newTestRouter()
+	created := serve(routes.router, http.MethodPost, "/user/1/wallets", "token-user-1", `{"name":"euros","currency":"EUR"}`)
+	assert.Equal(t, http.StatusCreated, created.Code)
+	assert.Contains(t, created.Body.String(), `"currency":"EUR"`)
+
+	converted := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"receiver_wallet_id":3,"amount":10.50}`)
+	assert.Equal(t, http.StatusOK, converted.Code)
+	assert.Equal(t, [2]int{2, 3}, routes.users.lastTransfer)
+	assert.Equal(t, money.New(968, "EUR"), routes.users.lastConversion.Amount)
+	assert.Equal(t, "0.9215", routes.users.lastConversion.Rate.String())
+
+	sameCurrency := serve(routes.router, http.MethodPost, "/user/2/transfer", "token-user-2", `{"user_id":2,"receiver_wallet_id":1,"amount":10.50}`)
+	assert.Equal(t, http.StatusOK, sameCurrency.Code)
+	assert.Nil(t, routes.users.lastConversion)
+
+	unquoted := serve(routes.router, http.MethodPost, "/user/1/transfer", "token-user-1", `{"user_id":1,"sender_wallet_id":3,"receiver_user_id":2,"amount":1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, unquoted.Code)
+}
+
+func TestTransactionHistory(t *testing.T) {
+	routes := newTestRouter()
+	counterparty, counterpartyUserId := "user1", 1
+	rate, err := money.ParseDecimal("0.9215")
+	assert.NoError(t, err)
+	destination := money.New(968, "EUR")
+	routes.users.entries = []model.TransactionEntry{
+		{
+			Transaction:        model.Transaction{ID: 12, Type: model.TransactionTypeTransfer, Amount: money.New(1050, "USD"), DestinationAmount: &destination, ExchangeRate: &rate},
+			EntryId:            31,
+			WalletId:           2,
+			EntryAmount:        money.New(-1050, "USD"),
+			BalanceAfter:       money.New(18950, "USD"),
+			CounterpartyUserId: &counterpartyUserId,
+			Counterparty:       &counterparty,
+		},
+		{
+			Transaction:  model.Transaction{ID: 11, Type: model.TransactionTypeDeposit, Amount: money.New(1000, "USD")},
+			EntryId:      30,
+			WalletId:     2,
+			EntryAmount:  money.New(1000, "USD"),
+			BalanceAfter: money.New(20000, "USD"),
+		},
+	}
+
+	first := serve(routes.router, http.MethodGet, "/user/2/transactions?limit=1&type=transfer&direction=outgoing&from=2024-12-01&to=2024-12-22&min_amount=5&counterparty=1", "token-user-2", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	var page struct {
+		Transactions []map[string]interface{} `json:"transactions"`
+		NextCursor   string                   `json:"next_cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(first.Body.Bytes(), &page))
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, float64(12), page.Transactions[0]["ID"])
+	assert.Equal(t, "outgoing", page.Transactions[0]["Direction"])
+	assert.Equal(t, 10.5, page.Transactions[0]["Amount"])
+	assert.Equal(t, 9.68, page.Transactions[0]["ConvertedAmount"])
+	assert.Equal(t, "user1", page.Transactions[0]["Counterparty"])
+	assert.Equal(t, 189.5, page.Transactions[0]["Balance"])
+	assert.NotEmpty(t, page.NextCursor)
+
+	filter := routes.users.lastFilter
+	assert.Equal(t, model.TransactionTypeTransfer, filter.Type)
+	assert.Equal(t, model.DirectionOutgoing, filter.Direction)
+	assert.Equal(t, time.Date(2024, 12, 23, 0, 0, 0, 0, time.UTC), *filter.To)
+	assert.Equal(t, "5", filter.MinAmount.String())
+	assert.Nil(t, filter.MaxAmount)
+	assert.Equal(t, 1, filter.CounterpartyUserId)
+
+	second := serve(routes.router, http.MethodGet, "/user/2/transactions?limit=1&cursor="+page.NextCursor, "token-user-2", "")
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Contains(t, second.Body.String(), `"Direction":"incoming"`)
+	assert.NotContains(t, second.Body.String(), "next_cursor")
+	assert.NotContains(t, second.Body.String(), "Counterparty")
+}
+
+func TestTransactionHistoryRejectsInvalidFilters(t *testing.T) {
+	routes := newTestRouter()
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=1000",
+		"type=refund",
+		"direction=sideways",
+		"from=yesterday",
+		"min_amount=-1",
+		"counterparty=me",
+		"cursor=not-a-cursor",
+	} {
+		response := serve(routes.router, http.MethodGet, "/user/2/transactions?"+query, "token-user-2", "")
+		assert.Equal(t, http.StatusBadRequest, response.Code, query)
+	}
+}
+
+func TestReceiverRefundsTransfer(t *testing.T) {
+	routes := newTestRouter()
+
+	partial := serve(routes.router, http.MethodPost, "/transactions/10/reversal", "token-user-2", `{"amount":2.5}`)
+	full := serve(routes.router, http.MethodPost, "/transactions/10/reversal", "token-user-2", "")
+
+	assert.Equal(t, http.StatusCreated, partial.Code)
+	assert.JSONEq(t, `{"status":"ok","message":"Reversal Successful","transaction_id":101,"reversal_of":10,"amount":2.50,"currency":"USD"}`, partial.Body.String())
+	assert.Equal(t, http.StatusCreated, full.Code)
+	assert.Contains(t, full.Body.String(), `"amount":10.00`)
+	assert.Equal(t, 2, routes.users.reversals)
+}
+
+func TestReversalPermissions(t *testing.T) {
+	routes := newTestRouter()
+
+	bySender := serve(routes.router, http.MethodPost, "/transactions/10/reversal", "token-user-1", "")
+	ownDeposit := serve(routes.router, http.MethodPost, "/transactions/11/reversal", "token-user-2", "")
+	forcedByReceiver := serve(routes.router, http.MethodPost, "/transactions/10/reversal", "token-user-2", `{"force":true}`)
+	missing := serve(routes.router, http.MethodPost, "/transactions/99/reversal", "token-user-2", "")
+
+	assert.Equal(t, http.StatusForbidden, bySender.Code)
+	assert.Equal(t, http.StatusForbidden, ownDeposit.Code)
+	assert.Equal(t, http.StatusForbidden, forcedByReceiver.Code)
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+	assert.Equal(t, 0, routes.users.reversals)
+
+	forcedByAdmin := serve(routes.router, http.MethodPost, "/transactions/11/reversal", "token-admin", `{"force":true}`)
+	assert.Equal(t, http.StatusCreated, forcedByAdmin.Code)
+	assert.True(t, routes.users.lastForce)
+}
+
+func TestReversalRejectsAmountsFinerThanCurrency(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/transactions/10/reversal", "token-user-2", `{"amount":0.001}`)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, 0, routes.users.reversals)
+}
+
+func TestHoldReducesAvailableBalance(t *testing.T) {
+	routes := newTestRouter()
+
+	placed := serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30,"expires_in":600}`)
+	tooLarge := serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":70.01}`)
+	balance := serve(routes.router, http.MethodGet, "/wallet/1/balance", "token-user-1", "")
+
+	assert.Equal(t, http.StatusCreated, placed.Code)
+	assert.Contains(t, placed.Body.String(), `"status":"active"`)
+	assert.Equal(t, http.StatusForbidden, tooLarge.Code)
+	assert.JSONEq(t, `{"balance": 100.00, "available_balance": 70.00, "currency": "USD"}`, balance.Body.String())
+}
+
+func TestHoldRejectsInvalidExpiry(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30,"expires_in":-1}`)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Empty(t, routes.holds.holds)
+}
+
+func TestPayeeCapturesHoldIntoTransfer(t *testing.T) {
+	routes := newTestRouter()
+	routes.wallets.Create(model.SystemActor, 2, "travel", "EUR", false)
+	placed := serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30,"receiver_wallet_id":3}`)
+
+	byPayer := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/capture", "token-user-1", `{"amount":12.5}`)
+	response := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/capture", "token-user-2", `{"amount":12.5}`)
+
+	assert.Contains(t, placed.Body.String(), `"receiver_wallet_id":3`)
+	assert.Equal(t, http.StatusForbidden, byPayer.Code)
+	assert.Contains(t, byPayer.Body.String(), `"code":"hold_not_permitted"`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"status":"captured"`)
+	assert.Contains(t, response.Body.String(), `"captured_amount":12.50`)
+	if assert.NotNil(t, routes.holds.lastReceiver) && assert.NotNil(t, routes.holds.lastConversion) {
+		assert.Equal(t, 3, *routes.holds.lastReceiver)
+		assert.Equal(t, money.New(1152, "EUR"), routes.holds.lastConversion.Amount)
+	}
+}
+
+func TestCaptureReleasedHoldConflicts(t *testing.T) {
+	routes := newTestRouter()
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30,"receiver_user_id":2}`)
+
+	released := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/release", "token-user-2", "")
+	captured := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/capture", "token-user-2", "")
+	holds := serve(routes.router, http.MethodGet, "/wallet/1/holds", "token-user-1", "")
+
+	assert.Equal(t, http.StatusOK, released.Code)
+	assert.Equal(t, http.StatusConflict, captured.Code)
+	assert.Contains(t, captured.Body.String(), `"code":"hold_not_active"`)
+	assert.JSONEq(t, `{"holds":[]}`, holds.Body.String())
+}
+
+func TestOnlyPayeeOrSettlingStaffSettleHold(t *testing.T) {
+	routes := newTestRouter()
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30,"receiver_user_id":2}`)
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":20}`)
+
+	releasedByPayer := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/release", "token-user-1", "")
+	capturedBySupport := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/capture", "token-support", `{"amount":-1}`)
+	releasedByAnotherUser := serve(routes.router, http.MethodPost, "/wallet/1/holds/2/release", "token-user-2", "")
+	releasedByFinance := serve(routes.router, http.MethodPost, "/wallet/1/holds/2/release", "token-finance", "")
+
+	assert.Equal(t, http.StatusForbidden, releasedByPayer.Code)
+	assert.Contains(t, releasedByPayer.Body.String(), `"code":"hold_not_permitted"`)
+	assert.Equal(t, http.StatusForbidden, capturedBySupport.Code)
+	assert.Contains(t, capturedBySupport.Body.String(), `"code":"hold_not_permitted"`)
+	assert.Equal(t, model.HoldStatusActive, routes.holds.holds[1].Status)
+	assert.Equal(t, http.StatusForbidden, releasedByAnotherUser.Code)
+	assert.Equal(t, http.StatusOK, releasedByFinance.Code)
+	assert.Equal(t, model.HoldStatusReleased, routes.holds.holds[2].Status)
+}
+
+func TestOwnerSettlesHoldWithoutPayee(t *testing.T) {
+	routes := newTestRouter()
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30}`)
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":20}`)
+
+	captured := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/capture", "token-user-1", `{"amount":12.5}`)
+	released := serve(routes.router, http.MethodPost, "/wallet/1/holds/2/release", "token-user-1", "")
+
+	assert.Equal(t, http.StatusOK, captured.Code)
+	assert.Equal(t, model.HoldStatusCaptured, routes.holds.holds[1].Status)
+	assert.Equal(t, http.StatusOK, released.Code)
+	assert.Equal(t, model.HoldStatusReleased, routes.holds.holds[2].Status)
+}
+
+func TestHoldOfAnotherWalletIsNotFound(t *testing.T) {
+	routes := newTestRouter()
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30}`)
+
+	throughOwnWallet := serve(routes.router, http.MethodPost, "/wallet/2/holds/1/release", "token-user-2", "")
+	throughOwnersWallet := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/release", "token-user-2", "")
+
+	assert.Equal(t, http.StatusNotFound, throughOwnWallet.Code)
+	assert.Contains(t, throughOwnWallet.Body.String(), `"code":"hold_not_found"`)
+	assert.Equal(t, http.StatusForbidden, throughOwnersWallet.Code)
+	assert.Equal(t, model.HoldStatusActive, routes.holds.holds[1].Status)
+}
+
+func TestCreateAndListSchedules(t *testing.T) {
+	routes := newTestRouter()
+	start := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+
+	created := serve(routes.router, http.MethodPost, "/user/1/schedules", "token-user-1", `{"receiver_user_id":2,"amount":25,"start_date":"`+start+`","recurrence":"monthly"}`)
+	listed := serve(routes.router, http.MethodGet, "/user/1/schedules", "token-user-1", "")
+
+	assert.Equal(t, http.StatusCreated, created.Code)
+	assert.Contains(t, created.Body.String(), `"receiver_wallet_id":2`)
+	assert.Contains(t, created.Body.String(), `"amount":25.00`)
+	assert.Equal(t, http.StatusOK, listed.Code)
+	assert.Contains(t, listed.Body.String(), `"recurrence":"monthly"`)
+	if assert.NotNil(t, routes.schedules.schedules[1].DayOfMonth) {
+		assert.Equal(t, time.Now().Add(48*time.Hour).UTC().Day(), *routes.schedules.schedules[1].DayOfMonth)
+	}
+}
+
+func TestCreateScheduleRejectsInvalidSchedules(t *testing.T) {
+	routes := newTestRouter()
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	for _, body := range []string{
+		`{"receiver_user_id":2,"amount":25,"start_date":"` + past + `"}`,
+		`{"receiver_user_id":2,"amount":25,"start_date":"` + future + `","recurrence":"hourly"}`,
+		`{"receiver_user_id":2,"amount":25,"start_date":"` + future + `","recurrence":"daily","day_of_month":3}`,
+		`{"receiver_user_id":1,"amount":25,"start_date":"` + future + `"}`,
+	} {
+		response := serve(routes.router, http.MethodPost, "/user/1/schedules", "token-user-1", body)
+		assert.Equal(t, http.StatusBadRequest, response.Code, body)
+	}
+	assert.Empty(t, routes.schedules.schedules)
+}
+
+func TestPauseAndCancelSchedule(t *testing.T) {
+	routes := newTestRouter()
+	start := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	serve(routes.router, http.MethodPost, "/user/1/schedules", "token-user-1", `{"receiver_user_id":2,"amount":25,"start_date":"`+start+`","recurrence":"weekly"}`)
+
+	paused := serve(routes.router, http.MethodPatch, "/user/1/schedules/1", "token-user-1", `{"status":"paused","amount":30}`)
+	cancelled := serve(routes.router, http.MethodDelete, "/user/1/schedules/1", "token-user-1", "")
+	resumed := serve(routes.router, http.MethodPatch, "/user/1/schedules/1", "token-user-1", `{"status":"active"}`)
+
+	assert.Equal(t, http.StatusOK, paused.Code)
+	assert.Contains(t, paused.Body.String(), `"status":"paused"`)
+	assert.Contains(t, paused.Body.String(), `"amount":30.00`)
+	assert.Equal(t, http.StatusOK, cancelled.Code)
+	assert.Contains(t, cancelled.Body.String(), `"status":"cancelled"`)
+	assert.Equal(t, http.StatusConflict, resumed.Code)
+}
+
+func TestScheduleOfAnotherUserIsNotFound(t *testing.T) {
+	routes := newTestRouter()
+	start := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	serve(routes.router, http.MethodPost, "/user/1/schedules", "token-user-1", `{"receiver_user_id":2,"amount":25,"start_date":"`+start+`"}`)
+
+	throughOwnUser := serve(routes.router, http.MethodDelete, "/user/2/schedules/1", "token-user-2", "")
+	throughOwner := serve(routes.router, http.MethodDelete, "/user/1/schedules/1", "token-user-2", "")
+
+	assert.Equal(t, http.StatusNotFound, throughOwnUser.Code)
+	assert.Equal(t, http.StatusForbidden, throughOwner.Code)
+	assert.Equal(t, model.ScheduleStatusActive, routes.schedules.schedules[1].Status)
+}
+
+func TestDepositOverDailyLimitIsRejected(t *testing.T) {
+	routes := newTestRouter()
+	routes.limits.limits = []model.TransactionLimit{
+		{Operation: model.TransactionTypeDeposit, Period: model.LimitPeriodDaily, Amount: money.NewDecimal(200, 0)},
+	}
+
+	within := serve(routes.router, http.MethodPost, "/wallet/1/deposit", "token-user-1", `{"user_id":1,"amount":50}`)
+	over := serve(routes.router, http.MethodPost, "/wallet/1/deposit", "token-user-1", `{"user_id":1,"amount":50.01}`)
+
+	assert.Equal(t, http.StatusOK, within.Code)
+	assert.Equal(t, http.StatusForbidden, over.Code)
+	assert.Equal(t, "application/problem+json", over.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "urn:go-wallet-service:problem:limit_exceeded",
+		"title": "Forbidden",
+		"status": 403,
+		"detail": "The amount exceeds the daily deposit limit",
+		"instance": "/wallet/1/deposit",
+		"code": "limit_exceeded",
+		"limit": {"operation":"deposit","period":"daily","scope":"user","limit":200.00,"remaining":50.00,"currency":"USD","resets_at":"2024-12-21T09:00:00Z"}
+	}`, over.Body.String())
+	assert.Equal(t, 1, routes.wallets.updates)
+}
+
+func TestTransferOverTransactionMaximumIsRejected(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/user/1/transfer", "token-user-1", `{"user_id":1,"receiver_user_id":2,"amount":10000000.01}`)
+
+	// the amount tag rejects it before the default transaction limit would
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), `{"field":"amount","rule":"max","message":"amount must be at most 10000000"}`)
+	assert.Nil(t, routes.users.lastConversion)
+	assert.Equal(t, [2]int{}, routes.users.lastTransfer)
+}
+
+// chargeFees gives the house user wallet 9 and charges 0.50 plus 1% on
+// withdrawals and transfers.
+func chargeFees(routes testRoutes) {
+	routes.wallets.wallets[9] = model.Wallet{ID: 9, UserId: 4, Name: "fees", IsDefault: true, Currency: money.DefaultCurrency, Balance: money.New(0, money.DefaultCurrency)}
+	for _, transactionType := range []string{model.TransactionTypeWithdraw, model.TransactionTypeTransfer} {
+		routes.fees.rules = append(routes.fees.rules, model.FeeRule{TransactionType: transactionType, Flat: money.NewDecimal(50, 2), Rate: money.NewDecimal(1, 2)})
+	}
+}
+
+func TestQuoteWithdrawal(t *testing.T) {
+	routes := newTestRouter()
+	chargeFees(routes)
+
+	response := serve(routes.router, http.MethodGet, "/wallet/1/quote?type=withdraw&amount=20", "token-user-1", "")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"type":"withdraw","amount":20.00,"fee":0.70,"total":20.70,"currency":"USD"}`, response.Body.String())
+}
+
+func TestQuoteRejectsInvalidParameters(t *testing.T) {
+	routes := newTestRouter()
+
+	assert.Equal(t, http.StatusBadRequest, serve(routes.router, http.MethodGet, "/wallet/1/quote?type=deposit&amount=20", "token-user-1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(routes.router, http.MethodGet, "/wallet/1/quote?type=transfer&amount=-1", "token-user-1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(routes.router, http.MethodGet, "/wallet/1/quote?type=transfer", "token-user-1", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(routes.router, http.MethodGet, "/wallet/1/quote?type=transfer&amount=20", "token-user-2", "").Code)
+}
+
+func TestWithdrawAndTransferChargeFees(t *testing.T) {
+	routes := newTestRouter()
+	chargeFees(routes)
+
+	withdrawal := serve(routes.router, http.MethodPost, "/wallet/1/withdraw", "token-user-1", `{"user_id":1,"amount":20}`)
+	transfer := serve(routes.router, http.MethodPost, "/user/1/transfer", "token-user-1", `{"user_id":1,"receiver_user_id":2,"amount":10}`)
+
+	assert.Equal(t, http.StatusOK, withdrawal.Code)
+	assert.Equal(t, &model.Fee{Amount: money.New(70, money.DefaultCurrency), HouseWalletId: 9}, routes.wallets.lastFee)
+	assert.Equal(t, http.StatusOK, transfer.Code)
+	assert.Equal(t, &model.Fee{Amount: money.New(60, money.DefaultCurrency), HouseWalletId: 9}, routes.users.lastFee)
+}
+
+func TestDepositAndUnpricedOperationsAreFree(t *testing.T) {
+	routes := newTestRouter()
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30}`)
+
+	serve(routes.router, http.MethodPost, "/wallet/1/withdraw", "token-user-1", `{"user_id":1,"amount":20}`)
+	serve(routes.router, http.MethodPost, "/wallet/1/holds/1/capture", "token-user-1", `{}`)
+
+	assert.Nil(t, routes.wallets.lastFee)
+	assert.Nil(t, routes.holds.lastFee)
+
+	chargeFees(routes)
+	serve(routes.router, http.MethodPost, "/wallet/1/deposit", "token-user-1", `{"user_id":1,"amount":20}`)
+	assert.Nil(t, routes.wallets.lastFee)
+}
+
+func TestCaptureHoldChargesFee(t *testing.T) {
+	routes := newTestRouter()
+	chargeFees(routes)
+	serve(routes.router, http.MethodPost, "/wallet/1/holds", "token-user-1", `{"amount":30}`)
+
+	response := serve(routes.router, http.MethodPost, "/wallet/1/holds/1/capture", "token-finance", `{"amount":12.5}`)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, &model.Fee{Amount: money.New(63, money.DefaultCurrency), HouseWalletId: 9}, routes.holds.lastFee)
+}
+
+func TestFeeWithoutHouseWalletFails(t *testing.T) {
+	routes := newTestRouter()
+	chargeFees(routes)
+	delete(routes.wallets.wallets, 9)
+
+	response := serve(routes.router, http.MethodPost, "/wallet/1/withdraw", "token-user-1", `{"user_id":1,"amount":20}`)
+
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Contains(t, response.Body.String(), `"code":"internal_error"`)
+	assert.NotContains(t, response.Body.String(), "house")
+	assert.Equal(t, 0, routes.wallets.updates)
+}
+
+func TestRequestValidationListsEveryFailingField(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/wallet/2/deposit", "token-user-2", `{"amount":-5,"currency":"XYZ"}`)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.JSONEq(t, `{
+		"type": "urn:go-wallet-service:problem:invalid_parameter",
+		"title": "Invalid request",
+		"status": 400,
+		"detail": "Parameters are missing, not expected or not matching the required format",
+		"instance": "/wallet/2/deposit",
+		"code": "invalid_parameter",
+		"errors": [
+			{"field":"user_id","rule":"required","message":"user_id is required"},
+			{"field":"amount","rule":"min","message":"amount must be at least 0"},
+			{"field":"currency","rule":"currency","message":"currency is not a valid currency"}
+		]
+	}`, response.Body.String())
+	assert.Equal(t, 0, routes.wallets.updates)
+}
+
+func TestZeroAmountAndBadScheduleAreRejected(t *testing.T) {
+	routes := newTestRouter()
+
+	withdrawal := serve(routes.router, http.MethodPost, "/wallet/2/withdraw", "token-user-2", `{"user_id":2,"amount":0}`)
+	schedule := serve(routes.router, http.MethodPost, "/user/1/schedules", "token-user-1", `{"receiver_user_id":2,"amount":5,"start_date":"2030-01-01T09:00:00Z","recurrence":"yearly","day_of_month":40}`)
+
+	assert.Equal(t, http.StatusBadRequest, withdrawal.Code)
+	assert.Contains(t, withdrawal.Body.String(), `"rule":"required"`)
+	assert.Equal(t, http.StatusBadRequest, schedule.Code)
+	assert.Contains(t, schedule.Body.String(), `{"field":"recurrence","rule":"oneof","message":"recurrence must be one of once, daily, weekly, monthly"}`)
+	assert.Contains(t, schedule.Body.String(), `{"field":"day_of_month","rule":"max","message":"day_of_month must be at most 31"}`)
+	assert.Equal(t, 0, routes.wallets.updates)
+}
+
+func TestHoldOverBalanceIsInsufficientFunds(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/wallet/2/holds", "token-user-2", `{"amount":1000000}`)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.JSONEq(t, `{
+		"type": "urn:go-wallet-service:problem:insufficient_funds",
+		"title": "Insufficient funds",
+		"status": 403,
+		"detail": "the amount is greater than the available wallet balance",
+		"instance": "/wallet/2/holds",
+		"code": "insufficient_funds"
+	}`, response.Body.String())
+}
+
+// registration is the RegistrationData as a client reads it back.
+type registration struct {
+	User   model.UserData `json:"user"`
+	Wallet struct {
+		Name      string      `json:"name"`
+		IsDefault bool        `json:"is_default"`
+		Balance   json.Number `json:"balance"`
+	} `json:"wallet"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func register(t *testing.T, routes testRoutes, body string) registration {
+	response := serve(routes.router, http.MethodPost, "/users", "", body)
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var registration registration
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&registration))
+	return registration
+}
+
+func TestRegisterCreatesUserWalletAndSession(t *testing.T) {
+	routes := newTestRouter()
+
+	registration := register(t, routes, `{"username":"alice","display_name":"Alice","email":"alice@example.com"}`)
+
+	assert.Equal(t, "alice", registration.User.Username)
+	assert.Equal(t, "Alice", registration.User.DisplayName)
+	assert.Equal(t, model.RoleUser, registration.User.Role)
+	assert.Nil(t, registration.User.Phone)
+	assert.Equal(t, service.DefaultWalletName, registration.Wallet.Name)
+	assert.True(t, registration.Wallet.IsDefault)
+	assert.Equal(t, "Bearer", registration.TokenType)
+	assert.NotEmpty(t, registration.RefreshToken)
+
+	response := serve(routes.router, http.MethodGet, "/user/10", registration.AccessToken, "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"email":"alice@example.com"`)
+}
+
+func TestRegisterRejectsTakenAndInvalidUsernames(t *testing.T) {
+	routes := newTestRouter()
+	register(t, routes, `{"username":"alice"}`)
+
+	taken := serve(routes.router, http.MethodPost, "/users", "", `{"username":"alice"}`)
+	invalid := serve(routes.router, http.MethodPost, "/users", "", `{"username":"Alice Smith","email":"alice","phone":"555-0100"}`)
+
+	assert.Equal(t, http.StatusConflict, taken.Code)
+	assert.Contains(t, taken.Body.String(), `"code":"username_taken"`)
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	for _, field := range []string{"username", "email", "phone"} {
+		assert.Contains(t, invalid.Body.String(), `"field":"`+field+`"`)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	routes := newTestRouter()
+	registration := register(t, routes, `{"username":"alice","email":"alice@example.com"}`)
+
+	response := serve(routes.router, http.MethodPatch, "/user/10", registration.AccessToken, `{"display_name":"Alice","email":"","phone":"+15550100"}`)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"display_name":"Alice"`)
+	assert.Contains(t, response.Body.String(), `"email":null`)
+	assert.Contains(t, response.Body.String(), `"phone":"+15550100"`)
+}
+
+func TestProfileOfAnotherUserIsForbidden(t *testing.T) {
+	routes := newTestRouter()
+
+	read := serve(routes.router, http.MethodGet, "/user/2", "token-user-1", "")
+	update := serve(routes.router, http.MethodPatch, "/user/2", "token-user-1", `{"display_name":"Mallory"}`)
+	remove := serve(routes.router, http.MethodDelete, "/user/2", "token-user-1", "")
+
+	assert.Equal(t, http.StatusForbidden, read.Code)
+	assert.Equal(t, http.StatusForbidden, update.Code)
+	assert.Equal(t, http.StatusForbidden, remove.Code)
+	assert.False(t, routes.users.deleted[2])
+}
+
+func TestDeleteAccount(t *testing.T) {
+	routes := newTestRouter()
+	registration := register(t, routes, `{"username":"alice"}`)
+
+	funded := serve(routes.router, http.MethodDelete, "/user/1", "token-user-1", "")
+	deleted := serve(routes.router, http.MethodDelete, "/user/10", registration.AccessToken, "")
+
+	assert.Equal(t, http.StatusConflict, funded.Code)
+	assert.Contains(t, funded.Body.String(), `"code":"account_not_empty"`)
+	assert.Equal(t, http.StatusOK, deleted.Code)
+	assert.True(t, routes.users.deleted[10])
+}
+
+func TestAdminChangesUserAndWalletStatus(t *testing.T) {
+	routes := newTestRouter()
+
+	user := serve(routes.router, http.MethodPost, "/admin/users/2/status", "token-admin", `{"status":"frozen","reason":"chargeback under review"}`)
+	wallet := serve(routes.router, http.MethodPost, "/admin/wallets/1/status", "token-admin", `{"status":"suspended","reason":"court order"}`)
+
+	assert.Equal(t, http.StatusCreated, user.Code)
+	assert.Contains(t, user.Body.String(), `"user_id":2,"wallet_id":null,"from_status":"active","to_status":"frozen","reason":"chargeback under review","actor_user_id":3`)
+	assert.Equal(t, http.StatusCreated, wallet.Code)
+	assert.Contains(t, wallet.Body.String(), `"user_id":1,"wallet_id":1,"from_status":"active","to_status":"suspended","reason":"court order","actor_user_id":3`)
+	assert.Equal(t, model.StatusSuspended, routes.wallets.wallets[1].Status)
+
+	balance := serve(routes.router, http.MethodGet, "/user/1/wallets", "token-user-1", "")
+	assert.Contains(t, balance.Body.String(), `"status":"suspended"`)
+}
+
+func TestStatusChangesAreReservedToAdmins(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/admin/wallets/1/status", "token-user-1", `{"status":"active","reason":"unfreezing myself"}`)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Contains(t, response.Body.String(), `"code":"admin_required"`)
+	assert.Equal(t, model.StatusActive, routes.wallets.wallets[1].Status)
+}
+
+func TestStatusChangeNeedsKnownStatusAndReason(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/admin/users/2/status", "token-admin", `{"status":"banned"}`)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Contains(t, response.Body.String(), `{"field":"status","rule":"oneof","message":"status must be one of active, frozen, suspended, closed"}`)
+	assert.Contains(t, response.Body.String(), `{"field":"reason","rule":"required","message":"reason is required"}`)
+}
+
+func TestStaffRolesGrantTheirPermissions(t *testing.T) {
+	freeze := `{"status":"frozen","reason":"chargeback under review"}`
+	credit := `{"type":"credit","amount":10,"reason_code":"goodwill"}`
+
+	for name, tc := range map[string]struct {
+		token  string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		"support looks up users":          {"token-support", http.MethodGet, "/admin/users/2", "", http.StatusOK},
+		"support reads the audit log":     {"token-support", http.MethodGet, "/admin/audit", "", http.StatusOK},
+		"support cannot freeze":           {"token-support", http.MethodPost, "/admin/wallets/2/status", freeze, http.StatusForbidden},
+		"support cannot adjust":           {"token-support", http.MethodPost, "/admin/wallets/2/adjustments", credit, http.StatusForbidden},
+		"operator freezes":                {"token-operator", http.MethodPost, "/admin/wallets/2/status", freeze, http.StatusCreated},
+		"operator cannot adjust":          {"token-operator", http.MethodPost, "/admin/wallets/2/adjustments", credit, http.StatusForbidden},
+		"finance adjusts":                 {"token-finance", http.MethodPost, "/admin/wallets/2/adjustments", credit, http.StatusCreated},
+		"finance cannot freeze":           {"token-finance", http.MethodPost, "/admin/users/2/status", freeze, http.StatusForbidden},
+		"admin does everything":           {"token-admin", http.MethodPost, "/admin/wallets/2/adjustments", credit, http.StatusCreated},
+		"users have no access":            {"token-user-2", http.MethodGet, "/admin/users/2", "", http.StatusForbidden},
+		"staff needs a token like anyone": {"", http.MethodGet, "/admin/users/2", "", http.StatusUnauthorized},
+	} {
+		t.Run(name, func(t *testing.T) {
+			routes := newTestRouter()
+
+			response := serve(routes.router, tc.method, tc.path, tc.token, tc.body)
+
+			assert.Equal(t, tc.status, response.Code, response.Body.String())
+		})
+	}
+}
+
+func TestDeniedRoleIsToldWhy(t *testing.T) {
+	routes := newTestRouter()
+
+	response := serve(routes.router, http.MethodPost, "/admin/wallets/2/adjustments", "token-support", `{"type":"debit","amount":10,"reason_code":"correction"}`)
+
+	assert.Contains(t, response.Body.String(), `"code":"permission_denied"`)
+	assert.Empty(t, routes.wallets.adjustments)
+	if assert.Len(t, routes.audit.entries, 1) {
+		assert.Equal(t, model.AuditActionAccessDenied, routes.audit.entries[0].Action)
+	}
+}
+
+func TestRequestIdIsEchoedOrGenerated(t *testing.T) {
+	routes := newTestRouter()
+
+	r := httptest.NewRequest(http.MethodGet, "/wallet/2/balance", nil)
+	r.Header.Set("Authorization", "Bearer token-user-2")
+	r.Header.Set(middleware.RequestIdHeader, "checkout-42")
+	echoed := httptest.NewRecorder()
+	routes.router.ServeHTTP(echoed, r)
+
+	r = httptest.NewRequest(http.MethodGet, "/wallet/2/balance", nil)
+	r.Header.Set("Authorization", "Bearer token-user-2")
+	r.Header.Set(middleware.RequestIdHeader, "not a usable id")
+	replaced := httptest.NewRecorder()
+	routes.router.ServeHTTP(replaced, r)
+
+	assert.Equal(t, "checkout-42", echoed.Header().Get(middleware.RequestIdHeader))
+	assert.Regexp(t, `^[0-9a-f]{32}$`, replaced.Header().Get(middleware.RequestIdHeader))
+}
+
+func TestRefusedRequestsAreAudited(t *testing.T) {
+	routes := newTestRouter()
+
+	unauthenticated := serve(routes.router, http.MethodGet, "/wallet/2/balance", "unknown", "")
+	forbidden := serve(routes.router, http.MethodPost, "/wallet/1/deposit", "token-user-2", `{"user_id":2,"amount":10}`)
+
+	if assert.Len(t, routes.audit.entries, 2) {
+		failed, denied := routes.audit.entries[0], routes.audit.entries[1]
+		assert.Equal(t, model.AuditActionAuthFailed, failed.Action)
+		assert.Equal(t, model.ActorTypeUser, failed.ActorType)
+		assert.Nil(t, failed.ActorUserId)
+		assert.Equal(t, 2, *failed.WalletId)
+		assert.Equal(t, unauthenticated.Header().Get(middleware.RequestIdHeader), failed.RequestId)
+		assert.JSONEq(t, `{"method":"GET","path":"/wallet/2/balance","status":401,"code":"token_invalid"}`, failed.Details)
+
+		assert.Equal(t, model.AuditActionAccessDenied, denied.Action)
+		assert.Equal(t, 2, *denied.ActorUserId)
+		assert.Equal(t, 1, *denied.WalletId)
+		assert.Equal(t, "192.0.2.1", denied.IP)
+		assert.Equal(t, forbidden.Header().Get(middleware.RequestIdHeader), denied.RequestId)
+	}
+}
+
+func TestAuditorOnlyReadsTheAuditLog(t *testing.T) {
+	routes := newTestRouter()
+	routes.users.registered[8] = model.User{ID: 8, Role: model.RoleAuditor, Status: model.StatusActive}
+	routes.tokens.Create(model.OAuthToken{UserId: 8, TokenHash: service.HashToken("token-auditor"), Type: model.TokenTypeAccess, SessionId: "token-auditor", ExpiryDate: time.Now().Add(time.Hour)})
+
+	audit := serve(routes.router, http.MethodGet, "/admin/audit?action=access.denied", "token-auditor", "")
+	lookup := serve(routes.router, http.MethodGet, "/admin/users/2", "token-auditor", "")
+	badType := serve(routes.router, http.MethodGet, "/admin/audit?actor_type=robot", "token-auditor", "")
+
+	assert.Equal(t, http.StatusOK, audit.Code)
+	assert.Equal(t, http.StatusForbidden, lookup.Code)
+	assert.Equal(t, http.StatusBadRequest, badType.Code)
+}
+
+func TestStaffLookUpClosedAccounts(t *testing.T) {
+	routes := newTestRouter()
+	closed := time.Date(2024, time.December, 20, 0, 0, 0, 0, time.UTC)
+	wallet := routes.wallets.wallets[2]
+	wallet.Balance, wallet.Status, wallet.IsDefault, wallet.DeletionDate = money.New(0, wallet.Currency), model.StatusClosed, false, &closed
+	routes.wallets.wallets[2] = wallet
+	routes.users.deleted[2] = true
+
+	user := serve(routes.router, http.MethodGet, "/admin/users/2", "token-support", "")
+	closedWallet := serve(routes.router, http.MethodGet, "/admin/wallets/2", "token-support", "")
+	byOwner := serve(routes.router, http.MethodGet, "/wallet/2/balance", "token-user-2", "")
+
+	assert.Equal(t, http.StatusOK, user.Code)
+	assert.Contains(t, user.Body.String(), `"status":"closed","creation_date":"0001-01-01T00:00:00Z","deletion_date":"2024-12-20T00:00:00Z"}`)
+	assert.Contains(t, user.Body.String(), `"wallets":[{"id":2,"name":"main","is_default":false,"balance":0.00,"currency":"USD","status":"closed"}]`)
+	assert.Equal(t, http.StatusOK, closedWallet.Code)
+	assert.Contains(t, closedWallet.Body.String(), `"deletion_date":"2024-12-20T00:00:00Z"`)
+	assert.NotEqual(t, http.StatusOK, byOwner.Code)
+}
+
+func TestLookupsAreAudited(t *testing.T) {
+	routes := newTestRouter()
+	routes.users.transactions[10] = model.Transaction{ID: 10, Type: model.TransactionTypeTransfer, SenderUserId: 1, SenderWalletId: 1, ReceiverUserId: 2, ReceiverWalletId: 2, Amount: money.New(1000, "USD"), Currency: "USD"}
+
+	user := serve(routes.router, http.MethodGet, "/admin/users/2", "token-support", "")
+	wallet := serve(routes.router, http.MethodGet, "/admin/wallets/2", "token-support", "")
+	transaction := serve(routes.router, http.MethodGet, "/admin/transactions/10", "token-support", "")
+	missing := serve(routes.router, http.MethodGet, "/admin/transactions/99", "token-support", "")
+
+	assert.Contains(t, user.Body.String(), `"wallets":[{"id":2,"name":"main","is_default":true,"balance":200.00,"currency":"USD","status":"active"}]`)
+	assert.Contains(t, wallet.Body.String(), `"user_id":2,"available_balance":200.00`)
+	assert.Contains(t, transaction.Body.String(), `"sender_wallet_id":1,"receiver_user_id":2,"receiver_wallet_id":2,"amount":10.00,"currency":"USD"`)
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+
+	var actions []string
+	for _, entry := range routes.audit.entries {
+		assert.Equal(t, model.ActorTypeAdmin, entry.ActorType)
+		assert.Equal(t, 5, *entry.ActorUserId)
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{model.AuditActionUserViewed, model.AuditActionWalletViewed, model.AuditActionTransactionViewed}, actions)
+}
+
+func TestAdjustmentNeedsReasonCode(t *testing.T) {
+	routes := newTestRouter()
+
+	missing := serve(routes.router, http.MethodPost, "/admin/wallets/2/adjustments", "token-finance", `{"type":"credit","amount":10}`)
+	unknown := serve(routes.router, http.MethodPost, "/admin/wallets/2/adjustments", "token-finance", `{"type":"credit","amount":10,"reason_code":"because"}`)
+	adjusted := serve(routes.router, http.MethodPost, "/admin/wallets/2/adjustments", "token-finance", `{"type":"debit","amount":"12.50","reason_code":"chargeback","note":"case 4411"}`)
+
+	assert.Equal(t, http.StatusBadRequest, missing.Code)
+	assert.Contains(t, missing.Body.String(), `{"field":"reason_code","rule":"required","message":"reason_code is required"}`)
+	assert.Equal(t, http.StatusBadRequest, unknown.Code)
+	assert.Contains(t, unknown.Body.String(), `"field":"reason_code","rule":"oneof"`)
+	assert.Equal(t, http.StatusCreated, adjusted.Code)
+	assert.Contains(t, adjusted.Body.String(), `"type":"debit"`)
+	assert.Contains(t, adjusted.Body.String(), `"reason_code":"chargeback"`)
+	assert.Equal(t, []model.Adjustment{{WalletId: 2, Type: model.TransactionTypeDebit, Amount: money.New(1250, "USD"), ReasonCode: model.ReasonCodeChargeback, Note: "case 4411"}}, routes.wallets.adjustments)
+	if assert.Len(t, routes.wallets.adjusters, 1) {
+		assert.Equal(t, model.ActorTypeAdmin, routes.wallets.adjusters[0].Type)
+		assert.Equal(t, 7, routes.wallets.adjusters[0].UserId)
+		assert.Equal(t, adjusted.Header().Get(middleware.RequestIdHeader), routes.wallets.adjusters[0].RequestId)
+	}
+}
+
+func TestAuditLogListsNewestFirst(t *testing.T) {
+	routes := newTestRouter()
+	for _, action := range []string{model.AuditActionUserStatusChanged, model.AuditActionWalletAdjusted, model.AuditActionWalletStatusChanged} {
+		routes.audit.Append(model.Actor{Type: model.ActorTypeAdmin, UserId: 3}, model.AuditEntry{Action: action, Details: `{"reason":"test"}`})
+	}
+
+	response := serve(routes.router, http.MethodGet, "/admin/audit?actor_user_id=3&limit=2", "token-support", "")
+	invalid := serve(routes.router, http.MethodGet, "/admin/audit?limit=1000", "token-support", "")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"id":3,"actor_type":"admin","actor_user_id":3,"action":"wallet.status_changed"`)
+	assert.Contains(t, response.Body.String(), `"details":{"reason":"test"}`)
+	assert.NotContains(t, response.Body.String(), `"id":1,`)
+	assert.Contains(t, response.Body.String(), `"next_before":2`)
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	assert.Equal(t, model.AuditActionAuditViewed, routes.audit.entries[len(routes.audit.entries)-1].Action)
+}
+
+func TestRegisterAndRemoveWebhook(t *testing.T) {
+	routes := newTestRouter()
+
+	registered := serve(routes.router, http.MethodPost, "/admin/webhooks", "token-admin", `{"url":"https://example.com/hooks","event_types":["wallet.deposited","wallet.withdrawn"],"description":"ledger sync"}`)
+	listed := serve(routes.router, http.MethodGet, "/admin/webhooks", "token-admin", "")
+	removed := serve(routes.router, http.MethodDelete, "/admin/webhooks/1", "token-admin", "")
+	removedAgain := serve(routes.router, http.MethodDelete, "/admin/webhooks/1", "token-admin", "")
+
+	assert.Equal(t, http.StatusCreated, registered.Code)
+	assert.Contains(t, registered.Body.String(), `"event_types":["wallet.deposited","wallet.withdrawn"],"description":"ledger sync","active":true`)
+	assert.Regexp(t, `"secret":"whsec_[0-9a-f]{64}"`, registered.Body.String())
+	assert.Contains(t, listed.Body.String(), `"url":"https://example.com/hooks"`)
+	assert.NotContains(t, listed.Body.String(), "secret")
+	assert.Equal(t, http.StatusOK, removed.Code)
+	assert.Contains(t, removed.Body.String(), `"active":false`)
+	assert.Equal(t, http.StatusNotFound, removedAgain.Code)
+	assert.Contains(t, removedAgain.Body.String(), `"code":"webhook_not_found"`)
+}
+
+func TestRegisterWebhookRejectsInvalidEndpoints(t *testing.T) {
+	routes := newTestRouter()
+
+	badUrl := serve(routes.router, http.MethodPost, "/admin/webhooks", "token-admin", `{"url":"ftp://example.com/hooks"}`)
+	badType := serve(routes.router, http.MethodPost, "/admin/webhooks", "token-admin", `{"url":"https://example.com/hooks","event_types":["wallet.exploded"]}`)
+	operator := serve(routes.router, http.MethodPost, "/admin/webhooks", "token-operator", `{"url":"https://example.com/hooks"}`)
+
+	assert.Equal(t, http.StatusBadRequest, badUrl.Code)
+	assert.Contains(t, badUrl.Body.String(), `"field":"url","rule":"webhook_url"`)
+	assert.Equal(t, http.StatusBadRequest, badType.Code)
+	assert.Contains(t, badType.Body.String(), `"field":"event_types","rule":"event_types"`)
+	assert.Equal(t, http.StatusForbidden, operator.Code)
+	assert.Empty(t, routes.webhooks.endpoints)
+}
+
+func TestWebhookDeliveriesAndRedelivery(t *testing.T) {
+	routes := newTestRouter()
+	routes.webhooks.endpoints[1] = model.WebhookEndpoint{ID: 1, URL: "https://example.com/hooks", Active: true}
+	routes.webhooks.deliveries[1] = model.WebhookDelivery{ID: 1, EndpointId: 1, EventId: 5, Status: model.DeliveryStatusDead, Attempts: model.MaxWebhookAttempts}
+	routes.webhooks.deliveries[2] = model.WebhookDelivery{ID: 2, EndpointId: 1, EventId: 6, Status: model.DeliveryStatusPending, Attempts: 1}
+
+	dead := serve(routes.router, http.MethodGet, "/admin/webhooks/1/deliveries?status=dead", "token-admin", "")
+	badStatus := serve(routes.router, http.MethodGet, "/admin/webhooks/1/deliveries?status=lost", "token-admin", "")
+	missing := serve(routes.router, http.MethodGet, "/admin/webhooks/9/deliveries", "token-admin", "")
+	pending := serve(routes.router, http.MethodPost, "/admin/webhooks/deliveries/2/redeliver", "token-admin", "")
+	redelivered := serve(routes.router, http.MethodPost, "/admin/webhooks/deliveries/1/redeliver", "token-admin", "")
+
+	assert.Equal(t, http.StatusOK, dead.Code)
+	assert.Contains(t, dead.Body.String(), `"id":1,"endpoint_id":1,"event_id":5,"status":"dead"`)
+	assert.NotContains(t, dead.Body.String(), `"id":2,`)
+	assert.Equal(t, http.StatusBadRequest, badStatus.Code)
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+	assert.Equal(t, http.StatusConflict, pending.Code)
+	assert.Contains(t, pending.Body.String(), `"code":"delivery_pending"`)
+	assert.Equal(t, http.StatusAccepted, redelivered.Code)
+	assert.Contains(t, redelivered.Body.String(), `"status":"pending","attempts":0`)
+}
+
+// streamEvent is one event read from an event stream.
+type streamEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openEventStream connects to the event stream of the wallet, sending
+// lastEventId as Last-Event-ID when it is set.
+func openEventStream(t *testing.T, server *httptest.Server, walletId int, token string, lastEventId string) *bufio.Reader {
+	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/wallet/%d/events", server.URL, walletId), nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if lastEventId != "" {
+		r.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	response, err := client.Do(r)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	return bufio.NewReader(response.Body)
+}
+
+// readEvent reads the next event of a stream, skipping comments.
+func readEvent(t *testing.T, stream *bufio.Reader) streamEvent {
+	var event streamEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.event != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func walletEntry(entryId int, transactionId int, walletId int, amount int64, balanceAfter int64) model.TransactionEntry {
+	return model.TransactionEntry{
+		Transaction:  model.Transaction{ID: transactionId, Type: model.TransactionTypeDeposit, Amount: money.New(amount, "USD")},
+		EntryId:      entryId,
+		WalletId:     walletId,
+		EntryAmount:  money.New(amount, "USD"),
+		BalanceAfter: money.New(balanceAfter, "USD"),
+	}
+}
+
+func TestWalletEventsPushNewTransactions(t *testing.T) {
+	routes := newTestRouter()
+	routes.users.entries = []model.TransactionEntry{walletEntry(30, 11, 2, 500, 20000)}
+	server := httptest.NewServer(routes.router)
+	t.Cleanup(server.Close)
+
+	stream := openEventStream(t, server, 2, "token-user-2", "")
+	opened := readEvent(t, stream)
+
+	routes.users.entries = append([]model.TransactionEntry{walletEntry(31, 12, 2, 1000, 21000)}, routes.users.entries...)
+	deposit := serve(routes.router, http.MethodPost, "/wallet/2/deposit", "token-user-2", `{"user_id":2,"amount":10}`)
+	transaction := readEvent(t, stream)
+	balance := readEvent(t, stream)
+
+	assert.Equal(t, streamEvent{event: "balance", data: `{"available_balance":200.00,"balance":200.00,"currency":"USD"}`}, opened)
+	assert.Equal(t, http.StatusOK, deposit.Code)
+	assert.Equal(t, "31", transaction.id)
+	assert.Equal(t, "transaction", transaction.event)
+	assert.Contains(t, transaction.data, `"ID":12,"Type":"deposit","Direction":"incoming","WalletId":2,"Amount":10.00`)
+	assert.Contains(t, transaction.data, `"Balance":210.00`)
+	assert.Equal(t, "balance", balance.event)
+	assert.Empty(t, balance.id)
+}
+
+func TestWalletEventsResumeAfterLastEventId(t *testing.T) {
+	routes := newTestRouter()
+	routes.users.entries = []model.TransactionEntry{
+		walletEntry(33, 14, 2, 300, 20800),
+		walletEntry(32, 13, 1, 200, 10200),
+		walletEntry(31, 12, 2, 500, 20500),
+		walletEntry(30, 11, 2, 500, 20000),
+	}
+	server := httptest.NewServer(routes.router)
+	t.Cleanup(server.Close)
+
+	stream := openEventStream(t, server, 2, "token-user-2", "30")
+	first, second, balance := readEvent(t, stream), readEvent(t, stream), readEvent(t, stream)
+
+	assert.Equal(t, "31", first.id)
+	assert.Contains(t, first.data, `"ID":12,`)
+	assert.Equal(t, "33", second.id)
+	assert.Contains(t, second.data, `"ID":14,`)
+	assert.Equal(t, "balance", balance.event)
+}
+
+func TestWalletEventsRejectBadRequests(t *testing.T) {
+	routes := newTestRouter()
+
+	anotherUsers := serve(routes.router, http.MethodGet, "/wallet/1/events", "token-user-2", "")
+	anonymous := serve(routes.router, http.MethodGet, "/wallet/2/events", "", "")
+	r := httptest.NewRequest(http.MethodGet, "/wallet/2/events", nil)
+	r.Header.Set("Authorization", "Bearer token-user-2")
+	r.Header.Set("Last-Event-ID", "latest")
+	badId := httptest.NewRecorder()
+	routes.router.ServeHTTP(badId, r)
+
+	assert.Equal(t, http.StatusForbidden, anotherUsers.Code)
+	assert.Equal(t, http.StatusUnauthorized, anonymous.Code)
+	assert.Equal(t, http.StatusBadRequest, badId.Code)
+	assert.Contains(t, badId.Body.String(), "Last-Event-ID")
+}
@@ -0,0 +1,215 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/repository"
+	"go-wallet-service/internal/service"
+)
+
+var scheduleService *service.ScheduleService
+
+func ScheduleRoutes(r *mux.Router, ts *service.TokenService, ss *service.ScheduleService, ws *service.WalletService, is *service.IdempotencyService) {
+	scheduleService = ss
+	walletService = ws
+
+	scheduleRouter := r.PathPrefix("/user/{userId}/schedules").Subrouter()
+	scheduleRouter.Use(middleware.OAuth(ts))
+	scheduleRouter.Use(middleware.UserSelf())
+	idempotent := middleware.Idempotency(is)
+
+	scheduleRouter.Handle("", handle(schedulesHandler)).Methods("GET")
+	scheduleRouter.Handle("", idempotent(handle(createScheduleHandler))).Methods("POST")
+	scheduleRouter.Handle("/{scheduleId}", handle(updateScheduleHandler)).Methods("PATCH")
+	scheduleRouter.Handle("/{scheduleId}", handle(cancelScheduleHandler)).Methods("DELETE")
+	scheduleRouter.Handle("/{scheduleId}/runs", handle(scheduleRunsHandler)).Methods("GET")
+}
+
+func schedulesHandler(w http.ResponseWriter, r *http.Request) error {
+	userId, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
+	}
+
+	schedules, err := scheduleService.GetByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	scheduleModels := make([]model.ScheduledTransferData, len(schedules))
+	for i, schedule := range schedules {
+		scheduleModels[i] = mapSchedule(schedule)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"schedules": scheduleModels,
+	})
+	return nil
+}
+
+func createScheduleHandler(w http.ResponseWriter, r *http.Request) error {
+	userId, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
+	}
+
+	var scheduleParams object.ScheduleParams
+	if err := decodeParams(r, &scheduleParams); err != nil {
+		return err
+	}
+
+	senderWallet, err := walletService.GetUserWallet(userId, scheduleParams.SenderWalletId)
+	if err != nil {
+		return err
+	}
+
+	amount, err := service.WalletAmount(senderWallet, scheduleParams.Amount, scheduleParams.Currency)
+	if err != nil {
+		return err
+	}
+
+	receiverWallet, err := walletService.GetReceiverWallet(senderWallet, scheduleParams.ReceiverUserId, scheduleParams.ReceiverWalletId)
+	if err != nil {
+		return err
+	}
+
+	schedule, err := scheduleService.Create(senderWallet, receiverWallet, amount, scheduleParams.StartDate, scheduleParams.Recurrence, scheduleParams.DayOfMonth)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mapSchedule(schedule))
+	return nil
+}
+
+func updateScheduleHandler(w http.ResponseWriter, r *http.Request) error {
+	schedule, err := userSchedule(r)
+	if err != nil {
+		return err
+	}
+
+	var scheduleParams object.UpdateScheduleParams
+	if err := decodeParams(r, &scheduleParams); err != nil {
+		return err
+	}
+
+	edit := service.ScheduleEdit{
+		NextRunDate: scheduleParams.NextRunDate,
+		Recurrence:  scheduleParams.Recurrence,
+		DayOfMonth:  scheduleParams.DayOfMonth,
+		Status:      scheduleParams.Status,
+	}
+	if scheduleParams.Amount != nil {
+		senderWallet, err := walletService.GetById(schedule.SenderWalletId)
+		if err != nil {
+			return err
+		}
+
+		amount, err := service.WalletAmount(senderWallet, *scheduleParams.Amount, scheduleParams.Currency)
+		if err != nil {
+			return err
+		}
+		edit.Amount = &amount
+	}
+
+	schedule, err = scheduleService.Edit(schedule, edit)
+	if errors.Is(err, repository.ErrScheduleChanged) {
+		return repository.ErrScheduleChanged.WithMessage("The schedule changed while it was being edited, try again")
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mapSchedule(schedule))
+	return nil
+}
+
+func cancelScheduleHandler(w http.ResponseWriter, r *http.Request) error {
+	schedule, err := userSchedule(r)
+	if err != nil {
+		return err
+	}
+
+	schedule, err = scheduleService.Cancel(schedule)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mapSchedule(schedule))
+	return nil
+}
+
+func scheduleRunsHandler(w http.ResponseWriter, r *http.Request) error {
+	schedule, err := userSchedule(r)
+	if err != nil {
+		return err
+	}
+
+	runs, err := scheduleService.GetRuns(schedule.ID)
+	if err != nil {
+		return err
+	}
+
+	runModels := make([]model.ScheduledTransferRunData, len(runs))
+	for i, run := range runs {
+		runModels[i] = model.ScheduledTransferRunData{
+			ID:            run.ID,
+			ScheduledDate: run.ScheduledDate,
+			Attempt:       run.Attempt,
+			Status:        run.Status,
+			TransactionId: run.TransactionId,
+			Error:         run.Error,
+			RunDate:       run.CreationDate,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs": runModels,
+	})
+	return nil
+}
+
+// userSchedule returns the schedule named by the {scheduleId} path variable
+// when it belongs to the {userId} user.
+func userSchedule(r *http.Request) (model.ScheduledTransfer, error) {
+	userId, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return model.ScheduledTransfer{}, err
+	}
+	scheduleId, err := middleware.PathId(r, "scheduleId")
+	if err != nil {
+		return model.ScheduledTransfer{}, err
+	}
+
+	return scheduleService.GetUserSchedule(userId, scheduleId)
+}
+
+func mapSchedule(schedule model.ScheduledTransfer) model.ScheduledTransferData {
+	return model.ScheduledTransferData{
+		ID:               schedule.ID,
+		SenderWalletId:   schedule.SenderWalletId,
+		ReceiverWalletId: schedule.ReceiverWalletId,
+		Amount:           schedule.Amount,
+		Currency:         schedule.Amount.Currency.String(),
+		Recurrence:       schedule.Recurrence,
+		DayOfMonth:       schedule.DayOfMonth,
+		NextRunDate:      schedule.NextRunDate,
+		Attempts:         schedule.Attempts,
+		Status:           schedule.Status,
+	}
+}
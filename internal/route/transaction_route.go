@@ -0,0 +1,61 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/service"
+)
+
+func TransactionRoutes(r *mux.Router, ts *service.TokenService, us *service.UserService, is *service.IdempotencyService) {
+	userService = us
+
+	transactionRouter := r.PathPrefix("/transactions").Subrouter()
+	transactionRouter.Use(middleware.OAuth(ts))
+	idempotent := middleware.Idempotency(is)
+
+	transactionRouter.Handle("/{transactionId}/reversal", idempotent(handle(reversalHandler))).Methods("POST")
+}
+
+func reversalHandler(w http.ResponseWriter, r *http.Request) error {
+	transactionId, err := middleware.PathId(r, "transactionId")
+	if err != nil {
+		return err
+	}
+
+	var reversalParams object.ReversalParams
+	if err := decodeParams(r, &reversalParams); err != nil {
+		return err
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if reversalParams.UserId != nil && *reversalParams.UserId != principal.UserId {
+		return middleware.ErrUnauthorized
+	}
+
+	user, err := userService.GetById(principal.UserId)
+	if err != nil {
+		return err
+	}
+
+	reversal, err := userService.Reverse(middleware.ActorFromRequest(r), user.Role, transactionId, reversalParams.Amount, reversalParams.Force)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "ok",
+		"message":        "Reversal Successful",
+		"transaction_id": reversal.ID,
+		"reversal_of":    transactionId,
+		"amount":         reversal.Amount,
+		"currency":       reversal.Currency,
+	})
+	return nil
+}
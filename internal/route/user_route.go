@@ -4,13 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/rs/zerolog/log"
 
 	"go-wallet-service/internal/middleware"
 	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
 	"go-wallet-service/internal/object"
 	"go-wallet-service/internal/service"
 	"go-wallet-service/utils"
@@ -18,106 +20,325 @@ import (
 
 var userService *service.UserService
 
-func UserRoutes(r *mux.Router, us *service.UserService, ws *service.WalletService) {
+var errNotSender = utils.Forbidden("operation_not_permitted", "The current user is not the sender")
+
+func UserRoutes(r *mux.Router, ts *service.TokenService, us *service.UserService, ws *service.WalletService, ms *service.MovementService, is *service.IdempotencyService) {
+	tokenService = ts
 	userService = us
 	walletService = ws
+	movementService = ms
+
+	r.Handle("/users", handle(registerHandler)).Methods("POST")
 
 	userRouter := r.PathPrefix("/user/{userId}").Subrouter()
-	userRouter.Use(middleware.OAuth(us))
+	userRouter.Use(middleware.OAuth(ts))
+	userRouter.Use(middleware.UserSelf())
+	idempotent := middleware.Idempotency(is)
 
-	userRouter.HandleFunc("/transactions", transactionHandler).Methods("GET")
-	userRouter.HandleFunc("/transfer", transferHandler).Methods("POST")
+	userRouter.Handle("", handle(profileHandler)).Methods("GET")
+	userRouter.Handle("", handle(updateProfileHandler)).Methods("PATCH")
+	userRouter.Handle("", handle(deleteUserHandler)).Methods("DELETE")
+	userRouter.Handle("/wallets", handle(walletsHandler)).Methods("GET")
+	userRouter.Handle("/wallets", handle(createWalletHandler)).Methods("POST")
+	userRouter.Handle("/transactions", handle(transactionHandler)).Methods("GET")
+	userRouter.Handle("/transfer", idempotent(handle(transferHandler))).Methods("POST")
 }
 
-func transactionHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userId := vars["userId"]
+// registerHandler creates a user with their first wallet and starts their
+// first session, whose tokens it answers with.
+func registerHandler(w http.ResponseWriter, r *http.Request) error {
+	var registerParams object.RegisterParams
+	if err := decodeParams(r, &registerParams); err != nil {
+		return err
+	}
 
-	id, err := strconv.Atoi(userId)
+	currency := money.DefaultCurrency
+	if registerParams.Currency != "" {
+		parsed, err := money.ParseCurrency(registerParams.Currency)
+		if err != nil {
+			return err
+		}
+		currency = parsed
+	}
+
+	user, wallet, err := userService.Register(middleware.ActorFromRequest(r), service.Registration{
+		Username:    registerParams.Username,
+		DisplayName: registerParams.DisplayName,
+		Email:       registerParams.Email,
+		Phone:       registerParams.Phone,
+		WalletName:  registerParams.WalletName,
+		Currency:    currency,
+	})
 	if err != nil {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", fmt.Sprintf("%s must be a valid integer", userId)).Send()
-		return
+		return err
 	}
 
-	transactions, err := userService.GetUserTransactionsByUserId(id)
+	tokenPair, err := tokenService.Issue(user.ID)
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to fetch transactions for user [%d]", id)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to fetch transactions", http.StatusInternalServerError)
-		return
+		return utils.Internal("The user was registered but no session could be started, use POST /oauth/token once one is granted", err)
 	}
 
-	var receiverUserIds []int
-	for _, txn := range transactions {
-		receiverUserIds = append(receiverUserIds, txn.ReceiverUserId)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(model.RegistrationData{
+		User:         mapUser(user),
+		Wallet:       mapWallet(wallet),
+		AccessToken:  tokenPair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokenPair.ExpiresIn.Seconds()),
+		RefreshToken: tokenPair.RefreshToken,
+	})
+	return nil
+}
+
+func profileHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
 	}
 
-	users, err := userService.GetByIds(receiverUserIds)
+	user, err := userService.GetById(id)
 	if err != nil {
-		log.Error().Str("error", "user_service_error").Str("error_description", fmt.Sprintf("Unable to fetch users due to: %s ", err.Error())).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to fetch user IDs", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	receiverUsernames := make(map[int]string)
-	for _, user := range users {
-		receiverUsernames[user.ID] = user.Username
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mapUser(user))
+	return nil
+}
+
+func updateProfileHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
+	}
+
+	var profileParams object.ProfileParams
+	if err := decodeParams(r, &profileParams); err != nil {
+		return err
 	}
 
-	json.NewEncoder(w).Encode(mapTransactions(transactions, receiverUsernames))
+	user, err := userService.UpdateProfile(middleware.ActorFromRequest(r), id, service.ProfileEdit{
+		DisplayName: profileParams.DisplayName,
+		Email:       profileParams.Email,
+		Phone:       profileParams.Phone,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mapUser(user))
+	return nil
 }
 
-func transferHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userId := vars["userId"]
+// deleteUserHandler closes the account of the user, ending every session.
+func deleteUserHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
+	}
 
-	requestParams, ok := r.Context().Value("requestParams").(string)
-	if !ok {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", "Parameters are missing, not expected or not matching the required format").Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+	if err := userService.Delete(middleware.ActorFromRequest(r), id); err != nil {
+		return err
 	}
 
-	var transferParams object.TransferParams
-	err := json.Unmarshal([]byte(requestParams), &transferParams)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": "Account Deleted",
+	})
+	return nil
+}
+
+func transactionHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := middleware.PathId(r, "userId")
 	if err != nil {
-		log.Error().Str("error", "json_unmarshal_error").Str("error_description", fmt.Sprintf("Unable to unmarshal parameters: %v", requestParams)).Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+		return err
 	}
 
-	senderWallet, err := walletService.GetWalletByUserId(transferParams.UserId)
+	filter, err := transactionFilter(r.URL.Query())
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to fetch wallet for user [%d]", transferParams.UserId)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to fetch wallet", http.StatusInternalServerError)
+		return err
 	}
-	if senderWallet[0].Balance < transferParams.Amount {
-		utils.HttpErrorResponse(w, "operation_not_permitted", "The transfer amount is greater than wallet balance", http.StatusForbidden)
+
+	page, err := userService.GetUserTransactions(id, filter, r.URL.Query().Get("cursor"))
+	if err != nil {
+		return err
 	}
 
-	id, err := strconv.Atoi(userId)
+	response := map[string]interface{}{
+		"transactions": versionOf(r).transactions(page.Entries),
+	}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	return nil
+}
+
+// transactionFilter reads the history filters from the query string. Dates
+// are RFC 3339 timestamps or plain dates; a plain "to" date includes the
+// whole day.
+func transactionFilter(query url.Values) (model.TransactionFilter, error) {
+	filter := model.TransactionFilter{Limit: service.DefaultTransactionPageSize}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > service.MaxTransactionPageSize {
+			return model.TransactionFilter{}, invalidParameter("limit must be between 1 and %d", service.MaxTransactionPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	switch value := query.Get("type"); value {
+	case "", model.TransactionTypeDeposit, model.TransactionTypeWithdraw, model.TransactionTypeTransfer, model.TransactionTypeReversal, model.TransactionTypeFee, model.TransactionTypeCredit, model.TransactionTypeDebit:
+		filter.Type = value
+	default:
+		return model.TransactionFilter{}, invalidParameter("type must be one of deposit, withdraw, transfer, reversal, fee, credit or debit")
+	}
+
+	switch value := query.Get("direction"); value {
+	case "", model.DirectionIncoming, model.DirectionOutgoing:
+		filter.Direction = value
+	default:
+		return model.TransactionFilter{}, invalidParameter("direction must be incoming or outgoing")
+	}
+
+	var err error
+	if filter.From, err = timeParam(query, "from", false); err != nil {
+		return model.TransactionFilter{}, err
+	}
+	if filter.To, err = timeParam(query, "to", true); err != nil {
+		return model.TransactionFilter{}, err
+	}
+	if filter.MinAmount, err = amountParam(query, "min_amount"); err != nil {
+		return model.TransactionFilter{}, err
+	}
+	if filter.MaxAmount, err = amountParam(query, "max_amount"); err != nil {
+		return model.TransactionFilter{}, err
+	}
+
+	if value := query.Get("counterparty"); value != "" {
+		counterparty, err := strconv.Atoi(value)
+		if err != nil || counterparty <= 0 {
+			return model.TransactionFilter{}, invalidParameter("counterparty must be a user ID")
+		}
+		filter.CounterpartyUserId = counterparty
+	}
+	return filter, nil
+}
+
+func timeParam(query url.Values, name string, endOfDay bool) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
 	if err != nil {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", fmt.Sprintf("%s must be a valid integer", userId)).Send()
-		return
+		return nil, invalidParameter("%s must be a date such as 2024-12-22 or an RFC 3339 timestamp", name)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
 	}
+	return &t, nil
+}
 
-	if id != transferParams.UserId {
-		utils.HttpErrorResponse(w, "operation_not_permitted", "The current user is not the sender", http.StatusForbidden)
+func amountParam(query url.Values, name string) (*money.Decimal, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
 	}
 
-	receiverWallet, err := walletService.GetWalletByUserId(transferParams.ReceiverUserId)
+	amount, err := money.ParseDecimal(value)
+	if err != nil || amount.Sign() < 0 {
+		return nil, invalidParameter("%s must be a non-negative amount", name)
+	}
+	return &amount, nil
+}
+
+func walletsHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := middleware.PathId(r, "userId")
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to fetch wallet for user [%d]", transferParams.UserId)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to fetch wallet", http.StatusInternalServerError)
+		return err
 	}
 
-	senderWalletBalance := senderWallet[0].Balance - transferParams.Amount
-	receiverWalletBalance := receiverWallet[0].Balance + transferParams.Amount
+	wallets, err := walletService.GetWalletByUserId(id)
+	if err != nil {
+		return err
+	}
+
+	walletModels := make([]model.WalletData, len(wallets))
+	for i, wallet := range wallets {
+		walletModels[i] = mapWallet(wallet)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(walletModels)
+	return nil
+}
 
-	err = userService.Transfer(transferParams.UserId, senderWallet[0].ID, senderWalletBalance, transferParams.ReceiverUserId, receiverWallet[0].ID, receiverWalletBalance, transferParams.Amount)
+func createWalletHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := middleware.PathId(r, "userId")
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to transfer from wallet [%d] to wallet [%d]", senderWallet[0].ID, receiverWallet[0].ID)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to deposit", http.StatusInternalServerError)
-		return
+		return err
+	}
+
+	var createWalletParams object.CreateWalletParams
+	if err := decodeParams(r, &createWalletParams); err != nil {
+		return err
+	}
+
+	currency := money.DefaultCurrency
+	if createWalletParams.Currency != "" {
+		currency, err = money.ParseCurrency(createWalletParams.Currency)
+		if err != nil {
+			return money.ErrUnknownCurrency.WithMessage(fmt.Sprintf("%s is not a supported currency", createWalletParams.Currency))
+		}
+	}
+
+	wallet, err := walletService.Create(middleware.ActorFromRequest(r), id, createWalletParams.Name, currency, createWalletParams.IsDefault)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mapWallet(wallet))
+	return nil
+}
+
+func transferHandler(w http.ResponseWriter, r *http.Request) error {
+	var transferParams object.TransferParams
+	if err := decodeParams(r, &transferParams); err != nil {
+		return err
+	}
+
+	id, err := middleware.PathId(r, "userId")
+	if err != nil {
+		return err
+	}
+
+	if id != transferParams.UserId {
+		return errNotSender
+	}
+
+	senderWallet, err := walletService.GetUserWallet(transferParams.UserId, transferParams.SenderWalletId)
+	if err != nil {
+		return err
+	}
+
+	if err := movementService.Transfer(middleware.ActorFromRequest(r), senderWallet, transferParams.ReceiverUserId, transferParams.ReceiverWalletId, transferParams.Amount, transferParams.Currency); err != nil {
+		return err
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -126,17 +347,54 @@ func transferHandler(w http.ResponseWriter, r *http.Request) {
 		"status":  "ok",
 		"message": "Transfer Successful",
 	})
+	return nil
 }
 
-func mapTransactions(source []model.Transaction, receivers map[int]string) []model.TransactionData {
+func mapTransactions(source []model.TransactionEntry) []model.TransactionData {
 	transactionModels := make([]model.TransactionData, len(source))
-	for i, txn := range source {
+	for i, entry := range source {
+		amount := entry.EntryAmount
+		if amount.IsNegative() {
+			amount = amount.Neg()
+		}
+
+		// the side of a cross-currency transfer the wallet did not see
+		var convertedAmount *money.Money
+		if entry.DestinationAmount != nil {
+			convertedAmount = entry.DestinationAmount
+			if entry.Direction() == model.DirectionIncoming {
+				convertedAmount = &entry.Amount
+			}
+		}
+
 		transactionModels[i] = model.TransactionData{
-			TransactionDate: txn.CreationDate,
-			Type:            txn.Type,
-			Amount:          txn.Amount,
-			Receiver:        receivers[txn.ReceiverUserId],
+			ID:              entry.ID,
+			Type:            entry.Type,
+			Direction:       entry.Direction(),
+			WalletId:        entry.WalletId,
+			Amount:          amount,
+			ConvertedAmount: convertedAmount,
+			ExchangeRate:    entry.ExchangeRate,
+			Counterparty:    entry.Counterparty,
+			ReversalOf:      entry.ReversalOf,
+			FeeOf:           entry.FeeOf,
+			ReversedAmount:  entry.ReversedAmount,
+			Balance:         entry.BalanceAfter,
+			TransactionDate: entry.CreationDate,
 		}
 	}
 	return transactionModels
 }
+
+func mapUser(user model.User) model.UserData {
+	return model.UserData{
+		ID:           user.ID,
+		Username:     user.Username,
+		DisplayName:  user.DisplayName,
+		Email:        user.Email,
+		Phone:        user.Phone,
+		Role:         user.Role,
+		Status:       user.Status,
+		CreationDate: user.CreationDate,
+	}
+}
@@ -0,0 +1,158 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-wallet-service/internal/model"
+	modelv2 "go-wallet-service/internal/model/v2"
+	"go-wallet-service/utils"
+)
+
+// Version is a version of the REST API. Every version registers the same
+// routes with the same services, and reads the same request bodies. A handler
+// whose response changes tells the versions apart with versionOf, as the
+// transactions of a wallet's history do. A route added by a later version,
+// whose operation says since which one it is served, is registered on every
+// version but answered as missing by the earlier ones.
+type Version struct {
+	Number int
+	// Prefix is the path the routes of the version are served under.
+	Prefix string
+	// Deprecation is when the version was, or will be, deprecated in favour
+	// of the one served under Successor, and Sunset when it stops being
+	// served. Both are zero for the current version.
+	Deprecation time.Time
+	Sunset      time.Time
+	Successor   string
+
+	// transaction shows an entry of a wallet's history.
+	transaction func(model.TransactionData) any
+}
+
+var (
+	// unversionedDeprecation is the day the API was first served under /v1
+	// and /v2, which deprecated the paths without a version.
+	unversionedDeprecation = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	// unversionedSunset gives the clients of the paths without a version
+	// until the second quarter of 2027 to add /v1. /v1 is deprecated in turn
+	// once they are gone, and its clients are given the same six months
+	// to move to /v2 before v1Sunset.
+	unversionedSunset = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+	v1Sunset          = unversionedSunset.AddDate(0, 6, 0)
+)
+
+var (
+	// V1 is the API as it was before it had versions.
+	V1 = Version{
+		Number:      1,
+		Prefix:      "/v1",
+		Deprecation: unversionedSunset,
+		Sunset:      v1Sunset,
+		Successor:   "/v2",
+		transaction: transactionV1,
+	}
+	// V2 keys transactions in snake_case like every other object.
+	V2 = Version{
+		Number: 2,
+		Prefix: "/v2",
+		transaction: func(transaction model.TransactionData) any {
+			return modelv2.TransactionData(transaction)
+		},
+	}
+	// Unversioned serves V1 at the root, where its clients found it before
+	// the API had versions, until they move to /v1.
+	Unversioned = Version{
+		Number:      1,
+		Deprecation: unversionedDeprecation,
+		Sunset:      unversionedSunset,
+		Successor:   "/v1",
+		transaction: transactionV1,
+	}
+
+	// Versions are the versions of the API served.
+	Versions = []Version{V1, V2, Unversioned}
+)
+
+var errNotInVersion = utils.NotFound("not_found", "No resource exists at this path in this version of the API")
+
+type versionContextKey struct{}
+
+func transactionV1(transaction model.TransactionData) any {
+	return transaction
+}
+
+// VersionRouter returns a router of r for the routes of version, which tells
+// the clients of a deprecated version when it goes away and where to move.
+func VersionRouter(r *mux.Router, version Version) *mux.Router {
+	var router *mux.Router
+	if version.Prefix == "" {
+		router = r.NewRoute().Subrouter()
+	} else {
+		router = r.PathPrefix(version.Prefix).Subrouter()
+	}
+	router.Use(version.middleware)
+	return router
+}
+
+// middleware sets the version of the requests to its routes, and answers the
+// routes of later versions as missing. A deprecated version answers with the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers, and links the same
+// path of its successor.
+func (v Version) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !v.serves(mux.CurrentRoute(r), r.Method) {
+			utils.WriteProblem(w, r, errNotInVersion)
+			return
+		}
+		if !v.Deprecation.IsZero() {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(v.Deprecation.Unix(), 10))
+			if !v.Sunset.IsZero() {
+				w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if v.Successor != "" {
+				w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, v.Successor, strings.TrimPrefix(r.URL.Path, v.Prefix)))
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionContextKey{}, v)))
+	})
+}
+
+// serves tells whether the version serves the method of route: every route
+// does unless its operation was added by a later version.
+func (v Version) serves(route *mux.Route, method string) bool {
+	if route == nil {
+		return true
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return true
+	}
+	op, ok := operations[method+" "+strings.TrimPrefix(path, v.Prefix)]
+	return !ok || op.since <= v.Number
+}
+
+// versionOf returns the version of the API the request was made to. Routes
+// registered outside a version router are served as V1.
+func versionOf(r *http.Request) Version {
+	if version, ok := r.Context().Value(versionContextKey{}).(Version); ok {
+		return version
+	}
+	return V1
+}
+
+// transactions shows the entries of a wallet's history as the version does.
+func (v Version) transactions(entries []model.TransactionEntry) []any {
+	transactions := mapTransactions(entries)
+	shown := make([]any, len(transactions))
+	for i, transaction := range transactions {
+		shown[i] = v.transaction(transaction)
+	}
+	return shown
+}
@@ -0,0 +1,98 @@
+package route
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+)
+
+func TestVersionsServeTheSameRoutes(t *testing.T) {
+	routes := newTestRouter()
+
+	for _, prefix := range []string{"", "/v1", "/v2"} {
+		response := serve(routes.router, http.MethodGet, prefix+"/wallet/2/balance", "token-user-2", "")
+
+		assert.Equal(t, http.StatusOK, response.Code, prefix)
+		assert.JSONEq(t, `{"balance": 200.00, "available_balance": 200.00, "currency": "USD"}`, response.Body.String(), prefix)
+	}
+	assert.Equal(t, http.StatusNotFound, serve(routes.router, http.MethodGet, "/v3/wallet/2/balance", "token-user-2", "").Code)
+}
+
+func TestDeprecatedVersionsAnnounceTheirSunset(t *testing.T) {
+	routes := newTestRouter()
+
+	for _, tt := range []struct {
+		path        string
+		token       string
+		deprecation string
+		sunset      string
+		link        string
+	}{
+		{"/wallet/2/balance", "token-user-2", "@1792281600", "Thu, 01 Apr 2027 00:00:00 GMT", `</v1/wallet/2/balance>; rel="successor-version"`},
+		{"/v1/wallet/2/balance", "token-user-2", "@1806537600", "Fri, 01 Oct 2027 00:00:00 GMT", `</v2/wallet/2/balance>; rel="successor-version"`},
+		{"/v1/wallet/2/balance", "", "@1806537600", "Fri, 01 Oct 2027 00:00:00 GMT", `</v2/wallet/2/balance>; rel="successor-version"`},
+		{"/v2/wallet/2/balance", "token-user-2", "", "", ""},
+	} {
+		response := serve(routes.router, http.MethodGet, tt.path, tt.token, "")
+
+		assert.Equal(t, tt.deprecation, response.Header().Get("Deprecation"), tt.path)
+		assert.Equal(t, tt.sunset, response.Header().Get("Sunset"), tt.path)
+		assert.Equal(t, tt.link, response.Header().Get("Link"), tt.path)
+	}
+}
+
+func TestTransactionsAreKeyedByVersion(t *testing.T) {
+	routes := newTestRouter()
+	routes.users.entries = []model.TransactionEntry{walletEntry(30, 11, 2, 500, 20000)}
+
+	transactionOf := func(path string) map[string]any {
+		response := serve(routes.router, http.MethodGet, path, "token-user-2", "")
+		assert.Equal(t, http.StatusOK, response.Code, path)
+		var page struct{ Transactions []map[string]any }
+		if err := json.Unmarshal(response.Body.Bytes(), &page); err != nil || len(page.Transactions) != 1 {
+			t.Fatalf("Failed to read the transactions of %s: %v", path, err)
+		}
+		return page.Transactions[0]
+	}
+	unversioned := transactionOf("/user/2/transactions")
+	v1 := transactionOf("/v1/user/2/transactions")
+	v2 := transactionOf("/v2/user/2/transactions")
+
+	assert.Equal(t, unversioned, v1)
+	assert.Equal(t, 11.0, v1["ID"])
+	assert.Equal(t, 2.0, v1["WalletId"])
+	assert.Contains(t, v1, "TransactionDate")
+	assert.Equal(t, 11.0, v2["id"])
+	assert.Equal(t, 2.0, v2["wallet_id"])
+	assert.Equal(t, "incoming", v2["direction"])
+	assert.Contains(t, v2, "transaction_date")
+	assert.NotContains(t, v2, "ID")
+}
+
+func TestWalletEventsAreKeyedByVersion(t *testing.T) {
+	routes := newTestRouter()
+	routes.users.entries = []model.TransactionEntry{walletEntry(31, 12, 2, 500, 20500)}
+	server := httptest.NewServer(routes.router)
+	t.Cleanup(server.Close)
+
+	r, err := http.NewRequest(http.MethodGet, server.URL+"/v2/wallet/2/events", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", "Bearer token-user-2")
+	r.Header.Set("Last-Event-ID", "30")
+	response, err := server.Client().Do(r)
+	if err != nil {
+		t.Fatalf("Failed to open the event stream: %v", err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+
+	transaction := readEvent(t, bufio.NewReader(response.Body))
+
+	assert.Equal(t, "31", transaction.id)
+	assert.Contains(t, transaction.data, `"id":12,"type":"deposit","direction":"incoming","wallet_id":2,"amount":5.00`)
+}
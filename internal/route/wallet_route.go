@@ -2,96 +2,115 @@ package route
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/gorilla/mux"
-	"github.com/rs/zerolog/log"
 
 	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
 	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/repository"
 	"go-wallet-service/internal/service"
 	"go-wallet-service/utils"
 )
 
-var walletService *service.WalletService
+var (
+	errDefaultUnset = utils.Invalid("invalid_parameter", "The default wallet is changed by making another wallet the default")
+	errEmptyName    = utils.Invalid("invalid_parameter", "The wallet name cannot be empty")
+	errQuoteType    = utils.Invalid("invalid_parameter", "The type must be withdraw or transfer")
+)
+
+var (
+	walletService   *service.WalletService
+	movementService *service.MovementService
+	limitService    *service.LimitService
+	feeService      *service.FeeService
+)
 
-func WalletRoutes(r *mux.Router, us *service.UserService, ws *service.WalletService) {
+func WalletRoutes(r *mux.Router, ts *service.TokenService, ws *service.WalletService, us *service.UserService, hs *service.HoldService, ms *service.MovementService, ls *service.LimitService, fs *service.FeeService, is *service.IdempotencyService) {
 	walletService = ws
+	movementService = ms
+	userService = us
+	holdService = hs
+	limitService = ls
+	feeService = fs
 
 	walletRouter := r.PathPrefix("/wallet").Subrouter()
-	walletRouter.Use(middleware.OAuth(us))
-
-	walletRouter.HandleFunc("/{walletId}/balance", balanceHandler).Methods("GET")
-	walletRouter.HandleFunc("/{walletId}/deposit", depositHandler).Methods("POST")
-	walletRouter.HandleFunc("/{walletId}/withdraw", withdrawHandler).Methods("POST")
+	walletRouter.Use(middleware.OAuth(ts))
+	walletRouter.Use(middleware.WalletOwner(ws))
+	idempotent := middleware.Idempotency(is)
+
+	walletRouter.Handle("/{walletId}", handle(updateWalletHandler)).Methods("PATCH")
+	walletRouter.Handle("/{walletId}/balance", handle(balanceHandler)).Methods("GET")
+	walletRouter.Handle("/{walletId}/events", handle(walletEventsHandler)).Methods("GET")
+	walletRouter.Handle("/{walletId}/quote", handle(quoteHandler)).Methods("GET")
+	walletRouter.Handle("/{walletId}/deposit", idempotent(handle(depositHandler))).Methods("POST")
+	walletRouter.Handle("/{walletId}/withdraw", idempotent(handle(withdrawHandler))).Methods("POST")
+	walletRouter.Handle("/{walletId}/holds", handle(holdsHandler)).Methods("GET")
+	walletRouter.Handle("/{walletId}/holds", idempotent(handle(placeHoldHandler))).Methods("POST")
+
+	// a hold is settled by its payee, who does not own the held wallet
+	settleRouter := r.PathPrefix("/wallet").Subrouter()
+	settleRouter.Use(middleware.OAuth(ts))
+	settleRouter.Handle("/{walletId}/holds/{holdId}/capture", idempotent(handle(captureHoldHandler))).Methods("POST")
+	settleRouter.Handle("/{walletId}/holds/{holdId}/release", handle(releaseHoldHandler)).Methods("POST")
 }
 
-func balanceHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	requestWalletId := vars["walletId"]
-
-	walletId, err := strconv.Atoi(requestWalletId)
+func balanceHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
 	if err != nil {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", fmt.Sprintf("%s must be a valid integer", requestWalletId)).Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+		return err
 	}
 
-	wallet, err := walletService.GetById(walletId)
+	balance, err := walletBalance(walletId)
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to fetch wallet [%d]", walletId)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to fetch wallet", http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]float64{
-		"balance": wallet.Balance,
-	})
+	json.NewEncoder(w).Encode(balance)
+	return nil
 }
 
-func depositHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	requestWalletId := vars["walletId"]
+// walletBalance is the balance of a wallet as the balance route and the
+// wallet's event stream answer it.
+func walletBalance(walletId int) (map[string]interface{}, error) {
+	wallet, err := walletService.GetById(walletId)
+	if err != nil {
+		return nil, err
+	}
 
-	walletId, err := strconv.Atoi(requestWalletId)
+	available, err := walletService.GetAvailableBalance(walletId)
 	if err != nil {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", fmt.Sprintf("%s must be a valid integer", requestWalletId)).Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+		return nil, err
 	}
 
-	requestParams, ok := r.Context().Value("requestParams").(string)
-	if !ok {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", "Parameters are missing, not expected or not matching the required format").Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+	return map[string]interface{}{
+		"balance":           wallet.Balance,
+		"available_balance": available,
+		"currency":          wallet.Currency,
+	}, nil
+}
+
+func depositHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
 	}
 
 	var depositParams object.DepositParams
-	err = json.Unmarshal([]byte(requestParams), &depositParams)
-	if err != nil {
-		log.Error().Str("error", "json_unmarshal_error").Str("error_description", fmt.Sprintf("Unable to unmarshal parameters: %v", requestParams)).Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+	if err := decodeParams(r, &depositParams); err != nil {
+		return err
 	}
 
 	wallet, err := walletService.GetById(walletId)
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to fetch wallet [%d]", walletId)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to fetch wallet", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	wallet.Balance += depositParams.Amount
-
-	err = walletService.Update(wallet, depositParams.Amount, "deposit")
-	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to deposit [%f] to wallet [%d] due to: %v", wallet.Balance, walletId, err.Error())).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to deposit", http.StatusInternalServerError)
-		return
+	if err := movementService.Deposit(middleware.ActorFromRequest(r), wallet, depositParams.Amount, depositParams.Currency); err != nil {
+		return err
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -100,59 +119,125 @@ func depositHandler(w http.ResponseWriter, r *http.Request) {
 		"status":  "ok",
 		"message": "Deposit Successful",
 	})
+	return nil
 }
 
-func withdrawHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	requestWalletId := vars["walletId"]
+func withdrawHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
+	}
+
+	var withdrawParams object.WithdrawParams
+	if err := decodeParams(r, &withdrawParams); err != nil {
+		return err
+	}
 
-	walletId, err := strconv.Atoi(requestWalletId)
+	wallet, err := walletService.GetById(walletId)
 	if err != nil {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", fmt.Sprintf("%s must be a valid integer", requestWalletId)).Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+		return err
 	}
 
-	requestParams, ok := r.Context().Value("requestParams").(string)
-	if !ok {
-		log.Error().Str("error", "invalid_parameter").Str("error_description", "Parameters are missing, not expected or not matching the required format").Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+	if err := movementService.Withdraw(middleware.ActorFromRequest(r), wallet, withdrawParams.Amount, withdrawParams.Currency); err != nil {
+		return err
 	}
 
-	var withdrawParams object.WithdrawParams
-	err = json.Unmarshal([]byte(requestParams), &withdrawParams)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": "Withdraw Successful",
+	})
+	return nil
+}
+
+func quoteHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
 	if err != nil {
-		log.Error().Str("error", "json_unmarshal_error").Str("error_description", fmt.Sprintf("Unable to unmarshal parameters: %v", requestParams)).Send()
-		utils.HttpErrorResponse(w, "invalid_parameter", "Parameters are missing, not expected or not matching the required format", http.StatusBadRequest)
-		return
+		return err
+	}
+
+	query := r.URL.Query()
+	transactionType := query.Get("type")
+	if transactionType != model.TransactionTypeWithdraw && transactionType != model.TransactionTypeTransfer {
+		return errQuoteType
+	}
+	requestAmount, err := money.ParseDecimal(query.Get("amount"))
+	if err != nil {
+		return err
 	}
 
 	wallet, err := walletService.GetById(walletId)
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to fetch wallet [%d]", walletId)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to fetch wallet", http.StatusInternalServerError)
-		return
+		return err
+	}
+
+	amount, err := service.WalletAmount(wallet, requestAmount, query.Get("currency"))
+	if err != nil {
+		return err
+	}
+	if !amount.IsPositive() {
+		return repository.ErrInvalidAmount
+	}
+
+	quote, err := feeService.Quote(wallet, transactionType, amount)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.FeeQuoteData{
+		Type:     quote.TransactionType,
+		Amount:   quote.Amount,
+		Fee:      quote.Fee,
+		Total:    quote.Total,
+		Currency: quote.Amount.Currency.String(),
+	})
+	return nil
+}
+
+func updateWalletHandler(w http.ResponseWriter, r *http.Request) error {
+	walletId, err := middleware.PathId(r, "walletId")
+	if err != nil {
+		return err
 	}
 
-	if wallet.Balance < withdrawParams.Amount {
-		utils.HttpErrorResponse(w, "operation_not_permitted", "The withdrawal amount is greater than wallet balance", http.StatusForbidden)
-		return
+	var walletParams object.WalletParams
+	if err := decodeParams(r, &walletParams); err != nil {
+		return err
 	}
 
-	wallet.Balance -= withdrawParams.Amount
+	if walletParams.IsDefault != nil && !*walletParams.IsDefault {
+		return errDefaultUnset
+	}
+	if walletParams.Name != nil && *walletParams.Name == "" {
+		return errEmptyName
+	}
 
-	err = walletService.Update(wallet, withdrawParams.Amount, "withdraw")
+	wallet, err := walletService.GetById(walletId)
+	if walletParams.Name != nil && err == nil {
+		wallet, err = walletService.Rename(middleware.ActorFromRequest(r), walletId, *walletParams.Name)
+	}
+	if walletParams.IsDefault != nil && err == nil {
+		wallet, err = walletService.SetDefault(middleware.ActorFromRequest(r), walletId)
+	}
 	if err != nil {
-		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to deposit [%f] to wallet [%d]", wallet.Balance, walletId)).Send()
-		utils.HttpErrorResponse(w, "bad_request", "Unable to deposit", http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "ok",
-		"message": "Withdraw Successful",
-	})
+	json.NewEncoder(w).Encode(mapWallet(wallet))
+	return nil
+}
+
+func mapWallet(wallet model.Wallet) model.WalletData {
+	return model.WalletData{
+		ID:        wallet.ID,
+		Name:      wallet.Name,
+		IsDefault: wallet.IsDefault,
+		Balance:   wallet.Balance,
+		Currency:  wallet.Currency.String(),
+		Status:    wallet.Status,
+	}
 }
@@ -0,0 +1,161 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/object"
+	"go-wallet-service/internal/service"
+)
+
+var webhookService *service.WebhookService
+
+func webhooksHandler(w http.ResponseWriter, r *http.Request) error {
+	endpoints, err := webhookService.GetEndpoints()
+	if err != nil {
+		return err
+	}
+
+	endpointModels := make([]model.WebhookEndpointData, len(endpoints))
+	for i, endpoint := range endpoints {
+		endpointModels[i] = mapWebhookEndpoint(endpoint)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": endpointModels,
+	})
+	return nil
+}
+
+// registerWebhookHandler answers the new endpoint along with its secret,
+// which is never shown again.
+func registerWebhookHandler(w http.ResponseWriter, r *http.Request) error {
+	var webhookParams object.WebhookParams
+	if err := decodeParams(r, &webhookParams); err != nil {
+		return err
+	}
+
+	endpoint, err := webhookService.Register(middleware.ActorFromRequest(r), webhookParams.URL, webhookParams.EventTypes, webhookParams.Description)
+	if err != nil {
+		return err
+	}
+
+	endpointModel := mapWebhookEndpoint(endpoint)
+	endpointModel.Secret = endpoint.Secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(endpointModel)
+	return nil
+}
+
+func removeWebhookHandler(w http.ResponseWriter, r *http.Request) error {
+	endpointId, err := middleware.PathId(r, "webhookId")
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := webhookService.Remove(middleware.ActorFromRequest(r), endpointId)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mapWebhookEndpoint(endpoint))
+	return nil
+}
+
+// webhookDeliveriesHandler lists the latest deliveries to an endpoint, only
+// those with ?status= when it is given.
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) error {
+	endpointId, err := middleware.PathId(r, "webhookId")
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	switch status {
+	case "", model.DeliveryStatusPending, model.DeliveryStatusDelivered, model.DeliveryStatusDead:
+	default:
+		return invalidParameter("status must be one of pending, delivered or dead")
+	}
+	limit := service.DefaultDeliveryPageSize
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > service.MaxDeliveryPageSize {
+			return invalidParameter("limit must be between 1 and %d", service.MaxDeliveryPageSize)
+		}
+	}
+
+	deliveries, err := webhookService.GetDeliveries(endpointId, status, limit)
+	if err != nil {
+		return err
+	}
+
+	deliveryModels := make([]model.WebhookDeliveryData, len(deliveries))
+	for i, delivery := range deliveries {
+		deliveryModels[i] = mapWebhookDelivery(delivery)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveryModels,
+	})
+	return nil
+}
+
+// redeliverHandler queues a delivered or dead delivery to be sent again.
+func redeliverHandler(w http.ResponseWriter, r *http.Request) error {
+	deliveryId, err := middleware.PathId(r, "deliveryId")
+	if err != nil {
+		return err
+	}
+
+	delivery, err := webhookService.Redeliver(middleware.ActorFromRequest(r), deliveryId)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(mapWebhookDelivery(delivery))
+	return nil
+}
+
+func mapWebhookEndpoint(endpoint model.WebhookEndpoint) model.WebhookEndpointData {
+	eventTypes := []string(endpoint.EventTypes)
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	return model.WebhookEndpointData{
+		ID:           endpoint.ID,
+		URL:          endpoint.URL,
+		EventTypes:   eventTypes,
+		Description:  endpoint.Description,
+		Active:       endpoint.Active,
+		CreationDate: endpoint.CreationDate,
+	}
+}
+
+func mapWebhookDelivery(delivery model.WebhookDelivery) model.WebhookDeliveryData {
+	data := model.WebhookDeliveryData{
+		ID:             delivery.ID,
+		EndpointId:     delivery.EndpointId,
+		EventId:        delivery.EventId,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		DeliveryDate:   delivery.DeliveryDate,
+		CreationDate:   delivery.CreationDate,
+	}
+	if delivery.Status == model.DeliveryStatusPending {
+		data.NextAttemptDate = &delivery.NextAttemptDate
+	}
+	return data
+}
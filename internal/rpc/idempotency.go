@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/rpc/walletpb"
+	"go-wallet-service/utils"
+)
+
+const (
+	idempotencyKeyMetadata     = "idempotency-key"
+	idempotentReplayedMetadata = "idempotent-replayed"
+)
+
+// idempotentCalls are the calls that move money, each with the message it
+// answers with, which is what a replay is decoded into.
+var idempotentCalls = map[string]func() proto.Message{
+	walletpb.WalletService_Deposit_FullMethodName:  func() proto.Message { return &walletpb.Balance{} },
+	walletpb.WalletService_Withdraw_FullMethodName: func() proto.Message { return &walletpb.Balance{} },
+	walletpb.WalletService_Transfer_FullMethodName: func() proto.Message { return &walletpb.Balance{} },
+}
+
+// idempotency makes the calls that move money safe to retry, as the
+// Idempotency middleware does for the REST routes. The first call carrying
+// idempotency-key metadata runs and its answer is stored; later calls from
+// the same user with the same key and request get the stored answer back,
+// with idempotent-replayed metadata. Keys are shared with the REST routes,
+// where a key used by a call is rejected as reused.
+func (s *server) idempotency(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	newResponse, ok := idempotentCalls[info.FullMethod]
+	key := firstMetadata(ctx, idempotencyKeyMetadata)
+	if !ok || key == "" {
+		return handler(ctx, request)
+	}
+	if len(key) > middleware.MaxIdempotencyKeyLength {
+		return nil, middleware.ErrInvalidIdempotencyKey
+	}
+
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(request.(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := append([]byte(info.FullMethod+"\n"), payload...)
+
+	userId := actorFromContext(ctx).UserId
+	stored, reserved, err := s.idempotencyService.Begin(userId, key, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		grpc.SetHeader(ctx, metadata.Pairs(idempotentReplayedMetadata, "true"))
+		return replay(stored, newResponse())
+	}
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		// server errors and panics leave nothing worth replaying, so the key
+		// is freed for the client's retry
+		if err := s.idempotencyService.Release(userId, key); err != nil {
+			log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to release idempotency key for user [%d] due to: %s", userId, err.Error())).Send()
+		}
+	}()
+
+	response, callErr := handler(ctx, request)
+
+	statusCode := http.StatusOK
+	var body []byte
+	if callErr != nil {
+		statusCode = utils.AsError(callErr).Status()
+		if statusCode >= http.StatusInternalServerError {
+			return nil, callErr
+		}
+		body, err = proto.Marshal(statusOf(callErr).Proto())
+	} else {
+		body, err = proto.Marshal(response.(proto.Message))
+	}
+
+	// the call may have moved money, so a key whose answer cannot be stored
+	// stays reserved until it expires rather than letting a retry run twice
+	completed = true
+	if err == nil {
+		err = s.idempotencyService.Complete(userId, key, statusCode, body)
+	}
+	if err != nil {
+		log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to store idempotent response for user [%d] due to: %s", userId, err.Error())).Send()
+	}
+	return response, callErr
+}
+
+// replay decodes a stored answer: the response of a call that succeeded, or
+// the status of one refused with a client error.
+func replay(stored model.IdempotencyKey, response proto.Message) (any, error) {
+	if *stored.StatusCode >= http.StatusBadRequest {
+		var st status.Status
+		if err := proto.Unmarshal(stored.ResponseBody, &st); err != nil {
+			return nil, utils.Internal("The stored answer of the call could not be replayed", err)
+		}
+		return nil, grpcstatus.ErrorProto(&st)
+	}
+
+	if err := proto.Unmarshal(stored.ResponseBody, response); err != nil {
+		return nil, utils.Internal("The stored answer of the call could not be replayed", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+)
+
+const (
+	authorizationMetadata = "authorization"
+	requestIdMetadata     = "x-request-id"
+	userAgentMetadata     = "user-agent"
+)
+
+type actorContextKey struct{}
+
+// actorFromContext is who makes the call. The user is unknown until the call
+// is authenticated.
+func actorFromContext(ctx context.Context) model.Actor {
+	if actor, ok := ctx.Value(actorContextKey{}).(*model.Actor); ok {
+		return *actor
+	}
+	return model.Actor{Type: model.ActorTypeUser}
+}
+
+// auditUnary gives the call an ID, answers the errors it fails with as
+// statuses and audits the refused ones, like the Audit middleware does for
+// the REST routes.
+func (s *server) auditUnary(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, actor := s.startCall(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIdMetadata, actor.RequestId))
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		return nil, s.refuse(info.FullMethod, *actor, request, err)
+	}
+	return response, nil
+}
+
+func (s *server) auditStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, actor := s.startCall(stream.Context())
+	stream.SetHeader(metadata.Pairs(requestIdMetadata, actor.RequestId))
+
+	call := &serverStream{ServerStream: stream, ctx: ctx}
+	if err := handler(srv, call); err != nil {
+		return s.refuse(info.FullMethod, *actor, call.request, err)
+	}
+	return nil
+}
+
+// startCall adds the caller, so far known only by where the call came from,
+// to the context. Authentication fills in the user.
+func (s *server) startCall(ctx context.Context) (context.Context, *model.Actor) {
+	actor := &model.Actor{
+		Type:      model.ActorTypeUser,
+		IP:        peerIP(ctx),
+		UserAgent: firstMetadata(ctx, userAgentMetadata),
+		RequestId: middleware.RequestId(firstMetadata(ctx, requestIdMetadata)),
+	}
+	return context.WithValue(ctx, actorContextKey{}, actor), actor
+}
+
+// refuse turns the error a call failed with into its status, writing calls
+// refused as unauthenticated or unauthorized to the audit log.
+func (s *server) refuse(method string, actor model.Actor, request any, err error) error {
+	st := statusOf(err)
+	if st.Code() == codes.Internal {
+		log.Error().Str("error", "internal_error").Str("error_description", fmt.Sprintf("%s failed due to: %s", method, err.Error())).Send()
+	}
+	if st.Code() != codes.Unauthenticated && st.Code() != codes.PermissionDenied {
+		return st.Err()
+	}
+
+	action := model.AuditActionAccessDenied
+	if st.Code() == codes.Unauthenticated {
+		action = model.AuditActionAuthFailed
+	}
+	details, detailsErr := json.Marshal(map[string]interface{}{
+		"rpc":    method,
+		"status": st.Code().String(),
+		"code":   reasonOf(st),
+	})
+	entry := model.AuditEntry{Action: action, Details: string(details)}
+	if request, ok := request.(interface{ GetWalletId() int64 }); ok && request.GetWalletId() != 0 {
+		walletId := int(request.GetWalletId())
+		entry.WalletId = &walletId
+	}
+
+	recordErr := detailsErr
+	if recordErr == nil {
+		recordErr = s.auditService.Record(actor, entry)
+	}
+	if recordErr != nil {
+		log.Error().Str("error", "audit_failed").Str("error_description", fmt.Sprintf("Unable to audit refused call [%s] due to: %s", actor.RequestId, recordErr.Error())).Send()
+	}
+	return st.Err()
+}
+
+func (s *server) authenticateUnary(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+func (s *server) authenticateStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authenticate checks the bearer token in the authorization metadata, as the
+// OAuth middleware checks the Authorization header, and makes its user the
+// caller.
+func (s *server) authenticate(ctx context.Context) error {
+	token, ok := strings.CutPrefix(firstMetadata(ctx, authorizationMetadata), "Bearer ")
+	if !ok {
+		return middleware.ErrAuthorizationRequired
+	}
+	if token == "" || strings.Contains(token, " ") {
+		return middleware.ErrAuthorizationRequired.WithMessage("OAuth Bearer authorization invalid format")
+	}
+
+	userId, err := s.tokenService.Authenticate(token)
+	if err != nil {
+		return middleware.TokenError(err)
+	}
+
+	if actor, ok := ctx.Value(actorContextKey{}).(*model.Actor); ok {
+		actor.UserId = userId
+	}
+	return nil
+}
+
+// serverStream is a stream whose context carries the caller. It keeps the
+// first message received so a refused stream can be audited with the wallet
+// it asked for.
+type serverStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	request any
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) RecvMsg(m any) error {
+	err := ss.ServerStream.RecvMsg(m)
+	if err == nil && ss.request == nil {
+		ss.request = m
+	}
+	return err
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	values := metadata.ValueFromIncomingContext(ctx, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// peerIP is the address the call came from.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
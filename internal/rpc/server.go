@@ -0,0 +1,266 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"go-wallet-service/internal/middleware"
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/rpc/walletpb"
+	"go-wallet-service/internal/service"
+	"go-wallet-service/utils"
+)
+
+//go:generate protoc --proto_path=../../proto --go_out=walletpb --go_opt=paths=source_relative --go-grpc_out=walletpb --go-grpc_opt=paths=source_relative wallet/v1/wallet.proto
+
+var (
+	errInvalidType      = utils.Invalid("invalid_parameter", "type must be one of deposit, withdraw, transfer, reversal, fee, credit or debit")
+	errInvalidDirection = utils.Invalid("invalid_parameter", "direction must be incoming or outgoing")
+	errInvalidPageSize  = utils.Invalid("invalid_parameter", fmt.Sprintf("page_size must be between 1 and %d", service.MaxTransactionPageSize))
+)
+
+// server answers the WalletService calls with the services the REST routes
+// use, so a wallet behaves the same whichever API moves its money.
+type server struct {
+	walletpb.UnimplementedWalletServiceServer
+
+	tokenService       *service.TokenService
+	walletService      *service.WalletService
+	userService        *service.UserService
+	movementService    *service.MovementService
+	idempotencyService *service.IdempotencyService
+	auditService       *service.AuditService
+}
+
+// NewServer returns a gRPC server of the WalletService. Every call is
+// authenticated with the bearer token of the REST routes, and refused calls
+// are audited the same way.
+func NewServer(ts *service.TokenService, ws *service.WalletService, us *service.UserService, ms *service.MovementService, is *service.IdempotencyService, as *service.AuditService) *grpc.Server {
+	s := &server{
+		tokenService:       ts,
+		walletService:      ws,
+		userService:        us,
+		movementService:    ms,
+		idempotencyService: is,
+		auditService:       as,
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.auditUnary, s.authenticateUnary, s.idempotency),
+		grpc.ChainStreamInterceptor(s.auditStream, s.authenticateStream),
+	)
+	walletpb.RegisterWalletServiceServer(grpcServer, s)
+	return grpcServer
+}
+
+func (s *server) GetBalance(ctx context.Context, request *walletpb.GetBalanceRequest) (*walletpb.Balance, error) {
+	wallet, err := s.ownedWallet(ctx, request.WalletId)
+	if err != nil {
+		return nil, err
+	}
+	return s.balance(wallet.ID)
+}
+
+func (s *server) Deposit(ctx context.Context, request *walletpb.DepositRequest) (*walletpb.Balance, error) {
+	wallet, err := s.ownedWallet(ctx, request.WalletId)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := money.ParseDecimal(request.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.movementService.Deposit(actorFromContext(ctx), wallet, amount, request.Currency); err != nil {
+		return nil, err
+	}
+	return s.balance(wallet.ID)
+}
+
+func (s *server) Withdraw(ctx context.Context, request *walletpb.WithdrawRequest) (*walletpb.Balance, error) {
+	wallet, err := s.ownedWallet(ctx, request.WalletId)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := money.ParseDecimal(request.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.movementService.Withdraw(actorFromContext(ctx), wallet, amount, request.Currency); err != nil {
+		return nil, err
+	}
+	return s.balance(wallet.ID)
+}
+
+func (s *server) Transfer(ctx context.Context, request *walletpb.TransferRequest) (*walletpb.Balance, error) {
+	actor := actorFromContext(ctx)
+	senderWallet, err := s.walletService.GetUserWallet(actor.UserId, optionalId(request.SenderWalletId))
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := money.ParseDecimal(request.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.movementService.Transfer(actor, senderWallet, int(request.ReceiverUserId), optionalId(request.ReceiverWalletId), amount, request.Currency); err != nil {
+		return nil, err
+	}
+	return s.balance(senderWallet.ID)
+}
+
+func (s *server) ListTransactions(ctx context.Context, request *walletpb.ListTransactionsRequest) (*walletpb.ListTransactionsResponse, error) {
+	filter := model.TransactionFilter{Limit: service.DefaultTransactionPageSize}
+	if request.PageSize != 0 {
+		if request.PageSize < 0 || request.PageSize > service.MaxTransactionPageSize {
+			return nil, errInvalidPageSize
+		}
+		filter.Limit = int(request.PageSize)
+	}
+
+	switch request.Type {
+	case "", model.TransactionTypeDeposit, model.TransactionTypeWithdraw, model.TransactionTypeTransfer, model.TransactionTypeReversal, model.TransactionTypeFee, model.TransactionTypeCredit, model.TransactionTypeDebit:
+		filter.Type = request.Type
+	default:
+		return nil, errInvalidType
+	}
+
+	switch request.Direction {
+	case "", model.DirectionIncoming, model.DirectionOutgoing:
+		filter.Direction = request.Direction
+	default:
+		return nil, errInvalidDirection
+	}
+
+	if request.WalletId != nil {
+		wallet, err := s.ownedWallet(ctx, *request.WalletId)
+		if err != nil {
+			return nil, err
+		}
+		filter.WalletId = wallet.ID
+	}
+
+	page, err := s.userService.GetUserTransactions(actorFromContext(ctx).UserId, filter, request.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &walletpb.ListTransactionsResponse{
+		Transactions:  make([]*walletpb.Transaction, len(page.Entries)),
+		NextPageToken: page.NextCursor,
+	}
+	for i, entry := range page.Entries {
+		response.Transactions[i] = mapTransaction(entry)
+	}
+	return response, nil
+}
+
+// ownedWallet returns the wallet when it belongs to the caller, as the
+// WalletOwner middleware does for the REST routes.
+func (s *server) ownedWallet(ctx context.Context, walletId int64) (model.Wallet, error) {
+	wallet, err := s.walletService.GetById(int(walletId))
+	if err != nil {
+		return model.Wallet{}, err
+	}
+
+	actor := actorFromContext(ctx)
+	if wallet.UserId != actor.UserId {
+		log.Error().Str("error", "invalid_authorization").Str("error_description", fmt.Sprintf("User [%d] is not the owner of wallet [%d]", actor.UserId, walletId)).Send()
+		return model.Wallet{}, middleware.ErrNotWalletOwner
+	}
+	return wallet, nil
+}
+
+func (s *server) balance(walletId int) (*walletpb.Balance, error) {
+	wallet, err := s.walletService.GetById(walletId)
+	if err != nil {
+		return nil, err
+	}
+
+	available, err := s.walletService.GetAvailableBalance(walletId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletpb.Balance{
+		WalletId:         int64(wallet.ID),
+		Balance:          mapMoney(wallet.Balance),
+		AvailableBalance: mapMoney(available),
+	}, nil
+}
+
+func optionalId(id *int64) *int {
+	if id == nil {
+		return nil
+	}
+	value := int(*id)
+	return &value
+}
+
+func mapMoney(amount money.Money) *walletpb.Money {
+	return &walletpb.Money{Amount: amount.String(), Currency: amount.Currency.String()}
+}
+
+func optionalMoney(amount *money.Money) *walletpb.Money {
+	if amount == nil {
+		return nil
+	}
+	return mapMoney(*amount)
+}
+
+func optionalInt64(value *int) *int64 {
+	if value == nil {
+		return nil
+	}
+	converted := int64(*value)
+	return &converted
+}
+
+// mapTransaction is the entry as the wallet saw it, like the REST history
+// shows it: the amount without sign, and for a cross-currency transfer the
+// side the wallet did not see.
+func mapTransaction(entry model.TransactionEntry) *walletpb.Transaction {
+	amount := entry.EntryAmount
+	if amount.IsNegative() {
+		amount = amount.Neg()
+	}
+
+	var convertedAmount *money.Money
+	if entry.DestinationAmount != nil {
+		convertedAmount = entry.DestinationAmount
+		if entry.Direction() == model.DirectionIncoming {
+			convertedAmount = &entry.Amount
+		}
+	}
+
+	transaction := &walletpb.Transaction{
+		Id:              int64(entry.ID),
+		EntryId:         int64(entry.EntryId),
+		Type:            entry.Type,
+		Direction:       entry.Direction(),
+		WalletId:        int64(entry.WalletId),
+		Amount:          mapMoney(amount),
+		ConvertedAmount: optionalMoney(convertedAmount),
+		ReversalOf:      optionalInt64(entry.ReversalOf),
+		FeeOf:           optionalInt64(entry.FeeOf),
+		ReversedAmount:  optionalMoney(entry.ReversedAmount),
+		Balance:         mapMoney(entry.BalanceAfter),
+		TransactionDate: timestamppb.New(entry.CreationDate),
+	}
+	if entry.ExchangeRate != nil {
+		transaction.ExchangeRate = entry.ExchangeRate.String()
+	}
+	if entry.Counterparty != nil {
+		transaction.Counterparty = *entry.Counterparty
+	}
+	return transaction
+}
@@ -0,0 +1,436 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+	"go-wallet-service/internal/rpc/walletpb"
+	"go-wallet-service/internal/service"
+)
+
+// fakeUserRepository pages through the seeded entries and counts transfers.
+// Its other methods are not called by the WalletService.
+type fakeUserRepository struct {
+	repository.UserRepository
+	entries      []model.TransactionEntry
+	lastTransfer [2]int
+}
+
+func (f *fakeUserRepository) GetUserTransactionsByUserId(userId int, filter model.TransactionFilter) ([]model.TransactionEntry, error) {
+	var entries []model.TransactionEntry
+	for i := range f.entries {
+		entry := f.entries[len(f.entries)-1-i]
+		if filter.OldestFirst {
+			entry = f.entries[i]
+		}
+		if filter.WalletId != 0 && entry.WalletId != filter.WalletId {
+			continue
+		}
+		if filter.BeforeEntryId != 0 && entry.EntryId >= filter.BeforeEntryId || entry.EntryId <= filter.AfterEntryId {
+			continue
+		}
+		if len(entries) == filter.Limit {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (f *fakeUserRepository) Transfer(actor model.Actor, senderWalletId int, receiverWalletId int, amount money.Money, conversion *model.Conversion, fee *model.Fee, check repository.MovementCheck) error {
+	f.lastTransfer = [2]int{senderWalletId, receiverWalletId}
+	return nil
+}
+
+// fakeWalletRepository moves the balance of its wallets on every update.
+type fakeWalletRepository struct {
+	repository.WalletRepository
+	wallets map[int]model.Wallet
+	updates int
+}
+
+func (f *fakeWalletRepository) GetById(walletId int) (model.Wallet, error) {
+	wallet, ok := f.wallets[walletId]
+	if !ok {
+		return model.Wallet{}, sql.ErrNoRows
+	}
+	return wallet, nil
+}
+
+func (f *fakeWalletRepository) GetAvailableBalance(walletId int) (money.Money, error) {
+	return f.wallets[walletId].Balance, nil
+}
+
+func (f *fakeWalletRepository) GetDefaultWalletByUserId(userId int) (model.Wallet, error) {
+	for _, wallet := range f.wallets {
+		if wallet.UserId == userId && wallet.IsDefault {
+			return wallet, nil
+		}
+	}
+	return model.Wallet{}, sql.ErrNoRows
+}
+
+func (f *fakeWalletRepository) Update(actor model.Actor, walletId int, amount money.Money, transactionType string, fee *model.Fee, check repository.MovementCheck) (model.Wallet, error) {
+	wallet := f.wallets[walletId]
+	if check != nil {
+		if err := check(wallet, fakeLimitRepository{}); err != nil {
+			return model.Wallet{}, err
+		}
+	}
+	f.updates++
+	if transactionType == model.TransactionTypeWithdraw {
+		amount = amount.Neg()
+	}
+	wallet.Balance, _ = wallet.Balance.Add(amount)
+	f.wallets[walletId] = wallet
+	return wallet, nil
+}
+
+type fakeTokenRepository struct {
+	repository.TokenRepository
+	tokens map[string]model.OAuthToken
+}
+
+func (f *fakeTokenRepository) GetByHash(tokenHash string) (model.OAuthToken, error) {
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return model.OAuthToken{}, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+// fakeIdempotencyRepository keeps the keys of a test in memory.
+type fakeIdempotencyRepository struct {
+	keys map[string]model.IdempotencyKey
+}
+
+func (f *fakeIdempotencyRepository) Reserve(userId int, key string, requestHash string, expiryDate time.Time) (model.IdempotencyKey, bool, error) {
+	id := fmt.Sprintf("%d/%s", userId, key)
+	if stored, ok := f.keys[id]; ok {
+		return stored, false, nil
+	}
+	f.keys[id] = model.IdempotencyKey{UserId: userId, Key: key, RequestHash: requestHash, ExpiryDate: expiryDate}
+	return f.keys[id], true, nil
+}
+
+func (f *fakeIdempotencyRepository) Complete(userId int, key string, statusCode int, responseBody []byte) error {
+	id := fmt.Sprintf("%d/%s", userId, key)
+	stored := f.keys[id]
+	stored.StatusCode, stored.ResponseBody = &statusCode, responseBody
+	f.keys[id] = stored
+	return nil
+}
+
+func (f *fakeIdempotencyRepository) Release(userId int, key string) error {
+	delete(f.keys, fmt.Sprintf("%d/%s", userId, key))
+	return nil
+}
+
+// fakeLimitRepository caps deposits at 500.00 a transaction.
+type fakeLimitRepository struct{}
+
+func (fakeLimitRepository) GetLimits(wallet model.Wallet, operation string) ([]model.TransactionLimit, error) {
+	if operation != model.TransactionTypeDeposit {
+		return nil, nil
+	}
+	return []model.TransactionLimit{{Operation: operation, Period: model.LimitPeriodTransaction, Amount: money.NewDecimal(500, 0)}}, nil
+}
+
+func (fakeLimitRepository) GetUsage(wallet model.Wallet, scope string, operation string, window time.Duration) (model.LimitUsage, error) {
+	return model.LimitUsage{Total: money.New(0, wallet.Currency)}, nil
+}
+
+type fakeFeeRepository struct{}
+
+func (fakeFeeRepository) GetRules(transactionType string, currency money.Currency) ([]model.FeeRule, error) {
+	return nil, nil
+}
+
+type fakeAuditRepository struct {
+	repository.AuditRepository
+	entries []model.AuditEntry
+}
+
+func (f *fakeAuditRepository) Append(actor model.Actor, entry model.AuditEntry) (model.AuditEntry, error) {
+	entry = entry.By(actor)
+	f.entries = append(f.entries, entry)
+	return entry, nil
+}
+
+type testServer struct {
+	client  walletpb.WalletServiceClient
+	users   *fakeUserRepository
+	wallets *fakeWalletRepository
+	audit   *fakeAuditRepository
+}
+
+// newTestServer serves the WalletService over an in-memory connection to two
+// users: user 1 owns wallet 1 and user 2 owns wallet 2, and their access
+// tokens are "token-user-1" and "token-user-2".
+func newTestServer(t *testing.T) testServer {
+	userRepository := &fakeUserRepository{}
+	walletRepository := &fakeWalletRepository{wallets: map[int]model.Wallet{
+		1: {ID: 1, UserId: 1, Name: "main", IsDefault: true, Currency: money.DefaultCurrency, Balance: money.New(10000, money.DefaultCurrency), Status: model.StatusActive},
+		2: {ID: 2, UserId: 2, Name: "main", IsDefault: true, Currency: money.DefaultCurrency, Balance: money.New(20000, money.DefaultCurrency), Status: model.StatusActive},
+	}}
+	tokenRepository := &fakeTokenRepository{tokens: map[string]model.OAuthToken{}}
+	for userId, token := range map[int]string{1: "token-user-1", 2: "token-user-2"} {
+		tokenRepository.tokens[service.HashToken(token)] = model.OAuthToken{UserId: userId, Type: model.TokenTypeAccess, ExpiryDate: time.Now().Add(time.Hour)}
+	}
+	auditRepository := &fakeAuditRepository{}
+
+	walletHub := service.NewWalletHub()
+	ws := service.NewWalletService(walletRepository, walletHub)
+	us := service.NewUserService(userRepository, nil, walletHub)
+	server := NewServer(
+		service.NewTokenService(tokenRepository, time.Minute, time.Hour),
+		ws,
+		us,
+		service.NewMovementService(ws, us, service.NewLimitService(fakeLimitRepository{}), service.NewFeeService(fakeFeeRepository{}, walletRepository, 0)),
+		service.NewIdempotencyService(&fakeIdempotencyRepository{keys: map[string]model.IdempotencyKey{}}, time.Hour),
+		service.NewAuditService(auditRepository),
+	)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	connection, err := grpc.NewClient("passthrough:///wallet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connection.Close() })
+
+	return testServer{client: walletpb.NewWalletServiceClient(connection), users: userRepository, wallets: walletRepository, audit: auditRepository}
+}
+
+// withToken adds the bearer token, and any other metadata pairs, to the
+// outgoing metadata.
+func withToken(token string, pairs ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), append([]string{"authorization", "Bearer " + token}, pairs...)...)
+}
+
+// errorInfo is the ErrorInfo detail of the status err carries.
+func errorInfo(t *testing.T, err error) *errdetails.ErrorInfo {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return nil
+}
+
+func TestCallsRequireToken(t *testing.T) {
+	ts := newTestServer(t)
+
+	_, err := ts.client.GetBalance(context.Background(), &walletpb.GetBalanceRequest{WalletId: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "authorization_required", errorInfo(t, err).Reason)
+
+	_, err = ts.client.GetBalance(withToken("token-unknown"), &walletpb.GetBalanceRequest{WalletId: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "token_invalid", errorInfo(t, err).Reason)
+
+	if assert.Len(t, ts.audit.entries, 2) {
+		entry := ts.audit.entries[0]
+		assert.Equal(t, model.AuditActionAuthFailed, entry.Action)
+		assert.Nil(t, entry.ActorUserId)
+		assert.Equal(t, 1, *entry.WalletId)
+		assert.JSONEq(t, `{"rpc":"/wallet.v1.WalletService/GetBalance","status":"Unauthenticated","code":"authorization_required"}`, entry.Details)
+		assert.NotEmpty(t, entry.RequestId)
+	}
+}
+
+func TestBalanceOfOwnWallet(t *testing.T) {
+	ts := newTestServer(t)
+
+	var header metadata.MD
+	ctx := withToken("token-user-1", "x-request-id", "req-42")
+	balance, err := ts.client.GetBalance(ctx, &walletpb.GetBalanceRequest{WalletId: 1}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), balance.WalletId)
+	assert.Equal(t, "100.00", balance.Balance.Amount)
+	assert.Equal(t, "USD", balance.AvailableBalance.Currency)
+	assert.Equal(t, []string{"req-42"}, header.Get("x-request-id"))
+}
+
+func TestWalletOfAnotherUserIsDenied(t *testing.T) {
+	ts := newTestServer(t)
+
+	_, err := ts.client.Deposit(withToken("token-user-1"), &walletpb.DepositRequest{WalletId: 2, Amount: "10"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "invalid_authorization", errorInfo(t, err).Reason)
+	assert.Zero(t, ts.wallets.updates)
+
+	stream, err := ts.client.WatchWallet(withToken("token-user-1"), &walletpb.WatchWalletRequest{WalletId: 2})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	if assert.Len(t, ts.audit.entries, 2) {
+		for _, entry := range ts.audit.entries {
+			assert.Equal(t, model.AuditActionAccessDenied, entry.Action)
+			assert.Equal(t, 1, *entry.ActorUserId)
+			assert.Equal(t, 2, *entry.WalletId)
+		}
+	}
+}
+
+func TestErrorsKeepTheirCode(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := withToken("token-user-1")
+
+	_, err := ts.client.GetBalance(ctx, &walletpb.GetBalanceRequest{WalletId: 99})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = ts.client.Deposit(ctx, &walletpb.DepositRequest{WalletId: 1, Amount: "10", Currency: "EUR"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "currency_mismatch", errorInfo(t, err).Reason)
+
+	_, err = ts.client.Withdraw(ctx, &walletpb.WithdrawRequest{WalletId: 1, Amount: "0"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "invalid_amount", errorInfo(t, err).Reason)
+
+	_, err = ts.client.Deposit(ctx, &walletpb.DepositRequest{WalletId: 1, Amount: "500.01"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	info := errorInfo(t, err)
+	assert.Equal(t, "limit_exceeded", info.Reason)
+	assert.Contains(t, info.Metadata["limit"], `"period":"transaction"`)
+
+	_, err = ts.client.ListTransactions(ctx, &walletpb.ListTransactionsRequest{Direction: "sideways"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Zero(t, ts.wallets.updates)
+}
+
+func TestDepositReplaysIdempotentCall(t *testing.T) {
+	ts := newTestServer(t)
+
+	first, err := ts.client.Deposit(withToken("token-user-1", "idempotency-key", "deposit-1"), &walletpb.DepositRequest{WalletId: 1, Amount: "25.50"})
+	assert.NoError(t, err)
+	assert.Equal(t, "125.50", first.Balance.Amount)
+
+	var header metadata.MD
+	replayed, err := ts.client.Deposit(withToken("token-user-1", "idempotency-key", "deposit-1"), &walletpb.DepositRequest{WalletId: 1, Amount: "25.50"}, grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.Equal(t, "125.50", replayed.Balance.Amount)
+	assert.Equal(t, []string{"true"}, header.Get("idempotent-replayed"))
+	assert.Equal(t, 1, ts.wallets.updates)
+
+	_, err = ts.client.Deposit(withToken("token-user-1", "idempotency-key", "deposit-1"), &walletpb.DepositRequest{WalletId: 1, Amount: "30"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "idempotency_key_reused", errorInfo(t, err).Reason)
+
+	// a refusal is replayed too, without being run again
+	_, err = ts.client.Withdraw(withToken("token-user-1", "idempotency-key", "withdraw-1"), &walletpb.WithdrawRequest{WalletId: 1, Amount: "10", Currency: "EUR"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = ts.client.Withdraw(withToken("token-user-1", "idempotency-key", "withdraw-1"), &walletpb.WithdrawRequest{WalletId: 1, Amount: "10", Currency: "EUR"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "currency_mismatch", errorInfo(t, err).Reason)
+}
+
+func TestTransferFromDefaultWallet(t *testing.T) {
+	ts := newTestServer(t)
+
+	balance, err := ts.client.Transfer(withToken("token-user-1"), &walletpb.TransferRequest{ReceiverUserId: 2, Amount: "10"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), balance.WalletId)
+	assert.Equal(t, [2]int{1, 2}, ts.users.lastTransfer)
+
+	sender := int64(2)
+	_, err = ts.client.Transfer(withToken("token-user-1"), &walletpb.TransferRequest{SenderWalletId: &sender, ReceiverUserId: 2, Amount: "10"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "wallet_not_owned", errorInfo(t, err).Reason)
+}
+
+func TestListTransactionsPages(t *testing.T) {
+	ts := newTestServer(t)
+	for id := 1; id <= 3; id++ {
+		ts.users.entries = append(ts.users.entries, walletEntry(id, 1))
+	}
+
+	walletId := int64(1)
+	page, err := ts.client.ListTransactions(withToken("token-user-1"), &walletpb.ListTransactionsRequest{WalletId: &walletId, PageSize: 2})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Transactions, 2) {
+		assert.Equal(t, int64(3), page.Transactions[0].EntryId)
+		assert.Equal(t, "incoming", page.Transactions[0].Direction)
+		assert.Equal(t, "1.00", page.Transactions[0].Amount.Amount)
+	}
+	assert.NotEmpty(t, page.NextPageToken)
+
+	page, err = ts.client.ListTransactions(withToken("token-user-1"), &walletpb.ListTransactionsRequest{WalletId: &walletId, PageSize: 2, PageToken: page.NextPageToken})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Transactions, 1) {
+		assert.Equal(t, int64(1), page.Transactions[0].EntryId)
+	}
+	assert.Empty(t, page.NextPageToken)
+
+	walletId = 2
+	_, err = ts.client.ListTransactions(withToken("token-user-1"), &walletpb.ListTransactionsRequest{WalletId: &walletId})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestWatchWalletSendsNewTransactions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.users.entries = append(ts.users.entries, walletEntry(1, 1))
+
+	ctx, cancel := context.WithCancel(withToken("token-user-1"))
+	defer cancel()
+	stream, err := ts.client.WatchWallet(ctx, &walletpb.WatchWalletRequest{WalletId: 1})
+	assert.NoError(t, err)
+
+	event, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "100.00", event.GetBalance().GetBalance().GetAmount())
+
+	ts.users.entries = append(ts.users.entries, walletEntry(2, 1))
+	_, err = ts.client.Deposit(withToken("token-user-1"), &walletpb.DepositRequest{WalletId: 1, Amount: "1"})
+	assert.NoError(t, err)
+
+	event, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), event.GetTransaction().GetEntryId())
+	event, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "101.00", event.GetBalance().GetBalance().GetAmount())
+
+	// a client that comes back is sent what it missed first
+	resumed, err := ts.client.WatchWallet(ctx, &walletpb.WatchWalletRequest{WalletId: 1, AfterEntryId: 1})
+	assert.NoError(t, err)
+	event, err = resumed.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), event.GetTransaction().GetEntryId())
+}
+
+// walletEntry is a deposit of 1.00 into the wallet, recorded as its ledger
+// entry entryId.
+func walletEntry(entryId int, walletId int) model.TransactionEntry {
+	amount := money.New(100, money.DefaultCurrency)
+	return model.TransactionEntry{
+		Transaction:  model.Transaction{ID: 100 + entryId, Type: model.TransactionTypeDeposit, Amount: amount, Currency: amount.Currency, CreationDate: time.Now()},
+		EntryId:      entryId,
+		WalletId:     walletId,
+		EntryAmount:  amount,
+		BalanceAfter: amount,
+	}
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go-wallet-service/utils"
+)
+
+// errorDomain names the service in the ErrorInfo of the statuses it answers
+// with.
+const errorDomain = "go-wallet-service"
+
+var kindCodes = map[utils.ErrorKind]codes.Code{
+	utils.KindInternal:          codes.Internal,
+	utils.KindValidation:        codes.InvalidArgument,
+	utils.KindUnauthorized:      codes.Unauthenticated,
+	utils.KindForbidden:         codes.PermissionDenied,
+	utils.KindInsufficientFunds: codes.FailedPrecondition,
+	utils.KindNotFound:          codes.NotFound,
+	utils.KindConflict:          codes.Aborted,
+	utils.KindUnprocessable:     codes.FailedPrecondition,
+}
+
+// statusOf is the status a call failing with err is answered with. A catalog
+// error keeps its code as the reason of an ErrorInfo detail, whose metadata
+// holds the members its problem response would carry, encoded as JSON.
+func statusOf(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+
+	appErr := utils.AsError(err)
+	st := status.New(kindCodes[appErr.Kind], appErr.Message)
+
+	info := &errdetails.ErrorInfo{Reason: appErr.Code, Domain: errorDomain}
+	for key, value := range appErr.Extensions {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		if info.Metadata == nil {
+			info.Metadata = make(map[string]string, len(appErr.Extensions))
+		}
+		info.Metadata[key] = string(encoded)
+	}
+
+	detailed, err := st.WithDetails(info)
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+// reasonOf is the error code the status was answered with.
+func reasonOf(st *status.Status) string {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == errorDomain {
+			return info.Reason
+		}
+	}
+	return ""
+}
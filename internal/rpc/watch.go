@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"time"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/rpc/walletpb"
+	"go-wallet-service/utils"
+)
+
+const (
+	// watchCatchUpInterval is how often a quiet watch looks for transactions
+	// made by other replicas of the service, whose changes this one is not
+	// told.
+	watchCatchUpInterval = 15 * time.Second
+	watchPageSize        = 100
+)
+
+var errInvalidAfterEntryId = utils.Invalid("invalid_parameter", "after_entry_id must not be negative")
+
+// WatchWallet streams the new transactions of a wallet, each followed by its
+// balance, until the client cancels the call. The stream starts with the
+// balance, after the transactions made since after_entry_id when it is set.
+func (s *server) WatchWallet(request *walletpb.WatchWalletRequest, stream walletpb.WalletService_WatchWalletServer) error {
+	if request.AfterEntryId < 0 {
+		return errInvalidAfterEntryId
+	}
+
+	wallet, err := s.ownedWallet(stream.Context(), request.WalletId)
+	if err != nil {
+		return err
+	}
+
+	// subscribing before reading the ledger misses no change in between
+	changes, unsubscribe := s.walletService.Subscribe(wallet.ID)
+	defer unsubscribe()
+
+	lastEntryId := int(request.AfterEntryId)
+	if lastEntryId == 0 {
+		lastEntryId, err = s.userService.LastWalletEntryId(wallet)
+		if err != nil {
+			return err
+		}
+	}
+
+	catchUp := time.NewTicker(watchCatchUpInterval)
+	defer catchUp.Stop()
+
+	sendBalance := true
+	for {
+		lastEntryId, err = s.sendWalletEvents(stream, wallet, lastEntryId, sendBalance)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-changes:
+			sendBalance = true
+		case <-catchUp.C:
+			sendBalance = false
+		}
+	}
+}
+
+// sendWalletEvents sends the transactions of the wallet made after entry
+// lastEntryId, followed by its balance when there were any or sendBalance is
+// set. It returns the ID of the last entry sent.
+func (s *server) sendWalletEvents(stream walletpb.WalletService_WatchWalletServer, wallet model.Wallet, lastEntryId int, sendBalance bool) (int, error) {
+	for {
+		entries, err := s.userService.GetWalletEntriesAfter(wallet, lastEntryId, watchPageSize)
+		if err != nil {
+			return lastEntryId, err
+		}
+		for _, entry := range entries {
+			event := &walletpb.WalletEvent{Event: &walletpb.WalletEvent_Transaction{Transaction: mapTransaction(entry)}}
+			if err := stream.Send(event); err != nil {
+				return lastEntryId, err
+			}
+			lastEntryId = entry.EntryId
+			sendBalance = true
+		}
+		if len(entries) < watchPageSize {
+			break
+		}
+	}
+
+	if !sendBalance {
+		return lastEntryId, nil
+	}
+	balance, err := s.balance(wallet.ID)
+	if err != nil {
+		return lastEntryId, err
+	}
+	return lastEntryId, stream.Send(&walletpb.WalletEvent{Event: &walletpb.WalletEvent_Balance{Balance: balance}})
+}
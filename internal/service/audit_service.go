@@ -0,0 +1,38 @@
+package service
+
+import (
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/repository"
+)
+
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 200
+)
+
+type AuditService struct {
+	auditRepository repository.AuditRepository
+}
+
+func NewAuditService(auditRepository repository.AuditRepository) *AuditService {
+	return &AuditService{auditRepository: auditRepository}
+}
+
+// Record appends the entry to the audit log on behalf of actor.
+func (as *AuditService) Record(actor model.Actor, entry model.AuditEntry) error {
+	_, err := as.auditRepository.Append(actor, entry)
+	return err
+}
+
+// List returns the audit entries matching filter, newest first.
+func (as *AuditService) List(filter model.AuditFilter) ([]model.AuditEntry, error) {
+	if filter.Limit <= 0 || filter.Limit > MaxAuditPageSize {
+		return nil, ErrInvalidPageSize
+	}
+	return as.auditRepository.List(filter)
+}
+
+// Verify checks the hash chain of the whole audit log.
+func (as *AuditService) Verify() (model.AuditVerification, error) {
+	return as.auditRepository.Verify()
+}
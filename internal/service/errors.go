@@ -0,0 +1,27 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrUserNotFound        = utils.NotFound("user_not_found", "the user does not exist")
+	ErrWalletNotFound      = utils.NotFound("wallet_not_found", "the wallet does not exist")
+	ErrTransactionNotFound = utils.NotFound("transaction_not_found", "the transaction does not exist")
+	ErrHoldNotFound        = utils.NotFound("hold_not_found", "the hold does not exist")
+	ErrScheduleNotFound    = utils.NotFound("schedule_not_found", "the schedule does not exist")
+	ErrWebhookNotFound     = utils.NotFound("webhook_not_found", "the webhook endpoint does not exist")
+	ErrDeliveryNotFound    = utils.NotFound("delivery_not_found", "the webhook delivery does not exist")
+)
+
+// notFound reports a missing row as the catalog error for it and leaves any
+// other error as it is.
+func notFound(err error, missing *utils.Error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return missing
+	}
+	return err
+}
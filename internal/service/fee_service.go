@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+	"go-wallet-service/utils"
+)
+
+// ErrNoHouseWallet causes the internal error a fee fails with when the house
+// user has no wallet in its currency: the service is misconfigured, and
+// nothing the client changes makes the operation go through.
+var ErrNoHouseWallet = errors.New("no house wallet in the currency")
+
+// feeTypes are the transaction types fees are charged on.
+var feeTypes = map[string]bool{
+	model.TransactionTypeWithdraw: true,
+	model.TransactionTypeTransfer: true,
+}
+
+type FeeService struct {
+	feeRepository    repository.FeeRepository
+	walletRepository repository.WalletRepository
+	houseUserId      int
+}
+
+// NewFeeService charges fees into the wallets of the house user. No fees are
+// charged when houseUserId is zero.
+func NewFeeService(feeRepository repository.FeeRepository, walletRepository repository.WalletRepository, houseUserId int) *FeeService {
+	return &FeeService{feeRepository: feeRepository, walletRepository: walletRepository, houseUserId: houseUserId}
+}
+
+// Quote prices an operation of the given type taking amount from the wallet:
+// the fee on it and the total the wallet pays.
+func (fs *FeeService) Quote(wallet model.Wallet, transactionType string, amount money.Money) (model.FeeQuote, error) {
+	fee := money.New(0, wallet.Currency)
+	if fs.houseUserId != 0 && wallet.UserId != fs.houseUserId && feeTypes[transactionType] {
+		rules, err := fs.feeRepository.GetRules(transactionType, wallet.Currency)
+		if err != nil {
+			return model.FeeQuote{}, err
+		}
+		if rule, ok := feeRule(rules, amount); ok {
+			fee, err = ruleFee(rule, amount)
+			if err != nil {
+				return model.FeeQuote{}, err
+			}
+		}
+	}
+
+	total, err := amount.Add(fee)
+	if err != nil {
+		return model.FeeQuote{}, err
+	}
+	return model.FeeQuote{TransactionType: transactionType, Amount: amount, Fee: fee, Total: total}, nil
+}
+
+// Fee returns the fee to charge on an operation of the given type taking
+// amount from the wallet, or nil when it is free.
+func (fs *FeeService) Fee(wallet model.Wallet, transactionType string, amount money.Money) (*model.Fee, error) {
+	quote, err := fs.Quote(wallet, transactionType, amount)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Fee.IsZero() {
+		return nil, nil
+	}
+
+	houseWallets, err := fs.walletRepository.GetWalletByUserId(fs.houseUserId)
+	if err != nil {
+		return nil, err
+	}
+	for _, houseWallet := range houseWallets {
+		if houseWallet.Currency == wallet.Currency {
+			return &model.Fee{Amount: quote.Fee, HouseWalletId: houseWallet.ID}, nil
+		}
+	}
+	return nil, utils.Internal("Unable to charge the fee", fmt.Errorf("%w: %s", ErrNoHouseWallet, wallet.Currency))
+}
+
+// feeRule picks the tier amount falls in, the rule with the highest minimum
+// it reaches. Rules in the amount's currency, when there are any, replace
+// those for any currency.
+func feeRule(rules []model.FeeRule, amount money.Money) (model.FeeRule, bool) {
+	schedule := rules[:0:0]
+	for _, rule := range rules {
+		if rule.Currency != nil {
+			schedule = append(schedule, rule)
+		}
+	}
+	if len(schedule) == 0 {
+		schedule = rules
+	}
+
+	var found bool
+	var best model.FeeRule
+	for _, rule := range schedule {
+		if rule.MinAmount.Cmp(amount.Decimal()) > 0 {
+			continue
+		}
+		if !found || rule.MinAmount.Cmp(best.MinAmount) > 0 {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// ruleFee is the flat part of the rule plus its rate of amount, rounded half
+// up to the currency's minor unit and held to the rule's cap.
+func ruleFee(rule model.FeeRule, amount money.Money) (money.Money, error) {
+	flat, err := money.RoundDecimal(rule.Flat, amount.Currency, money.RoundHalfUp)
+	if err != nil {
+		return money.Money{}, err
+	}
+	variable, err := amount.Mul(rule.Rate, money.RoundHalfUp)
+	if err != nil {
+		return money.Money{}, err
+	}
+	fee, err := flat.Add(variable)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	if rule.Cap != nil {
+		maximum, err := money.RoundDecimal(*rule.Cap, amount.Currency, money.RoundDown)
+		if err != nil {
+			return money.Money{}, err
+		}
+		if maximum.LessThan(fee) {
+			fee = maximum
+		}
+	}
+	return fee, nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+	"go-wallet-service/utils"
+)
+
+// fakeFeeRepository serves the rules of a test, filtered like the table is.
+type fakeFeeRepository struct {
+	rules []model.FeeRule
+}
+
+func (f *fakeFeeRepository) GetRules(transactionType string, currency money.Currency) ([]model.FeeRule, error) {
+	var rules []model.FeeRule
+	for _, rule := range f.rules {
+		if rule.TransactionType == transactionType && (rule.Currency == nil || *rule.Currency == currency) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// houseWallets serves the wallets of the house user.
+type houseWallets struct {
+	repository.WalletRepository
+	wallets []model.Wallet
+}
+
+func (h houseWallets) GetWalletByUserId(userId int) ([]model.Wallet, error) {
+	return h.wallets, nil
+}
+
+func TestQuotePicksTierAndRoundsAndCaps(t *testing.T) {
+	eur := money.Currency("EUR")
+	fees := &fakeFeeRepository{rules: []model.FeeRule{
+		{TransactionType: model.TransactionTypeWithdraw, Flat: money.NewDecimal(25, 2), Rate: money.NewDecimal(1, 2)},
+		{TransactionType: model.TransactionTypeWithdraw, MinAmount: money.NewDecimal(1000, 0), Rate: money.NewDecimal(5, 3), Cap: decimalPtr(money.NewDecimal(8, 0))},
+		{TransactionType: model.TransactionTypeWithdraw, Currency: &eur, Flat: money.NewDecimal(1, 0)},
+	}}
+	feeService := NewFeeService(fees, houseWallets{}, 1)
+	wallet := model.Wallet{ID: 2, UserId: 2, Currency: "USD"}
+
+	for name, tc := range map[string]struct {
+		wallet model.Wallet
+		amount money.Money
+		fee    money.Money
+	}{
+		"flat and rate":          {wallet, money.New(1000, "USD"), money.New(35, "USD")},
+		"rate rounded half up":   {wallet, money.New(50, "USD"), money.New(26, "USD")},
+		"higher tier capped":     {wallet, money.New(200000, "USD"), money.New(800, "USD")},
+		"higher tier under cap":  {wallet, money.New(100000, "USD"), money.New(500, "USD")},
+		"currency rule replaces": {model.Wallet{ID: 3, UserId: 2, Currency: eur}, money.New(200000, eur), money.New(100, eur)},
+		"house pays no fee":      {model.Wallet{ID: 1, UserId: 1, Currency: "USD"}, money.New(1000, "USD"), money.New(0, "USD")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			quote, err := feeService.Quote(tc.wallet, model.TransactionTypeWithdraw, tc.amount)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.fee, quote.Fee)
+			total, _ := tc.amount.Add(tc.fee)
+			assert.Equal(t, total, quote.Total)
+		})
+	}
+
+	quote, err := feeService.Quote(wallet, model.TransactionTypeTransfer, money.New(1000, "USD"))
+	assert.NoError(t, err)
+	assert.True(t, quote.Fee.IsZero())
+}
+
+func TestFeePaysIntoHouseWalletOfCurrency(t *testing.T) {
+	fees := &fakeFeeRepository{rules: []model.FeeRule{
+		{TransactionType: model.TransactionTypeTransfer, Rate: money.NewDecimal(1, 2)},
+	}}
+	house := houseWallets{wallets: []model.Wallet{{ID: 1, UserId: 1, Currency: "USD"}, {ID: 5, UserId: 1, Currency: "EUR"}}}
+	feeService := NewFeeService(fees, house, 1)
+
+	fee, err := feeService.Fee(model.Wallet{ID: 3, UserId: 2, Currency: "EUR"}, model.TransactionTypeTransfer, money.New(1000, "EUR"))
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Fee{Amount: money.New(10, "EUR"), HouseWalletId: 5}, fee)
+
+	_, err = feeService.Fee(model.Wallet{ID: 4, UserId: 2, Currency: "JPY"}, model.TransactionTypeTransfer, money.New(1000, "JPY"))
+	assert.ErrorIs(t, err, ErrNoHouseWallet)
+	assert.Equal(t, utils.KindInternal, utils.AsError(err).Kind)
+
+	fee, err = NewFeeService(fees, house, 0).Fee(model.Wallet{ID: 3, UserId: 2, Currency: "EUR"}, model.TransactionTypeTransfer, money.New(1000, "EUR"))
+	assert.NoError(t, err)
+	assert.Nil(t, fee)
+}
+
+func decimalPtr(d money.Decimal) *money.Decimal {
+	return &d
+}
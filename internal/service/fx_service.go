@@ -0,0 +1,120 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+var ErrRateUnavailable = utils.Unprocessable("rate_unavailable", "no exchange rate for the currency pair")
+
+// FXRateProvider quotes exchange rates: the number of units of quote one unit
+// of base buys.
+type FXRateProvider interface {
+	Rate(base money.Currency, quote money.Currency) (money.Decimal, error)
+}
+
+type tableRateProvider struct {
+	fxRateRepository repository.FXRateRepository
+}
+
+// NewTableRateProvider quotes the rates kept in the fx_rates table.
+func NewTableRateProvider(fxRateRepository repository.FXRateRepository) FXRateProvider {
+	return &tableRateProvider{fxRateRepository: fxRateRepository}
+}
+
+func (p *tableRateProvider) Rate(base money.Currency, quote money.Currency) (money.Decimal, error) {
+	if base == quote {
+		return money.NewDecimal(1, 0), nil
+	}
+
+	rate, err := p.fxRateRepository.GetRate(base, quote)
+	if errors.Is(err, sql.ErrNoRows) {
+		return money.Decimal{}, fmt.Errorf("%w: %s/%s", ErrRateUnavailable, base, quote)
+	}
+	return rate, err
+}
+
+type fileRateProvider struct {
+	rates map[string]money.Decimal
+}
+
+// NewFileRateProvider quotes the rates of a JSON file that maps currency pairs
+// to rates, e.g. {"USD/EUR": "0.9215", "EUR/USD": "1.0852"}. The file is read
+// once; every pair used for a transfer must be listed in both directions it is
+// needed in.
+func NewFileRateProvider(path string) (FXRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates map[string]money.Decimal
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("invalid exchange rate file %s: %w", path, err)
+	}
+
+	provider := &fileRateProvider{rates: make(map[string]money.Decimal, len(rates))}
+	for pair, rate := range rates {
+		base, quote, ok := strings.Cut(pair, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid currency pair %q in %s", pair, path)
+		}
+		baseCurrency, err := money.ParseCurrency(base)
+		if err != nil {
+			return nil, err
+		}
+		quoteCurrency, err := money.ParseCurrency(quote)
+		if err != nil {
+			return nil, err
+		}
+		if rate.Sign() <= 0 {
+			return nil, fmt.Errorf("exchange rate of %s in %s must be positive", pair, path)
+		}
+		provider.rates[currencyPair(baseCurrency, quoteCurrency)] = rate
+	}
+	return provider, nil
+}
+
+func (p *fileRateProvider) Rate(base money.Currency, quote money.Currency) (money.Decimal, error) {
+	if base == quote {
+		return money.NewDecimal(1, 0), nil
+	}
+
+	rate, ok := p.rates[currencyPair(base, quote)]
+	if !ok {
+		return money.Decimal{}, fmt.Errorf("%w: %s/%s", ErrRateUnavailable, base, quote)
+	}
+	return rate, nil
+}
+
+func currencyPair(base money.Currency, quote money.Currency) string {
+	return fmt.Sprintf("%s/%s", base, quote)
+}
+
+// convert quotes amount in currency at the provider's current rate, rounding
+// half to even. It returns nil when amount is already in currency.
+func convert(provider FXRateProvider, amount money.Money, currency money.Currency) (*model.Conversion, error) {
+	if amount.Currency == currency {
+		return nil, nil
+	}
+
+	rate, err := provider.Rate(amount.Currency, currency)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := amount.Convert(rate, currency, money.RoundHalfEven)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Conversion{Rate: rate, Amount: converted}, nil
+}
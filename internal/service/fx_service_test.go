@@ -0,0 +1,92 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+)
+
+// recordingUserRepository keeps the conversion of the last transfer.
+type recordingUserRepository struct {
+	repository.UserRepository
+	conversion *model.Conversion
+}
+
+func (r *recordingUserRepository) Transfer(actor model.Actor, senderWalletId int, receiverWalletId int, amount money.Money, conversion *model.Conversion, fee *model.Fee, check repository.MovementCheck) error {
+	r.conversion = conversion
+	return nil
+}
+
+func newWallet(id int, currency money.Currency) model.Wallet {
+	return model.Wallet{ID: id, Currency: currency, Balance: money.New(0, currency)}
+}
+
+func writeRateFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write rate file: %v", err)
+	}
+	return path
+}
+
+func TestFileRateProvider(t *testing.T) {
+	provider, err := NewFileRateProvider(writeRateFile(t, `{"USD/EUR": "0.9215", "usd/jpy": 151.37}`))
+	assert.NoError(t, err)
+
+	rate, err := provider.Rate("USD", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.9215", rate.String())
+
+	rate, err = provider.Rate("USD", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, "151.37", rate.String())
+
+	rate, err = provider.Rate("EUR", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", rate.String())
+
+	_, err = provider.Rate("EUR", "USD")
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+}
+
+func TestFileRateProviderRejectsInvalidRates(t *testing.T) {
+	for _, content := range []string{
+		`{"USD-EUR": "0.92"}`,
+		`{"USD/XXX": "0.92"}`,
+		`{"USD/EUR": "0"}`,
+		`{"USD/EUR": "abc"}`,
+	} {
+		_, err := NewFileRateProvider(writeRateFile(t, content))
+		assert.Error(t, err, content)
+	}
+
+	_, err := NewFileRateProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestTransferConvertsAcrossCurrencies(t *testing.T) {
+	provider, err := NewFileRateProvider(writeRateFile(t, `{"USD/JPY": "151.37"}`))
+	assert.NoError(t, err)
+	repository := &recordingUserRepository{}
+	userService := NewUserService(repository, provider, nil)
+
+	sender := newWallet(1, "USD")
+	err = userService.Transfer(model.SystemActor, sender, newWallet(2, "JPY"), money.New(1050, "USD"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(1589, "JPY"), repository.conversion.Amount)
+
+	err = userService.Transfer(model.SystemActor, sender, newWallet(3, "USD"), money.New(1050, "USD"), nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, repository.conversion)
+
+	err = userService.Transfer(model.SystemActor, sender, newWallet(4, "EUR"), money.New(1050, "USD"), nil, nil)
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+const MaxHoldTTL = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidHoldExpiry = utils.Invalid("invalid_hold_expiry", "invalid hold expiry")
+	ErrHoldNotPermitted  = utils.Forbidden("hold_not_permitted", "only the payee of the hold, or the owner of the wallet when it has none, may capture or release it")
+)
+
+type HoldService struct {
+	holdRepository repository.HoldRepository
+	fxRateProvider FXRateProvider
+	ttl            time.Duration
+	walletHub      *WalletHub
+}
+
+// NewHoldService publishes the holds it places, captures and releases to
+// walletHub, since each changes an available balance.
+func NewHoldService(holdRepository repository.HoldRepository, fxRateProvider FXRateProvider, ttl time.Duration, walletHub *WalletHub) *HoldService {
+	return &HoldService{holdRepository: holdRepository, fxRateProvider: fxRateProvider, ttl: ttl, walletHub: walletHub}
+}
+
+func (hs *HoldService) GetById(holdId int) (model.Hold, error) {
+	hold, err := hs.holdRepository.GetById(holdId)
+	return hold, notFound(err, ErrHoldNotFound)
+}
+
+func (hs *HoldService) GetActiveByWalletId(walletId int) ([]model.Hold, error) {
+	return hs.holdRepository.GetActiveByWalletId(walletId)
+}
+
+// Place holds amount of the wallet's available balance for expiresIn, or for
+// the service's default TTL when expiresIn is zero. A hold placed for a payee
+// is settled by them, and one without a payee by the wallet's owner.
+func (hs *HoldService) Place(actor model.Actor, wallet model.Wallet, payee *model.Wallet, amount money.Money, expiresIn time.Duration) (model.Hold, error) {
+	if expiresIn == 0 {
+		expiresIn = hs.ttl
+	}
+	if expiresIn < 0 || expiresIn > MaxHoldTTL {
+		return model.Hold{}, ErrInvalidHoldExpiry
+	}
+	var payeeWalletId *int
+	if payee != nil {
+		payeeWalletId = &payee.ID
+	}
+	hold, err := hs.holdRepository.Create(actor, wallet.ID, payeeWalletId, amount, time.Now().Add(expiresIn))
+	if err != nil {
+		return model.Hold{}, err
+	}
+	hs.walletHub.Publish(wallet.ID)
+	return hold, nil
+}
+
+// Capture turns the hold into a transfer to payee, the wallet it was placed
+// for, or into a withdrawal when it has none, on behalf of an actor
+// CheckSettle allowed to. A nil amount captures the whole hold. The fee, if
+// any, is charged on top of the captured amount, and check vets the movement.
+func (hs *HoldService) Capture(actor model.Actor, hold model.Hold, amount *money.Money, payee *model.Wallet, fee *model.Fee, check repository.MovementCheck) (model.Hold, error) {
+	if payee == nil {
+		captured, err := hs.holdRepository.Capture(actor, hold.ID, amount, nil, fee, check)
+		if err != nil {
+			return model.Hold{}, err
+		}
+		hs.walletHub.Publish(movedWallets(fee, hold.WalletId)...)
+		return captured, nil
+	}
+
+	capturedAmount := hold.Amount
+	if amount != nil {
+		capturedAmount = *amount
+	}
+	conversion, err := convert(hs.fxRateProvider, capturedAmount, payee.Currency)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	captured, err := hs.holdRepository.Capture(actor, hold.ID, amount, conversion, fee, check)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	hs.walletHub.Publish(movedWallets(fee, hold.WalletId, payee.ID)...)
+	return captured, nil
+}
+
+// Release gives the held money back to the wallet on behalf of an actor
+// CheckSettle allowed to.
+func (hs *HoldService) Release(actor model.Actor, hold model.Hold) (model.Hold, error) {
+	released, err := hs.holdRepository.Release(actor, hold.ID)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	hs.walletHub.Publish(released.WalletId)
+	return released, nil
+}
+
+// CheckSettle refuses actor, whose user has role, the capture or release of a
+// hold on wallet placed for payee unless they own payee, or own wallet when
+// the hold has no payee, so the payer of a hold for someone else cannot take
+// it back. Staff allowed to settle holds may settle any.
+func (hs *HoldService) CheckSettle(actor model.Actor, role string, wallet model.Wallet, payee *model.Wallet) error {
+	if model.HasPermission(role, model.PermissionSettle) {
+		return nil
+	}
+	settler := wallet
+	if payee != nil {
+		settler = *payee
+	}
+	if settler.UserId != actor.UserId {
+		return ErrHoldNotPermitted
+	}
+	return nil
+}
+
+// RunSweeper marks expired holds every interval until ctx is done.
+func (hs *HoldService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := hs.holdRepository.ReleaseExpired()
+			if err != nil {
+				log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to release expired holds due to: %s", err.Error())).Send()
+				continue
+			}
+			if expired > 0 {
+				log.Info().Int64("holds", expired).Msg("Released expired holds")
+			}
+		}
+	}
+}
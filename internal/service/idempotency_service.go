@@ -0,0 +1,59 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrIdempotencyKeyReused     = utils.Unprocessable("idempotency_key_reused", "idempotency key reused with a different request")
+	ErrIdempotencyKeyInProgress = utils.Conflict("idempotency_key_in_progress", "a request with this idempotency key is still in progress")
+)
+
+type IdempotencyService struct {
+	idempotencyRepository repository.IdempotencyRepository
+	ttl                   time.Duration
+}
+
+func NewIdempotencyService(idempotencyRepository repository.IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{idempotencyRepository: idempotencyRepository, ttl: ttl}
+}
+
+// Begin claims key for the request identified by fingerprint. It returns the
+// stored key and false when the request has already completed and should be
+// replayed, and true when the caller must execute the request and then call
+// Complete or Release.
+func (is *IdempotencyService) Begin(userId int, key string, fingerprint []byte) (model.IdempotencyKey, bool, error) {
+	hash := sha256.Sum256(fingerprint)
+	requestHash := hex.EncodeToString(hash[:])
+
+	idempotencyKey, reserved, err := is.idempotencyRepository.Reserve(userId, key, requestHash, time.Now().Add(is.ttl))
+	if err != nil {
+		return model.IdempotencyKey{}, false, err
+	}
+	if reserved {
+		return idempotencyKey, true, nil
+	}
+
+	if idempotencyKey.RequestHash != requestHash {
+		return model.IdempotencyKey{}, false, ErrIdempotencyKeyReused
+	}
+	if !idempotencyKey.Completed() {
+		return model.IdempotencyKey{}, false, ErrIdempotencyKeyInProgress
+	}
+	return idempotencyKey, false, nil
+}
+
+func (is *IdempotencyService) Complete(userId int, key string, statusCode int, responseBody []byte) error {
+	return is.idempotencyRepository.Complete(userId, key, statusCode, responseBody)
+}
+
+func (is *IdempotencyService) Release(userId int, key string) error {
+	return is.idempotencyRepository.Release(userId, key)
+}
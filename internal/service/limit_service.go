@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+// DefaultTransactionMaximum caps a single deposit, withdrawal or transfer, in
+// major units of its currency, unless a limit in the database says otherwise.
+var DefaultTransactionMaximum = money.NewDecimal(10000000, 0)
+
+var ErrLimitExceeded = utils.Forbidden("limit_exceeded", "transaction limit exceeded")
+
+// periodWindows are the rolling windows of the capped periods.
+var periodWindows = map[string]time.Duration{
+	model.LimitPeriodDaily:   24 * time.Hour,
+	model.LimitPeriodMonthly: 30 * 24 * time.Hour,
+}
+
+// LimitError names the limit an operation would break, what is left of it
+// and, for a capped period, when the oldest operation counted against it
+// leaves the period. It matches ErrLimitExceeded.
+type LimitError struct {
+	Operation string
+	Period    string
+	Scope     string
+	Limit     money.Money
+	Remaining money.Money
+	ResetsAt  *time.Time
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %s limit of %s exceeded, %s remaining", e.Period, e.Operation, e.Limit, e.Remaining)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Problem is the breach as clients are told of it: ErrLimitExceeded naming
+// the limit, with its details under "limit".
+func (e *LimitError) Problem() *utils.Error {
+	return ErrLimitExceeded.
+		WithMessage(fmt.Sprintf("The amount exceeds the %s %s limit", e.Period, e.Operation)).
+		With("limit", model.LimitBreachData{
+			Operation: e.Operation,
+			Period:    e.Period,
+			Scope:     e.Scope,
+			Limit:     e.Limit,
+			Remaining: e.Remaining,
+			Currency:  e.Limit.Currency.String(),
+			ResetsAt:  e.ResetsAt,
+		})
+}
+
+type LimitService struct {
+	limitRepository repository.LimitRepository
+}
+
+func NewLimitService(limitRepository repository.LimitRepository) *LimitService {
+	return &LimitService{limitRepository: limitRepository}
+}
+
+// Check returns the check the repositories run on a movement of amount, taken
+// from or paid into a wallet by an operation of the given type, before making
+// it. The check fails with a *LimitError when the movement would break one of
+// the wallet's limits. The most specific limit of each period applies: the
+// wallet's own over its user's over everyone's, and one in the wallet's
+// currency over one in any. A capped period counts the wallet's own
+// operations under a wallet limit and all its user's operations in the
+// currency otherwise, as usage reads them inside the movement's transaction.
+func (ls *LimitService) Check(operation string, amount money.Money) repository.MovementCheck {
+	return func(wallet model.Wallet, usage repository.LimitRepository) error {
+		return ls.check(usage, wallet, operation, amount)
+	}
+}
+
+func (ls *LimitService) check(usage repository.LimitRepository, wallet model.Wallet, operation string, amount money.Money) error {
+	limits, err := ls.limitRepository.GetLimits(wallet, operation)
+	if err != nil {
+		return err
+	}
+
+	for _, period := range []string{model.LimitPeriodTransaction, model.LimitPeriodDaily, model.LimitPeriodMonthly} {
+		limit, ok := effectiveLimit(limits, period)
+		if !ok {
+			if period != model.LimitPeriodTransaction {
+				continue
+			}
+			limit = model.TransactionLimit{Operation: operation, Period: period, Amount: DefaultTransactionMaximum}
+		}
+
+		maximum, err := money.RoundDecimal(limit.Amount, wallet.Currency, money.RoundDown)
+		if err != nil {
+			return err
+		}
+		scope := model.LimitScopeUser
+		if limit.WalletId != nil {
+			scope = model.LimitScopeWallet
+		}
+
+		if period == model.LimitPeriodTransaction {
+			if maximum.LessThan(amount) {
+				return &LimitError{Operation: operation, Period: period, Scope: scope, Limit: maximum, Remaining: maximum}
+			}
+			continue
+		}
+
+		window := periodWindows[period]
+		used, err := usage.GetUsage(wallet, scope, operation, window)
+		if err != nil {
+			return err
+		}
+		remaining, err := maximum.Sub(used.Total)
+		if err != nil {
+			return err
+		}
+		if remaining.IsNegative() {
+			remaining = money.New(0, wallet.Currency)
+		}
+		if remaining.LessThan(amount) {
+			var resetsAt *time.Time
+			if used.Oldest != nil {
+				reset := used.Oldest.Add(window)
+				resetsAt = &reset
+			}
+			return &LimitError{Operation: operation, Period: period, Scope: scope, Limit: maximum, Remaining: remaining, ResetsAt: resetsAt}
+		}
+	}
+	return nil
+}
+
+// effectiveLimit picks the most specific of the limits of a period.
+func effectiveLimit(limits []model.TransactionLimit, period string) (model.TransactionLimit, bool) {
+	var found bool
+	var best model.TransactionLimit
+	for _, limit := range limits {
+		if limit.Period != period {
+			continue
+		}
+		if !found || specificity(limit) > specificity(best) {
+			best, found = limit, true
+		}
+	}
+	return best, found
+}
+
+func specificity(limit model.TransactionLimit) int {
+	rank := 0
+	switch {
+	case limit.WalletId != nil:
+		rank = 4
+	case limit.UserId != nil:
+		rank = 2
+	}
+	if limit.Currency != nil {
+		rank++
+	}
+	return rank
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+)
+
+// fakeLimitRepository holds the limits of a test and reports the same usage
+// for every period and scope, keeping the scope it was last asked about.
+type fakeLimitRepository struct {
+	limits    []model.TransactionLimit
+	usage     model.LimitUsage
+	lastScope string
+}
+
+func (f *fakeLimitRepository) GetLimits(wallet model.Wallet, operation string) ([]model.TransactionLimit, error) {
+	var limits []model.TransactionLimit
+	for _, limit := range f.limits {
+		if limit.Operation == operation {
+			limits = append(limits, limit)
+		}
+	}
+	return limits, nil
+}
+
+func (f *fakeLimitRepository) GetUsage(wallet model.Wallet, scope string, operation string, window time.Duration) (model.LimitUsage, error) {
+	f.lastScope = scope
+	return f.usage, nil
+}
+
+func TestCheckDefaultTransactionMaximum(t *testing.T) {
+	repository := &fakeLimitRepository{}
+	limitService := NewLimitService(repository)
+	wallet := newWallet(1, "USD")
+
+	assert.NoError(t, limitService.Check(model.TransactionTypeDeposit, money.New(1000000000, "USD"))(wallet, repository))
+
+	err := limitService.Check(model.TransactionTypeDeposit, money.New(1000000001, "USD"))(wallet, repository)
+	var limitErr *LimitError
+	if assert.ErrorAs(t, err, &limitErr) {
+		assert.Equal(t, model.LimitPeriodTransaction, limitErr.Period)
+		assert.Nil(t, limitErr.ResetsAt)
+	}
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+}
+
+func TestCheckPrefersMostSpecificLimit(t *testing.T) {
+	userId, walletId := 7, 1
+	usd := money.Currency("USD")
+	repository := &fakeLimitRepository{limits: []model.TransactionLimit{
+		{Operation: model.TransactionTypeWithdraw, Period: model.LimitPeriodTransaction, Amount: money.NewDecimal(100, 0)},
+		{Operation: model.TransactionTypeWithdraw, Period: model.LimitPeriodTransaction, Amount: money.NewDecimal(500, 0), UserId: &userId},
+		{Operation: model.TransactionTypeWithdraw, Period: model.LimitPeriodTransaction, Amount: money.NewDecimal(300, 0), UserId: &userId, Currency: &usd},
+		{Operation: model.TransactionTypeWithdraw, Period: model.LimitPeriodDaily, Amount: money.NewDecimal(1000, 0), WalletId: &walletId},
+	}}
+	limitService := NewLimitService(repository)
+	wallet := model.Wallet{ID: walletId, UserId: userId, Currency: usd}
+
+	assert.NoError(t, limitService.Check(model.TransactionTypeWithdraw, money.New(30000, "USD"))(wallet, repository))
+	assert.Equal(t, model.LimitScopeWallet, repository.lastScope)
+	assert.ErrorIs(t, limitService.Check(model.TransactionTypeWithdraw, money.New(30001, "USD"))(wallet, repository), ErrLimitExceeded)
+	assert.NoError(t, limitService.Check(model.TransactionTypeDeposit, money.New(30001, "USD"))(wallet, repository))
+}
+
+func TestCheckRollingCapReportsRemainingAndReset(t *testing.T) {
+	oldest := time.Date(2024, 12, 20, 9, 0, 0, 0, time.UTC)
+	repository := &fakeLimitRepository{
+		limits: []model.TransactionLimit{
+			{Operation: model.TransactionTypeTransfer, Period: model.LimitPeriodMonthly, Amount: money.NewDecimal(2000, 0)},
+		},
+		usage: model.LimitUsage{Total: money.New(175050, "USD"), Oldest: &oldest},
+	}
+	limitService := NewLimitService(repository)
+
+	err := limitService.Check(model.TransactionTypeTransfer, money.New(25000, "USD"))(newWallet(1, "USD"), repository)
+
+	var limitErr *LimitError
+	if assert.ErrorAs(t, err, &limitErr) {
+		assert.Equal(t, model.LimitPeriodMonthly, limitErr.Period)
+		assert.Equal(t, model.LimitScopeUser, limitErr.Scope)
+		assert.Equal(t, money.New(200000, "USD"), limitErr.Limit)
+		assert.Equal(t, money.New(24950, "USD"), limitErr.Remaining)
+		assert.Equal(t, oldest.Add(30*24*time.Hour), *limitErr.ResetsAt)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+)
+
+// MovementService makes the deposits, withdrawals and transfers clients ask
+// for, whichever API they ask it through: it reads the amount in the wallet's
+// currency, prices the fee and has the limits checked in the transaction that
+// moves the money.
+type MovementService struct {
+	walletService *WalletService
+	userService   *UserService
+	limitService  *LimitService
+	feeService    *FeeService
+}
+
+func NewMovementService(walletService *WalletService, userService *UserService, limitService *LimitService, feeService *FeeService) *MovementService {
+	return &MovementService{walletService: walletService, userService: userService, limitService: limitService, feeService: feeService}
+}
+
+// Deposit pays amount, in currency when one is given, into the wallet.
+func (ms *MovementService) Deposit(actor model.Actor, wallet model.Wallet, amount money.Decimal, currency string) error {
+	deposited, err := movementAmount(wallet, amount, currency)
+	if err != nil {
+		return err
+	}
+
+	check := ms.limitService.Check(model.TransactionTypeDeposit, deposited)
+	_, err = ms.walletService.Update(actor, wallet.ID, deposited, model.TransactionTypeDeposit, nil, check)
+	return err
+}
+
+// Withdraw takes amount, in currency when one is given, and its fee from the
+// wallet.
+func (ms *MovementService) Withdraw(actor model.Actor, wallet model.Wallet, amount money.Decimal, currency string) error {
+	withdrawn, err := movementAmount(wallet, amount, currency)
+	if err != nil {
+		return err
+	}
+
+	fee, err := ms.feeService.Fee(wallet, model.TransactionTypeWithdraw, withdrawn)
+	if err != nil {
+		return err
+	}
+
+	check := ms.limitService.Check(model.TransactionTypeWithdraw, withdrawn)
+	_, err = ms.walletService.Update(actor, wallet.ID, withdrawn, model.TransactionTypeWithdraw, fee, check)
+	return err
+}
+
+// Transfer sends amount, in currency when one is given, from the sender
+// wallet to the receiver's wallet, its default one when receiverWalletId is
+// nil, and takes the fee from the sender wallet.
+func (ms *MovementService) Transfer(actor model.Actor, senderWallet model.Wallet, receiverUserId int, receiverWalletId *int, amount money.Decimal, currency string) error {
+	sent, err := movementAmount(senderWallet, amount, currency)
+	if err != nil {
+		return err
+	}
+
+	receiverWallet, err := ms.walletService.GetReceiverWallet(senderWallet, receiverUserId, receiverWalletId)
+	if err != nil {
+		return err
+	}
+
+	fee, err := ms.feeService.Fee(senderWallet, model.TransactionTypeTransfer, sent)
+	if err != nil {
+		return err
+	}
+
+	check := ms.limitService.Check(model.TransactionTypeTransfer, sent)
+	return ms.userService.Transfer(actor, senderWallet, receiverWallet, sent, fee, check)
+}
+
+// movementAmount reads the amount of a movement, which must be positive so it
+// is priced and checked against the limits as the amount it moves.
+func movementAmount(wallet model.Wallet, amount money.Decimal, currency string) (money.Money, error) {
+	moved, err := WalletAmount(wallet, amount, currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	if !moved.IsPositive() {
+		return money.Money{}, repository.ErrInvalidAmount
+	}
+	return moved, nil
+}
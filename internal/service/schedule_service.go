@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+const (
+	// ScheduleRetryDelay is how long the first retry of a scheduled transfer
+	// refused for lack of funds waits. Every further retry waits twice as
+	// long as the one before.
+	ScheduleRetryDelay = 15 * time.Minute
+
+	scheduleClaimLimit = 50
+	scheduleClaimLease = 5 * time.Minute
+)
+
+var (
+	ErrInvalidSchedule     = utils.Invalid("invalid_schedule", "invalid schedule")
+	ErrInvalidScheduleEdit = utils.Conflict("schedule_closed", "only active and paused schedules can be edited")
+)
+
+// ScheduleEdit holds the changes to a schedule; nil fields are left as they
+// are.
+type ScheduleEdit struct {
+	Amount      *money.Money
+	NextRunDate *time.Time
+	Recurrence  *string
+	DayOfMonth  *int
+	Status      *string
+}
+
+type ScheduleService struct {
+	scheduleRepository repository.ScheduleRepository
+	walletRepository   repository.WalletRepository
+	fxRateProvider     FXRateProvider
+	limitService       *LimitService
+	feeService         *FeeService
+	walletHub          *WalletHub
+}
+
+// NewScheduleService publishes the transfers its runs make to walletHub.
+func NewScheduleService(scheduleRepository repository.ScheduleRepository, walletRepository repository.WalletRepository, fxRateProvider FXRateProvider, limitService *LimitService, feeService *FeeService, walletHub *WalletHub) *ScheduleService {
+	return &ScheduleService{scheduleRepository: scheduleRepository, walletRepository: walletRepository, fxRateProvider: fxRateProvider, limitService: limitService, feeService: feeService, walletHub: walletHub}
+}
+
+func (ss *ScheduleService) GetByUserId(userId int) ([]model.ScheduledTransfer, error) {
+	return ss.scheduleRepository.GetByUserId(userId)
+}
+
+// GetUserSchedule returns the schedule when it belongs to the user. Schedules
+// of other users are reported missing rather than forbidden.
+func (ss *ScheduleService) GetUserSchedule(userId int, scheduleId int) (model.ScheduledTransfer, error) {
+	schedule, err := ss.scheduleRepository.GetById(scheduleId)
+	if err != nil {
+		return model.ScheduledTransfer{}, notFound(err, ErrScheduleNotFound)
+	}
+	if schedule.UserId != userId {
+		return model.ScheduledTransfer{}, ErrScheduleNotFound
+	}
+	return schedule, nil
+}
+
+func (ss *ScheduleService) GetRuns(scheduleId int) ([]model.ScheduledTransferRun, error) {
+	return ss.scheduleRepository.GetRuns(scheduleId)
+}
+
+// Create schedules amount, in the sender wallet's currency, to be sent to the
+// receiver wallet on startDate and then on every recurrence.
+func (ss *ScheduleService) Create(senderWallet model.Wallet, receiverWallet model.Wallet, amount money.Money, startDate time.Time, recurrence string, dayOfMonth *int) (model.ScheduledTransfer, error) {
+	schedule := model.ScheduledTransfer{
+		UserId:           senderWallet.UserId,
+		SenderWalletId:   senderWallet.ID,
+		ReceiverWalletId: receiverWallet.ID,
+		Amount:           amount,
+		Recurrence:       recurrence,
+		DayOfMonth:       dayOfMonth,
+		ScheduledDate:    startDate.UTC(),
+	}
+	if schedule.Recurrence == "" {
+		schedule.Recurrence = model.RecurrenceOnce
+	}
+	schedule = withDayOfMonth(schedule)
+	if err := validateSchedule(schedule); err != nil {
+		return model.ScheduledTransfer{}, err
+	}
+	if schedule.ScheduledDate.Before(time.Now()) {
+		return model.ScheduledTransfer{}, fmt.Errorf("%w: the start date is in the past", ErrInvalidSchedule)
+	}
+	return ss.scheduleRepository.Create(schedule)
+}
+
+// Edit applies the changes to an active or paused schedule. Moving its next
+// run starts the occurrence, and its retries, over.
+func (ss *ScheduleService) Edit(schedule model.ScheduledTransfer, edit ScheduleEdit) (model.ScheduledTransfer, error) {
+	if schedule.Status != model.ScheduleStatusActive && schedule.Status != model.ScheduleStatusPaused {
+		return model.ScheduledTransfer{}, ErrInvalidScheduleEdit
+	}
+
+	if edit.Amount != nil {
+		schedule.Amount = *edit.Amount
+	}
+	if edit.Recurrence != nil {
+		schedule.Recurrence = *edit.Recurrence
+		if schedule.Recurrence != model.RecurrenceMonthly {
+			schedule.DayOfMonth = nil
+		}
+	}
+	if edit.DayOfMonth != nil {
+		schedule.DayOfMonth = edit.DayOfMonth
+	}
+	if edit.NextRunDate != nil {
+		if edit.NextRunDate.Before(time.Now()) {
+			return model.ScheduledTransfer{}, fmt.Errorf("%w: the next run date is in the past", ErrInvalidSchedule)
+		}
+		schedule.ScheduledDate = edit.NextRunDate.UTC()
+		schedule.NextRunDate = schedule.ScheduledDate
+		schedule.Attempts = 0
+	}
+	if edit.Status != nil {
+		if *edit.Status != model.ScheduleStatusActive && *edit.Status != model.ScheduleStatusPaused {
+			return model.ScheduledTransfer{}, fmt.Errorf("%w: status must be active or paused", ErrInvalidSchedule)
+		}
+		schedule.Status = *edit.Status
+	}
+	schedule = withDayOfMonth(schedule)
+	if err := validateSchedule(schedule); err != nil {
+		return model.ScheduledTransfer{}, err
+	}
+	return ss.scheduleRepository.Update(schedule)
+}
+
+func (ss *ScheduleService) Cancel(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+	schedule.Status = model.ScheduleStatusCancelled
+	return ss.scheduleRepository.Update(schedule)
+}
+
+// RunWorker runs the due schedules every interval until ctx is done. Any
+// number of replicas may run it at once.
+func (ss *ScheduleService) RunWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ss.RunDue(); err != nil {
+				log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to claim due schedules due to: %s", err.Error())).Send()
+			}
+		}
+	}
+}
+
+// RunDue claims the schedules that are due and runs each once.
+func (ss *ScheduleService) RunDue() error {
+	schedules, err := ss.scheduleRepository.ClaimDue(scheduleClaimLimit, scheduleClaimLease)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		run, err := ss.run(schedule)
+		if errors.Is(err, repository.ErrScheduleChanged) {
+			continue
+		}
+		if err != nil {
+			log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to run schedule [%d] due to: %s", schedule.ID, err.Error())).Send()
+			continue
+		}
+		if run.Status == model.RunStatusFailed {
+			log.Info().Int("schedule", schedule.ID).Str("reason", *run.Error).Msg("Scheduled transfer failed")
+		}
+	}
+	return nil
+}
+
+// run makes the transfer of one claimed schedule, converting it at the
+// current rate when the receiver wallet holds another currency. A transfer
+// that would break the sender's limits fails like any other. The transfer
+// fee is priced at the time of the run; a run it cannot be priced for, as
+// when the house user has no wallet in the currency, is left to be claimed
+// again.
+func (ss *ScheduleService) run(schedule model.ScheduledTransfer) (model.ScheduledTransferRun, error) {
+	senderWallet, err := ss.walletRepository.GetById(schedule.SenderWalletId)
+	if err != nil {
+		return ss.scheduleRepository.Fail(schedule, err)
+	}
+
+	receiverWallet, err := ss.walletRepository.GetById(schedule.ReceiverWalletId)
+	if err != nil {
+		return ss.scheduleRepository.Fail(schedule, err)
+	}
+	conversion, err := convert(ss.fxRateProvider, schedule.Amount, receiverWallet.Currency)
+	if err != nil {
+		return ss.scheduleRepository.Fail(schedule, err)
+	}
+	fee, err := ss.feeService.Fee(senderWallet, model.TransactionTypeTransfer, schedule.Amount)
+	if err != nil {
+		return model.ScheduledTransferRun{}, err
+	}
+	check := ss.limitService.Check(model.TransactionTypeTransfer, schedule.Amount)
+	run, err := ss.scheduleRepository.Execute(schedule, conversion, fee, check, time.Now().Add(retryDelay(schedule.Attempts)))
+	if err != nil {
+		return model.ScheduledTransferRun{}, err
+	}
+	if run.Status == model.RunStatusSucceeded {
+		ss.walletHub.Publish(movedWallets(fee, schedule.SenderWalletId, schedule.ReceiverWalletId)...)
+	}
+	return run, nil
+}
+
+// retryDelay is how long to wait after attempts failed attempts.
+func retryDelay(attempts int) time.Duration {
+	return ScheduleRetryDelay << attempts
+}
+
+// withDayOfMonth pins a monthly schedule without a day of month to the day it
+// is scheduled on, so a run moved to the end of a short month does not move
+// the ones after it.
+func withDayOfMonth(schedule model.ScheduledTransfer) model.ScheduledTransfer {
+	if schedule.Recurrence == model.RecurrenceMonthly && schedule.DayOfMonth == nil {
+		day := schedule.ScheduledDate.Day()
+		schedule.DayOfMonth = &day
+	}
+	return schedule
+}
+
+func validateSchedule(schedule model.ScheduledTransfer) error {
+	switch schedule.Recurrence {
+	case model.RecurrenceOnce, model.RecurrenceDaily, model.RecurrenceWeekly:
+		if schedule.DayOfMonth != nil {
+			return fmt.Errorf("%w: day_of_month only applies to monthly schedules", ErrInvalidSchedule)
+		}
+	case model.RecurrenceMonthly:
+		if schedule.DayOfMonth != nil && (*schedule.DayOfMonth < 1 || *schedule.DayOfMonth > 31) {
+			return fmt.Errorf("%w: day_of_month must be between 1 and 31", ErrInvalidSchedule)
+		}
+	default:
+		return fmt.Errorf("%w: recurrence must be once, daily, weekly or monthly", ErrInvalidSchedule)
+	}
+	if !schedule.Amount.IsPositive() {
+		return repository.ErrInvalidAmount
+	}
+	return nil
+}
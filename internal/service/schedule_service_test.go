@@ -0,0 +1,112 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
+	"go-wallet-service/internal/repository"
+)
+
+// recordingScheduleRepository hands out its due schedules once and keeps how
+// each of them was run.
+type recordingScheduleRepository struct {
+	repository.ScheduleRepository
+	due         []model.ScheduledTransfer
+	conversions map[int]*model.Conversion
+	retries     map[int]time.Time
+	failures    map[int]error
+}
+
+func (r *recordingScheduleRepository) ClaimDue(limit int, lease time.Duration) ([]model.ScheduledTransfer, error) {
+	due := r.due
+	r.due = nil
+	return due, nil
+}
+
+func (r *recordingScheduleRepository) Execute(schedule model.ScheduledTransfer, conversion *model.Conversion, fee *model.Fee, check repository.MovementCheck, retryAt time.Time) (model.ScheduledTransferRun, error) {
+	if err := check(model.Wallet{ID: schedule.SenderWalletId, Currency: schedule.Amount.Currency}, &fakeLimitRepository{}); err != nil {
+		return r.Fail(schedule, err)
+	}
+	r.conversions[schedule.ID] = conversion
+	r.retries[schedule.ID] = retryAt
+	return model.ScheduledTransferRun{ScheduleId: schedule.ID, Status: model.RunStatusSucceeded}, nil
+}
+
+func (r *recordingScheduleRepository) Fail(schedule model.ScheduledTransfer, reason error) (model.ScheduledTransferRun, error) {
+	r.failures[schedule.ID] = reason
+	message := reason.Error()
+	return model.ScheduledTransferRun{ScheduleId: schedule.ID, Status: model.RunStatusFailed, Error: &message}, nil
+}
+
+// walletsById serves the wallets of a test by ID.
+type walletsById struct {
+	repository.WalletRepository
+	wallets map[int]model.Wallet
+}
+
+func (w walletsById) GetById(walletId int) (model.Wallet, error) {
+	return w.wallets[walletId], nil
+}
+
+func TestRunDueConvertsChecksLimitsAndRetriesWithBackoff(t *testing.T) {
+	provider, err := NewFileRateProvider(writeRateFile(t, `{"USD/EUR": "0.9215"}`))
+	assert.NoError(t, err)
+	schedules := &recordingScheduleRepository{
+		due: []model.ScheduledTransfer{
+			{ID: 1, SenderWalletId: 1, ReceiverWalletId: 2, Amount: money.New(1000, "USD")},
+			{ID: 2, SenderWalletId: 1, ReceiverWalletId: 3, Amount: money.New(1000, "USD"), Attempts: 2},
+			{ID: 3, SenderWalletId: 1, ReceiverWalletId: 4, Amount: money.New(1000, "USD")},
+			{ID: 4, SenderWalletId: 1, ReceiverWalletId: 2, Amount: money.New(2000000000, "USD")},
+		},
+		conversions: map[int]*model.Conversion{},
+		retries:     map[int]time.Time{},
+		failures:    map[int]error{},
+	}
+	wallets := walletsById{wallets: map[int]model.Wallet{
+		1: newWallet(1, "USD"),
+		2: newWallet(2, "USD"),
+		3: newWallet(3, "EUR"),
+		4: newWallet(4, "JPY"),
+	}}
+	scheduleService := NewScheduleService(schedules, wallets, provider, NewLimitService(&fakeLimitRepository{}), NewFeeService(nil, wallets, 0), nil)
+
+	start := time.Now()
+	assert.NoError(t, scheduleService.RunDue())
+
+	assert.Nil(t, schedules.conversions[1])
+	assert.WithinDuration(t, start.Add(ScheduleRetryDelay), schedules.retries[1], time.Second)
+	assert.Equal(t, money.New(922, "EUR"), schedules.conversions[2].Amount)
+	assert.WithinDuration(t, start.Add(4*ScheduleRetryDelay), schedules.retries[2], time.Second)
+	assert.ErrorIs(t, schedules.failures[3], ErrRateUnavailable)
+	assert.ErrorIs(t, schedules.failures[4], ErrLimitExceeded)
+}
+
+func TestCreateScheduleValidatesRecurrence(t *testing.T) {
+	scheduleService := NewScheduleService(&recordingScheduleRepository{}, walletsById{}, nil, nil, nil, nil)
+	sender := newWallet(1, "USD")
+	receiver := newWallet(2, "USD")
+	amount := money.New(1000, "USD")
+	tomorrow := time.Now().Add(24 * time.Hour)
+	day := 15
+
+	for name, create := range map[string]func() error{
+		"unknown recurrence": func() error {
+			_, err := scheduleService.Create(sender, receiver, amount, tomorrow, "yearly", nil)
+			return err
+		},
+		"day of weekly schedule": func() error {
+			_, err := scheduleService.Create(sender, receiver, amount, tomorrow, model.RecurrenceWeekly, &day)
+			return err
+		},
+		"start in the past": func() error {
+			_, err := scheduleService.Create(sender, receiver, amount, time.Now().Add(-time.Hour), model.RecurrenceOnce, nil)
+			return err
+		},
+	} {
+		assert.ErrorIs(t, create(), ErrInvalidSchedule, name)
+	}
+}
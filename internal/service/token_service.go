@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrTokenInvalid = utils.Unauthorized("token_invalid", "token is invalid")
+	ErrTokenExpired = utils.Unauthorized("token_expired", "token has expired")
+	ErrTokenRevoked = utils.Unauthorized("token_revoked", "token has been revoked")
+)
+
+const tokenBytes = 32
+
+// TokenPair is what the token endpoint hands out: a short-lived access token
+// used as Bearer authorization and a refresh token that obtains the next pair.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+type TokenService struct {
+	tokenRepository repository.TokenRepository
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	now             func() time.Time
+}
+
+func NewTokenService(tokenRepository repository.TokenRepository, accessTokenTTL time.Duration, refreshTokenTTL time.Duration) *TokenService {
+	return &TokenService{
+		tokenRepository: tokenRepository,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		now:             time.Now,
+	}
+}
+
+// Issue starts a new session for the user.
+func (ts *TokenService) Issue(userId int) (TokenPair, error) {
+	sessionId, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return ts.issue(userId, sessionId)
+}
+
+func (ts *TokenService) issue(userId int, sessionId string) (TokenPair, error) {
+	accessToken, err := ts.create(userId, sessionId, model.TokenTypeAccess, ts.accessTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := ts.create(userId, sessionId, model.TokenTypeRefresh, ts.refreshTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: ts.accessTokenTTL}, nil
+}
+
+func (ts *TokenService) create(userId int, sessionId string, tokenType string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = ts.tokenRepository.Create(model.OAuthToken{
+		UserId:     userId,
+		TokenHash:  HashToken(token),
+		Type:       tokenType,
+		SessionId:  sessionId,
+		ExpiryDate: ts.now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Authenticate returns the user of a valid access token.
+func (ts *TokenService) Authenticate(accessToken string) (int, error) {
+	token, err := ts.lookup(accessToken, model.TokenTypeAccess)
+	if err != nil {
+		return 0, err
+	}
+	return token.UserId, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair in the same session.
+// The refresh token is single use: presenting it again revokes the whole
+// session, since it means the token has leaked.
+func (ts *TokenService) Refresh(refreshToken string) (TokenPair, error) {
+	token, err := ts.lookup(refreshToken, model.TokenTypeRefresh)
+	if errors.Is(err, ErrTokenRevoked) {
+		if err := ts.tokenRepository.RevokeSession(token.SessionId); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrTokenRevoked
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	revoked, err := ts.tokenRepository.Revoke(token.ID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !revoked {
+		if err := ts.tokenRepository.RevokeSession(token.SessionId); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrTokenRevoked
+	}
+
+	return ts.issue(token.UserId, token.SessionId)
+}
+
+// Revoke ends the session of an access or refresh token. Unknown tokens are
+// ignored, as revoking them has nothing left to do.
+func (ts *TokenService) Revoke(rawToken string) error {
+	token, err := ts.tokenRepository.GetByHash(HashToken(rawToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ts.tokenRepository.RevokeSession(token.SessionId)
+}
+
+// RevokeAll ends every session of the user.
+func (ts *TokenService) RevokeAll(userId int) error {
+	return ts.tokenRepository.RevokeAllByUserId(userId)
+}
+
+// lookup returns the stored token, which is also set alongside ErrTokenRevoked
+// and ErrTokenExpired.
+func (ts *TokenService) lookup(rawToken string, tokenType string) (model.OAuthToken, error) {
+	token, err := ts.tokenRepository.GetByHash(HashToken(rawToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.OAuthToken{}, ErrTokenInvalid
+	}
+	if err != nil {
+		return model.OAuthToken{}, err
+	}
+
+	if token.Type != tokenType {
+		return model.OAuthToken{}, ErrTokenInvalid
+	}
+	if token.RevocationDate != nil {
+		return token, ErrTokenRevoked
+	}
+	if !ts.now().Before(token.ExpiryDate) {
+		return token, ErrTokenExpired
+	}
+	return token, nil
+}
+
+// HashToken returns the form in which a token is stored.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
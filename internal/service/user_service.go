@@ -1,34 +1,261 @@
 package service
 
 import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
 	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
 	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+const (
+	DefaultTransactionPageSize = 50
+	MaxTransactionPageSize     = 200
+
+	cursorPrefix = "entry:"
+)
+
+var (
+	ErrInvalidCursor        = utils.Invalid("invalid_cursor", "invalid cursor")
+	ErrInvalidPageSize      = utils.Invalid("invalid_page_size", "invalid page size")
+	ErrReversalNotPermitted = utils.Forbidden("reversal_not_permitted", "the user may not reverse this transaction")
 )
 
 type UserService struct {
 	userRepository repository.UserRepository
+	fxRateProvider FXRateProvider
+	walletHub      *WalletHub
 }
 
-func NewUserService(userRepository repository.UserRepository) *UserService {
-	return &UserService{userRepository: userRepository}
+// NewUserService publishes the transfers and reversals it makes to walletHub.
+func NewUserService(userRepository repository.UserRepository, fxRateProvider FXRateProvider, walletHub *WalletHub) *UserService {
+	return &UserService{userRepository: userRepository, fxRateProvider: fxRateProvider, walletHub: walletHub}
 }
 
 func (us *UserService) GetById(userId int) (model.User, error) {
-	return us.userRepository.GetById(userId)
+	user, err := us.userRepository.GetById(userId)
+	return user, notFound(err, ErrUserNotFound)
+}
+
+// GetByIdIncludingDeleted returns the user even when the account was deleted.
+func (us *UserService) GetByIdIncludingDeleted(userId int) (model.User, error) {
+	user, err := us.userRepository.GetByIdIncludingDeleted(userId)
+	return user, notFound(err, ErrUserNotFound)
+}
+
+// DefaultWalletName names the first wallet of a user who registers without
+// naming it.
+const DefaultWalletName = "main"
+
+// ProfileEdit holds the changes to a user's profile; nil fields are left as
+// they are and an empty email or phone is removed.
+type ProfileEdit struct {
+	DisplayName *string
+	Email       *string
+	Phone       *string
+}
+
+// Registration describes a new user and their first wallet. Email and phone
+// may be left empty.
+type Registration struct {
+	Username    string
+	DisplayName string
+	Email       string
+	Phone       string
+	WalletName  string
+	Currency    money.Currency
+}
+
+// Register creates a user and their first wallet.
+func (us *UserService) Register(actor model.Actor, registration Registration) (model.User, model.Wallet, error) {
+	user := model.User{
+		Username:    registration.Username,
+		DisplayName: registration.DisplayName,
+		Email:       optional(registration.Email),
+		Phone:       optional(registration.Phone),
+	}
+	walletName := registration.WalletName
+	if walletName == "" {
+		walletName = DefaultWalletName
+	}
+	return us.userRepository.Register(actor, user, walletName, registration.Currency)
+}
+
+func (us *UserService) UpdateProfile(actor model.Actor, userId int, edit ProfileEdit) (model.User, error) {
+	user, err := us.GetById(userId)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	if edit.DisplayName != nil {
+		user.DisplayName = *edit.DisplayName
+	}
+	if edit.Email != nil {
+		user.Email = optional(*edit.Email)
+	}
+	if edit.Phone != nil {
+		user.Phone = optional(*edit.Phone)
+	}
+
+	user, err = us.userRepository.UpdateProfile(actor, user)
+	return user, notFound(err, ErrUserNotFound)
+}
+
+// Delete closes the user's account, which must no longer hold any money.
+func (us *UserService) Delete(actor model.Actor, userId int) error {
+	return notFound(us.userRepository.Delete(actor, userId), ErrUserNotFound)
+}
+
+// SetStatus changes the status of the user on behalf of actor, who gives
+// reason for it.
+func (us *UserService) SetStatus(actor model.Actor, userId int, status string, reason string) (model.StatusChange, error) {
+	change, err := us.userRepository.SetStatus(actor, userId, model.StatusChange{ToStatus: status, Reason: reason})
+	return change, notFound(err, ErrUserNotFound)
+}
+
+// optional reads an empty profile field as no value.
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
 }
 
 func (us *UserService) GetByIds(userIds []int) ([]model.User, error) {
 	return us.userRepository.GetByIds(userIds)
 }
 
-func (us *UserService) GetUserTransactionsByUserId(userId int) ([]model.Transaction, error) {
-	return us.userRepository.GetUserTransactionsByUserId(userId)
+func (us *UserService) GetTransactionById(transactionId int) (model.Transaction, error) {
+	transaction, err := us.userRepository.GetTransactionById(transactionId)
+	return transaction, notFound(err, ErrTransactionNotFound)
+}
+
+// Reverse returns amount of a transaction, or all of it that is left when
+// amount is nil, to where it came from, on behalf of actor, whose user has
+// role. The receiver of a transfer may refund it; deposits and forced
+// reversals, which may overdraw the paying wallet, are reserved to staff
+// allowed to adjust balances.
+func (us *UserService) Reverse(actor model.Actor, role string, transactionId int, amount *money.Decimal, force bool) (model.Transaction, error) {
+	original, err := us.GetTransactionById(transactionId)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	canAdjust := model.HasPermission(role, model.PermissionAdjust)
+	isRefund := original.Type == model.TransactionTypeTransfer && original.ReceiverUserId == actor.UserId
+	if !canAdjust && (!isRefund || force) {
+		return model.Transaction{}, ErrReversalNotPermitted
+	}
+
+	var refund *money.Money
+	if amount != nil {
+		m, err := money.FromDecimal(*amount, original.Currency)
+		if err != nil {
+			return model.Transaction{}, err
+		}
+		refund = &m
+	}
+
+	reversal, err := us.userRepository.Reverse(actor, transactionId, refund, force)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	us.walletHub.Publish(reversal.SenderWalletId, reversal.ReceiverWalletId)
+	return reversal, nil
+}
+
+// TransactionPage is one page of a user's transaction history. NextCursor is
+// empty on the last page.
+type TransactionPage struct {
+	Entries    []model.TransactionEntry
+	NextCursor string
+}
+
+// GetUserTransactions returns the page of the user's history that starts at
+// cursor, or at the newest entry when cursor is empty.
+func (us *UserService) GetUserTransactions(userId int, filter model.TransactionFilter, cursor string) (TransactionPage, error) {
+	if filter.Limit <= 0 || filter.Limit > MaxTransactionPageSize {
+		return TransactionPage{}, ErrInvalidPageSize
+	}
+	if cursor != "" {
+		entryId, err := decodeCursor(cursor)
+		if err != nil {
+			return TransactionPage{}, err
+		}
+		filter.BeforeEntryId = entryId
+	}
+
+	// one entry past the page tells whether another page follows
+	pageSize := filter.Limit
+	filter.Limit++
+	entries, err := us.userRepository.GetUserTransactionsByUserId(userId, filter)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	page := TransactionPage{Entries: entries}
+	if len(entries) > pageSize {
+		page.Entries = entries[:pageSize]
+		page.NextCursor = encodeCursor(page.Entries[pageSize-1].EntryId)
+	}
+	return page, nil
+}
+
+// GetWalletEntriesAfter returns up to limit entries of the wallet made after
+// entry afterEntryId, oldest first.
+func (us *UserService) GetWalletEntriesAfter(wallet model.Wallet, afterEntryId int, limit int) ([]model.TransactionEntry, error) {
+	return us.userRepository.GetUserTransactionsByUserId(wallet.UserId, model.TransactionFilter{WalletId: wallet.ID, AfterEntryId: afterEntryId, OldestFirst: true, Limit: limit})
+}
+
+// LastWalletEntryId returns the ID of the newest entry of the wallet, or 0
+// when it has none.
+func (us *UserService) LastWalletEntryId(wallet model.Wallet) (int, error) {
+	entries, err := us.userRepository.GetUserTransactionsByUserId(wallet.UserId, model.TransactionFilter{WalletId: wallet.ID, Limit: 1})
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	return entries[0].EntryId, nil
+}
+
+// Transfer moves amount, given in the sender wallet's currency, into the
+// receiver wallet. When the receiver wallet holds another currency the amount
+// is converted at the provider's current rate. The fee, if any, is taken from
+// the sender on top of amount. check, when given, vets the transfer once the
+// sender wallet is locked.
+func (us *UserService) Transfer(actor model.Actor, senderWallet model.Wallet, receiverWallet model.Wallet, amount money.Money, fee *model.Fee, check repository.MovementCheck) error {
+	conversion, err := convert(us.fxRateProvider, amount, receiverWallet.Currency)
+	if err != nil {
+		return err
+	}
+	if err := us.userRepository.Transfer(actor, senderWallet.ID, receiverWallet.ID, amount, conversion, fee, check); err != nil {
+		return err
+	}
+	us.walletHub.Publish(movedWallets(fee, senderWallet.ID, receiverWallet.ID)...)
+	return nil
 }
 
-func (us *UserService) GetUserByToken(token string) (int, error) {
-	return us.userRepository.GetUserByToken(token)
+// encodeCursor hides the entry ID behind an opaque token, so clients do not
+// build cursors of their own.
+func encodeCursor(entryId int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(entryId)))
 }
 
-func (us *UserService) Transfer(senderUserId int, senderWalletId int, senderWalletBalance float64, receiverUserId int, receiverWalletId int, receiverWalletBalance float64, amount float64) error {
-	return us.userRepository.Transfer(senderUserId, senderWalletId, senderWalletBalance, receiverUserId, receiverWalletId, receiverWalletBalance, amount)
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	value, ok := strings.CutPrefix(string(decoded), cursorPrefix)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	entryId, err := strconv.Atoi(value)
+	if err != nil || entryId <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return entryId, nil
 }
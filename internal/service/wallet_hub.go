@@ -0,0 +1,70 @@
+package service
+
+import (
+	"sync"
+
+	"go-wallet-service/internal/model"
+)
+
+// WalletHub tells the event streams of this process which wallets changed.
+// A change carries no data: subscribers read what changed from the ledger, so
+// one that falls behind only gets the news later, never loses it.
+type WalletHub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan struct{}]struct{}
+}
+
+func NewWalletHub() *WalletHub {
+	return &WalletHub{subscribers: map[int]map[chan struct{}]struct{}{}}
+}
+
+// Subscribe returns a channel that receives after the wallet changes and a
+// function that unsubscribes it. Changes published before the channel is
+// read are merged into one.
+func (h *WalletHub) Subscribe(walletId int) (<-chan struct{}, func()) {
+	changes := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[walletId] == nil {
+		h.subscribers[walletId] = map[chan struct{}]struct{}{}
+	}
+	h.subscribers[walletId][changes] = struct{}{}
+
+	return changes, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[walletId], changes)
+		if len(h.subscribers[walletId]) == 0 {
+			delete(h.subscribers, walletId)
+		}
+	}
+}
+
+// Publish tells the subscribers of the wallets that they changed, without
+// waiting for any of them. A nil hub has no subscribers.
+func (h *WalletHub) Publish(walletIds ...int) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, walletId := range walletIds {
+		for changes := range h.subscribers[walletId] {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// movedWallets are the wallets a movement between walletIds changes, along
+// with the house wallet when it charges fee.
+func movedWallets(fee *model.Fee, walletIds ...int) []int {
+	if fee != nil {
+		walletIds = append(walletIds, fee.HouseWalletId)
+	}
+	return walletIds
+}
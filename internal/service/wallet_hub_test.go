@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+)
+
+// pending counts the changes waiting on a subscription.
+func pending(changes <-chan struct{}) int {
+	count := 0
+	for {
+		select {
+		case <-changes:
+			count++
+		default:
+			return count
+		}
+	}
+}
+
+func TestHubTellsOnlySubscribersOfChangedWallets(t *testing.T) {
+	hub := NewWalletHub()
+	first, unsubscribeFirst := hub.Subscribe(1)
+	second, unsubscribeSecond := hub.Subscribe(1)
+	other, _ := hub.Subscribe(2)
+	defer unsubscribeSecond()
+
+	hub.Publish(1)
+	hub.Publish(1, 3)
+
+	assert.Equal(t, 1, pending(first))
+	assert.Equal(t, 1, pending(second))
+	assert.Equal(t, 0, pending(other))
+
+	unsubscribeFirst()
+	hub.Publish(1, 2)
+
+	assert.Equal(t, 0, pending(first))
+	assert.Equal(t, 1, pending(second))
+	assert.Equal(t, 1, pending(other))
+}
+
+func TestMovedWalletsIncludeTheHouseWallet(t *testing.T) {
+	assert.Equal(t, []int{1, 2}, movedWallets(nil, 1, 2))
+	assert.Equal(t, []int{1, 2, 9}, movedWallets(&model.Fee{HouseWalletId: 9}, 1, 2))
+
+	var hub *WalletHub
+	hub.Publish(1)
+}
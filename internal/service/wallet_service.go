@@ -1,26 +1,152 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+
 	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/money"
 	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+var (
+	ErrWalletNotOwned   = utils.Forbidden("wallet_not_owned", "the wallet does not belong to the user")
+	ErrReceiverMismatch = utils.Invalid("invalid_parameter", "The receiver wallet does not belong to the receiver")
+	ErrSameWallet       = utils.Invalid("invalid_parameter", "The sender and receiver wallets must be different")
 )
 
 type WalletService struct {
 	walletRepository repository.WalletRepository
+	walletHub        *WalletHub
 }
 
-func NewWalletService(walletRepository repository.WalletRepository) *WalletService {
-	return &WalletService{walletRepository: walletRepository}
+// NewWalletService publishes the balance changes it makes to walletHub.
+func NewWalletService(walletRepository repository.WalletRepository, walletHub *WalletHub) *WalletService {
+	return &WalletService{walletRepository: walletRepository, walletHub: walletHub}
 }
 
 func (ws *WalletService) GetWalletByUserId(userId int) ([]model.Wallet, error) {
 	return ws.walletRepository.GetWalletByUserId(userId)
 }
 
+// GetAllWalletsByUserId lists every wallet of the user, closed ones too.
+func (ws *WalletService) GetAllWalletsByUserId(userId int) ([]model.Wallet, error) {
+	return ws.walletRepository.GetAllWalletsByUserId(userId)
+}
+
 func (ws *WalletService) GetById(walletId int) (model.Wallet, error) {
-	return ws.walletRepository.GetById(walletId)
+	wallet, err := ws.walletRepository.GetById(walletId)
+	return wallet, notFound(err, ErrWalletNotFound)
+}
+
+// GetByIdIncludingDeleted returns the wallet even when it or its owner's
+// account was closed.
+func (ws *WalletService) GetByIdIncludingDeleted(walletId int) (model.Wallet, error) {
+	wallet, err := ws.walletRepository.GetByIdIncludingDeleted(walletId)
+	return wallet, notFound(err, ErrWalletNotFound)
+}
+
+func (ws *WalletService) GetAvailableBalance(walletId int) (money.Money, error) {
+	return ws.walletRepository.GetAvailableBalance(walletId)
+}
+
+// Subscribe tells when the balance or available balance of the wallet
+// changed, until the returned function is called.
+func (ws *WalletService) Subscribe(walletId int) (<-chan struct{}, func()) {
+	return ws.walletHub.Subscribe(walletId)
+}
+
+// GetUserWallet returns the user's wallet with the given ID, or the user's
+// default wallet when no ID is given.
+func (ws *WalletService) GetUserWallet(userId int, walletId *int) (model.Wallet, error) {
+	if walletId == nil {
+		wallet, err := ws.walletRepository.GetDefaultWalletByUserId(userId)
+		return wallet, notFound(err, ErrWalletNotFound)
+	}
+
+	wallet, err := ws.GetById(*walletId)
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	if wallet.UserId != userId {
+		return model.Wallet{}, ErrWalletNotOwned
+	}
+	return wallet, nil
+}
+
+// GetReceiverWallet returns the wallet money from senderWallet is sent to:
+// receiverWalletId, which must belong to receiverUserId when both are given,
+// or else the receiver's default wallet. It must not be the sender wallet.
+func (ws *WalletService) GetReceiverWallet(senderWallet model.Wallet, receiverUserId int, receiverWalletId *int) (model.Wallet, error) {
+	if receiverUserId == 0 && receiverWalletId != nil {
+		wallet, err := ws.GetById(*receiverWalletId)
+		if err == nil {
+			receiverUserId = wallet.UserId
+		}
+	}
+
+	receiverWallet, err := ws.GetUserWallet(receiverUserId, receiverWalletId)
+	if errors.Is(err, ErrWalletNotOwned) {
+		return model.Wallet{}, ErrReceiverMismatch
+	}
+	if err != nil {
+		return model.Wallet{}, err
+	}
+
+	if senderWallet.ID == receiverWallet.ID {
+		return model.Wallet{}, ErrSameWallet
+	}
+	return receiverWallet, nil
+}
+
+func (ws *WalletService) Create(actor model.Actor, userId int, name string, currency money.Currency, isDefault bool) (model.Wallet, error) {
+	return ws.walletRepository.Create(actor, userId, name, currency, isDefault)
+}
+
+func (ws *WalletService) Rename(actor model.Actor, walletId int, name string) (model.Wallet, error) {
+	return ws.walletRepository.Rename(actor, walletId, name)
+}
+
+func (ws *WalletService) SetDefault(actor model.Actor, walletId int) (model.Wallet, error) {
+	return ws.walletRepository.SetDefault(actor, walletId)
+}
+
+func (ws *WalletService) Update(actor model.Actor, walletId int, amount money.Money, transactionType string, fee *model.Fee, check repository.MovementCheck) (model.Wallet, error) {
+	wallet, err := ws.walletRepository.Update(actor, walletId, amount, transactionType, fee, check)
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	ws.walletHub.Publish(movedWallets(fee, walletId)...)
+	return wallet, nil
+}
+
+// SetStatus changes the status of the wallet on behalf of actor, who gives
+// reason for it.
+func (ws *WalletService) SetStatus(actor model.Actor, walletId int, status string, reason string) (model.StatusChange, error) {
+	change, err := ws.walletRepository.SetStatus(actor, walletId, model.StatusChange{ToStatus: status, Reason: reason})
+	return change, notFound(err, ErrWalletNotFound)
+}
+
+// Adjust credits or debits the wallet by hand, as described by adjustment.
+func (ws *WalletService) Adjust(actor model.Actor, adjustment model.Adjustment) (model.Transaction, error) {
+	transaction, err := ws.walletRepository.Adjust(actor, adjustment)
+	if err != nil {
+		return model.Transaction{}, notFound(err, ErrWalletNotFound)
+	}
+	ws.walletHub.Publish(adjustment.WalletId)
+	return transaction, nil
 }
 
-func (ws *WalletService) Update(wallet model.Wallet, amount float64, transactionType string) error {
-	return ws.walletRepository.Update(wallet, amount, transactionType)
+// WalletAmount reads an amount a client asked for in the wallet's currency. A
+// currency sent along with the amount must be the wallet's own.
+func WalletAmount(wallet model.Wallet, amount money.Decimal, currency string) (money.Money, error) {
+	if currency != "" {
+		requested, err := money.ParseCurrency(currency)
+		if err != nil || requested != wallet.Currency {
+			return money.Money{}, money.ErrCurrencyMismatch.WithMessage(fmt.Sprintf("The amount must be in the wallet currency %s", wallet.Currency))
+		}
+	}
+	return money.FromDecimal(amount, wallet.Currency)
 }
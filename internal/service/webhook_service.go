@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/repository"
+
+	"go-wallet-service/utils"
+)
+
+const (
+	// WebhookRetryDelay is how long the first retry of a failed delivery
+	// waits. Every further retry waits twice as long as the one before.
+	WebhookRetryDelay = 30 * time.Second
+	// WebhookTimeout bounds a single attempt, response included.
+	WebhookTimeout = 10 * time.Second
+
+	DefaultDeliveryPageSize = 50
+	MaxDeliveryPageSize     = 200
+
+	// Headers of a webhook request. The signature is the hex HMAC-SHA256,
+	// keyed with the endpoint's secret, of the timestamp, a dot and the body.
+	WebhookEventIdHeader    = "X-Webhook-Event-Id"
+	WebhookEventTypeHeader  = "X-Webhook-Event-Type"
+	WebhookDeliveryIdHeader = "X-Webhook-Delivery-Id"
+	WebhookTimestampHeader  = "X-Webhook-Timestamp"
+	WebhookSignatureHeader  = "X-Webhook-Signature"
+
+	webhookClaimLimit = 50
+	// webhookClaimLease outlasts the attempts of a full claim, so a slow
+	// endpoint does not get the same event twice at once.
+	webhookClaimLease = webhookClaimLimit * (WebhookTimeout + time.Second)
+	// maxWebhookResponse is how much of an endpoint's answer is read.
+	maxWebhookResponse = 64 << 10
+)
+
+var ErrInvalidWebhook = utils.Invalid("invalid_webhook", "invalid webhook endpoint")
+
+type WebhookService struct {
+	webhookRepository repository.WebhookRepository
+	client            *http.Client
+}
+
+// NewWebhookService delivers events with client, which should time out
+// within WebhookTimeout.
+func NewWebhookService(webhookRepository repository.WebhookRepository, client *http.Client) *WebhookService {
+	return &WebhookService{webhookRepository: webhookRepository, client: client}
+}
+
+// Register adds an endpoint receiving the events of eventTypes, or of every
+// type when there are none, with a secret of its own to check their
+// signatures. The secret is only ever returned here.
+func (ws *WebhookService) Register(actor model.Actor, endpointUrl string, eventTypes []string, description string) (model.WebhookEndpoint, error) {
+	parsed, err := url.Parse(endpointUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return model.WebhookEndpoint{}, fmt.Errorf("%w: the url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	for _, eventType := range eventTypes {
+		if !model.IsEventType(eventType) {
+			return model.WebhookEndpoint{}, fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	return ws.webhookRepository.CreateEndpoint(actor, model.WebhookEndpoint{
+		URL:         endpointUrl,
+		Secret:      "whsec_" + hex.EncodeToString(secret),
+		EventTypes:  eventTypes,
+		Description: description,
+	})
+}
+
+func (ws *WebhookService) GetEndpoints() ([]model.WebhookEndpoint, error) {
+	return ws.webhookRepository.GetEndpoints()
+}
+
+func (ws *WebhookService) Remove(actor model.Actor, endpointId int) (model.WebhookEndpoint, error) {
+	endpoint, err := ws.webhookRepository.RemoveEndpoint(actor, endpointId)
+	return endpoint, notFound(err, ErrWebhookNotFound)
+}
+
+// GetDeliveries returns the latest deliveries to the endpoint, only those
+// with status when it is set.
+func (ws *WebhookService) GetDeliveries(endpointId int, status string, limit int) ([]model.WebhookDelivery, error) {
+	if limit <= 0 || limit > MaxDeliveryPageSize {
+		return nil, ErrInvalidPageSize
+	}
+	if _, err := ws.webhookRepository.GetEndpointById(endpointId); err != nil {
+		return nil, notFound(err, ErrWebhookNotFound)
+	}
+	return ws.webhookRepository.GetDeliveries(endpointId, status, limit)
+}
+
+// Redeliver sends a delivered or dead delivery again.
+func (ws *WebhookService) Redeliver(actor model.Actor, deliveryId int) (model.WebhookDelivery, error) {
+	delivery, err := ws.webhookRepository.Redeliver(actor, deliveryId)
+	return delivery, notFound(err, ErrDeliveryNotFound)
+}
+
+// RunDispatcher sends the due deliveries every interval until ctx is done.
+// Any number of replicas may run it at once.
+func (ws *WebhookService) RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ws.DispatchDue(); err != nil {
+				log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to claim due webhook deliveries due to: %s", err.Error())).Send()
+			}
+		}
+	}
+}
+
+// DispatchDue claims the deliveries that are due and attempts each once.
+func (ws *WebhookService) DispatchDue() error {
+	deliveries, err := ws.webhookRepository.ClaimDue(webhookClaimLimit, webhookClaimLease)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		settled, err := ws.deliver(delivery)
+		if errors.Is(err, repository.ErrDeliveryChanged) {
+			continue
+		}
+		if err != nil {
+			log.Error().Str("error", "database_error").Str("error_description", fmt.Sprintf("Unable to deliver webhook delivery [%d] due to: %s", delivery.ID, err.Error())).Send()
+			continue
+		}
+		if settled.Status == model.DeliveryStatusDead {
+			log.Warn().Int("delivery", settled.ID).Int("endpoint", settled.EndpointId).Int("event", settled.EventId).Str("reason", *settled.LastError).Msg("Webhook delivery is dead")
+		}
+	}
+	return nil
+}
+
+// deliver sends the event of one claimed delivery to its endpoint and records
+// how it went. A failed delivery is retried until it has used up its
+// attempts.
+func (ws *WebhookService) deliver(delivery model.WebhookDelivery) (model.WebhookDelivery, error) {
+	endpoint, err := ws.webhookRepository.GetEndpointById(delivery.EndpointId)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	event, err := ws.webhookRepository.GetEventById(delivery.EventId)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	body, err := json.Marshal(model.EventData{ID: event.ID, Type: event.Type, CreationDate: event.CreationDate, Data: json.RawMessage(event.Payload)})
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	attempt := ws.send(endpoint, delivery, event, body)
+
+	var retryAt *time.Time
+	if !attempt.Succeeded() && delivery.Attempts+1 < model.MaxWebhookAttempts {
+		next := time.Now().Add(webhookRetryDelay(delivery.Attempts))
+		retryAt = &next
+	}
+	return ws.webhookRepository.Settle(delivery, attempt, retryAt)
+}
+
+// send makes one attempt of a delivery. Only a 2xx answer delivers it.
+func (ws *WebhookService) send(endpoint model.WebhookEndpoint, delivery model.WebhookDelivery, event model.OutboxEvent, body []byte) model.WebhookAttempt {
+	request, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return model.WebhookAttempt{Error: err.Error()}
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookEventIdHeader, strconv.Itoa(event.ID))
+	request.Header.Set(WebhookEventTypeHeader, event.Type)
+	request.Header.Set(WebhookDeliveryIdHeader, strconv.Itoa(delivery.ID))
+	request.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, timestamp, body))
+
+	response, err := ws.client.Do(request)
+	if err != nil {
+		return model.WebhookAttempt{Error: err.Error()}
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, maxWebhookResponse))
+
+	attempt := model.WebhookAttempt{StatusCode: response.StatusCode}
+	if !attempt.Succeeded() {
+		attempt.Error = fmt.Sprintf("the endpoint answered %d", response.StatusCode)
+	}
+	return attempt
+}
+
+// SignWebhook is the signature of a webhook request sent at timestamp, in
+// seconds since the epoch, with body. Receivers compute it with their
+// secret and compare it to the X-Webhook-Signature header.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay is how long to wait after attempts failed attempts.
+func webhookRetryDelay(attempts int) time.Duration {
+	return WebhookRetryDelay << attempts
+}
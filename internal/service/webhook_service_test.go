@@ -0,0 +1,154 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-wallet-service/internal/model"
+	"go-wallet-service/internal/repository"
+)
+
+// recordingWebhookRepository hands out its due deliveries once and keeps how
+// each attempt went.
+type recordingWebhookRepository struct {
+	repository.WebhookRepository
+	endpoint model.WebhookEndpoint
+	event    model.OutboxEvent
+	due      []model.WebhookDelivery
+	attempts []model.WebhookAttempt
+	retries  []*time.Time
+}
+
+func (r *recordingWebhookRepository) GetEndpointById(endpointId int) (model.WebhookEndpoint, error) {
+	return r.endpoint, nil
+}
+
+func (r *recordingWebhookRepository) GetEventById(eventId int) (model.OutboxEvent, error) {
+	return r.event, nil
+}
+
+func (r *recordingWebhookRepository) ClaimDue(limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	due := r.due
+	r.due = nil
+	return due, nil
+}
+
+func (r *recordingWebhookRepository) Settle(delivery model.WebhookDelivery, attempt model.WebhookAttempt, retryAt *time.Time) (model.WebhookDelivery, error) {
+	r.attempts = append(r.attempts, attempt)
+	r.retries = append(r.retries, retryAt)
+
+	delivery.Attempts++
+	switch {
+	case attempt.Succeeded():
+		delivery.Status = model.DeliveryStatusDelivered
+	case retryAt != nil:
+		delivery.NextAttemptDate = *retryAt
+	default:
+		delivery.Status = model.DeliveryStatusDead
+		delivery.LastError = &attempt.Error
+	}
+	return delivery, nil
+}
+
+// webhookReceiver is an endpoint answering every request with status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.requests = append(wr.requests, r)
+	wr.bodies = append(wr.bodies, body)
+	w.WriteHeader(wr.status)
+}
+
+func newWebhookTest(t *testing.T, status int) (*WebhookService, *recordingWebhookRepository, *webhookReceiver) {
+	receiver := &webhookReceiver{status: status}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	webhooks := &recordingWebhookRepository{
+		endpoint: model.WebhookEndpoint{ID: 3, URL: server.URL + "/hooks", Secret: "whsec_test", Active: true},
+		event:    model.OutboxEvent{ID: 41, Type: model.EventTypeWalletDeposited, Payload: `{"transaction": {"id": 9}}`, CreationDate: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	return NewWebhookService(webhooks, server.Client()), webhooks, receiver
+}
+
+func TestDeliveryIsSignedWithTheEndpointSecret(t *testing.T) {
+	webhookService, webhooks, receiver := newWebhookTest(t, http.StatusNoContent)
+	webhooks.due = []model.WebhookDelivery{{ID: 7, EndpointId: 3, EventId: 41, Status: model.DeliveryStatusPending}}
+
+	assert.NoError(t, webhookService.DispatchDue())
+
+	if assert.Len(t, receiver.requests, 1) {
+		request, body := receiver.requests[0], receiver.bodies[0]
+		assert.Equal(t, "/hooks", request.URL.Path)
+		assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+		assert.Equal(t, "41", request.Header.Get(WebhookEventIdHeader))
+		assert.Equal(t, model.EventTypeWalletDeposited, request.Header.Get(WebhookEventTypeHeader))
+		assert.Equal(t, "7", request.Header.Get(WebhookDeliveryIdHeader))
+		assert.JSONEq(t, `{"id": 41, "type": "wallet.deposited", "creation_date": "2026-03-01T12:00:00Z", "data": {"transaction": {"id": 9}}}`, string(body))
+
+		timestamp, err := strconv.ParseInt(request.Header.Get(WebhookTimestampHeader), 10, 64)
+		assert.NoError(t, err)
+		assert.Equal(t, SignWebhook("whsec_test", timestamp, body), request.Header.Get(WebhookSignatureHeader))
+		assert.NotEqual(t, SignWebhook("whsec_other", timestamp, body), request.Header.Get(WebhookSignatureHeader))
+	}
+	assert.Equal(t, []model.WebhookAttempt{{StatusCode: http.StatusNoContent}}, webhooks.attempts)
+	assert.Equal(t, []*time.Time{nil}, webhooks.retries)
+}
+
+func TestFailedDeliveryIsRetriedWithBackoffUntilDead(t *testing.T) {
+	webhookService, webhooks, receiver := newWebhookTest(t, http.StatusInternalServerError)
+	webhooks.due = []model.WebhookDelivery{
+		{ID: 1, EndpointId: 3, EventId: 41, Status: model.DeliveryStatusPending},
+		{ID: 2, EndpointId: 3, EventId: 41, Status: model.DeliveryStatusPending, Attempts: 3},
+		{ID: 3, EndpointId: 3, EventId: 41, Status: model.DeliveryStatusPending, Attempts: model.MaxWebhookAttempts - 1},
+	}
+
+	start := time.Now()
+	assert.NoError(t, webhookService.DispatchDue())
+
+	assert.Len(t, receiver.requests, 3)
+	if assert.Len(t, webhooks.retries, 3) {
+		assert.WithinDuration(t, start.Add(WebhookRetryDelay), *webhooks.retries[0], time.Second)
+		assert.WithinDuration(t, start.Add(8*WebhookRetryDelay), *webhooks.retries[1], time.Second)
+		assert.Nil(t, webhooks.retries[2])
+	}
+	assert.Equal(t, model.WebhookAttempt{StatusCode: http.StatusInternalServerError, Error: "the endpoint answered 500"}, webhooks.attempts[0])
+}
+
+func TestUnreachableEndpointFailsTheAttempt(t *testing.T) {
+	webhookService, webhooks, _ := newWebhookTest(t, http.StatusOK)
+	webhooks.endpoint.URL = "http://127.0.0.1:1/hooks"
+	webhooks.due = []model.WebhookDelivery{{ID: 1, EndpointId: 3, EventId: 41, Status: model.DeliveryStatusPending}}
+
+	assert.NoError(t, webhookService.DispatchDue())
+
+	if assert.Len(t, webhooks.attempts, 1) {
+		assert.Zero(t, webhooks.attempts[0].StatusCode)
+		assert.NotEmpty(t, webhooks.attempts[0].Error)
+		assert.NotNil(t, webhooks.retries[0])
+	}
+}
+
+func TestRegisterChecksTheEndpoint(t *testing.T) {
+	webhookService := NewWebhookService(&recordingWebhookRepository{}, http.DefaultClient)
+
+	_, err := webhookService.Register(model.SystemActor, "ftp://example.com/hooks", nil, "")
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	_, err = webhookService.Register(model.SystemActor, "https://example.com/hooks", []string{"wallet.exploded"}, "")
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
@@ -13,9 +17,13 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"go-wallet-service/internal/ledger"
+	"go-wallet-service/internal/middleware"
 	"go-wallet-service/internal/repository"
 	"go-wallet-service/internal/route"
+	"go-wallet-service/internal/rpc"
 	"go-wallet-service/internal/service"
+	"go-wallet-service/utils"
 )
 
 const (
@@ -23,31 +31,117 @@ const (
 
 	_DotEnvDatabaseUrl = "DATABASE_URL"
 	_DotEnvBaseUrl     = "BASE_URL"
+
+	_DotEnvIdempotencyKeyTTL    = "IDEMPOTENCY_KEY_TTL"
+	_DotEnvAccessTokenTTL       = "ACCESS_TOKEN_TTL"
+	_DotEnvRefreshTokenTTL      = "REFRESH_TOKEN_TTL"
+	_DotEnvFXRatesFile          = "FX_RATES_FILE"
+	_DotEnvHoldTTL              = "HOLD_TTL"
+	_DotEnvHoldSweepInterval    = "HOLD_SWEEP_INTERVAL"
+	_DotEnvSchedulePollInterval = "SCHEDULE_POLL_INTERVAL"
+	_DotEnvHouseUserId          = "HOUSE_USER_ID"
+	_DotEnvWebhookPollInterval  = "WEBHOOK_POLL_INTERVAL"
+	_DotEnvGRPCPort             = "GRPC_PORT"
+
+	_DefaultIdempotencyKeyTTL    = 24 * time.Hour
+	_DefaultAccessTokenTTL       = 15 * time.Minute
+	_DefaultRefreshTokenTTL      = 30 * 24 * time.Hour
+	_DefaultHoldTTL              = 7 * 24 * time.Hour
+	_DefaultHoldSweepInterval    = time.Minute
+	_DefaultSchedulePollInterval = time.Minute
+	_DefaultWebhookPollInterval  = 5 * time.Second
+	_DefaultGRPCPort             = "9090"
 )
 
 var (
-	LogLevel      string
-	DatabaseUrl   string
-	walletService *service.WalletService
-	userService   *service.UserService
+	LogLevel           string
+	DatabaseUrl        string
+	walletService      *service.WalletService
+	userService        *service.UserService
+	idempotencyService *service.IdempotencyService
+	tokenService       *service.TokenService
+	holdService        *service.HoldService
+	scheduleService    *service.ScheduleService
+	limitService       *service.LimitService
+	feeService         *service.FeeService
+	movementService    *service.MovementService
+	auditService       *service.AuditService
+	webhookService     *service.WebhookService
 )
 
 func main() {
+	checkLedger := flag.Bool("check-ledger", false, "Verify the ledger invariants and exit")
+	verifyAudit := flag.Bool("verify-audit", false, "Verify the hash chain of the audit log and exit")
+	flag.Parse()
+
 	loadAndCheckDotEnvFile()
 	setLogLevel()
 	db := connectToDatabase()
 	defer db.Close()
 
+	if *checkLedger {
+		if !runLedgerCheck(db) {
+			db.Close()
+			os.Exit(1)
+		}
+		return
+	}
+	if *verifyAudit {
+		if !runAuditCheck(db) {
+			db.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
 	userRepository := repository.NewUserRepository(db)
 	walletRepository := repository.NewWalletRepository(db)
+	idempotencyRepository := repository.NewIdempotencyRepository(db)
+	tokenRepository := repository.NewTokenRepository(db)
+	holdRepository := repository.NewHoldRepository(db)
+	scheduleRepository := repository.NewScheduleRepository(db)
+	limitRepository := repository.NewLimitRepository(db)
+	feeRepository := repository.NewFeeRepository(db)
+	auditRepository := repository.NewAuditRepository(db)
+	webhookRepository := repository.NewWebhookRepository(db)
+
+	rateProvider := fxRateProvider(db)
+	walletHub := service.NewWalletHub()
+	userService = service.NewUserService(userRepository, rateProvider, walletHub)
+	walletService = service.NewWalletService(walletRepository, walletHub)
+	idempotencyService = service.NewIdempotencyService(idempotencyRepository, durationFromDotEnv(_DotEnvIdempotencyKeyTTL, _DefaultIdempotencyKeyTTL))
+	tokenService = service.NewTokenService(tokenRepository, durationFromDotEnv(_DotEnvAccessTokenTTL, _DefaultAccessTokenTTL), durationFromDotEnv(_DotEnvRefreshTokenTTL, _DefaultRefreshTokenTTL))
+	holdService = service.NewHoldService(holdRepository, rateProvider, durationFromDotEnv(_DotEnvHoldTTL, _DefaultHoldTTL), walletHub)
+	limitService = service.NewLimitService(limitRepository)
+	feeService = service.NewFeeService(feeRepository, walletRepository, houseUserId())
+	movementService = service.NewMovementService(walletService, userService, limitService, feeService)
+	scheduleService = service.NewScheduleService(scheduleRepository, walletRepository, rateProvider, limitService, feeService, walletHub)
+	auditService = service.NewAuditService(auditRepository)
+	webhookService = service.NewWebhookService(webhookRepository, &http.Client{Timeout: service.WebhookTimeout})
 
-	userService = service.NewUserService(userRepository)
-	walletService = service.NewWalletService(walletRepository)
+	go holdService.RunSweeper(context.Background(), durationFromDotEnv(_DotEnvHoldSweepInterval, _DefaultHoldSweepInterval))
+	go scheduleService.RunWorker(context.Background(), durationFromDotEnv(_DotEnvSchedulePollInterval, _DefaultSchedulePollInterval))
+	go webhookService.RunDispatcher(context.Background(), durationFromDotEnv(_DotEnvWebhookPollInterval, _DefaultWebhookPollInterval))
 
 	router := mux.NewRouter()
 	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
-	route.WalletRoutes(router, userService, walletService)
-	route.UserRoutes(router, userService, walletService)
+	router.Use(middleware.Audit(auditService))
+	// every version is served by the same services, so a version only
+	// changes which routes it serves and how they write responses
+	for _, version := range route.Versions {
+		api := route.VersionRouter(router, version)
+		route.OAuthRoutes(api, tokenService)
+		route.WalletRoutes(api, tokenService, walletService, userService, holdService, movementService, limitService, feeService, idempotencyService)
+		route.UserRoutes(api, tokenService, userService, walletService, movementService, idempotencyService)
+		route.TransactionRoutes(api, tokenService, userService, idempotencyService)
+		route.ScheduleRoutes(api, tokenService, scheduleService, walletService, idempotencyService)
+		route.AdminRoutes(api, tokenService, userService, walletService, auditService, webhookService, idempotencyService)
+		if err := route.OpenAPIRoutes(api, version); err != nil {
+			log.Panic().Str("error", "openapi_failed").Str("error_description", fmt.Sprintf("Unable to document version %d of the routes due to: %s", version.Number, err.Error())).Send()
+		}
+	}
+
+	go serveGRPC(grpcPort())
 
 	log.Debug().Msg("Connected to Server")
 	if err := http.ListenAndServe(":8080", router); err != nil {
@@ -84,6 +178,77 @@ func loadAndCheckDotEnvFile() {
 	LogLevel = os.Getenv(_DotEnvLogLevel)
 }
 
+func durationFromDotEnv(config string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(config)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Panic().Str("error", "invalid_dot_env").Str("error_description", fmt.Sprintf("%s must be a positive duration such as 24h", config)).Send()
+	}
+	return duration
+}
+
+// houseUserId is the user whose wallets collect fees, from HOUSE_USER_ID. No
+// fees are charged when it is not set.
+func houseUserId() int {
+	value := os.Getenv(_DotEnvHouseUserId)
+	if value == "" {
+		return 0
+	}
+
+	userId, err := strconv.Atoi(value)
+	if err != nil || userId <= 0 {
+		log.Panic().Str("error", "invalid_dot_env").Str("error_description", fmt.Sprintf("%s must be a user ID", _DotEnvHouseUserId)).Send()
+	}
+	return userId
+}
+
+// grpcPort is the port the gRPC API listens on, from GRPC_PORT.
+func grpcPort() string {
+	value := os.Getenv(_DotEnvGRPCPort)
+	if value == "" {
+		return _DefaultGRPCPort
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		log.Panic().Str("error", "invalid_dot_env").Str("error_description", fmt.Sprintf("%s must be a port number", _DotEnvGRPCPort)).Send()
+	}
+	return value
+}
+
+// serveGRPC serves the gRPC API on port with the services of the REST routes.
+func serveGRPC(port string) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Panic().Str("error", "connection_failed").Str("error_description", fmt.Sprintf("Unable to listen for gRPC on port %s due to: %s", port, err.Error())).Send()
+	}
+
+	server := rpc.NewServer(tokenService, walletService, userService, movementService, idempotencyService, auditService)
+	log.Debug().Msgf("Serving gRPC on port %s", port)
+	if err := server.Serve(listener); err != nil {
+		log.Panic().Str("error", "connection_failed").Str("error_description", fmt.Sprintf("Unable to serve gRPC due to: %s", err.Error())).Send()
+	}
+}
+
+// fxRateProvider quotes exchange rates from FX_RATES_FILE when it is set and
+// from the fx_rates table otherwise.
+func fxRateProvider(db *sqlx.DB) service.FXRateProvider {
+	path := os.Getenv(_DotEnvFXRatesFile)
+	if path == "" {
+		return service.NewTableRateProvider(repository.NewFXRateRepository(db))
+	}
+
+	provider, err := service.NewFileRateProvider(path)
+	if err != nil {
+		log.Panic().Str("error", "invalid_dot_env").Str("error_description", fmt.Sprintf("Unable to load exchange rates from %s due to: %s", path, err.Error())).Send()
+	}
+	return provider
+}
+
 func connectToDatabase() *sqlx.DB {
 	db, err := sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
 	if err != nil {
@@ -92,6 +257,51 @@ func connectToDatabase() *sqlx.DB {
 	return db
 }
 
+func runLedgerCheck(db *sqlx.DB) bool {
+	report, err := ledger.Check(db)
+	if err != nil {
+		log.Error().Str("error", "ledger_check_failed").Str("error_description", fmt.Sprintf("Unable to check ledger due to: %s", err.Error())).Send()
+		return false
+	}
+
+	for _, total := range report.Totals {
+		fmt.Printf("%s entries total %d\n", total.Currency, total.Total)
+	}
+	for _, postingId := range report.UnbalancedPostings {
+		fmt.Printf("posting [%d] is unbalanced\n", postingId)
+	}
+	for _, mismatch := range report.WalletMismatches {
+		fmt.Printf("wallet [%d] balance %d does not match ledger balance %d\n", mismatch.WalletId, mismatch.Balance, mismatch.LedgerBalance)
+	}
+
+	if !report.OK() {
+		fmt.Println("ledger is inconsistent")
+		return false
+	}
+	fmt.Println("ledger is consistent")
+	return true
+}
+
+func runAuditCheck(db *sqlx.DB) bool {
+	verification, err := repository.NewAuditRepository(db).Verify()
+	if err != nil {
+		log.Error().Str("error", "audit_check_failed").Str("error_description", fmt.Sprintf("Unable to verify audit log due to: %s", err.Error())).Send()
+		return false
+	}
+
+	if verification.Unhashed > 0 {
+		fmt.Printf("%d entries were written before the log was chained\n", verification.Unhashed)
+	}
+	if !verification.OK() {
+		fmt.Printf("entry [%d] is broken: %s\n", verification.BrokenId, verification.Problem)
+		fmt.Printf("audit log is broken after %d intact entries\n", verification.Chained)
+		return false
+	}
+	fmt.Printf("%d entries chained, last entry [%d] hashed %s\n", verification.Chained, verification.LastId, verification.LastHash)
+	fmt.Println("audit log is intact")
+	return true
+}
+
 func setLogLevel() {
 	switch LogLevel {
 	case "DEBUG":
@@ -104,6 +314,5 @@ func setLogLevel() {
 }
 
 func notFoundHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	json.NewEncoder(w).Encode(map[string]string{"error": "Not Found"})
+	utils.WriteProblem(w, r, utils.NotFound("not_found", "No resource exists at this path"))
 }
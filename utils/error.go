@@ -2,24 +2,217 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ProblemTypePrefix starts the type URI of every problem response; the error
+// code completes it.
+const ProblemTypePrefix = "urn:go-wallet-service:problem:"
+
+// ErrorKind places an Error in the catalog and decides the HTTP status it is
+// answered with.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindInsufficientFunds
+	KindNotFound
+	KindConflict
+	KindUnprocessable
 )
 
+var kindStatuses = map[ErrorKind]int{
+	KindInternal:          http.StatusInternalServerError,
+	KindValidation:        http.StatusBadRequest,
+	KindUnauthorized:      http.StatusUnauthorized,
+	KindForbidden:         http.StatusForbidden,
+	KindInsufficientFunds: http.StatusForbidden,
+	KindNotFound:          http.StatusNotFound,
+	KindConflict:          http.StatusConflict,
+	KindUnprocessable:     http.StatusUnprocessableEntity,
+}
+
+var kindTitles = map[ErrorKind]string{
+	KindInternal:          "Internal error",
+	KindValidation:        "Invalid request",
+	KindUnauthorized:      "Unauthorized",
+	KindForbidden:         "Forbidden",
+	KindInsufficientFunds: "Insufficient funds",
+	KindNotFound:          "Not found",
+	KindConflict:          "Conflict",
+	KindUnprocessable:     "Unprocessable request",
+}
+
+// Error is a domain error with a stable, machine-readable code. Packages
+// declare the errors they return as Errors, and handlers return them for
+// WriteProblem to answer. Two Errors match under errors.Is when their kind
+// and code are the same.
+type Error struct {
+	Kind       ErrorKind
+	Code       string
+	Message    string
+	Extensions map[string]any
+	cause      error
+}
+
+func NewError(kind ErrorKind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Invalid(code string, message string) *Error {
+	return NewError(KindValidation, code, message)
+}
+
+func Unauthorized(code string, message string) *Error {
+	return NewError(KindUnauthorized, code, message)
+}
+
+func Forbidden(code string, message string) *Error {
+	return NewError(KindForbidden, code, message)
+}
+
+func InsufficientFunds(code string, message string) *Error {
+	return NewError(KindInsufficientFunds, code, message)
+}
+
+func NotFound(code string, message string) *Error {
+	return NewError(KindNotFound, code, message)
+}
+
+func Conflict(code string, message string) *Error {
+	return NewError(KindConflict, code, message)
+}
+
+func Unprocessable(code string, message string) *Error {
+	return NewError(KindUnprocessable, code, message)
+}
+
+// Internal reports a failure the client cannot act on. Only message is shown
+// to the client; the cause is logged.
+func Internal(message string, cause error) *Error {
+	return &Error{Kind: KindInternal, Code: "internal_error", Message: message, cause: cause}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.cause.Error())
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Kind == e.Kind && other.Code == e.Code
+}
+
+// Status is the HTTP status the error is answered with.
+func (e *Error) Status() int {
+	return kindStatuses[e.Kind]
+}
+
+// WithMessage returns a copy of the error that tells the client message.
+func (e *Error) WithMessage(message string) *Error {
+	copied := e.copy()
+	copied.Message = message
+	return copied
+}
+
+// With returns a copy of the error whose problem response also carries the
+// member key.
+func (e *Error) With(key string, value any) *Error {
+	copied := e.copy()
+	copied.Extensions = make(map[string]any, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		copied.Extensions[k] = v
+	}
+	copied.Extensions[key] = value
+	return copied
+}
+
+func (e *Error) copy() *Error {
+	copied := *e
+	return &copied
+}
+
+// Problem is an error that tells clients more than the catalog error it
+// matches, such as the details of the limit a movement broke.
+type Problem interface {
+	error
+	Problem() *Error
+}
+
+// AsError finds the catalog error in err's chain. A client error wrapped with
+// more detail, such as fmt.Errorf("%w: day_of_month is out of range", ...),
+// keeps that detail as its message, and a Problem is answered as it tells.
+// Request validation failures list their fields under "errors", and anything
+// else is an internal error.
+func AsError(err error) *Error {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return Invalid("invalid_parameter", "Parameters are missing, not expected or not matching the required format").With("errors", validationErr.Fields)
+	}
+	var problem Problem
+	if errors.As(err, &problem) {
+		return problem.Problem()
+	}
+
+	var appErr *Error
+	if !errors.As(err, &appErr) {
+		return Internal("An unexpected error occurred", err)
+	}
+	if appErr.Kind != KindInternal && err != error(appErr) {
+		return appErr.WithMessage(err.Error())
+	}
+	return appErr
+}
+
+// WriteProblem answers err with an RFC 7807 application/problem+json response.
+// Internal errors are logged with their cause, which the client never sees.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := AsError(err)
+	status := appErr.Status()
+
+	if appErr.Kind == KindInternal {
+		log.Error().Str("error", appErr.Code).Str("error_description", fmt.Sprintf("%s %s failed due to: %s", r.Method, r.URL.Path, err.Error())).Send()
+	} else {
+		log.Debug().Str("error", appErr.Code).Str("error_description", appErr.Message).Send()
+	}
+
+	problem := make(map[string]any, len(appErr.Extensions)+6)
+	for key, value := range appErr.Extensions {
+		problem[key] = value
+	}
+	problem["type"] = ProblemTypePrefix + appErr.Code
+	problem["title"] = kindTitles[appErr.Kind]
+	problem["status"] = status
+	problem["detail"] = appErr.Message
+	problem["instance"] = r.URL.Path
+	problem["code"] = appErr.Code
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// ErrorResponse is the error body of the OAuth2 endpoints, whose format RFC
+// 6749 fixes. Every other endpoint answers with WriteProblem.
 type ErrorResponse struct {
 	Error            string `json:"error"`
 	ErrorDescription string `json:"error_description"`
 	Code             int    `json:"code"`
 }
 
-/*
-func NewErrorResponse(errorType string, errorDescription string, code int) ErrorResponse {
-	return ErrorResponse{
-		Error:            errorType,
-		ErrorDescription: errorDescription,
-		Code:             code,
-	}
-}*/
-
 func HttpErrorResponse(w http.ResponseWriter, errorType string, errorDescription string, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
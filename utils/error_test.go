@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errHoldNotActive = Conflict("hold_not_active", "the hold is no longer active")
+
+func TestAsError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err     error
+		kind    ErrorKind
+		code    string
+		message string
+	}{
+		"catalog error":    {errHoldNotActive, KindConflict, "hold_not_active", "the hold is no longer active"},
+		"wrapped detail":   {fmt.Errorf("%w: captured twice", errHoldNotActive), KindConflict, "hold_not_active", "the hold is no longer active: captured twice"},
+		"custom message":   {errHoldNotActive.WithMessage("Already captured"), KindConflict, "hold_not_active", "Already captured"},
+		"validation error": {&ValidationError{Fields: []FieldError{{Field: "amount", Rule: "required"}}}, KindValidation, "invalid_parameter", "Parameters are missing, not expected or not matching the required format"},
+		"unknown error":    {errors.New("connection refused"), KindInternal, "internal_error", "An unexpected error occurred"},
+		"internal cause":   {fmt.Errorf("query: %w", Internal("Unable to log out", errors.New("connection refused"))), KindInternal, "internal_error", "Unable to log out"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			appErr := AsError(tc.err)
+
+			assert.Equal(t, tc.kind, appErr.Kind)
+			assert.Equal(t, tc.code, appErr.Code)
+			assert.Equal(t, tc.message, appErr.Message)
+		})
+	}
+}
+
+func TestErrorsMatchByKindAndCode(t *testing.T) {
+	assert.ErrorIs(t, errHoldNotActive.WithMessage("Already captured"), errHoldNotActive)
+	assert.ErrorIs(t, fmt.Errorf("capture: %w", errHoldNotActive.With("hold_id", 7)), errHoldNotActive)
+	assert.NotErrorIs(t, Invalid("hold_not_active", "the hold is no longer active"), errHoldNotActive)
+	assert.NotErrorIs(t, Conflict("schedule_closed", "the schedule is closed"), errHoldNotActive)
+}
+
+func TestWriteProblem(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/wallet/1/holds/7/capture", nil)
+	response := httptest.NewRecorder()
+
+	WriteProblem(response, request, errHoldNotActive.With("hold_id", 7))
+
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "urn:go-wallet-service:problem:hold_not_active",
+		"title": "Conflict",
+		"status": 409,
+		"detail": "the hold is no longer active",
+		"instance": "/wallet/1/holds/7/capture",
+		"code": "hold_not_active",
+		"hold_id": 7
+	}`, response.Body.String())
+}
+
+func TestWriteProblemHidesInternalCauses(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/wallet/1/balance", nil)
+	response := httptest.NewRecorder()
+
+	WriteProblem(response, request, errors.New("pq: password authentication failed"))
+
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Contains(t, response.Body.String(), `"code":"internal_error"`)
+	assert.NotContains(t, response.Body.String(), "password")
+}
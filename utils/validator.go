@@ -1,17 +1,167 @@
 package utils
 
 import (
-	"encoding/json"
-	"net/http"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
-func JsonErrorUnless(condition bool, message string, details string, status int, w http.ResponseWriter) {
-	if !condition {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(status)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":   message,
-			"details": details,
-		})
+// FieldError is one rule a request field failed, named by its json key.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every failing field of a request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidatorFunc reports whether a field value passes a rule. param is what
+// follows the rule's "=" in the tag, if anything.
+type ValidatorFunc func(value reflect.Value, param string) bool
+
+var validators = map[string]ValidatorFunc{
+	"required": func(value reflect.Value, _ string) bool { return !value.IsZero() },
+	"min": func(value reflect.Value, param string) bool {
+		order, ok := compare(value, param)
+		return ok && order >= 0
+	},
+	"max": func(value reflect.Value, param string) bool {
+		order, ok := compare(value, param)
+		return ok && order <= 0
+	},
+	"oneof": func(value reflect.Value, param string) bool {
+		for _, option := range strings.Fields(param) {
+			if fmt.Sprint(value.Interface()) == option {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// RegisterValidator adds a rule that binding tags can name. Rules must be
+// registered before requests are served.
+func RegisterValidator(rule string, validator ValidatorFunc) {
+	validators[rule] = validator
+}
+
+// Validate checks the fields of the struct s points to against the rules in
+// their binding tags, such as `binding:"required,min=0,max=100"`. Only
+// required applies to a field left out of the request; the other rules are
+// checked once it has a value. It returns a *ValidationError naming every
+// field that fails.
+func Validate(s any) error {
+	value := reflect.Indirect(reflect.ValueOf(s))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot validate %T", s)
+	}
+
+	var failed []FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("binding")
+		if tag == "" {
+			continue
+		}
+
+		name := fieldName(field)
+		fieldValue := value.Field(i)
+		present := !fieldValue.IsZero()
+		for _, rule := range strings.Split(tag, ",") {
+			rule, param, _ := strings.Cut(rule, "=")
+			validator, ok := validators[rule]
+			if !ok {
+				return fmt.Errorf("unknown validation rule %q on %s", rule, field.Name)
+			}
+
+			target := fieldValue
+			if rule != "required" {
+				if !present {
+					continue
+				}
+				target = reflect.Indirect(fieldValue)
+			}
+			if !validator(target, param) {
+				failed = append(failed, FieldError{Field: name, Rule: rule, Message: ruleMessage(name, rule, param)})
+				break
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return &ValidationError{Fields: failed}
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func ruleMessage(field string, rule string, param string) string {
+	switch rule {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", field, param)
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", field, param)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.Join(strings.Fields(param), ", "))
+	default:
+		return fmt.Sprintf("%s is not a valid %s", field, rule)
+	}
+}
+
+// compare orders a field against the bound of a min or max rule: numbers by
+// value, strings, slices and maps by length, and any other type by the
+// number its String method prints, such as a decimal amount. A value with no
+// size to compare fails both rules.
+func compare(value reflect.Value, param string) (int, bool) {
+	bound, ok := new(big.Rat).SetString(param)
+	if !ok {
+		return 0, false
+	}
+
+	var size *big.Rat
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = new(big.Rat).SetInt64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = new(big.Rat).SetUint64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size, ok = new(big.Rat).SetString(strconv.FormatFloat(value.Float(), 'f', -1, 64))
+	case reflect.String:
+		size = new(big.Rat).SetInt64(int64(utf8.RuneCountInString(value.String())))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		size = new(big.Rat).SetInt64(int64(value.Len()))
+	default:
+		stringer, isStringer := value.Interface().(fmt.Stringer)
+		if !isStringer {
+			return 0, false
+		}
+		size, ok = new(big.Rat).SetString(stringer.String())
+	}
+	if !ok {
+		return 0, false
 	}
+	return size.Cmp(bound), true
 }
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// amount is a struct that prints the number it holds, like a decimal amount.
+type amount struct {
+	value string
+}
+
+func (a amount) String() string {
+	return a.value
+}
+
+type params struct {
+	UserId   int     `json:"user_id" binding:"required"`
+	Amount   amount  `json:"amount" binding:"required,min=0,max=100"`
+	Name     *string `json:"name" binding:"max=5"`
+	Kind     string  `json:"kind" binding:"oneof=a b"`
+	Code     string  `json:"code" binding:"upper"`
+	Optional int     `binding:"min=1"`
+}
+
+func TestValidate(t *testing.T) {
+	RegisterValidator("upper", func(value reflect.Value, _ string) bool {
+		return value.String() == "" || value.String() == "ABC"
+	})
+	long := "too long"
+
+	for name, tc := range map[string]struct {
+		params params
+		failed []string
+	}{
+		"valid":            {params{UserId: 1, Amount: amount{"99.99"}, Kind: "b", Code: "ABC"}, nil},
+		"missing required": {params{}, []string{"user_id:required", "amount:required"}},
+		"zero is missing":  {params{UserId: 1, Amount: amount{"0"}}, nil},
+		"below minimum":    {params{UserId: 1, Amount: amount{"-0.01"}}, []string{"amount:min"}},
+		"above maximum":    {params{UserId: 1, Amount: amount{"100.01"}}, []string{"amount:max"}},
+		"pointer length":   {params{UserId: 1, Amount: amount{"1"}, Name: &long}, []string{"name:max"}},
+		"not one of":       {params{UserId: 1, Amount: amount{"1"}, Kind: "c"}, []string{"kind:oneof"}},
+		"custom validator": {params{UserId: 1, Amount: amount{"1"}, Code: "abc"}, []string{"code:upper"}},
+		"no json tag":      {params{UserId: 1, Amount: amount{"1"}, Optional: -1}, []string{"Optional:min"}},
+		"every failure":    {params{Amount: amount{"1000"}, Kind: "c"}, []string{"user_id:required", "amount:max", "kind:oneof"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := Validate(&tc.params)
+			if tc.failed == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				var failed []string
+				for _, field := range validationErr.Fields {
+					failed = append(failed, field.Field+":"+field.Rule)
+				}
+				assert.Equal(t, tc.failed, failed)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsUnknownRule(t *testing.T) {
+	var unknown struct {
+		Name string `binding:"nonsense"`
+	}
+
+	err := Validate(&unknown)
+
+	assert.Error(t, err)
+	assert.NotErrorAs(t, err, new(*ValidationError))
+}